@@ -0,0 +1,32 @@
+// cmd/devcerts/main.go
+package main
+
+import (
+	"flag"
+	"log"
+	"microservices-project/pkg/tlsconfig"
+)
+
+// Certificates for the services in docker-compose.yml, plus one for tools like grpcurl.
+var defaultNames = []string{"userservice", "productservice", "orderservice", "dev-client"}
+
+// Generates a local CA and service certificates for docker-compose.tls.yml:
+//
+//	go run ./cmd/devcerts                    # into ./certs
+//	go run ./cmd/devcerts -out certs myname  # just the certificate for myname
+//
+// The CA is created on the first run and reused afterwards, so running it again renews the
+// service certificates without restarting anything.
+func main() {
+	out := flag.String("out", "certs", "directory to write the certificates to")
+	flag.Parse()
+
+	names := flag.Args()
+	if len(names) == 0 {
+		names = defaultNames
+	}
+	if err := tlsconfig.WriteDevCertificates(*out, names...); err != nil {
+		log.Fatalf("Failed to generate certificates: %v", err)
+	}
+	log.Printf("Wrote certificates for %v to %s", names, *out)
+}
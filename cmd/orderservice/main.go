@@ -6,15 +6,25 @@ import (
 	"fmt"
 	"log"
 	"microservices-project/internal/database"
+	orderEvents "microservices-project/internal/orderservice/events"
 	orderHandler "microservices-project/internal/orderservice/handler"
 	orderRepo "microservices-project/internal/orderservice/repository"
 	orderService "microservices-project/internal/orderservice/service"
+	"microservices-project/internal/orderservice/model"
+	"microservices-project/pkg/auth"
 	"microservices-project/pkg/grpcclient" // Our gRPC client helper
+	"microservices-project/pkg/health"
+	"microservices-project/pkg/metrics"
+	"microservices-project/pkg/pagination"
+	"microservices-project/pkg/tlsconfig"
 	orderpb "microservices-project/protos/orderpb"
+	productpb "microservices-project/protos/productpb"
+	userpb "microservices-project/protos/userpb"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -29,6 +39,15 @@ const (
 	defaultHTTPPort         = "8083"
 	defaultUserServiceAddr   = "localhost:50051" // Address of UserService gRPC
 	defaultProductServiceAddr = "localhost:50052" // Address of ProductService gRPC
+	defaultJWKSURL            = "http://localhost:8081/.well-known/jwks.json" // UserService publishes its token keys here
+
+	// Saga recovery: unfinished sagas older than sagaStaleAfter are assumed orphaned
+	// (their request died with a previous process) and are completed or compensated.
+	sagaRecoveryInterval = 1 * time.Minute
+	sagaStaleAfter       = 2 * time.Minute
+
+	// Published outbox events are kept this long for consumers that replay from the table.
+	outboxRetention = 7 * 24 * time.Hour
 )
 
 func main() {
@@ -38,8 +57,23 @@ func main() {
 	if err := database.ConnectDB(); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if err := metrics.RegisterDBStats(database.DB, "postgres"); err != nil { // Connection pool gauges
+		log.Fatalf("Failed to register database metrics: %v", err)
+	}
 	// defer database.CloseDB() // Will be closed by OS or last service if sharing connection
 
+	// --- TLS ---
+	// TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE turn on TLS for our gRPC server and clients,
+	// TLS_MUTUAL=true requires client certificates, and TLS_ALLOWED_CLIENTS lists who may call.
+	// Certificate files are reloaded when they change.
+	certs, err := tlsconfig.FromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+	if certs == nil {
+		log.Println("TLS is off; gRPC traffic is plaintext")
+	}
+
 	// --- gRPC Client Connections ---
 	userServiceAddr := os.Getenv("USER_SERVICE_GRPC_ADDR")
 	if userServiceAddr == "" {
@@ -50,21 +84,66 @@ func main() {
 		productServiceAddr = defaultProductServiceAddr
 	}
 
-	userSvcClient, userConn, err := grpcclient.NewUserServiceClient(userServiceAddr)
+	// Outgoing calls carry the caller's token, so downstream services see who the order is for.
+	// Background work (saga recovery) has no caller and uses our service token instead, and so
+	// do the stock RPCs that ProductService reserves for services, and API key lookups.
+	serviceToken := os.Getenv("SERVICE_AUTH_TOKEN")
+	if serviceToken == "" {
+		log.Println("SERVICE_AUTH_TOKEN is not set; stock reservation calls to ProductService will be rejected")
+	}
+	internalMethods := []string{
+		productpb.ProductService_ReserveStock_FullMethodName,
+		productpb.ProductService_CommitReservation_FullMethodName,
+		productpb.ProductService_ReleaseReservation_FullMethodName,
+		productpb.ProductService_BatchUpdateStock_FullMethodName,
+		userpb.UserService_ValidateAPIKey_FullMethodName,
+	}
+	forwardAuthUnary := grpc.WithChainUnaryInterceptor(auth.UnaryClientInterceptor(serviceToken, internalMethods...))
+	forwardAuthStream := grpc.WithChainStreamInterceptor(auth.StreamClientInterceptor(serviceToken, internalMethods...))
+
+	// With TLS, the services must present certificates issued to these names
+	userServiceTLSNames := tlsconfig.PeerNamesFromEnv("USER_SERVICE_TLS_NAMES", "userservice")
+	productServiceTLSNames := tlsconfig.PeerNamesFromEnv("PRODUCT_SERVICE_TLS_NAMES", "productservice")
+
+	// Calls are spread over the replicas the addresses resolve to (see grpcclient for the
+	// static:///, dnssrv:/// and registry:/// schemes) by GRPC_LB_POLICY: round_robin (default),
+	// least_request or pick_first.
+	lbPolicy, err := grpcclient.BalancerFromEnv("GRPC_LB_POLICY")
+	if err != nil {
+		log.Fatalf("Invalid load balancing policy: %v", err)
+	}
+
+	// Neither connection is waited for: calls fail (or are retried) until the services are up,
+	// and fail fast while one is down, so a slow dependency doesn't hold up our startup.
+	userSvcClient, userConn, err := grpcclient.NewUserServiceClient(userServiceAddr, lbPolicy,
+		grpc.WithTransportCredentials(certs.ClientCredentials(userServiceTLSNames...)), forwardAuthUnary, forwardAuthStream)
 	if err != nil {
 		log.Fatalf("Failed to connect to UserService: %v", err)
 	}
 	defer userConn.Close()
 
-	productSvcClient, productConn, err := grpcclient.NewProductServiceClient(productServiceAddr)
+	productSvcClient, productConn, err := grpcclient.NewProductServiceClient(productServiceAddr, lbPolicy,
+		grpc.WithTransportCredentials(certs.ClientCredentials(productServiceTLSNames...)), forwardAuthUnary, forwardAuthStream)
 	if err != nil {
 		log.Fatalf("Failed to connect to ProductService: %v", err)
 	}
 	defer productConn.Close()
 
+	// --- Authentication ---
+	authenticator, err := newAuthenticator(userSvcClient)
+	if err != nil {
+		log.Fatalf("Failed to set up authentication: %v", err)
+	}
+
 	// --- Initialize Layers ---
 	ordRepository := orderRepo.NewOrderRepository(database.DB)
-	ordSvc := orderService.NewOrderService(ordRepository, userSvcClient, productSvcClient)
+	sagaRepository := orderRepo.NewSagaRepository(database.DB)
+	idempotencyRepository := orderRepo.NewIdempotencyRepository(database.DB)
+	idempotencyRetention := durationFromEnv("IDEMPOTENCY_KEY_RETENTION", orderService.DefaultIdempotencyRetention)
+	pageTokens := pagination.NewTokenCodec(pagination.SecretFromEnv("PAGE_TOKEN_SECRET"))
+	requireVerifiedEmail := boolFromEnv("REQUIRE_VERIFIED_EMAIL", false) // Only verified users may place orders
+	ordSvc := orderService.NewOrderService(ordRepository, sagaRepository, idempotencyRepository, userSvcClient, productSvcClient, idempotencyRetention, pageTokens, requireVerifiedEmail)
+	outboxRepository := orderRepo.NewOutboxRepository(database.DB)
 	grpcOrderServer := orderHandler.NewOrderGRPCServer(ordSvc)
 	httpOrderHandler := orderHandler.NewOrderHTTPHandler(ordSvc)
 
@@ -78,14 +157,100 @@ func main() {
 		httpPort = defaultHTTPPort
 	}
 
+	// --- Saga Recovery ---
+	// Runs once at startup (to clean up after a crash) and then periodically,
+	// which also retries compensations that failed because ProductService was down.
+	// Expired idempotency keys and old published outbox events are purged on the same schedule.
+	recoveryCtx, stopRecovery := context.WithCancel(context.Background())
+	defer stopRecovery()
+	go func() {
+		ticker := time.NewTicker(sagaRecoveryInterval)
+		defer ticker.Stop()
+		for {
+			if err := ordSvc.RecoverSagas(recoveryCtx, sagaStaleAfter); err != nil {
+				log.Printf("Saga recovery finished with errors: %v", err)
+			}
+			if purged, err := ordSvc.PurgeExpiredIdempotencyKeys(recoveryCtx); err != nil {
+				log.Printf("Failed to purge expired idempotency keys: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired idempotency key(s)", purged)
+			}
+			if purged, err := outboxRepository.DeletePublishedBefore(recoveryCtx, time.Now().Add(-outboxRetention)); err != nil {
+				log.Printf("Failed to purge published outbox events: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d published outbox event(s)", purged)
+			}
+			select {
+			case <-recoveryCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// --- Outbox Relay ---
+	// EVENT_PUBLISHER selects where order events go: "inprocess" (default) or "postgres" (LISTEN/NOTIFY).
+	// Status changes also wake up WatchOrder streams. With the in-process bus only the replica
+	// running the relay hears about them; other replicas fall back to polling.
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	var publisher orderEvents.EventPublisher
+	switch os.Getenv("EVENT_PUBLISHER") {
+	case "postgres":
+		channel := os.Getenv("EVENT_NOTIFY_CHANNEL")
+		publisher = orderEvents.NewPostgresNotifyPublisher(database.DB, channel)
+		go func() {
+			if err := orderEvents.ListenPostgres(relayCtx, database.ConnectionString(), channel, ordSvc.HandleOrderEvent); err != nil {
+				log.Printf("Order event listener stopped: %v", err)
+			}
+		}()
+		log.Println("Publishing order events with Postgres NOTIFY")
+	case "", "inprocess":
+		bus := orderEvents.NewInProcessBus()
+		bus.Subscribe(func(ctx context.Context, event *model.OutboxEvent) error {
+			log.Printf("Event %s: %s for %s %s", event.ID, event.EventType, event.AggregateType, event.AggregateID)
+			return nil
+		})
+		bus.Subscribe(ordSvc.HandleOrderEvent, model.EventOrderStatusChanged)
+		publisher = bus
+	default:
+		log.Fatalf("Unknown EVENT_PUBLISHER %q (expected inprocess or postgres)", os.Getenv("EVENT_PUBLISHER"))
+	}
+	relay := orderEvents.NewRelay(outboxRepository, publisher, durationFromEnv("OUTBOX_POLL_INTERVAL", orderEvents.DefaultRelayInterval))
+	go relay.Run(relayCtx)
+
 	// --- Start gRPC Server ---
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", grpcPort))
 	if err != nil {
 		log.Fatalf("Failed to listen for Order gRPC: %v", err)
 	}
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.Creds(certs.ServerCredentials()),
+		grpc.KeepaliveEnforcementPolicy(grpcclient.KeepaliveEnforcementPolicy), // Allow our clients' keepalive pings
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(), // First, so rejected calls are counted too
+			auth.UnaryServerInterceptor(authenticator),
+			auth.UnaryScopeInterceptor(orderHandler.MethodScopes),
+		),
+		grpc.ChainStreamInterceptor(
+			metrics.StreamServerInterceptor(),
+			auth.StreamServerInterceptor(authenticator),
+			auth.StreamScopeInterceptor(orderHandler.MethodScopes),
+		),
+	)
 	orderpb.RegisterOrderServiceServer(grpcServer, grpcOrderServer)
 	reflection.Register(grpcServer)
+
+	// --- Health ---
+	// Readiness (/readyz, and grpc.health.v1 for gRPC load balancers) follows these checks;
+	// liveness (/livez) doesn't, so an outage elsewhere takes us out of rotation without
+	// getting us restarted.
+	checker := health.NewChecker(orderpb.OrderService_ServiceDesc.ServiceName)
+	checker.Add("database", database.DB.PingContext)
+	checker.Add("UserService", userConn.Check) // Orders can't be placed without either
+	checker.Add("ProductService", productConn.Check)
+	checker.Register(grpcServer)
+	go checker.Run(context.Background(), health.DefaultInterval)
 	go func() {
 		log.Printf("Order gRPC server listening on :%s", grpcPort)
 		if err := grpcServer.Serve(lis); err != nil {
@@ -98,12 +263,14 @@ func main() {
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
+	r.Use(metrics.HTTPMiddleware) // Request rate, errors and duration per route
 	r.Use(middleware.Recoverer)
+	r.Use(auth.Middleware(authenticator))
 
-	r.Get("/health", func(w http.ResponseWriter, req *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "OrderService is healthy")
-	})
+	// Probes and metrics
+	r.Get("/livez", health.LivezHandler)
+	r.Get("/readyz", checker.ReadyzHandler)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
 	r.Mount("/api/v1", httpOrderHandler.Routes())
 
 	httpServer := &http.Server{
@@ -122,6 +289,13 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Order Service shutting down servers...")
+	// Report NOT_SERVING first and keep serving for a while, so load balancers stop sending
+	// us requests before we stop taking them.
+	checker.Shutdown()
+	time.Sleep(durationFromEnv("SHUTDOWN_DRAIN_DELAY", health.DefaultDrainDelay))
+	stopRecovery()
+	stopRelay() // Unpublished events stay in the outbox and go out after restart
+	ordSvc.CloseWatchers() // Otherwise open WatchOrder streams would block GracefulStop
 
 	grpcServer.GracefulStop()
 	log.Println("Order gRPC server gracefully stopped.")
@@ -133,4 +307,51 @@ func main() {
 	}
 	log.Println("Order HTTP server gracefully stopped.")
 	log.Println("Order Service shut down.")
-}
\ No newline at end of file
+}
+
+// durationFromEnv reads a Go duration (e.g. "24h") from the environment, falling back to def.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using default %s", key, value, def)
+		return def
+	}
+	return d
+}
+
+// boolFromEnv reads a boolean (e.g. "true", "1") from the environment, falling back to def.
+func boolFromEnv(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using default %t", key, value, def)
+		return def
+	}
+	return b
+}
+
+// newAuthenticator accepts access tokens issued by the UserService (checked against its JWKS,
+// JWT_JWKS_URL), the service tokens listed in SERVICE_TOKENS and API keys, which users checks.
+func newAuthenticator(users userpb.UserServiceClient) (auth.Authenticator, error) {
+	jwtConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := auth.KeySourceFromEnv(defaultJWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	serviceTokens, err := auth.ServiceTokensFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	apiKeys := auth.NewAPIKeys(grpcclient.UserServiceAPIKeys(users), auth.DefaultAPIKeyCacheTTL)
+	return auth.Authenticators{serviceTokens, apiKeys, auth.NewVerifier(keys, jwtConfig)}, nil
+}
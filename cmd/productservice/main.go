@@ -9,7 +9,14 @@ import (
 	productHandler "microservices-project/internal/productservice/handler"
 	productRepo "microservices-project/internal/productservice/repository"
 	productService "microservices-project/internal/productservice/service"
+	"microservices-project/pkg/auth"
+	"microservices-project/pkg/grpcclient"
+	"microservices-project/pkg/health"
+	"microservices-project/pkg/metrics"
+	"microservices-project/pkg/pagination"
+	"microservices-project/pkg/tlsconfig"
 	productpb "microservices-project/protos/productpb"
+	userpb "microservices-project/protos/userpb"
 	"net"
 	"net/http"
 	"os"
@@ -26,6 +33,11 @@ import (
 const (
 	defaultGRPCPort = "50052" // Different port from UserService
 	defaultHTTPPort = "8082" // Different port from UserService
+
+	defaultReservationSweepInterval = 1 * time.Minute
+
+	defaultJWKSURL         = "http://localhost:8081/.well-known/jwks.json" // UserService publishes its token keys here
+	defaultUserServiceAddr = "localhost:50051"                             // UserService gRPC, for checking API keys
 )
 
 func main() {
@@ -38,11 +50,59 @@ func main() {
 	if err := database.ConnectDB(); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if err := metrics.RegisterDBStats(database.DB, "postgres"); err != nil { // Connection pool gauges
+		log.Fatalf("Failed to register database metrics: %v", err)
+	}
 	defer database.CloseDB() // This will be closed by the last service shutting down, or handled by OS
 
+	// --- TLS ---
+	// TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE turn on TLS for our gRPC server and clients,
+	// TLS_MUTUAL=true requires client certificates, and TLS_ALLOWED_CLIENTS lists who may call.
+	// Certificate files are reloaded when they change.
+	certs, err := tlsconfig.FromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+	if certs == nil {
+		log.Println("TLS is off; gRPC traffic is plaintext")
+	}
+
+	// --- Authentication ---
+	// Access tokens are verified against the UserService's published keys; OrderService
+	// authenticates with a service token. API keys are checked with the UserService, which
+	// we call with our own service token.
+	userServiceAddr := os.Getenv("USER_SERVICE_GRPC_ADDR")
+	if userServiceAddr == "" {
+		userServiceAddr = defaultUserServiceAddr
+	}
+	serviceToken := os.Getenv("SERVICE_AUTH_TOKEN")
+	if serviceToken == "" {
+		log.Println("SERVICE_AUTH_TOKEN is not set; requests with API keys will be rejected")
+	}
+	lbPolicy, err := grpcclient.BalancerFromEnv("GRPC_LB_POLICY") // Across UserService replicas
+	if err != nil {
+		log.Fatalf("Invalid load balancing policy: %v", err)
+	}
+	userSvcClient, userConn, err := grpcclient.NewUserServiceClient(userServiceAddr, lbPolicy,
+		grpc.WithTransportCredentials(certs.ClientCredentials(tlsconfig.PeerNamesFromEnv("USER_SERVICE_TLS_NAMES", "userservice")...)),
+		grpc.WithChainUnaryInterceptor(auth.UnaryClientInterceptor(serviceToken)),
+	)
+	if err != nil {
+		log.Fatalf("Failed to connect to UserService: %v", err)
+	}
+	defer userConn.Close()
+
+	authenticator, err := newAuthenticator(userSvcClient)
+	if err != nil {
+		log.Fatalf("Failed to set up authentication: %v", err)
+	}
+
 	// --- Initialize Layers (Dependency Injection) ---
 	prodRepository := productRepo.NewProductRepository(database.DB)
-	prodSvc := productService.NewProductService(prodRepository)
+	reservationRepository := productRepo.NewReservationRepository(database.DB)
+	reservationTTL := durationFromEnv("RESERVATION_TTL", productService.DefaultReservationTTL)
+	pageTokens := pagination.NewTokenCodec(pagination.SecretFromEnv("PAGE_TOKEN_SECRET"))
+	prodSvc := productService.NewProductService(prodRepository, reservationRepository, reservationTTL, pageTokens)
 	grpcProductServer := productHandler.NewProductGRPCServer(prodSvc)
 	httpProductHandler := productHandler.NewProductHTTPHandler(prodSvc)
 
@@ -56,14 +116,60 @@ func main() {
 		httpPort = defaultHTTPPort
 	}
 
+	// --- Reservation Sweeper ---
+	// Marks reservations past their TTL as EXPIRED. Availability already ignores them,
+	// this keeps the table tidy and the reservation status accurate.
+	sweepInterval := durationFromEnv("RESERVATION_SWEEP_INTERVAL", defaultReservationSweepInterval)
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sweepCtx.Done():
+				return
+			case <-ticker.C:
+				expired, err := prodSvc.ExpireReservations(sweepCtx)
+				if err != nil {
+					log.Printf("Reservation sweeper failed: %v", err)
+				} else if expired > 0 {
+					log.Printf("Reservation sweeper expired %d reservation(s)", expired)
+				}
+			}
+		}
+	}()
+
 	// --- Start gRPC Server ---
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", grpcPort))
 	if err != nil {
 		log.Fatalf("Failed to listen for gRPC: %v", err)
 	}
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.Creds(certs.ServerCredentials()),
+		grpc.KeepaliveEnforcementPolicy(grpcclient.KeepaliveEnforcementPolicy), // Allow our clients' keepalive pings
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(), // First, so rejected calls are counted too
+			auth.UnaryServerInterceptor(authenticator, productHandler.PublicMethods...),
+			auth.UnaryScopeInterceptor(productHandler.MethodScopes),
+		),
+		grpc.ChainStreamInterceptor(
+			metrics.StreamServerInterceptor(),
+			auth.StreamServerInterceptor(authenticator, productHandler.PublicMethods...),
+			auth.StreamScopeInterceptor(productHandler.MethodScopes),
+		),
+	)
 	productpb.RegisterProductServiceServer(grpcServer, grpcProductServer)
 	reflection.Register(grpcServer)
+
+	// --- Health ---
+	// Readiness (/readyz, and grpc.health.v1 for gRPC load balancers) follows these checks;
+	// liveness (/livez) doesn't, so an outage elsewhere takes us out of rotation without
+	// getting us restarted.
+	checker := health.NewChecker(productpb.ProductService_ServiceDesc.ServiceName)
+	checker.Add("database", database.DB.PingContext)
+	checker.Register(grpcServer)
+	go checker.Run(context.Background(), health.DefaultInterval)
 	go func() {
 		log.Printf("Product gRPC server listening on :%s", grpcPort)
 		if err := grpcServer.Serve(lis); err != nil {
@@ -76,12 +182,14 @@ func main() {
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
+	r.Use(metrics.HTTPMiddleware) // Request rate, errors and duration per route
 	r.Use(middleware.Recoverer)
+	r.Use(auth.Middleware(authenticator))
 
-	r.Get("/health", func(w http.ResponseWriter, req *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "ProductService is healthy")
-	})
+	// Probes and metrics
+	r.Get("/livez", health.LivezHandler)
+	r.Get("/readyz", checker.ReadyzHandler)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
 	r.Mount("/api/v1", httpProductHandler.Routes()) // Will define Routes() in http handler
 
 	httpServer := &http.Server{
@@ -100,6 +208,11 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Product Service shutting down servers...")
+	// Report NOT_SERVING first and keep serving for a while, so load balancers stop sending
+	// us requests before we stop taking them.
+	checker.Shutdown()
+	time.Sleep(durationFromEnv("SHUTDOWN_DRAIN_DELAY", health.DefaultDrainDelay))
+	stopSweeper()
 
 	grpcServer.GracefulStop()
 	log.Println("Product gRPC server gracefully stopped.")
@@ -111,4 +224,37 @@ func main() {
 	}
 	log.Println("Product HTTP server gracefully stopped.")
 	log.Println("Product Service shut down.")
-}
\ No newline at end of file
+}
+
+// durationFromEnv reads a Go duration (e.g. "15m") from the environment, falling back to def.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using default %s", key, value, def)
+		return def
+	}
+	return d
+}
+
+// newAuthenticator accepts access tokens issued by the UserService (checked against its JWKS,
+// JWT_JWKS_URL), the service tokens listed in SERVICE_TOKENS and API keys, which users checks.
+func newAuthenticator(users userpb.UserServiceClient) (auth.Authenticator, error) {
+	jwtConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := auth.KeySourceFromEnv(defaultJWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	serviceTokens, err := auth.ServiceTokensFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	apiKeys := auth.NewAPIKeys(grpcclient.UserServiceAPIKeys(users), auth.DefaultAPIKeyCacheTTL)
+	return auth.Authenticators{serviceTokens, apiKeys, auth.NewVerifier(keys, jwtConfig)}, nil
+}
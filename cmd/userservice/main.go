@@ -8,16 +8,27 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	// Internal packages
 	"microservices-project/internal/database"
+	"microservices-project/pkg/auth"
+	"microservices-project/pkg/mail"
+	"microservices-project/pkg/pagination"
+	"microservices-project/pkg/realip"
+	"microservices-project/pkg/tlsconfig"
 	userHandler "microservices-project/internal/userservice/handler"
 	userRepo "microservices-project/internal/userservice/repository"
 	userService "microservices-project/internal/userservice/service"
 
+	"microservices-project/pkg/grpcclient"
+	"microservices-project/pkg/health"
+	"microservices-project/pkg/metrics"
+
 	// Protobuf
+	orderpb "microservices-project/protos/orderpb"
 	userpb "microservices-project/protos/userpb"
 
 	// gRPC
@@ -32,6 +43,16 @@ import (
 const (
 	defaultGRPCPort = "50051"
 	defaultHTTPPort = "8081"
+
+	defaultOrderServiceAddr = "localhost:50053" // Data exports and erasures include orders
+
+	// Expired sessions are kept for a while so support can see recent logins, then deleted.
+	sessionCleanupInterval = 1 * time.Hour
+	sessionRetention       = 7 * 24 * time.Hour
+
+	// Where the links in account emails point; a frontend page that posts the token back.
+	defaultPasswordResetURL     = "http://localhost:3000/reset-password"
+	defaultEmailVerificationURL = "http://localhost:3000/verify-email"
 )
 
 func main() {
@@ -41,14 +62,151 @@ func main() {
 	if err := database.ConnectDB(); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if err := metrics.RegisterDBStats(database.DB, "postgres"); err != nil { // Connection pool gauges
+		log.Fatalf("Failed to register database metrics: %v", err)
+	}
 	defer database.CloseDB()
 
+	// --- Token signing keys ---
+	jwtConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+	signingKeys, err := auth.KeySetFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	tokenIssuer := auth.NewIssuer(signingKeys, jwtConfig)
+	tokenVerifier := auth.NewVerifier(signingKeys, jwtConfig)
+
+	serviceTokens, err := auth.ServiceTokensFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid service tokens: %v", err)
+	}
+
+	// Load balancers and proxies whose X-Forwarded-For we believe; login lockouts are per client IP
+	trustedProxies, err := realip.TrustedProxiesFromEnv("TRUSTED_PROXIES")
+	if err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
+	// --- TLS ---
+	// TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE turn on TLS for our gRPC server and clients,
+	// TLS_MUTUAL=true requires client certificates, and TLS_ALLOWED_CLIENTS lists who may call.
+	// Certificate files are reloaded when they change.
+	certs, err := tlsconfig.FromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+	if certs == nil {
+		log.Println("TLS is off; gRPC traffic is plaintext")
+	}
+
 	// --- Initialize Layers (Dependency Injection) ---
 	userRepository := userRepo.NewUserRepository(database.DB)
-	usrSvc := userService.NewUserService(userRepository) // 'usrSvc' to avoid conflict with package name
+	sessionRepository := userRepo.NewSessionRepository(database.DB)
+	userTokenRepository := userRepo.NewUserTokenRepository(database.DB)
+	refreshTokenTTL := durationFromEnv("REFRESH_TOKEN_TTL", userService.DefaultRefreshTokenTTL)
+	pageTokens := pagination.NewTokenCodec(pagination.SecretFromEnv("PAGE_TOKEN_SECRET"))
+
+	// Password reset and email verification mails
+	mailer, err := mail.MailerFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid mail configuration: %v", err)
+	}
+	accountEmails := userService.AccountEmailConfig{
+		PasswordResetURL:     envOrDefault("PASSWORD_RESET_URL", defaultPasswordResetURL),
+		EmailVerificationURL: envOrDefault("EMAIL_VERIFICATION_URL", defaultEmailVerificationURL),
+		PasswordResetTTL:     durationFromEnv("PASSWORD_RESET_TTL", userService.DefaultPasswordResetTTL),
+		EmailVerificationTTL: durationFromEnv("EMAIL_VERIFICATION_TTL", userService.DefaultEmailVerificationTTL),
+	}
+
+	// Failed login limits; lockouts double from LOGIN_LOCKOUT_BASE up to LOGIN_LOCKOUT_MAX
+	loginAttemptRepository := userRepo.NewLoginAttemptRepository(database.DB)
+	loginThrottle := userService.LoginThrottleConfig{
+		AccountFailures: intFromEnv("LOGIN_MAX_FAILURES", userService.DefaultLoginAccountFailures),
+		IPFailures:      intFromEnv("LOGIN_MAX_FAILURES_PER_IP", userService.DefaultLoginIPFailures),
+		BaseLockout:     durationFromEnv("LOGIN_LOCKOUT_BASE", userService.DefaultLoginBaseLockout),
+		MaxLockout:      durationFromEnv("LOGIN_LOCKOUT_MAX", userService.DefaultLoginMaxLockout),
+		FailureWindow:   durationFromEnv("LOGIN_FAILURE_WINDOW", userService.DefaultLoginFailureWindow),
+	}
+
+	// TOTP two-factor authentication
+	mfaRepository := userRepo.NewMFARepository(database.DB)
+	mfaConfig := userService.MFAConfig{
+		Issuer:       envOrDefault("MFA_ISSUER", userService.DefaultMFAIssuer),
+		ChallengeTTL: durationFromEnv("MFA_CHALLENGE_TTL", userService.DefaultMFAChallengeTTL),
+	}
+
+	// GDPR data requests: the OrderService exports and pseudonymises the user's orders. It only
+	// takes those calls from services, so they always carry our service token.
+	orderServiceAddr := os.Getenv("ORDER_SERVICE_GRPC_ADDR")
+	if orderServiceAddr == "" {
+		orderServiceAddr = defaultOrderServiceAddr
+	}
+	serviceToken := os.Getenv("SERVICE_AUTH_TOKEN")
+	if serviceToken == "" {
+		log.Println("SERVICE_AUTH_TOKEN is not set; data exports and erasures will be rejected by OrderService")
+	}
+	orderMethods := []string{
+		orderpb.OrderService_ExportUserOrders_FullMethodName,
+		orderpb.OrderService_EraseUserOrders_FullMethodName,
+	}
+	lbPolicy, err := grpcclient.BalancerFromEnv("GRPC_LB_POLICY") // Across OrderService replicas
+	if err != nil {
+		log.Fatalf("Invalid load balancing policy: %v", err)
+	}
+	orderSvcClient, orderConn, err := grpcclient.NewOrderServiceClient(orderServiceAddr, lbPolicy,
+		grpc.WithTransportCredentials(certs.ClientCredentials(tlsconfig.PeerNamesFromEnv("ORDER_SERVICE_TLS_NAMES", "orderservice")...)),
+		grpc.WithChainUnaryInterceptor(auth.UnaryClientInterceptor(serviceToken, orderMethods...)),
+	)
+	if err != nil {
+		log.Fatalf("Failed to set up OrderService client: %v", err)
+	}
+	defer orderConn.Close()
+
+	apiKeyRepository := userRepo.NewAPIKeyRepository(database.DB)
+	addressRepository := userRepo.NewAddressRepository(database.DB)
+	dataRequestRepository := userRepo.NewDataRequestRepository(database.DB)
+	usrSvc := userService.NewUserService(userService.UserServiceDeps{ // 'usrSvc' to avoid conflict with package name
+		Users:           userRepository,
+		Sessions:        sessionRepository,
+		Tokens:          userTokenRepository,
+		Issuer:          tokenIssuer,
+		Verifier:        tokenVerifier,
+		RefreshTokenTTL: refreshTokenTTL,
+		PageTokens:      pageTokens,
+		Mailer:          mailer,
+		Emails:          accountEmails,
+		LoginAttempts:   loginAttemptRepository,
+		LoginThrottle:   loginThrottle,
+		MFA:             mfaRepository,
+		MFAConfig:       mfaConfig,
+		APIKeys:         apiKeyRepository,
+		Addresses:       addressRepository,
+		DataRequests:    dataRequestRepository,
+		Orders:          orderSvcClient,
+	})
+
+	// Callers authenticate with an access token, an API key (looked up directly, so revoking
+	// one takes effect here at once), or, for our own services, a service token
+	authenticator := auth.Authenticators{serviceTokens, auth.NewAPIKeys(usrSvc.AuthenticateAPIKey, 0), tokenVerifier}
 	grpcUserServer := userHandler.NewUserGRPCServer(usrSvc)
 	httpUserHandler := userHandler.NewUserHTTPHandler(usrSvc) // Initialize HTTP handler
 
+	// --- First Admin ---
+	// Only admins can appoint admins, so the first one comes from the environment. Nothing
+	// happens once an admin exists.
+	if email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL"); email != "" {
+		admin, err := usrSvc.BootstrapAdmin(context.Background(), os.Getenv("BOOTSTRAP_ADMIN_USERNAME"), email, os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"))
+		if err != nil {
+			log.Fatalf("Failed to bootstrap admin %s: %v", email, err)
+		}
+		if admin != nil {
+			log.Printf("Bootstrapped admin %s (%s)", admin.Email, admin.ID)
+		}
+	}
+
 	// Configuration
 	grpcPort := os.Getenv("GRPC_PORT")
 	if grpcPort == "" {
@@ -59,14 +217,66 @@ func main() {
 		httpPort = defaultHTTPPort
 	}
 
+	// --- Session Cleanup ---
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go func() {
+		ticker := time.NewTicker(sessionCleanupInterval)
+		defer ticker.Stop()
+		for {
+			if purged, err := usrSvc.PurgeExpiredSessions(cleanupCtx, sessionRetention); err != nil {
+				log.Printf("Failed to purge expired sessions: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired session(s)", purged)
+			}
+			if purged, err := usrSvc.PurgeExpiredUserTokens(cleanupCtx, sessionRetention); err != nil {
+				log.Printf("Failed to purge expired user tokens: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired password reset/verification/2FA challenge token(s)", purged)
+			}
+			if purged, err := usrSvc.PurgeStaleLoginAttempts(cleanupCtx); err != nil {
+				log.Printf("Failed to purge stale login attempts: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d stale failed login counter(s)", purged)
+			}
+			select {
+			case <-cleanupCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
 	// --- Start gRPC Server ---
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", grpcPort))
 	if err != nil {
 		log.Fatalf("Failed to listen for gRPC: %v", err)
 	}
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.Creds(certs.ServerCredentials()),
+		grpc.KeepaliveEnforcementPolicy(grpcclient.KeepaliveEnforcementPolicy), // Allow our clients' keepalive pings
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(), // First, so rejected calls are counted too
+			auth.UnaryServerInterceptor(authenticator, userHandler.PublicMethods...),
+			auth.UnaryScopeInterceptor(userHandler.MethodScopes),
+		),
+		grpc.ChainStreamInterceptor(
+			metrics.StreamServerInterceptor(),
+			auth.StreamServerInterceptor(authenticator, userHandler.PublicMethods...),
+			auth.StreamScopeInterceptor(userHandler.MethodScopes),
+		),
+	)
 	userpb.RegisterUserServiceServer(grpcServer, grpcUserServer)
 	reflection.Register(grpcServer)
+
+	// --- Health ---
+	// Readiness (/readyz, and grpc.health.v1 for gRPC load balancers) follows these checks;
+	// liveness (/livez) doesn't, so an outage elsewhere takes us out of rotation without
+	// getting us restarted.
+	checker := health.NewChecker(userpb.UserService_ServiceDesc.ServiceName)
+	checker.Add("database", database.DB.PingContext)
+	checker.Register(grpcServer)
+	go checker.Run(context.Background(), health.DefaultInterval)
 	go func() {
 		log.Printf("gRPC server listening on :%s", grpcPort)
 		if err := grpcServer.Serve(lis); err != nil {
@@ -80,15 +290,19 @@ func main() {
 
 	// Middlewares
 	r.Use(middleware.RequestID) // Injects a request ID into the context
-	r.Use(middleware.RealIP)    // Sets X-Forwarded-For
+	r.Use(trustedProxies.Middleware) // Client IP from X-Forwarded-For, only when set by a trusted proxy
 	r.Use(middleware.Logger)    // Logs the start and end of each request with latency
+	r.Use(metrics.HTTPMiddleware) // Request rate, errors and duration per route
 	r.Use(middleware.Recoverer) // Recovers from panics and returns a 500 error
+	r.Use(auth.Middleware(authenticator)) // Puts the caller, if any, in the request context
 
-	// Health check
-	r.Get("/health", func(w http.ResponseWriter, req *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "UserService is healthy")
-	})
+	// Probes and metrics
+	r.Get("/livez", health.LivezHandler)
+	r.Get("/readyz", checker.ReadyzHandler)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	// Public signing keys, so other services can verify tokens without calling us
+	r.Get(auth.JWKSPath, signingKeys.ServeJWKS)
 
 	// Mount user specific routes
 	r.Mount("/api/v1", httpUserHandler.Routes()) // Prefix with /api/v1
@@ -110,6 +324,11 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down servers...")
+	// Report NOT_SERVING first and keep serving for a while, so load balancers stop sending
+	// us requests before we stop taking them.
+	checker.Shutdown()
+	time.Sleep(durationFromEnv("SHUTDOWN_DRAIN_DELAY", health.DefaultDrainDelay))
+	stopCleanup()
 
 	grpcServer.GracefulStop()
 	log.Println("gRPC server gracefully stopped.")
@@ -121,4 +340,40 @@ func main() {
 	}
 	log.Println("HTTP server gracefully stopped.")
 	log.Println("User Service shut down.")
-}
\ No newline at end of file
+}
+
+// durationFromEnv reads a Go duration (e.g. "720h") from the environment, falling back to def.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using default %s", key, value, def)
+		return def
+	}
+	return d
+}
+
+// intFromEnv reads a positive integer from the environment, falling back to def.
+func intFromEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s %q, using default %d", key, value, def)
+		return def
+	}
+	return n
+}
+
+// envOrDefault reads key from the environment, falling back to def.
+func envOrDefault(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
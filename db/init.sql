@@ -6,11 +6,139 @@ CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY,
     username VARCHAR(50) UNIQUE NOT NULL,
     email VARCHAR(100) UNIQUE NOT NULL,
+    email_verified_at TIMESTAMPTZ, -- NULL until the verification link is followed; reset when the email changes
     password_hash VARCHAR(255) NOT NULL,
+    roles TEXT[] NOT NULL DEFAULT '{customer}', -- customer, admin; copied into access tokens
+    mfa_secret VARCHAR(64), -- Base32 TOTP secret; set on enrolment, before it is confirmed
+    mfa_enabled_at TIMESTAMPTZ, -- NULL unless 2FA is confirmed and on
+    mfa_last_step BIGINT, -- TOTP time step of the last accepted code, so a code can't be replayed
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ -- Soft delete; username and email are anonymised at the same time
+);
+
+-- CREATE TABLE IF NOT EXISTS leaves an existing table alone, so columns added since are also
+-- added here. Every statement is safe to re-run against an existing database.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{customer}'; -- Existing users become customers
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ; -- NULL: no existing user is deleted
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ; -- NULL: existing users verify like new ones
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_secret VARCHAR(64); -- NULL: 2FA starts off for existing users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_users_roles ON users USING GIN (roles);
+-- Prefix search for the admin user list (LIKE 'abc%')
+CREATE INDEX IF NOT EXISTS idx_users_email_prefix ON users (email text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users (username text_pattern_ops);
+
+-- Refresh token sessions. Each row is one refresh token; rotation adds a row to the same family
+-- and points the old row at it via replaced_by. Only the SHA-256 of the token is stored.
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id UUID NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    replaced_by UUID,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_family_id ON user_sessions(family_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions(expires_at);
+
+-- Single-use tokens mailed to users (password reset, email verification). Like refresh tokens,
+-- only the SHA-256 of the token is stored.
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL, -- password_reset, email_verification, mfa_challenge
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    email VARCHAR(100) NOT NULL, -- The address the token was sent to
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id_purpose ON user_tokens(user_id, purpose);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_expires_at ON user_tokens(expires_at);
+
+-- One-time 2FA recovery codes (SHA-256 of the normalised code). A code is deleted when used.
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- Failed logins per account (lower-cased email, whether or not a user has it) and per client
+-- IP. Kept in the database so every UserService replica enforces the same lockouts.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope VARCHAR(16) NOT NULL, -- account, ip
+    key VARCHAR(255) NOT NULL,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failed_at ON login_attempts(last_failed_at);
+
+-- API keys for batch jobs and partner integrations. Like refresh tokens, only the SHA-256 of
+-- the key is stored, plus its first characters so admins can tell keys apart.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL, -- "mk_" and 8 characters of the key, for display
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}', -- products:write, orders:read, ...
+    created_by UUID REFERENCES users(id), -- The admin who created the key
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ, -- NULL for keys that don't expire
+    last_used_at TIMESTAMPTZ, -- Updated at most once a minute
+    revoked_at TIMESTAMPTZ
+);
+
+-- Shipping and billing address book. Orders keep a copy of the address they were shipped to,
+-- so editing or deleting an address here doesn't change past orders.
+CREATE TABLE IF NOT EXISTS user_addresses (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id),
+    label VARCHAR(50) NOT NULL DEFAULT '', -- "Home", "Office", ...
+    recipient_name VARCHAR(100) NOT NULL,
+    line1 VARCHAR(200) NOT NULL,
+    line2 VARCHAR(200) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL,
+    region VARCHAR(100) NOT NULL DEFAULT '', -- State, province or county
+    postal_code VARCHAR(20) NOT NULL,
+    country_code CHAR(2) NOT NULL, -- ISO 3166-1 alpha-2
+    phone VARCHAR(30) NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+CREATE INDEX IF NOT EXISTS idx_user_addresses_user_id ON user_addresses(user_id);
+-- At most one default address per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_addresses_default ON user_addresses(user_id) WHERE is_default;
+
+-- GDPR data exports and erasures, kept as the audit trail of what was done for whom and when
+CREATE TABLE IF NOT EXISTS data_requests (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id),
+    kind VARCHAR(20) NOT NULL, -- EXPORT or ERASURE
+    status VARCHAR(20) NOT NULL, -- PENDING, COMPLETED or FAILED
+    requested_by VARCHAR(255) NOT NULL, -- User ID of the requester, or the calling service's name
+    pseudonym UUID, -- ERASURE only: what the user's orders were moved to
+    orders_affected INTEGER NOT NULL DEFAULT 0, -- Orders exported or pseudonymised
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ -- Set once COMPLETED or FAILED
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_requests_user_id ON data_requests(user_id, created_at DESC);
+
 -- ProductService Tables
 CREATE TABLE IF NOT EXISTS products (
     id UUID PRIMARY KEY,
@@ -22,16 +150,43 @@ CREATE TABLE IF NOT EXISTS products (
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+-- Two-phase stock reservations. Pending reservations past expires_at no longer count
+-- against available stock and are flipped to EXPIRED by the productservice sweeper.
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id UUID PRIMARY KEY,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(50) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS stock_reservation_items (
+    reservation_id UUID NOT NULL REFERENCES stock_reservations(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (reservation_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_status_expires_at ON stock_reservations(status, expires_at);
+CREATE INDEX IF NOT EXISTS idx_stock_reservation_items_product_id ON stock_reservation_items(product_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_reservations_reference ON stock_reservations(reference) WHERE reference <> ''; -- One reservation per reference, however many retries race
+CREATE INDEX IF NOT EXISTS idx_products_created_at_id ON products(created_at DESC, id DESC); -- Keyset pagination
+
 -- OrderService Tables
 CREATE TABLE IF NOT EXISTS orders (
     id UUID PRIMARY KEY,
     user_id UUID NOT NULL,
     total_amount DECIMAL(10, 2) NOT NULL,
     status VARCHAR(50) NOT NULL,
+    shipping_address JSONB, -- Copy of the user's address at order time; NULL if none was given
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+-- Added since orders was first created; see the note on the users table
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_address JSONB; -- NULL: existing orders have no address copy
+
 CREATE TABLE IF NOT EXISTS order_items (
     id UUID PRIMARY KEY,
     order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
@@ -41,6 +196,60 @@ CREATE TABLE IF NOT EXISTS order_items (
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+-- Saga state for CreateOrder, so reservations and orders can be unwound after a failure or crash
+CREATE TABLE IF NOT EXISTS order_sagas (
+    id UUID PRIMARY KEY,
+    order_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS order_saga_steps (
+    id UUID PRIMARY KEY,
+    saga_id UUID NOT NULL REFERENCES order_sagas(id) ON DELETE CASCADE,
+    sequence INTEGER NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    reference VARCHAR(255) NOT NULL DEFAULT '', -- reservation ID or order ID, depending on action
+    status VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Idempotency keys for CreateOrder; a retried request with the same key returns order_id
+CREATE TABLE IF NOT EXISTS order_idempotency_keys (
+    user_id UUID NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL, -- hex SHA-256 of the request
+    order_id UUID NOT NULL,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+-- Transactional outbox: order events are written with the change and published by the relay
+CREATE TABLE IF NOT EXISTS outbox (
+    id UUID PRIMARY KEY,
+    aggregate_type VARCHAR(50) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT ''
+);
+
 CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id_created_at_id ON orders(user_id, created_at DESC, id DESC); -- Keyset pagination
 CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
-CREATE INDEX IF NOT EXISTS idx_order_items_product_id ON order_items(product_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_order_items_product_id ON order_items(product_id);
+CREATE INDEX IF NOT EXISTS idx_order_sagas_status_updated_at ON order_sagas(status, updated_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_sagas_order_id ON order_sagas(order_id); -- One saga per order
+CREATE INDEX IF NOT EXISTS idx_order_saga_steps_saga_id ON order_saga_steps(saga_id);
+CREATE INDEX IF NOT EXISTS idx_order_idempotency_keys_expires_at ON order_idempotency_keys(expires_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(created_at, id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox(published_at) WHERE published_at IS NOT NULL;
@@ -21,6 +21,27 @@ func ConnectDB() error {
 	if err := godotenv.Load(); err != nil {
         log.Println("No .env file found")
     }
+	connStr := ConnectionString()
+
+	var err error
+	DB, err = sql.Open("postgres", connStr)
+	if err != nil {
+		return fmt.Errorf("failed to open database connection: %w", err)
+	}
+
+	err = DB.Ping()
+	if err != nil {
+		DB.Close() // Close the connection if ping fails
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	log.Println("Successfully connected to PostgreSQL database!")
+	return nil
+}
+
+// ConnectionString builds the lib/pq connection string from the DB_* environment variables.
+// It is also used by components that need their own connection, such as LISTEN/NOTIFY listeners.
+func ConnectionString() string {
 	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
 	dbUser := os.Getenv("DB_USER")
@@ -47,23 +68,8 @@ func ConnectDB() error {
 		dbSSLMode = "disable"
 	}
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		dbHost, dbPort, dbUser, dbPassword, dbName, dbSSLMode)
-
-	var err error
-	DB, err = sql.Open("postgres", connStr)
-	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
-	}
-
-	err = DB.Ping()
-	if err != nil {
-		DB.Close() // Close the connection if ping fails
-		return fmt.Errorf("failed to ping database: %w", err)
-	}
-
-	log.Println("Successfully connected to PostgreSQL database!")
-	return nil
 }
 
 // CloseDB closes the database connection.
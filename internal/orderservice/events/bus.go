@@ -0,0 +1,56 @@
+// internal/orderservice/events/bus.go
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"microservices-project/internal/orderservice/model"
+	"sync"
+)
+
+// InProcessBus is an EventPublisher that calls subscribed handlers synchronously.
+// It is meant for consumers running inside the orderservice process.
+type InProcessBus struct {
+	mu       sync.RWMutex
+	handlers map[model.EventType][]Handler
+	all      []Handler
+}
+
+func NewInProcessBus() *InProcessBus {
+	return &InProcessBus{handlers: make(map[model.EventType][]Handler)}
+}
+
+// Subscribe registers handler for the given event types, or for every event if none are given.
+func (b *InProcessBus) Subscribe(handler Handler, eventTypes ...model.EventType) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(eventTypes) == 0 {
+		b.all = append(b.all, handler)
+		return
+	}
+	for _, eventType := range eventTypes {
+		b.handlers[eventType] = append(b.handlers[eventType], handler)
+	}
+}
+
+// Publish runs every matching handler. If any handler fails the event is reported as not
+// published, so the relay retries it and handlers that succeeded will see it again.
+func (b *InProcessBus) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.all)+len(b.handlers[event.EventType]))
+	handlers = append(handlers, b.all...)
+	handlers = append(handlers, b.handlers[event.EventType]...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d handler(s) failed for %s event %s: %w", len(errs), event.EventType, event.ID, errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// internal/orderservice/events/events_test.go
+package events
+
+import (
+	"context"
+	"errors"
+	"microservices-project/internal/orderservice/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockOutboxRepository struct {
+	mock.Mock
+	pending []*model.OutboxEvent
+}
+
+// ProcessPending mimics the real repository: hand events over in order and stop at the first failure.
+func (m *MockOutboxRepository) ProcessPending(ctx context.Context, limit int, handle func(ctx context.Context, event *model.OutboxEvent) error) (int, error) {
+	m.Called(ctx, limit)
+	published := 0
+	for len(m.pending) > 0 && published < limit {
+		if err := handle(ctx, m.pending[0]); err != nil {
+			m.pending[0].Attempts++
+			return published, err
+		}
+		m.pending = m.pending[1:]
+		published++
+	}
+	return published, nil
+}
+
+func (m *MockOutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func TestInProcessBus_RoutesByEventType(t *testing.T) {
+	bus := NewInProcessBus()
+	var created, all []string
+	bus.Subscribe(func(ctx context.Context, event *model.OutboxEvent) error {
+		created = append(created, event.ID)
+		return nil
+	}, model.EventOrderCreated)
+	bus.Subscribe(func(ctx context.Context, event *model.OutboxEvent) error {
+		all = append(all, event.ID)
+		return nil
+	})
+
+	assert.NoError(t, bus.Publish(context.Background(), &model.OutboxEvent{ID: "e1", EventType: model.EventOrderCreated}))
+	assert.NoError(t, bus.Publish(context.Background(), &model.OutboxEvent{ID: "e2", EventType: model.EventOrderStatusChanged}))
+
+	assert.Equal(t, []string{"e1"}, created)
+	assert.Equal(t, []string{"e1", "e2"}, all)
+}
+
+func TestInProcessBus_ReportsHandlerFailure(t *testing.T) {
+	bus := NewInProcessBus()
+	handlerErr := errors.New("consumer down")
+	bus.Subscribe(func(ctx context.Context, event *model.OutboxEvent) error { return handlerErr })
+
+	err := bus.Publish(context.Background(), &model.OutboxEvent{ID: "e1", EventType: model.EventOrderCreated})
+
+	assert.True(t, errors.Is(err, handlerErr))
+}
+
+func TestRelay_StopsAtFirstFailureAndRetries(t *testing.T) {
+	repo := &MockOutboxRepository{pending: []*model.OutboxEvent{
+		{ID: "e1", EventType: model.EventOrderCreated},
+		{ID: "e2", EventType: model.EventOrderStatusChanged},
+		{ID: "e3", EventType: model.EventOrderStatusChanged},
+	}}
+	repo.On("ProcessPending", mock.Anything, DefaultRelayBatchSize)
+
+	bus := NewInProcessBus()
+	var delivered []string
+	fail := true
+	bus.Subscribe(func(ctx context.Context, event *model.OutboxEvent) error {
+		if event.ID == "e2" && fail {
+			fail = false
+			return errors.New("temporary failure")
+		}
+		delivered = append(delivered, event.ID)
+		return nil
+	})
+	relay := NewRelay(repo, bus, time.Second)
+
+	published, err := relay.RelayOnce(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []string{"e1"}, delivered) // e3 must not overtake e2
+
+	published, err = relay.RelayOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []string{"e1", "e2", "e3"}, delivered)
+}
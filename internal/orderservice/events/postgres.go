@@ -0,0 +1,90 @@
+// internal/orderservice/events/postgres.go
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"microservices-project/internal/orderservice/model"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultNotifyChannel is the Postgres channel order events are sent on.
+const DefaultNotifyChannel = "order_events"
+
+// maxNotifyPayload keeps us under Postgres' 8000 byte NOTIFY payload limit.
+const maxNotifyPayload = 7900
+
+// PostgresNotifyPublisher publishes events with pg_notify, for consumers that LISTEN on the channel.
+// Events too large for a notification are sent without their payload; consumers can read
+// the full event from the outbox table by ID.
+type PostgresNotifyPublisher struct {
+	db      *sql.DB
+	channel string
+}
+
+func NewPostgresNotifyPublisher(db *sql.DB, channel string) *PostgresNotifyPublisher {
+	if channel == "" {
+		channel = DefaultNotifyChannel
+	}
+	return &PostgresNotifyPublisher{db: db, channel: channel}
+}
+
+func (p *PostgresNotifyPublisher) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+	}
+	if len(data) > maxNotifyPayload {
+		trimmed := *event
+		trimmed.Payload = nil
+		if data, err = json.Marshal(&trimmed); err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+	}
+	if _, err := p.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, p.channel, string(data)); err != nil {
+		return fmt.Errorf("failed to notify %s: %w", p.channel, err)
+	}
+	return nil
+}
+
+// ListenPostgres subscribes to channel and calls handler for every event until ctx is done.
+// Notifications are not persisted by Postgres, so anything sent while the listener is
+// disconnected is missed; consumers that need every event should read the outbox table as well.
+func ListenPostgres(ctx context.Context, connStr, channel string, handler Handler) error {
+	if channel == "" {
+		channel = DefaultNotifyChannel
+	}
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Postgres listener on %s: %v", channel, err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(channel); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				continue // Connection was re-established
+			}
+			event := &model.OutboxEvent{}
+			if err := json.Unmarshal([]byte(n.Extra), event); err != nil {
+				log.Printf("Ignoring malformed notification on %s: %v", channel, err)
+				continue
+			}
+			if err := handler(ctx, event); err != nil {
+				log.Printf("Handler failed for %s event %s: %v", event.EventType, event.ID, err)
+			}
+		}
+	}
+}
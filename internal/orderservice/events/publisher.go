@@ -0,0 +1,17 @@
+// internal/orderservice/events/publisher.go
+package events
+
+import (
+	"context"
+	"microservices-project/internal/orderservice/model"
+)
+
+// EventPublisher delivers outbox events to downstream consumers.
+// Publish may be called again for an event it already delivered (e.g. if marking the event
+// published fails), so consumers must be idempotent on event.ID.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *model.OutboxEvent) error
+}
+
+// Handler consumes a published event.
+type Handler func(ctx context.Context, event *model.OutboxEvent) error
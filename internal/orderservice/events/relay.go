@@ -0,0 +1,57 @@
+// internal/orderservice/events/relay.go
+package events
+
+import (
+	"context"
+	"log"
+	"microservices-project/internal/orderservice/repository"
+	"time"
+)
+
+const (
+	DefaultRelayInterval  = 1 * time.Second
+	DefaultRelayBatchSize = 100
+)
+
+// Relay moves events from the outbox table to an EventPublisher.
+type Relay struct {
+	outboxRepo repository.OutboxRepositoryInterface
+	publisher  EventPublisher
+	interval   time.Duration
+	batchSize  int
+}
+
+func NewRelay(outboxRepo repository.OutboxRepositoryInterface, publisher EventPublisher, interval time.Duration) *Relay {
+	if interval <= 0 {
+		interval = DefaultRelayInterval
+	}
+	return &Relay{outboxRepo: outboxRepo, publisher: publisher, interval: interval, batchSize: DefaultRelayBatchSize}
+}
+
+// Run relays events until ctx is cancelled. Full batches are followed immediately by
+// another pass, so a backlog drains without waiting for the next tick.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			published, err := r.RelayOnce(ctx)
+			if err != nil {
+				log.Printf("Outbox relay: %v", err)
+			}
+			if err != nil || published < r.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of pending events and returns how many went out.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	return r.outboxRepo.ProcessPending(ctx, r.batchSize, r.publisher.Publish)
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"microservices-project/internal/orderservice/model"
 	"microservices-project/internal/orderservice/service"
+	"microservices-project/pkg/auth"
 	orderpb "microservices-project/protos/orderpb"
 
 	"google.golang.org/grpc/codes"
@@ -14,6 +15,16 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// MethodScopes are the RPCs API keys may call, with the scope each needs.
+var MethodScopes = auth.MethodScopes{
+	orderpb.OrderService_CreateOrder_FullMethodName:       auth.ScopeOrdersWrite,
+	orderpb.OrderService_GetOrder_FullMethodName:          auth.ScopeOrdersRead,
+	orderpb.OrderService_ListUserOrders_FullMethodName:    auth.ScopeOrdersRead,
+	orderpb.OrderService_UpdateOrderStatus_FullMethodName: auth.ScopeOrdersWrite,
+	orderpb.OrderService_CancelOrder_FullMethodName:       auth.ScopeOrdersWrite,
+	orderpb.OrderService_WatchOrder_FullMethodName:        auth.ScopeOrdersRead,
+}
+
 type OrderGRPCServer struct {
 	orderpb.UnimplementedOrderServiceServer
 	orderService service.OrderServiceInterface
@@ -34,6 +45,10 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *orderpb.CreateOr
 	if len(req.Items) == 0 {
 		return nil, status.Errorf(codes.InvalidArgument, "at least one item is required")
 	}
+	// Customers order for themselves; admins and services may order for anyone
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
 
 	domainItems := make([]model.OrderItem, len(req.Items))
 	for i, item := range req.Items {
@@ -47,7 +62,7 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *orderpb.CreateOr
 		}
 	}
 
-	createdOrder, err := s.orderService.CreateOrder(ctx, req.UserId, domainItems)
+	createdOrder, err := s.orderService.CreateOrder(ctx, req.UserId, domainItems, req.ShippingAddressId, req.IdempotencyKey)
 	if err != nil {
 		log.Printf("Error creating order via gRPC: %v", err)
 		// Map service errors to gRPC status codes
@@ -57,6 +72,9 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *orderpb.CreateOr
 		if errors.Is(err, service.ErrUserValidationFailed) {
 			return nil, status.Errorf(codes.FailedPrecondition, err.Error()) // Or NotFound if user not found
 		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			return nil, status.Errorf(codes.FailedPrecondition, err.Error())
+		}
 		if errors.Is(err, service.ErrProductFetchFailed) {
 			// This could be NotFound if product not found, or Internal for other fetch issues
 			return nil, status.Errorf(codes.FailedPrecondition, err.Error())
@@ -67,6 +85,12 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *orderpb.CreateOr
 		if errors.Is(err, service.ErrProductStockUpdateFailed) {
 			return nil, status.Errorf(codes.Aborted, err.Error()) // Indicates an operation was aborted, often due to concurrency issues
 		}
+		if errors.Is(err, service.ErrIdempotencyKeyReused) {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, service.ErrIdempotencyKeyInProgress) {
+			return nil, status.Errorf(codes.Aborted, err.Error()) // Retry later with the same key
+		}
 		return nil, status.Errorf(codes.Internal, "failed to create order: %v", err)
 	}
 
@@ -87,6 +111,9 @@ func (s *OrderGRPCServer) GetOrder(ctx context.Context, req *orderpb.GetOrderReq
 		}
 		return nil, status.Errorf(codes.Internal, "failed to get order: %v", err)
 	}
+	if err := auth.CheckUser(ctx, domainOrder.UserID); err != nil {
+		return nil, auth.StatusError(err)
+	}
 	return &orderpb.GetOrderResponse{Order: toProtoOrder(domainOrder)}, nil
 }
 
@@ -95,17 +122,16 @@ func (s *OrderGRPCServer) ListUserOrders(ctx context.Context, req *orderpb.ListU
 	if req.UserId == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
 	}
-
-	page := 1 // Default
-	// Basic pagination, ignoring page_token for now
-	pageSize := int(req.PageSize)
-	if pageSize <= 0 {
-		pageSize = 10
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
 	}
 
-	domainOrders, err := s.orderService.ListUserOrders(ctx, req.UserId, page, pageSize)
+	domainOrders, nextPageToken, err := s.orderService.ListUserOrdersPage(ctx, req.UserId, req.PageToken, int(req.PageSize))
 	if err != nil {
 		log.Printf("Error listing user orders via gRPC: %v", err)
+		if errors.Is(err, service.ErrInvalidPageToken) {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Errorf(codes.Internal, "failed to list user orders: %v", err)
 	}
 
@@ -113,10 +139,140 @@ func (s *OrderGRPCServer) ListUserOrders(ctx context.Context, req *orderpb.ListU
 	for _, o := range domainOrders {
 		protoOrders = append(protoOrders, toProtoOrder(o))
 	}
-	// Not implementing next_page_token yet
-	return &orderpb.ListUserOrdersResponse{Orders: protoOrders, NextPageToken: ""}, nil
+	return &orderpb.ListUserOrdersResponse{Orders: protoOrders, NextPageToken: nextPageToken}, nil
+}
+
+func (s *OrderGRPCServer) UpdateOrderStatus(ctx context.Context, req *orderpb.UpdateOrderStatusRequest) (*orderpb.UpdateOrderStatusResponse, error) {
+	log.Printf("gRPC UpdateOrderStatus request for OrderID: %s, NewStatus: %s", req.OrderId, req.NewStatus)
+	if req.OrderId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "order_id is required")
+	}
+	if req.NewStatus == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "new_status is required")
+	}
+	// Fulfilment (paid, shipped, ...) is driven by staff and services, not customers
+	if err := auth.CheckRole(ctx, auth.RoleAdmin, auth.RoleService); err != nil {
+		return nil, auth.StatusError(err)
+	}
+
+	updatedOrder, err := s.orderService.UpdateOrderStatus(ctx, req.OrderId, model.OrderStatus(req.NewStatus))
+	if err != nil {
+		log.Printf("Error updating order status via gRPC: %v", err)
+		return nil, orderStatusError(err, "failed to update order status")
+	}
+	return &orderpb.UpdateOrderStatusResponse{Order: toProtoOrder(updatedOrder)}, nil
+}
+
+func (s *OrderGRPCServer) CancelOrder(ctx context.Context, req *orderpb.CancelOrderRequest) (*orderpb.CancelOrderResponse, error) {
+	log.Printf("gRPC CancelOrder request for OrderID: %s", req.OrderId)
+	if req.OrderId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "order_id is required")
+	}
+	if err := s.authorizeOrder(ctx, req.OrderId); err != nil {
+		return nil, orderStatusError(err, "failed to cancel order")
+	}
+
+	cancelledOrder, err := s.orderService.CancelOrder(ctx, req.OrderId)
+	if err != nil {
+		log.Printf("Error cancelling order via gRPC: %v", err)
+		return nil, orderStatusError(err, "failed to cancel order")
+	}
+	return &orderpb.CancelOrderResponse{Order: toProtoOrder(cancelledOrder)}, nil
 }
 
+func (s *OrderGRPCServer) WatchOrder(req *orderpb.GetOrderRequest, stream orderpb.OrderService_WatchOrderServer) error {
+	log.Printf("gRPC WatchOrder request for OrderID: %s", req.OrderId)
+	if req.OrderId == "" {
+		return status.Errorf(codes.InvalidArgument, "order_id is required")
+	}
+	if err := s.authorizeOrder(stream.Context(), req.OrderId); err != nil {
+		return orderStatusError(err, "failed to watch order")
+	}
+
+	err := s.orderService.WatchOrder(stream.Context(), req.OrderId, func(o *model.Order) error {
+		return stream.Send(toProtoOrder(o))
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return status.FromContextError(err).Err() // Client went away
+		}
+		log.Printf("Error watching order via gRPC: %v", err)
+		if errors.Is(err, service.ErrOrderNotFound) {
+			return status.Errorf(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, service.ErrInvalidOrderData) {
+			return status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		return status.Errorf(codes.Internal, "failed to watch order: %v", err)
+	}
+	return nil // Order reached a terminal status
+}
+
+// ExportUserOrders returns all of a user's orders for a data export (services only)
+func (s *OrderGRPCServer) ExportUserOrders(ctx context.Context, req *orderpb.ExportUserOrdersRequest) (*orderpb.ExportUserOrdersResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckRole(ctx, auth.RoleService); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC ExportUserOrders request for UserID: %s", req.UserId)
+
+	orders, err := s.orderService.ExportUserOrders(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Error exporting orders via gRPC: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to export orders")
+	}
+	protoOrders := make([]*orderpb.Order, len(orders))
+	for i, order := range orders {
+		protoOrders[i] = toProtoOrder(order)
+	}
+	return &orderpb.ExportUserOrdersResponse{Orders: protoOrders}, nil
+}
+
+// EraseUserOrders pseudonymises a user's orders when they are erased (services only)
+func (s *OrderGRPCServer) EraseUserOrders(ctx context.Context, req *orderpb.EraseUserOrdersRequest) (*orderpb.EraseUserOrdersResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleService); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC EraseUserOrders request for UserID: %s", req.UserId)
+
+	n, err := s.orderService.EraseUserOrders(ctx, req.UserId, req.Pseudonym)
+	if err != nil {
+		log.Printf("Error erasing orders via gRPC: %v", err)
+		if errors.Is(err, service.ErrInvalidOrderData) {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Errorf(codes.Internal, "failed to erase orders")
+	}
+	return &orderpb.EraseUserOrdersResponse{OrdersPseudonymised: n}, nil
+}
+
+// authorizeOrder lets the order's owner, admins and services through.
+func (s *OrderGRPCServer) authorizeOrder(ctx context.Context, orderID string) error {
+	order, err := s.orderService.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	return auth.CheckUser(ctx, order.UserID)
+}
+
+// orderStatusError maps errors from status changes to gRPC status codes.
+func orderStatusError(err error, msg string) error {
+	switch {
+	case errors.Is(err, auth.ErrMissingToken), errors.Is(err, auth.ErrForbidden):
+		return auth.StatusError(err)
+	case errors.Is(err, service.ErrInvalidOrderData), errors.Is(err, service.ErrInvalidOrderStatus):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrOrderNotFound):
+		return status.Errorf(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidStatusTransition):
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrProductStockUpdateFailed), errors.Is(err, service.ErrOrderNotSettled):
+		return status.Errorf(codes.Aborted, err.Error()) // Order was left unchanged, safe to retry
+	}
+	return status.Errorf(codes.Internal, "%s: %v", msg, err)
+}
 
 // Helper to convert domain model.Order to orderpb.Order
 func toProtoOrder(o *model.Order) *orderpb.Order {
@@ -131,7 +287,7 @@ func toProtoOrder(o *model.Order) *orderpb.Order {
 			PriceAtPurchase: item.PriceAtPurchase,
 		}
 	}
-	return &orderpb.Order{
+	protoOrder := &orderpb.Order{
 		Id:          o.ID,
 		UserId:      o.UserID,
 		Items:       items,
@@ -140,4 +296,18 @@ func toProtoOrder(o *model.Order) *orderpb.Order {
 		CreatedAt:   timestamppb.New(o.CreatedAt),
 		UpdatedAt:   timestamppb.New(o.UpdatedAt),
 	}
+	if a := o.ShippingAddress; a != nil {
+		protoOrder.ShippingAddress = &orderpb.ShippingAddress{
+			AddressId:     a.AddressID,
+			RecipientName: a.RecipientName,
+			Line1:         a.Line1,
+			Line2:         a.Line2,
+			City:          a.City,
+			Region:        a.Region,
+			PostalCode:    a.PostalCode,
+			CountryCode:   a.CountryCode,
+			Phone:         a.Phone,
+		}
+	}
+	return protoOrder
 }
\ No newline at end of file
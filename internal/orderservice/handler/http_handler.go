@@ -2,10 +2,14 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"microservices-project/internal/orderservice/model"
 	"microservices-project/internal/orderservice/service"
+	"microservices-project/pkg/auth"
 	"net/http"
 	"strconv"
 
@@ -13,6 +17,13 @@ import (
 	"github.com/go-chi/render"
 )
 
+const (
+	// idempotencyKeyHeader lets clients safely retry POST /orders.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// nextPageTokenHeader carries the token for the next page of a keyset-paginated list.
+	nextPageTokenHeader = "X-Next-Page-Token"
+)
+
 type OrderHTTPHandler struct {
 	orderService service.OrderServiceInterface
 }
@@ -26,10 +37,19 @@ func NewOrderHTTPHandler(orderService service.OrderServiceInterface) *OrderHTTPH
 func (h *OrderHTTPHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Use(render.SetContentType(render.ContentTypeJSON))
+	r.Use(auth.RequireAuthentication) // Every order endpoint needs a caller
+
+	// API keys need orders:read or orders:write; everyone else is checked per order
+	read := r.With(auth.RequireScope(auth.ScopeOrdersRead))
+	write := r.With(auth.RequireScope(auth.ScopeOrdersWrite))
 
-	r.Post("/orders", h.createOrder)                // Create a new order
-	r.Get("/orders/{orderID}", h.getOrder)          // Get a specific order
-	r.Get("/users/{userID}/orders", h.listUserOrders) // List orders for a specific user
+	write.Post("/orders", h.createOrder)       // Create a new order
+	read.Get("/orders/{orderID}", h.getOrder) // Get a specific order
+	write.With(auth.RequireRole(auth.RoleAdmin, auth.RoleService)).
+		Patch("/orders/{orderID}/status", h.updateOrderStatus) // Move an order to a new status (staff only)
+	write.Post("/orders/{orderID}/cancel", h.cancelOrder) // Cancel an order and restock its items
+	read.Get("/orders/{orderID}/events", h.watchOrder)    // Server-Sent Events stream of order updates
+	read.Get("/users/{userID}/orders", h.listUserOrders)  // List orders for a specific user
 
 	return r
 }
@@ -43,6 +63,8 @@ type CreateOrderHTTPRequestItem struct {
 type CreateOrderHTTPRequest struct {
 	UserID string                     `json:"user_id"`
 	Items  []CreateOrderHTTPRequestItem `json:"items"`
+	// ShippingAddressID is optional: an address from the user's address book to ship to
+	ShippingAddressID string `json:"shipping_address_id,omitempty"`
 }
 
 func (req *CreateOrderHTTPRequest) Bind(r *http.Request) error {
@@ -63,6 +85,17 @@ func (req *CreateOrderHTTPRequest) Bind(r *http.Request) error {
 	return nil
 }
 
+type UpdateOrderStatusHTTPRequest struct {
+	Status string `json:"status"`
+}
+
+func (req *UpdateOrderStatusHTTPRequest) Bind(r *http.Request) error {
+	if req.Status == "" {
+		return errors.New("status is required")
+	}
+	return nil
+}
+
 // We can use model.Order directly for responses as it has JSON tags.
 
 func (h *OrderHTTPHandler) createOrder(w http.ResponseWriter, r *http.Request) {
@@ -75,6 +108,13 @@ func (h *OrderHTTPHandler) createOrder(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("HTTP CreateOrder request for UserID: %s", data.UserID)
 
+	// Customers order for themselves; admins and services may order for anyone
+	if err := auth.CheckUser(r.Context(), data.UserID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
 	domainItems := make([]model.OrderItem, len(data.Items))
 	for i, item := range data.Items {
 		domainItems[i] = model.OrderItem{
@@ -83,14 +123,20 @@ func (h *OrderHTTPHandler) createOrder(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	createdOrder, err := h.orderService.CreateOrder(r.Context(), data.UserID, domainItems)
+	createdOrder, err := h.orderService.CreateOrder(r.Context(), data.UserID, domainItems, data.ShippingAddressID, r.Header.Get(idempotencyKeyHeader))
 	if err != nil {
 		log.Printf("Error creating order via HTTP: %v", err)
 		// More granular error mapping
 		if errors.Is(err, service.ErrInvalidOrderData) || errors.Is(err, service.ErrUserValidationFailed) {
 			render.Status(r, http.StatusBadRequest) // Or specific codes like 404 for user not found
+		} else if errors.Is(err, service.ErrEmailNotVerified) {
+			render.Status(r, http.StatusForbidden) // The user has to verify their email first
 		} else if errors.Is(err, service.ErrProductFetchFailed) || errors.Is(err, service.ErrInsufficientStockForOrder) {
 			render.Status(r, http.StatusConflict) // 409 Conflict if resource unavailable/insufficient
+		} else if errors.Is(err, service.ErrIdempotencyKeyReused) {
+			render.Status(r, http.StatusUnprocessableEntity) // Same key, different body
+		} else if errors.Is(err, service.ErrIdempotencyKeyInProgress) {
+			render.Status(r, http.StatusConflict) // The original request is still running
 		} else if errors.Is(err, service.ErrProductStockUpdateFailed) {
 			render.Status(r, http.StatusInternalServerError) // Or 409 if considered a business rule conflict
 		} else {
@@ -125,10 +171,18 @@ func (h *OrderHTTPHandler) getOrder(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, map[string]string{"error": err.Error()})
 		return
 	}
+	if err := auth.CheckUser(r.Context(), order.UserID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, order)
 }
 
+// listUserOrders pages with ?page=&pageSize= (offset based) or, when page is not given,
+// with ?pageToken=&pageSize= (keyset based). In token mode the token for the next page is
+// returned in the X-Next-Page-Token header, which is absent on the last page.
 func (h *OrderHTTPHandler) listUserOrders(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "userID")
 	if userID == "" {
@@ -136,12 +190,41 @@ func (h *OrderHTTPHandler) listUserOrders(w http.ResponseWriter, r *http.Request
 		render.JSON(w, r, map[string]string{"error": "user_id is required"})
 		return
 	}
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
 
 	pageStr := r.URL.Query().Get("page")
 	pageSizeStr := r.URL.Query().Get("pageSize")
-	page, _ := strconv.Atoi(pageStr)
 	pageSize, _ := strconv.Atoi(pageSizeStr)
 
+	if pageStr == "" {
+		pageToken := r.URL.Query().Get("pageToken")
+		log.Printf("HTTP ListUserOrders request for UserID: %s, PageToken: %q, PageSize: %d", userID, pageToken, pageSize)
+		orders, nextPageToken, err := h.orderService.ListUserOrdersPage(r.Context(), userID, pageToken, pageSize)
+		if err != nil {
+			log.Printf("Error listing user orders via HTTP: %v", err)
+			if errors.Is(err, service.ErrInvalidPageToken) {
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, map[string]string{"error": err.Error()})
+				return
+			}
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]string{"error": "Failed to list user orders"})
+			return
+		}
+		if nextPageToken != "" {
+			w.Header().Set(nextPageTokenHeader, nextPageToken)
+		}
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, orders)
+		return
+	}
+
+	page, _ := strconv.Atoi(pageStr)
+
 	log.Printf("HTTP ListUserOrders request for UserID: %s, Page: %d, PageSize: %d", userID, page, pageSize)
 
 	orders, err := h.orderService.ListUserOrders(r.Context(), userID, page, pageSize)
@@ -153,4 +236,133 @@ func (h *OrderHTTPHandler) listUserOrders(w http.ResponseWriter, r *http.Request
 	}
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, orders)
+}
+
+func (h *OrderHTTPHandler) updateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "orderID")
+	data := &UpdateOrderStatusHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("HTTP UpdateOrderStatus request for OrderID: %s, Status: %s", orderID, data.Status)
+
+	order, err := h.orderService.UpdateOrderStatus(r.Context(), orderID, model.OrderStatus(data.Status))
+	if err != nil {
+		log.Printf("Error updating order status via HTTP: %v", err)
+		renderOrderStatusError(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, order)
+}
+
+func (h *OrderHTTPHandler) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "orderID")
+	log.Printf("HTTP CancelOrder request for OrderID: %s", orderID)
+
+	if err := h.authorizeOrder(r.Context(), orderID); err != nil {
+		renderOrderStatusError(w, r, err)
+		return
+	}
+
+	order, err := h.orderService.CancelOrder(r.Context(), orderID)
+	if err != nil {
+		log.Printf("Error cancelling order via HTTP: %v", err)
+		renderOrderStatusError(w, r, err)
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, order)
+}
+
+// authorizeOrder lets the order's owner, admins and services through.
+func (h *OrderHTTPHandler) authorizeOrder(ctx context.Context, orderID string) error {
+	order, err := h.orderService.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	return auth.CheckUser(ctx, order.UserID)
+}
+
+// renderOrderStatusError maps errors from status changes to HTTP status codes.
+func renderOrderStatusError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, auth.ErrMissingToken), errors.Is(err, auth.ErrForbidden):
+		render.Status(r, auth.HTTPStatus(err))
+	case errors.Is(err, service.ErrInvalidOrderData), errors.Is(err, service.ErrInvalidOrderStatus):
+		render.Status(r, http.StatusBadRequest)
+	case errors.Is(err, service.ErrOrderNotFound):
+		render.Status(r, http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidStatusTransition), errors.Is(err, service.ErrOrderNotSettled):
+		render.Status(r, http.StatusConflict)
+	default:
+		render.Status(r, http.StatusInternalServerError)
+	}
+	render.JSON(w, r, map[string]string{"error": err.Error()})
+}
+
+// watchOrder streams the order as Server-Sent Events: one "order" event with the current
+// order, then one per status change. The stream ends when the order reaches a terminal status.
+func (h *OrderHTTPHandler) watchOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "orderID")
+	log.Printf("HTTP WatchOrder request for OrderID: %s", orderID)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": "streaming is not supported"})
+		return
+	}
+	if err := h.authorizeOrder(r.Context(), orderID); err != nil {
+		renderOrderStatusError(w, r, err)
+		return
+	}
+
+	// Headers are only sent with the first event, so a missing order still gets a normal JSON 404
+	streaming := false
+	err := h.orderService.WatchOrder(r.Context(), orderID, func(order *model.Order) error {
+		if !streaming {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			streaming = true
+		}
+		data, err := json.Marshal(order)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: order\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	log.Printf("Error watching order via HTTP: %v", err)
+	if streaming {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", jsonString(err.Error()))
+		flusher.Flush()
+		return
+	}
+	if errors.Is(err, service.ErrOrderNotFound) {
+		render.Status(r, http.StatusNotFound)
+	} else if errors.Is(err, service.ErrInvalidOrderData) {
+		render.Status(r, http.StatusBadRequest)
+	} else {
+		render.Status(r, http.StatusInternalServerError)
+	}
+	render.JSON(w, r, map[string]string{"error": err.Error()})
+}
+
+// jsonString encodes s as a JSON string literal, which is always safe on one SSE data line.
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
 }
\ No newline at end of file
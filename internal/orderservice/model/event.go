@@ -0,0 +1,79 @@
+// internal/orderservice/model/event.go
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType names a domain event published from the outbox.
+type EventType string
+
+const (
+	EventOrderCreated       EventType = "OrderCreated"
+	EventOrderStatusChanged EventType = "OrderStatusChanged"
+)
+
+// AggregateOrder is the aggregate type recorded for every order event.
+const AggregateOrder = "order"
+
+// OutboxEvent is a domain event stored in the outbox table in the same transaction as the
+// change it describes, and later published by the relay. Delivery is at-least-once, so
+// consumers should de-duplicate on ID.
+type OutboxEvent struct {
+	ID            string          `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     EventType       `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+	PublishedAt   *time.Time      `json:"published_at,omitempty"`
+	Attempts      int             `json:"attempts"`
+}
+
+// OrderCreatedPayload is the payload of an OrderCreated event.
+type OrderCreatedPayload struct {
+	Order *Order `json:"order"`
+}
+
+// OrderStatusChangedPayload is the payload of an OrderStatusChanged event.
+type OrderStatusChangedPayload struct {
+	OrderID   string      `json:"order_id"`
+	UserID    string      `json:"user_id"`
+	OldStatus OrderStatus `json:"old_status"`
+	NewStatus OrderStatus `json:"new_status"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
+
+// NewOrderCreatedEvent builds the OrderCreated event for a freshly written order.
+func NewOrderCreatedEvent(order *Order) (*OutboxEvent, error) {
+	return newOrderEvent(order.ID, EventOrderCreated, OrderCreatedPayload{Order: order}, order.CreatedAt)
+}
+
+// NewOrderStatusChangedEvent builds the OrderStatusChanged event for an order that moved from oldStatus.
+func NewOrderStatusChangedEvent(order *Order, oldStatus OrderStatus) (*OutboxEvent, error) {
+	return newOrderEvent(order.ID, EventOrderStatusChanged, OrderStatusChangedPayload{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		OldStatus: oldStatus,
+		NewStatus: order.Status,
+		ChangedAt: order.UpdatedAt,
+	}, order.UpdatedAt)
+}
+
+func newOrderEvent(orderID string, eventType EventType, payload interface{}, at time.Time) (*OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxEvent{
+		ID:            uuid.New().String(),
+		AggregateType: AggregateOrder,
+		AggregateID:   orderID,
+		EventType:     eventType,
+		Payload:       data,
+		CreatedAt:     at,
+	}, nil
+}
@@ -0,0 +1,16 @@
+// internal/orderservice/model/idempotency.go
+package model
+
+import "time"
+
+// IdempotencyKey remembers a client-supplied key for CreateOrder so a retried request
+// returns the original order instead of creating a new one. Keys are scoped per user.
+type IdempotencyKey struct {
+	UserID      string     `json:"user_id"`
+	Key         string     `json:"key"`
+	Fingerprint string     `json:"fingerprint"` // SHA-256 of the normalised request body
+	OrderID     string     `json:"order_id"`    // Assigned when the key is claimed, before the order exists
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
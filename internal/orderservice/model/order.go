@@ -12,6 +12,37 @@ const (
 	StatusCancelled  OrderStatus = "CANCELLED"
 )
 
+// orderTransitions lists the statuses each status may move to.
+// COMPLETED and CANCELLED are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	StatusPending:    {StatusProcessing, StatusCancelled},
+	StatusProcessing: {StatusCompleted, StatusCancelled},
+}
+
+// IsValid reports whether s is one of the known order statuses.
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case StatusPending, StatusProcessing, StatusCompleted, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsTerminal reports whether no further transitions are possible from s.
+func (s OrderStatus) IsTerminal() bool {
+	return s.IsValid() && len(orderTransitions[s]) == 0
+}
+
+// CanTransitionTo reports whether an order in status s may be moved to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 type OrderItem struct {
 	ID              string    `json:"id"` // Internal ID for the order item row
 	OrderID         string    `json:"-"`  // Foreign key to Order
@@ -21,12 +52,28 @@ type OrderItem struct {
 	CreatedAt       time.Time `json:"created_at,omitempty"`
 }
 
+// ShippingAddress is a copy of an address from the user's address book, taken when the
+// order is placed. Later edits to the address book don't change it.
+type ShippingAddress struct {
+	AddressID     string `json:"address_id"` // The address book entry it was copied from
+	RecipientName string `json:"recipient_name"`
+	Line1         string `json:"line1"`
+	Line2         string `json:"line2,omitempty"`
+	City          string `json:"city"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postal_code"`
+	CountryCode   string `json:"country_code"`
+	Phone         string `json:"phone,omitempty"`
+}
+
 type Order struct {
 	ID          string      `json:"id"`
 	UserID      string      `json:"user_id"`
 	Items       []OrderItem `json:"items"` // For returning items with order
 	TotalAmount float64     `json:"total_amount"`
 	Status      OrderStatus `json:"status"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
+	// ShippingAddress is nil for orders placed without one
+	ShippingAddress *ShippingAddress `json:"shipping_address,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
 }
\ No newline at end of file
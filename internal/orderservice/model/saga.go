@@ -0,0 +1,57 @@
+// internal/orderservice/model/saga.go
+package model
+
+import "time"
+
+// SagaStatus is the lifecycle state of an order creation saga.
+type SagaStatus string
+
+const (
+	SagaStatusStarted      SagaStatus = "STARTED"      // Steps are being applied
+	SagaStatusCompleted    SagaStatus = "COMPLETED"    // Order written, nothing to undo
+	SagaStatusCompensating SagaStatus = "COMPENSATING" // A step failed, applied steps are being reversed
+	SagaStatusCompensated  SagaStatus = "COMPENSATED"  // All applied steps have been reversed
+)
+
+// SagaStepStatus is the state of a single step within a saga.
+type SagaStepStatus string
+
+const (
+	SagaStepPending     SagaStepStatus = "PENDING"     // Recorded, remote call not confirmed yet; may have been applied
+	SagaStepApplied     SagaStepStatus = "APPLIED"     // Remote call succeeded, must be reversed on failure
+	SagaStepCompensated SagaStepStatus = "COMPENSATED" // Compensating action succeeded
+)
+
+// SagaAction identifies what a step did, and therefore how to compensate it.
+type SagaAction string
+
+const (
+	SagaActionReserveStock SagaAction = "RESERVE_STOCK" // Reference is the reservation ID; compensated by ReleaseReservation (by step ID while PENDING)
+	SagaActionCreateOrder  SagaAction = "CREATE_ORDER"  // Reference is the order ID; compensated by cancelling the order
+)
+
+// SagaStep is one remote or local action performed while creating an order.
+type SagaStep struct {
+	ID        string         `json:"id"`
+	SagaID    string         `json:"-"`
+	Sequence  int            `json:"sequence"`
+	Action    SagaAction     `json:"action"`
+	Reference string         `json:"reference,omitempty"`
+	Status    SagaStepStatus `json:"status"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Saga tracks the distributed steps needed to create a single order:
+// reserve stock, write the order, then commit the reservation.
+// OrderID is assigned up front so recovery can tell whether the order row was written.
+type Saga struct {
+	ID        string     `json:"id"`
+	OrderID   string     `json:"order_id"`
+	UserID    string     `json:"user_id"`
+	Status    SagaStatus `json:"status"`
+	Steps     []SagaStep `json:"steps"`
+	LastError string     `json:"last_error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,136 @@
+// internal/orderservice/repository/idempotency_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"microservices-project/internal/orderservice/model"
+	"time"
+)
+
+var ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+// IdempotencyRepositoryInterface stores CreateOrder idempotency keys.
+type IdempotencyRepositoryInterface interface {
+	// ClaimKey inserts the key, or takes over an expired one. If the key is already held,
+	// it returns the existing record and claimed=false.
+	ClaimKey(ctx context.Context, key *model.IdempotencyKey) (existing *model.IdempotencyKey, claimed bool, err error)
+	// ReclaimKey takes over an abandoned key, but only if it still points at oldOrderID.
+	ReclaimKey(ctx context.Context, userID, key, oldOrderID, newOrderID string, now time.Time) (bool, error)
+	CompleteKey(ctx context.Context, userID, key, orderID string) error
+	ReleaseKey(ctx context.Context, userID, key, orderID string) error
+	DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+func (r *IdempotencyRepository) ClaimKey(ctx context.Context, key *model.IdempotencyKey) (*model.IdempotencyKey, bool, error) {
+	// The conflict clause only overwrites rows whose retention window has passed,
+	// so an affected row count of 1 means we own the key.
+	query := `INSERT INTO order_idempotency_keys (user_id, idempotency_key, fingerprint, order_id, created_at, expires_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)
+	          ON CONFLICT (user_id, idempotency_key) DO UPDATE
+	          SET fingerprint = EXCLUDED.fingerprint, order_id = EXCLUDED.order_id, completed_at = NULL,
+	              created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+	          WHERE order_idempotency_keys.expires_at <= EXCLUDED.created_at`
+	result, err := r.db.ExecContext(ctx, query, key.UserID, key.Key, key.Fingerprint, key.OrderID, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		log.Printf("Error claiming idempotency key in DB: %v", err)
+		return nil, false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	if rowsAffected == 1 {
+		return key, true, nil
+	}
+
+	existing, err := r.getKey(ctx, key.UserID, key.Key)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+func (r *IdempotencyRepository) ReclaimKey(ctx context.Context, userID, key, oldOrderID, newOrderID string, now time.Time) (bool, error) {
+	query := `UPDATE order_idempotency_keys SET order_id = $1, created_at = $2
+	          WHERE user_id = $3 AND idempotency_key = $4 AND order_id = $5 AND completed_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, newOrderID, now, userID, key, oldOrderID)
+	if err != nil {
+		log.Printf("Error reclaiming idempotency key in DB: %v", err)
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *IdempotencyRepository) CompleteKey(ctx context.Context, userID, key, orderID string) error {
+	query := `UPDATE order_idempotency_keys SET completed_at = $1
+	          WHERE user_id = $2 AND idempotency_key = $3 AND order_id = $4`
+	result, err := r.db.ExecContext(ctx, query, time.Now(), userID, key, orderID)
+	if err != nil {
+		log.Printf("Error completing idempotency key in DB: %v", err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+	return nil
+}
+
+// ReleaseKey forgets a key whose request failed, so the client can retry with it.
+func (r *IdempotencyRepository) ReleaseKey(ctx context.Context, userID, key, orderID string) error {
+	query := `DELETE FROM order_idempotency_keys WHERE user_id = $1 AND idempotency_key = $2 AND order_id = $3 AND completed_at IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, userID, key, orderID); err != nil {
+		log.Printf("Error releasing idempotency key in DB: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM order_idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		log.Printf("Error deleting expired idempotency keys from DB: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *IdempotencyRepository) getKey(ctx context.Context, userID, key string) (*model.IdempotencyKey, error) {
+	record := &model.IdempotencyKey{}
+	var completedAt sql.NullTime
+	query := `SELECT user_id, idempotency_key, fingerprint, order_id, completed_at, created_at, expires_at
+	          FROM order_idempotency_keys WHERE user_id = $1 AND idempotency_key = $2`
+	err := r.db.QueryRowContext(ctx, query, userID, key).Scan(
+		&record.UserID, &record.Key, &record.Fingerprint, &record.OrderID, &completedAt, &record.CreatedAt, &record.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Released or purged between our insert and this read
+			return nil, ErrIdempotencyKeyNotFound
+		}
+		log.Printf("Error getting idempotency key from DB: %v", err)
+		return nil, err
+	}
+	if completedAt.Valid {
+		record.CompletedAt = &completedAt.Time
+	}
+	return record, nil
+}
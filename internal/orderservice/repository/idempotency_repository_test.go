@@ -0,0 +1,143 @@
+// internal/orderservice/repository/idempotency_repository_test.go
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"microservices-project/internal/orderservice/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// claimKeySQL matches the insert together with the clause that limits takeovers to expired rows.
+const claimKeySQL = `INSERT INTO order_idempotency_keys (.+) ON CONFLICT \(user_id, idempotency_key\) DO UPDATE ` +
+	`(.+) WHERE order_idempotency_keys.expires_at <= EXCLUDED.created_at`
+
+func newMockDBAndIdempotencyRepo(t *testing.T) (sqlmock.Sqlmock, *IdempotencyRepository) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return mock, NewIdempotencyRepository(db)
+}
+
+func newClaim(now time.Time) *model.IdempotencyKey {
+	return &model.IdempotencyKey{
+		UserID: "user-1", Key: "key-1", Fingerprint: "fp", OrderID: "order-2",
+		CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+func TestIdempotencyRepository_ClaimKey_TakesOverExpiredKey(t *testing.T) {
+	mock, repo := newMockDBAndIdempotencyRepo(t)
+
+	now := time.Now()
+	claim := newClaim(now)
+	// An expired row is overwritten by the conflict clause, which counts as one affected row
+	mock.ExpectExec(claimKeySQL).
+		WithArgs("user-1", "key-1", "fp", "order-2", now, claim.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	existing, claimed, err := repo.ClaimKey(context.Background(), claim)
+
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Same(t, claim, existing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotencyRepository_ClaimKey_ReturnsHeldKey(t *testing.T) {
+	mock, repo := newMockDBAndIdempotencyRepo(t)
+
+	now := time.Now()
+	completedAt := now.Add(-time.Minute)
+	mock.ExpectExec(claimKeySQL).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT (.+) FROM order_idempotency_keys WHERE user_id = \$1 AND idempotency_key = \$2`).
+		WithArgs("user-1", "key-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "idempotency_key", "fingerprint", "order_id", "completed_at", "created_at", "expires_at"}).
+			AddRow("user-1", "key-1", "fp", "order-1", completedAt, completedAt, now.Add(time.Hour)))
+
+	existing, claimed, err := repo.ClaimKey(context.Background(), newClaim(now))
+
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, "order-1", existing.OrderID)
+	require.NotNil(t, existing.CompletedAt)
+	assert.WithinDuration(t, completedAt, *existing.CompletedAt, time.Second)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotencyRepository_ClaimKey_ReleasedBeforeRead(t *testing.T) {
+	mock, repo := newMockDBAndIdempotencyRepo(t)
+
+	mock.ExpectExec(claimKeySQL).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT (.+) FROM order_idempotency_keys WHERE user_id = \$1 AND idempotency_key = \$2`).
+		WithArgs("user-1", "key-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "idempotency_key", "fingerprint", "order_id", "completed_at", "created_at", "expires_at"}))
+
+	_, claimed, err := repo.ClaimKey(context.Background(), newClaim(time.Now()))
+
+	assert.ErrorIs(t, err, ErrIdempotencyKeyNotFound)
+	assert.False(t, claimed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotencyRepository_ReclaimKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		rowsAffected int64
+		want         bool
+	}{
+		{name: "abandoned key is taken over", rowsAffected: 1, want: true},
+		{name: "another retry reclaimed it first", rowsAffected: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, repo := newMockDBAndIdempotencyRepo(t)
+			now := time.Now()
+			// Only a key still pointing at the dead attempt's order, and never completed, is taken over
+			mock.ExpectExec(`UPDATE order_idempotency_keys SET order_id = \$1, created_at = \$2 `+
+				`WHERE user_id = \$3 AND idempotency_key = \$4 AND order_id = \$5 AND completed_at IS NULL`).
+				WithArgs("order-2", now, "user-1", "key-1", "order-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+
+			ok, err := repo.ReclaimKey(context.Background(), "user-1", "key-1", "order-1", "order-2", now)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ok)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestIdempotencyRepository_ReleaseKey_OnlyUncompletedClaim(t *testing.T) {
+	mock, repo := newMockDBAndIdempotencyRepo(t)
+
+	mock.ExpectExec(`DELETE FROM order_idempotency_keys `+
+		`WHERE user_id = \$1 AND idempotency_key = \$2 AND order_id = \$3 AND completed_at IS NULL`).
+		WithArgs("user-1", "key-1", "order-1").
+		WillReturnResult(sqlmock.NewResult(0, 0)) // Already reclaimed by a retry: nothing to delete
+
+	err := repo.ReleaseKey(context.Background(), "user-1", "key-1", "order-1")
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotencyRepository_CompleteKey_NotFound(t *testing.T) {
+	mock, repo := newMockDBAndIdempotencyRepo(t)
+
+	mock.ExpectExec(`UPDATE order_idempotency_keys SET completed_at = \$1 WHERE user_id = \$2 AND idempotency_key = \$3 AND order_id = \$4`).
+		WithArgs(sqlmock.AnyArg(), "user-1", "key-1", "order-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.CompleteKey(context.Background(), "user-1", "key-1", "order-1")
+
+	assert.ErrorIs(t, err, ErrIdempotencyKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,22 +4,35 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"microservices-project/internal/orderservice/model"
+	"microservices-project/pkg/pagination"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-var ErrOrderNotFound = errors.New("order not found")
+var (
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrOrderStatusConflict = errors.New("order status changed concurrently")
+)
 
 type OrderRepositoryInterface interface {
 	CreateOrder(ctx context.Context, order *model.Order) (*model.Order, error)
 	GetOrderByID(ctx context.Context, id string) (*model.Order, error)
 	ListOrdersByUserID(ctx context.Context, userID string, limit int, offset int) ([]*model.Order, error)
+	ListOrdersByUserIDAfter(ctx context.Context, userID string, after *pagination.Cursor, limit int) ([]*model.Order, error)
 	UpdateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus) (*model.Order, error)
+	TransitionOrderStatus(ctx context.Context, orderID string, from, to model.OrderStatus) (*model.Order, error)
+	// ListAllOrdersByUserID returns every order of the user with its items, oldest first.
+	ListAllOrdersByUserID(ctx context.Context, userID string) ([]*model.Order, error)
+	// PseudonymiseUserOrders moves the user's orders, sagas and outbox events to pseudonym,
+	// cuts their shipping addresses down to the country and drops their idempotency keys.
+	// It returns the number of orders changed.
+	PseudonymiseUserOrders(ctx context.Context, userID, pseudonym string) (int64, error)
 }
 
 type OrderRepository struct {
@@ -37,16 +50,25 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, order *model.Order) (
 	}
 	defer tx.Rollback() // Rollback if not committed
 
-	order.ID = uuid.New().String()
+	if order.ID == "" { // The saga pre-assigns the ID so recovery can find the order
+		order.ID = uuid.New().String()
+	}
 	order.CreatedAt = time.Now()
 	order.UpdatedAt = time.Now()
 	if order.Status == "" {
 		order.Status = model.StatusPending // Default status
 	}
 
-	orderQuery := `INSERT INTO orders (id, user_id, total_amount, status, created_at, updated_at)
-	               VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err = tx.ExecContext(ctx, orderQuery, order.ID, order.UserID, order.TotalAmount, order.Status, order.CreatedAt, order.UpdatedAt)
+	var shippingAddress []byte // NULL unless the order has one
+	if order.ShippingAddress != nil {
+		if shippingAddress, err = json.Marshal(order.ShippingAddress); err != nil {
+			return nil, fmt.Errorf("failed to encode shipping address: %w", err)
+		}
+	}
+
+	orderQuery := `INSERT INTO orders (id, user_id, total_amount, status, shipping_address, created_at, updated_at)
+	               VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.ExecContext(ctx, orderQuery, order.ID, order.UserID, order.TotalAmount, order.Status, shippingAddress, order.CreatedAt, order.UpdatedAt)
 	if err != nil {
 		log.Printf("Error inserting order into DB: %v", err)
 		return nil, err
@@ -69,6 +91,15 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, order *model.Order) (
 		}
 	}
 
+	// Record the OrderCreated event in the same transaction, so it exists if and only if the order does
+	event, err := model.NewOrderCreatedEvent(order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OrderCreated event: %w", err)
+	}
+	if err = insertOutboxEvent(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		log.Printf("Error committing order transaction: %v", err)
 		return nil, err
@@ -78,11 +109,15 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, order *model.Order) (
 
 func (r *OrderRepository) GetOrderByID(ctx context.Context, id string) (*model.Order, error) {
 	order := &model.Order{}
-	queryOrder := `SELECT id, user_id, total_amount, status, created_at, updated_at
+	var shippingAddress []byte
+	queryOrder := `SELECT id, user_id, total_amount, status, shipping_address, created_at, updated_at
 	               FROM orders WHERE id = $1`
 	err := r.db.QueryRowContext(ctx, queryOrder, id).Scan(
-		&order.ID, &order.UserID, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt,
+		&order.ID, &order.UserID, &order.TotalAmount, &order.Status, &shippingAddress, &order.CreatedAt, &order.UpdatedAt,
 	)
+	if err == nil {
+		order.ShippingAddress, err = decodeShippingAddress(shippingAddress)
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrOrderNotFound
@@ -120,53 +155,267 @@ func (r *OrderRepository) GetOrderByID(ctx context.Context, id string) (*model.O
 }
 
 func (r *OrderRepository) ListOrdersByUserID(ctx context.Context, userID string, limit int, offset int) ([]*model.Order, error) {
-	query := `SELECT id, user_id, total_amount, status, created_at, updated_at
-	          FROM orders WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	query := `SELECT id, user_id, total_amount, status, shipping_address, created_at, updated_at
+	          FROM orders WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`
 	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
 	if err != nil {
 		log.Printf("Error listing orders by user ID from DB: %v", err)
 		return nil, err
 	}
+	return scanOrders(rows)
+}
+
+// ListOrdersByUserIDAfter returns up to limit of the user's orders that come after the cursor
+// in (created_at DESC, id DESC) order, or the first page if after is nil.
+func (r *OrderRepository) ListOrdersByUserIDAfter(ctx context.Context, userID string, after *pagination.Cursor, limit int) ([]*model.Order, error) {
+	query := `SELECT id, user_id, total_amount, status, shipping_address, created_at, updated_at
+	          FROM orders WHERE user_id = $1`
+	args := []interface{}{userID, limit}
+	if after != nil {
+		query += ` AND (created_at, id) < ($3, $4)`
+		args = append(args, after.CreatedAt, after.ID)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Error listing orders by user ID after cursor from DB: %v", err)
+		return nil, err
+	}
+	return scanOrders(rows)
+}
+
+func scanOrders(rows *sql.Rows) ([]*model.Order, error) {
 	defer rows.Close()
 
 	orders := []*model.Order{}
 	for rows.Next() {
 		order := &model.Order{}
+		var shippingAddress []byte
 		if err := rows.Scan(
-			&order.ID, &order.UserID, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt,
+			&order.ID, &order.UserID, &order.TotalAmount, &order.Status, &shippingAddress, &order.CreatedAt, &order.UpdatedAt,
 		); err != nil {
 			log.Printf("Error scanning order row: %v", err)
 			return nil, err
 		}
+		var err error
+		if order.ShippingAddress, err = decodeShippingAddress(shippingAddress); err != nil {
+			log.Printf("Error decoding shipping address of order %s: %v", order.ID, err)
+			return nil, err
+		}
 		// Optionally fetch items for each order here, or do it on demand (N+1 problem if not careful)
 		// For a list view, often items are not fully loaded immediately.
 		// For this example, we'll skip loading items for the list view to keep it simpler.
 		// If items are needed, call GetOrderByID or a specialized function.
 		orders = append(orders, order)
 	}
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		log.Printf("Error after iterating order rows: %v", err)
 		return nil, err
 	}
 	return orders, nil
 }
 
+func (r *OrderRepository) ListAllOrdersByUserID(ctx context.Context, userID string) ([]*model.Order, error) {
+	query := `SELECT id, user_id, total_amount, status, shipping_address, created_at, updated_at
+	          FROM orders WHERE user_id = $1 ORDER BY created_at, id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		log.Printf("Error listing all orders of user %s from DB: %v", userID, err)
+		return nil, err
+	}
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// One query for all the items rather than one per order
+	byID := make(map[string]*model.Order, len(orders))
+	for _, order := range orders {
+		order.Items = []model.OrderItem{}
+		byID[order.ID] = order
+	}
+	itemQuery := `SELECT i.order_id, i.id, i.product_id, i.quantity, i.price_at_purchase, i.created_at
+	              FROM order_items i JOIN orders o ON o.id = i.order_id
+	              WHERE o.user_id = $1 ORDER BY i.created_at ASC`
+	itemRows, err := r.db.QueryContext(ctx, itemQuery, userID)
+	if err != nil {
+		log.Printf("Error listing order items of user %s from DB: %v", userID, err)
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var item model.OrderItem
+		if err := itemRows.Scan(&item.OrderID, &item.ID, &item.ProductID, &item.Quantity, &item.PriceAtPurchase, &item.CreatedAt); err != nil {
+			log.Printf("Error scanning order item: %v", err)
+			return nil, err
+		}
+		if order, ok := byID[item.OrderID]; ok { // Skip items of orders placed since the first query
+			order.Items = append(order.Items, item)
+		}
+	}
+	if err := itemRows.Err(); err != nil {
+		log.Printf("Error after iterating order item rows: %v", err)
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *OrderRepository) PseudonymiseUserOrders(ctx context.Context, userID, pseudonym string) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	// Events still in the outbox carry copies of the orders; redact them the same way, first,
+	// while the orders can still be found by the user's ID
+	outboxQuery := `UPDATE outbox
+	                SET payload = CASE
+	                    WHEN event_type = $3 THEN jsonb_set(payload, '{order}', payload->'order'
+	                        || jsonb_build_object('user_id', $2::text)
+	                        || CASE WHEN payload->'order' ? 'shipping_address'
+	                                THEN jsonb_build_object('shipping_address', jsonb_build_object('country_code', payload->'order'->'shipping_address'->'country_code'))
+	                                ELSE '{}'::jsonb END)
+	                    ELSE payload || jsonb_build_object('user_id', $2::text) END
+	                WHERE aggregate_type = $4 AND aggregate_id IN (SELECT id FROM orders WHERE user_id = $1)`
+	if _, err := tx.ExecContext(ctx, outboxQuery, userID, pseudonym, model.EventOrderCreated, model.AggregateOrder); err != nil {
+		log.Printf("Error redacting outbox events of user %s in DB: %v", userID, err)
+		return 0, err
+	}
+
+	// Amounts, items and statuses stay as they are for the accounts; the country stays for tax
+	query := `UPDATE orders
+	          SET user_id = $2,
+	              shipping_address = CASE WHEN shipping_address IS NULL THEN NULL
+	                                      ELSE jsonb_build_object('country_code', shipping_address->'country_code') END
+	          WHERE user_id = $1`
+	result, err := tx.ExecContext(ctx, query, userID, pseudonym)
+	if err != nil {
+		log.Printf("Error pseudonymising orders of user %s in DB: %v", userID, err)
+		return 0, err
+	}
+	orders, _ := result.RowsAffected()
+	if _, err := tx.ExecContext(ctx, `UPDATE order_sagas SET user_id = $2 WHERE user_id = $1`, userID, pseudonym); err != nil {
+		log.Printf("Error pseudonymising order sagas of user %s in DB: %v", userID, err)
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM order_idempotency_keys WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error deleting idempotency keys of user %s in DB: %v", userID, err)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return orders, nil
+}
+
+// decodeShippingAddress decodes the shipping_address column; NULL decodes to nil.
+func decodeShippingAddress(data []byte) (*model.ShippingAddress, error) {
+	if data == nil {
+		return nil, nil
+	}
+	address := &model.ShippingAddress{}
+	if err := json.Unmarshal(data, address); err != nil {
+		return nil, fmt.Errorf("failed to decode shipping address: %w", err)
+	}
+	return address, nil
+}
+
 func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus) (*model.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	// Lock the row and read the old status for the OrderStatusChanged event
+	var oldStatus model.OrderStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&oldStatus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrderNotFound
+		}
+		log.Printf("Error locking order for status update in DB: %v", err)
+		return nil, err
+	}
+
 	updatedAt := time.Now()
 	query := `UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3 RETURNING user_id, total_amount, created_at`
 
 	order := &model.Order{ID: orderID, Status: status, UpdatedAt: updatedAt}
-	err := r.db.QueryRowContext(ctx, query, status, updatedAt, orderID).Scan(
+	err = tx.QueryRowContext(ctx, query, status, updatedAt, orderID).Scan(
 		&order.UserID, &order.TotalAmount, &order.CreatedAt,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrOrderNotFound
-		}
 		log.Printf("Error updating order status in DB: %v", err)
 		return nil, err
 	}
+
+	if oldStatus != status { // Re-applying the same status is not a change worth announcing
+		if err := r.recordStatusChange(ctx, tx, order, oldStatus); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing order status transaction: %v", err)
+		return nil, err
+	}
 	// To return the full order with items, you'd call GetOrderByID here
 	// For now, returning the partially filled order (without items)
 	return order, nil
+}
+
+// TransitionOrderStatus moves an order from one status to another, but only if it is still in
+// the expected "from" status. This stops two concurrent requests from both acting on the same
+// transition (e.g. restocking a cancelled order twice).
+func (r *OrderRepository) TransitionOrderStatus(ctx context.Context, orderID string, from, to model.OrderStatus) (*model.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	updatedAt := time.Now()
+	query := `UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4 RETURNING user_id, total_amount, created_at`
+
+	order := &model.Order{ID: orderID, Status: to, UpdatedAt: updatedAt}
+	err = tx.QueryRowContext(ctx, query, to, updatedAt, orderID, from).Scan(
+		&order.UserID, &order.TotalAmount, &order.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Either the order is gone or its status is no longer "from"
+			var exists bool
+			if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM orders WHERE id = $1)`, orderID).Scan(&exists); err != nil {
+				log.Printf("Error checking order existence in DB: %v", err)
+				return nil, err
+			}
+			if !exists {
+				return nil, ErrOrderNotFound
+			}
+			return nil, ErrOrderStatusConflict
+		}
+		log.Printf("Error transitioning order status in DB: %v", err)
+		return nil, err
+	}
+
+	if err := r.recordStatusChange(ctx, tx, order, from); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing order status transaction: %v", err)
+		return nil, err
+	}
+	return order, nil
+}
+
+func (r *OrderRepository) recordStatusChange(ctx context.Context, tx *sql.Tx, order *model.Order, oldStatus model.OrderStatus) error {
+	event, err := model.NewOrderStatusChangedEvent(order, oldStatus)
+	if err != nil {
+		return fmt.Errorf("failed to build OrderStatusChanged event: %w", err)
+	}
+	return insertOutboxEvent(ctx, tx, event)
 }
\ No newline at end of file
@@ -0,0 +1,119 @@
+// internal/orderservice/repository/outbox_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"microservices-project/internal/orderservice/model"
+	"time"
+)
+
+// outboxRelayLockID is the Postgres advisory lock held while relaying, so that only one
+// replica publishes at a time and events go out in the order they were written.
+const outboxRelayLockID = 7324150001
+
+// OutboxRepositoryInterface reads the outbox for the relay. Events are written by
+// OrderRepository inside the transactions that change orders.
+type OutboxRepositoryInterface interface {
+	// ProcessPending hands up to limit unpublished events, oldest first, to handle and marks
+	// each one published as soon as handle accepts it. It stops at the first failure so later
+	// events are never published ahead of an earlier one. It returns how many were published.
+	ProcessPending(ctx context.Context, limit int, handle func(ctx context.Context, event *model.OutboxEvent) error) (int, error)
+	DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+func (r *OutboxRepository) ProcessPending(ctx context.Context, limit int, handle func(ctx context.Context, event *model.OutboxEvent) error) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLockID).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to take outbox relay lock: %w", err)
+	}
+	if !locked {
+		return 0, nil // Another replica is relaying
+	}
+
+	query := `SELECT id, aggregate_type, aggregate_id, event_type, payload, created_at, attempts
+	          FROM outbox WHERE published_at IS NULL ORDER BY created_at ASC, id ASC LIMIT $1`
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		log.Printf("Error fetching pending outbox events: %v", err)
+		return 0, err
+	}
+	events := []*model.OutboxEvent{}
+	for rows.Next() {
+		event := &model.OutboxEvent{}
+		if err := rows.Scan(&event.ID, &event.AggregateType, &event.AggregateID, &event.EventType, &event.Payload, &event.CreatedAt, &event.Attempts); err != nil {
+			rows.Close()
+			log.Printf("Error scanning outbox event: %v", err)
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	var handleErr error
+	for _, event := range events {
+		if handleErr = handle(ctx, event); handleErr != nil {
+			_, err := tx.ExecContext(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2`, handleErr.Error(), event.ID)
+			if err != nil {
+				return published, fmt.Errorf("failed to record outbox failure: %w", err)
+			}
+			break
+		}
+		now := time.Now()
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox SET published_at = $1, attempts = attempts + 1, last_error = '' WHERE id = $2`, now, event.ID); err != nil {
+			return published, fmt.Errorf("failed to mark outbox event published: %w", err)
+		}
+		event.PublishedAt = &now
+		published++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return published, handleErr
+}
+
+func (r *OutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at IS NOT NULL AND published_at < $1`, before)
+	if err != nil {
+		log.Printf("Error deleting published outbox events: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertOutboxEvent writes an event; callers pass the transaction that made the change.
+func insertOutboxEvent(ctx context.Context, db execer, event *model.OutboxEvent) error {
+	query := `INSERT INTO outbox (id, aggregate_type, aggregate_id, event_type, payload, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := db.ExecContext(ctx, query, event.ID, event.AggregateType, event.AggregateID, event.EventType, []byte(event.Payload), event.CreatedAt)
+	if err != nil {
+		log.Printf("Error inserting %s event into outbox: %v", event.EventType, err)
+	}
+	return err
+}
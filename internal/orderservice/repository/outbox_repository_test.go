@@ -0,0 +1,97 @@
+// internal/orderservice/repository/outbox_repository_test.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"microservices-project/internal/orderservice/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var outboxColumns = []string{"id", "aggregate_type", "aggregate_id", "event_type", "payload", "created_at", "attempts"}
+
+func newMockDBAndOutboxRepo(t *testing.T) (sqlmock.Sqlmock, *OutboxRepository) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return mock, NewOutboxRepository(db)
+}
+
+func expectRelayLock(mock sqlmock.Sqlmock, locked bool) {
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(\$1\)`).
+		WithArgs(outboxRelayLockID).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(locked))
+}
+
+func TestOutboxRepository_ProcessPending_StopsAtFirstFailure(t *testing.T) {
+	mock, repo := newMockDBAndOutboxRepo(t)
+
+	now := time.Now()
+	mock.ExpectBegin()
+	expectRelayLock(mock, true)
+	mock.ExpectQuery(`SELECT (.+) FROM outbox WHERE published_at IS NULL ORDER BY created_at ASC, id ASC LIMIT \$1`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow("event-1", model.AggregateOrder, "order-1", model.EventOrderCreated, []byte(`{}`), now, 0).
+			AddRow("event-2", model.AggregateOrder, "order-1", model.EventOrderStatusChanged, []byte(`{}`), now, 2).
+			AddRow("event-3", model.AggregateOrder, "order-1", model.EventOrderStatusChanged, []byte(`{}`), now, 0))
+	mock.ExpectExec(`UPDATE outbox SET published_at = \$1, attempts = attempts \+ 1, last_error = '' WHERE id = \$2`).
+		WithArgs(sqlmock.AnyArg(), "event-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE outbox SET attempts = attempts \+ 1, last_error = \$1 WHERE id = \$2`).
+		WithArgs("broker down", "event-2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var handled []string
+	published, err := repo.ProcessPending(context.Background(), 10, func(ctx context.Context, event *model.OutboxEvent) error {
+		handled = append(handled, event.ID)
+		if event.ID == "event-2" {
+			return errors.New("broker down")
+		}
+		return nil
+	})
+
+	assert.EqualError(t, err, "broker down")
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []string{"event-1", "event-2"}, handled) // event-3 must not overtake event-2
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_ProcessPending_AnotherReplicaIsRelaying(t *testing.T) {
+	mock, repo := newMockDBAndOutboxRepo(t)
+
+	mock.ExpectBegin()
+	expectRelayLock(mock, false)
+	mock.ExpectRollback()
+
+	published, err := repo.ProcessPending(context.Background(), 10, func(ctx context.Context, event *model.OutboxEvent) error {
+		t.Fatalf("event %s handled without the relay lock", event.ID)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, published)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_DeletePublishedBefore(t *testing.T) {
+	mock, repo := newMockDBAndOutboxRepo(t)
+
+	before := time.Now().Add(-24 * time.Hour)
+	mock.ExpectExec(`DELETE FROM outbox WHERE published_at IS NOT NULL AND published_at < \$1`).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := repo.DeletePublishedBefore(context.Background(), before)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
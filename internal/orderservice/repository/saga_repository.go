@@ -0,0 +1,247 @@
+// internal/orderservice/repository/saga_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/orderservice/model"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrSagaNotFound = errors.New("saga not found")
+
+// SagaRepositoryInterface persists order creation sagas so that a restarted
+// orderservice can resume or unwind the steps it had already completed.
+type SagaRepositoryInterface interface {
+	CreateSaga(ctx context.Context, saga *model.Saga) (*model.Saga, error)
+	AddStep(ctx context.Context, sagaID string, step *model.SagaStep) error
+	UpdateSagaStatus(ctx context.Context, sagaID string, status model.SagaStatus, lastError string) error
+	UpdateStepStatus(ctx context.Context, stepID string, status model.SagaStepStatus) error
+	ApplyStep(ctx context.Context, stepID, reference string) error
+	GetSagaByOrderID(ctx context.Context, orderID string) (*model.Saga, error)
+	ListUnfinishedSagas(ctx context.Context, updatedBefore time.Time) ([]*model.Saga, error)
+	ClaimSaga(ctx context.Context, sagaID string, updatedBefore time.Time) (bool, error)
+}
+
+type SagaRepository struct {
+	db *sql.DB
+}
+
+func NewSagaRepository(db *sql.DB) *SagaRepository {
+	return &SagaRepository{db: db}
+}
+
+// CreateSaga inserts the saga and any initial steps in one transaction.
+func (r *SagaRepository) CreateSaga(ctx context.Context, saga *model.Saga) (*model.Saga, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	now := time.Now()
+	if saga.ID == "" {
+		saga.ID = uuid.New().String()
+	}
+	if saga.Status == "" {
+		saga.Status = model.SagaStatusStarted
+	}
+	saga.CreatedAt = now
+	saga.UpdatedAt = now
+
+	sagaQuery := `INSERT INTO order_sagas (id, order_id, user_id, status, last_error, created_at, updated_at)
+	              VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.ExecContext(ctx, sagaQuery, saga.ID, saga.OrderID, saga.UserID, saga.Status, saga.LastError, saga.CreatedAt, saga.UpdatedAt)
+	if err != nil {
+		log.Printf("Error inserting saga into DB: %v", err)
+		return nil, err
+	}
+
+	for i := range saga.Steps {
+		saga.Steps[i].Sequence = i
+		if err := insertStep(ctx, tx, saga.ID, &saga.Steps[i], now); err != nil {
+			log.Printf("Error inserting saga step into DB: %v", err)
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing saga transaction: %v", err)
+		return nil, err
+	}
+	return saga, nil
+}
+
+// AddStep appends a step to an existing saga, numbering it after the steps already recorded.
+func (r *SagaRepository) AddStep(ctx context.Context, sagaID string, step *model.SagaStep) error {
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(sequence) + 1, 0) FROM order_saga_steps WHERE saga_id = $1`, sagaID,
+	).Scan(&step.Sequence)
+	if err != nil {
+		log.Printf("Error getting next saga step sequence: %v", err)
+		return err
+	}
+	if err := insertStep(ctx, r.db, sagaID, step, time.Now()); err != nil {
+		log.Printf("Error inserting saga step into DB: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SagaRepository) UpdateSagaStatus(ctx context.Context, sagaID string, status model.SagaStatus, lastError string) error {
+	query := `UPDATE order_sagas SET status = $1, last_error = $2, updated_at = $3 WHERE id = $4`
+	result, err := r.db.ExecContext(ctx, query, status, lastError, time.Now(), sagaID)
+	if err != nil {
+		log.Printf("Error updating saga status in DB: %v", err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSagaNotFound
+	}
+	return nil
+}
+
+func (r *SagaRepository) UpdateStepStatus(ctx context.Context, stepID string, status model.SagaStepStatus) error {
+	query := `UPDATE order_saga_steps SET status = $1, updated_at = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, status, time.Now(), stepID)
+	if err != nil {
+		log.Printf("Error updating saga step status in DB: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ApplyStep marks a pending step as applied and records the reference its call returned.
+func (r *SagaRepository) ApplyStep(ctx context.Context, stepID, reference string) error {
+	query := `UPDATE order_saga_steps SET status = $1, reference = $2, updated_at = $3 WHERE id = $4`
+	_, err := r.db.ExecContext(ctx, query, model.SagaStepApplied, reference, time.Now(), stepID)
+	if err != nil {
+		log.Printf("Error applying saga step in DB: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetSagaByOrderID returns the saga that created orderID, without its steps.
+func (r *SagaRepository) GetSagaByOrderID(ctx context.Context, orderID string) (*model.Saga, error) {
+	saga := &model.Saga{}
+	query := `SELECT id, order_id, user_id, status, last_error, created_at, updated_at
+	          FROM order_sagas WHERE order_id = $1`
+	err := r.db.QueryRowContext(ctx, query, orderID).Scan(
+		&saga.ID, &saga.OrderID, &saga.UserID, &saga.Status, &saga.LastError, &saga.CreatedAt, &saga.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSagaNotFound
+		}
+		log.Printf("Error fetching saga of order %s from DB: %v", orderID, err)
+		return nil, err
+	}
+	return saga, nil
+}
+
+// ListUnfinishedSagas returns sagas that are still STARTED or COMPENSATING and have not
+// been touched since updatedBefore, i.e. sagas whose owning request has most likely died.
+func (r *SagaRepository) ListUnfinishedSagas(ctx context.Context, updatedBefore time.Time) ([]*model.Saga, error) {
+	query := `SELECT id, order_id, user_id, status, last_error, created_at, updated_at
+	          FROM order_sagas
+	          WHERE status IN ($1, $2) AND updated_at < $3
+	          ORDER BY created_at ASC`
+	rows, err := r.db.QueryContext(ctx, query, model.SagaStatusStarted, model.SagaStatusCompensating, updatedBefore)
+	if err != nil {
+		log.Printf("Error listing unfinished sagas from DB: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sagas := []*model.Saga{}
+	for rows.Next() {
+		saga := &model.Saga{}
+		if err := rows.Scan(&saga.ID, &saga.OrderID, &saga.UserID, &saga.Status, &saga.LastError, &saga.CreatedAt, &saga.UpdatedAt); err != nil {
+			log.Printf("Error scanning saga row: %v", err)
+			return nil, err
+		}
+		sagas = append(sagas, saga)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Error after iterating saga rows: %v", err)
+		return nil, err
+	}
+
+	for _, saga := range sagas {
+		steps, err := r.getSteps(ctx, saga.ID)
+		if err != nil {
+			return nil, err
+		}
+		saga.Steps = steps
+	}
+	return sagas, nil
+}
+
+// ClaimSaga bumps updated_at on a stale saga so that only one replica recovers it.
+// It returns false if another replica (or the original request) touched it first.
+func (r *SagaRepository) ClaimSaga(ctx context.Context, sagaID string, updatedBefore time.Time) (bool, error) {
+	query := `UPDATE order_sagas SET updated_at = $1 WHERE id = $2 AND updated_at < $3`
+	result, err := r.db.ExecContext(ctx, query, time.Now(), sagaID, updatedBefore)
+	if err != nil {
+		log.Printf("Error claiming saga %s: %v", sagaID, err)
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *SagaRepository) getSteps(ctx context.Context, sagaID string) ([]model.SagaStep, error) {
+	query := `SELECT id, sequence, action, reference, status, created_at, updated_at
+	          FROM order_saga_steps WHERE saga_id = $1 ORDER BY sequence ASC`
+	rows, err := r.db.QueryContext(ctx, query, sagaID)
+	if err != nil {
+		log.Printf("Error fetching steps for saga %s: %v", sagaID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := []model.SagaStep{}
+	for rows.Next() {
+		step := model.SagaStep{SagaID: sagaID}
+		if err := rows.Scan(&step.ID, &step.Sequence, &step.Action, &step.Reference, &step.Status, &step.CreatedAt, &step.UpdatedAt); err != nil {
+			log.Printf("Error scanning saga step: %v", err)
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Error after iterating saga step rows: %v", err)
+		return nil, err
+	}
+	return steps, nil
+}
+
+func insertStep(ctx context.Context, db execer, sagaID string, step *model.SagaStep, now time.Time) error {
+	step.ID = uuid.New().String()
+	step.SagaID = sagaID
+	if step.Status == "" {
+		step.Status = model.SagaStepPending
+	}
+	step.CreatedAt = now
+	step.UpdatedAt = now
+
+	query := `INSERT INTO order_saga_steps (id, saga_id, sequence, action, reference, status, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := db.ExecContext(ctx, query,
+		step.ID, step.SagaID, step.Sequence, step.Action, step.Reference, step.Status, step.CreatedAt, step.UpdatedAt,
+	)
+	return err
+}
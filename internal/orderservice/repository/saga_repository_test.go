@@ -0,0 +1,168 @@
+// internal/orderservice/repository/saga_repository_test.go
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"microservices-project/internal/orderservice/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockDBAndSagaRepo(t *testing.T) (sqlmock.Sqlmock, *SagaRepository) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return mock, NewSagaRepository(db)
+}
+
+func TestSagaRepository_CreateSaga_NumbersInitialSteps(t *testing.T) {
+	mock, repo := newMockDBAndSagaRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO order_sagas`).
+		WithArgs(sqlmock.AnyArg(), "order-1", "user-1", model.SagaStatusStarted, "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO order_saga_steps`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 0, model.SagaActionReserveStock, "", model.SagaStepPending, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	saga, err := repo.CreateSaga(context.Background(), &model.Saga{
+		OrderID: "order-1",
+		UserID:  "user-1",
+		Steps:   []model.SagaStep{{Action: model.SagaActionReserveStock}},
+	})
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, saga.ID)
+	assert.Equal(t, saga.ID, saga.Steps[0].SagaID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_AddStep_NumbersAfterExistingSteps(t *testing.T) {
+	mock, repo := newMockDBAndSagaRepo(t)
+
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(sequence\) \+ 1, 0\) FROM order_saga_steps WHERE saga_id = \$1`).
+		WithArgs("saga-1").
+		WillReturnRows(sqlmock.NewRows([]string{"next"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO order_saga_steps`).
+		WithArgs(sqlmock.AnyArg(), "saga-1", 1, model.SagaActionCreateOrder, "order-1", model.SagaStepApplied, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	step := &model.SagaStep{Action: model.SagaActionCreateOrder, Reference: "order-1", Status: model.SagaStepApplied}
+	err := repo.AddStep(context.Background(), "saga-1", step)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, step.Sequence)
+	assert.NotEmpty(t, step.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_ApplyStep_RecordsReference(t *testing.T) {
+	mock, repo := newMockDBAndSagaRepo(t)
+
+	mock.ExpectExec(`UPDATE order_saga_steps SET status = \$1, reference = \$2, updated_at = \$3 WHERE id = \$4`).
+		WithArgs(model.SagaStepApplied, "res-1", sqlmock.AnyArg(), "step-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.ApplyStep(context.Background(), "step-1", "res-1")
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_UpdateStepStatus(t *testing.T) {
+	mock, repo := newMockDBAndSagaRepo(t)
+
+	mock.ExpectExec(`UPDATE order_saga_steps SET status = \$1, updated_at = \$2 WHERE id = \$3`).
+		WithArgs(model.SagaStepCompensated, sqlmock.AnyArg(), "step-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.UpdateStepStatus(context.Background(), "step-1", model.SagaStepCompensated)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_UpdateSagaStatus_NotFound(t *testing.T) {
+	mock, repo := newMockDBAndSagaRepo(t)
+
+	mock.ExpectExec(`UPDATE order_sagas SET status = \$1, last_error = \$2, updated_at = \$3 WHERE id = \$4`).
+		WithArgs(model.SagaStatusCompensated, "boom", sqlmock.AnyArg(), "saga-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.UpdateSagaStatus(context.Background(), "saga-1", model.SagaStatusCompensated, "boom")
+
+	assert.ErrorIs(t, err, ErrSagaNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_GetSagaByOrderID_NotFound(t *testing.T) {
+	mock, repo := newMockDBAndSagaRepo(t)
+
+	mock.ExpectQuery(`SELECT (.+) FROM order_sagas WHERE order_id = \$1`).
+		WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "user_id", "status", "last_error", "created_at", "updated_at"}))
+
+	_, err := repo.GetSagaByOrderID(context.Background(), "order-1")
+
+	assert.ErrorIs(t, err, ErrSagaNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_ListUnfinishedSagas_LoadsSteps(t *testing.T) {
+	mock, repo := newMockDBAndSagaRepo(t)
+
+	now := time.Now()
+	cutoff := now.Add(-time.Minute)
+	mock.ExpectQuery(`SELECT (.+) FROM order_sagas WHERE status IN \(\$1, \$2\) AND updated_at < \$3`).
+		WithArgs(model.SagaStatusStarted, model.SagaStatusCompensating, cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "user_id", "status", "last_error", "created_at", "updated_at"}).
+			AddRow("saga-1", "order-1", "user-1", model.SagaStatusStarted, "", now, now))
+	mock.ExpectQuery(`SELECT (.+) FROM order_saga_steps WHERE saga_id = \$1 ORDER BY sequence ASC`).
+		WithArgs("saga-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sequence", "action", "reference", "status", "created_at", "updated_at"}).
+			AddRow("step-1", 0, model.SagaActionReserveStock, "res-1", model.SagaStepApplied, now, now).
+			AddRow("step-2", 1, model.SagaActionCreateOrder, "", model.SagaStepPending, now, now))
+
+	sagas, err := repo.ListUnfinishedSagas(context.Background(), cutoff)
+
+	require.NoError(t, err)
+	require.Len(t, sagas, 1)
+	require.Len(t, sagas[0].Steps, 2)
+	assert.Equal(t, "res-1", sagas[0].Steps[0].Reference)
+	assert.Equal(t, "saga-1", sagas[0].Steps[1].SagaID)
+	assert.Equal(t, model.SagaStepPending, sagas[0].Steps[1].Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_ClaimSaga(t *testing.T) {
+	cutoff := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name         string
+		rowsAffected int64
+		want         bool
+	}{
+		{name: "stale saga is claimed", rowsAffected: 1, want: true},
+		{name: "saga touched since is left to its owner", rowsAffected: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, repo := newMockDBAndSagaRepo(t)
+			mock.ExpectExec(`UPDATE order_sagas SET updated_at = \$1 WHERE id = \$2 AND updated_at < \$3`).
+				WithArgs(sqlmock.AnyArg(), "saga-1", cutoff).
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+
+			claimed, err := repo.ClaimSaga(context.Background(), "saga-1", cutoff)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, claimed)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
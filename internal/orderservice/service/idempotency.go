@@ -0,0 +1,147 @@
+// internal/orderservice/service/idempotency.go
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/orderservice/model"
+	"microservices-project/internal/orderservice/repository"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultIdempotencyRetention is how long a CreateOrder idempotency key is remembered.
+	DefaultIdempotencyRetention = 24 * time.Hour
+
+	maxIdempotencyKeyLength = 255
+
+	// idempotencyLockTimeout is how long an unfinished key blocks retries. After that the
+	// original request is assumed dead, and saga recovery will have released its stock.
+	idempotencyLockTimeout = 5 * time.Minute
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// createOrderIdempotent claims the key before doing any work. The key carries the order ID
+// the saga will use, so a retry can always find the order the first attempt created.
+func (s *OrderService) createOrderIdempotent(ctx context.Context, userID string, items []model.OrderItem, shippingAddressID, key string) (*model.Order, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, fmt.Errorf("%w: idempotency key must be at most %d characters", ErrInvalidOrderData, maxIdempotencyKeyLength)
+	}
+
+	now := time.Now()
+	claim := &model.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: orderFingerprint(userID, items, shippingAddressID),
+		OrderID:     uuid.New().String(),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.idempotencyRetention),
+	}
+	existing, claimed, err := s.idempotencyRepo.ClaimKey(ctx, claim)
+	if err != nil {
+		log.Printf("Error claiming idempotency key for user %s: %v", userID, err)
+		return nil, fmt.Errorf("failed to record idempotency key: %w", err)
+	}
+
+	if !claimed {
+		order, err := s.replayOrder(ctx, existing, claim)
+		if err != nil || order != nil {
+			return order, err
+		}
+		// The first attempt died without creating an order; take the key over under a new order ID
+		// so nothing the dead attempt left behind can ever be mistaken for ours.
+		ok, err := s.idempotencyRepo.ReclaimKey(ctx, userID, key, existing.OrderID, claim.OrderID, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reclaim idempotency key: %w", err)
+		}
+		if !ok {
+			return nil, ErrIdempotencyKeyInProgress // Another retry got there first
+		}
+		log.Printf("Reclaimed abandoned idempotency key for user %s (order %s -> %s)", userID, existing.OrderID, claim.OrderID)
+	}
+
+	order, err := s.createOrder(ctx, userID, items, shippingAddressID, claim.OrderID)
+	if err != nil {
+		if errors.Is(err, ErrCompensationFailed) {
+			// The order may still be there until saga recovery cancels it, so keep the claim: once
+			// idempotencyLockTimeout passes, a retry gets that order back or reclaims the key.
+			return nil, err
+		}
+		// Nothing is left of the attempt, so let the client retry with the same key
+		if releaseErr := s.idempotencyRepo.ReleaseKey(context.WithoutCancel(ctx), userID, key, claim.OrderID); releaseErr != nil {
+			log.Printf("Error releasing idempotency key for user %s: %v", userID, releaseErr)
+		}
+		return nil, err
+	}
+
+	if err := s.idempotencyRepo.CompleteKey(ctx, userID, key, claim.OrderID); err != nil {
+		// A retry will still find the order by ID once the lock timeout passes
+		log.Printf("Error completing idempotency key for order %s: %v", order.ID, err)
+	}
+	return order, nil
+}
+
+// replayOrder decides what to do with a key that is already held. It returns the original
+// order, an error, or (nil, nil) if the key was abandoned and may be reclaimed.
+func (s *OrderService) replayOrder(ctx context.Context, existing, claim *model.IdempotencyKey) (*model.Order, error) {
+	if existing.Fingerprint != claim.Fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	stale := claim.CreatedAt.Sub(existing.CreatedAt) >= idempotencyLockTimeout
+	if existing.CompletedAt == nil && !stale {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	order, err := s.repo.GetOrderByID(ctx, existing.OrderID)
+	if err == nil {
+		log.Printf("Returning order %s for repeated idempotency key", order.ID)
+		return order, nil
+	}
+	if !errors.Is(err, repository.ErrOrderNotFound) || existing.CompletedAt != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes keys whose retention window has passed.
+func (s *OrderService) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return s.idempotencyRepo.DeleteExpiredKeys(ctx, time.Now())
+}
+
+// orderFingerprint hashes the parts of a CreateOrder request that determine the order.
+// Product IDs are canonicalised and items sorted first, so a retry that spells an ID in
+// another case or lists the items in another order is not treated as a different request.
+func orderFingerprint(userID string, items []model.OrderItem, shippingAddressID string) string {
+	sorted := make([]model.OrderItem, len(items))
+	for i, item := range items {
+		sorted[i] = model.OrderItem{ProductID: canonicalProductID(item.ProductID), Quantity: item.Quantity}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ProductID != sorted[j].ProductID {
+			return sorted[i].ProductID < sorted[j].ProductID
+		}
+		return sorted[i].Quantity < sorted[j].Quantity
+	})
+
+	h := sha256.New()
+	fmt.Fprintf(h, "user:%s\n", userID)
+	for _, item := range sorted {
+		fmt.Fprintf(h, "item:%s:%d\n", item.ProductID, item.Quantity)
+	}
+	if shippingAddressID != "" { // Left out otherwise, so keys stored before addresses existed still match
+		fmt.Fprintf(h, "shipping:%s\n", shippingAddressID)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
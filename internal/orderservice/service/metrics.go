@@ -0,0 +1,37 @@
+// internal/orderservice/service/metrics.go
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/status"
+)
+
+// Stock update operations, for the operation label of stock update failures.
+const (
+	stockOpReserve = "reserve" // Holding stock for a new order
+	stockOpCommit  = "commit"  // Turning the hold into a deduction
+	stockOpRestock = "restock" // Returning the stock of a cancelled order
+)
+
+var (
+	ordersCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders created, by the status they were created with.",
+	}, []string{"status"})
+	// Every ErrProductStockUpdateFailed is counted here; alert on its rate.
+	stockUpdateFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "order_stock_update_failures_total",
+		Help: "Failed ProductService stock updates, by operation and reason (the gRPC status code).",
+	}, []string{"operation", "reason"})
+)
+
+// stockUpdateFailed counts a failed stock update. err is the ProductService's error, or nil
+// if the update couldn't even be attempted.
+func stockUpdateFailed(operation string, err error) {
+	reason := "NotAttempted"
+	if err != nil {
+		reason = status.Code(err).String()
+	}
+	stockUpdateFailures.WithLabelValues(operation, reason).Inc()
+}
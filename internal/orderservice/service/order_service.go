@@ -8,9 +8,11 @@ import (
 	"log"
 	"microservices-project/internal/orderservice/model"
 	"microservices-project/internal/orderservice/repository"
+	"microservices-project/pkg/pagination"
 	productpb "microservices-project/protos/productpb" // Product service proto
 	userpb "microservices-project/protos/userpb"       // User service proto
-	"sync"                                              // For concurrent product fetches
+	"strings"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -20,177 +22,257 @@ var (
 	ErrOrderNotFound         = repository.ErrOrderNotFound
 	ErrInvalidOrderData      = errors.New("invalid order data")
 	ErrUserValidationFailed  = errors.New("user validation failed")
+	ErrEmailNotVerified      = errors.New("email address must be verified before placing orders")
+	// ErrShippingAddressNotFound covers addresses that don't exist and ones of other users alike
+	ErrShippingAddressNotFound = fmt.Errorf("%w: shipping address not found in the user's address book", ErrInvalidOrderData)
 	ErrProductFetchFailed    = errors.New("failed to fetch product details")
 	ErrProductStockUpdateFailed = errors.New("failed to update product stock")
 	ErrInsufficientStockForOrder = errors.New("insufficient stock for one or more items in the order")
+	ErrInvalidOrderStatus        = errors.New("invalid order status")
+	ErrInvalidStatusTransition   = errors.New("invalid order status transition")
+	ErrOrderNotSettled           = errors.New("order is still being created")
+	ErrInvalidPageToken          = pagination.ErrInvalidPageToken
 )
 
 type OrderServiceInterface interface {
-	CreateOrder(ctx context.Context, userID string, items []model.OrderItem) (*model.Order, error)
+	// CreateOrder ships to shippingAddressID from the user's address book, if it is set.
+	CreateOrder(ctx context.Context, userID string, items []model.OrderItem, shippingAddressID, idempotencyKey string) (*model.Order, error)
 	GetOrderByID(ctx context.Context, id string) (*model.Order, error)
 	ListUserOrders(ctx context.Context, userID string, page, pageSize int) ([]*model.Order, error)
+	// ListUserOrdersPage pages with opaque tokens; nextPageToken is empty on the last page.
+	ListUserOrdersPage(ctx context.Context, userID, pageToken string, pageSize int) (orders []*model.Order, nextPageToken string, err error)
+	UpdateOrderStatus(ctx context.Context, orderID string, newStatus model.OrderStatus) (*model.Order, error)
+	CancelOrder(ctx context.Context, orderID string) (*model.Order, error)
+	WatchOrder(ctx context.Context, orderID string, send func(*model.Order) error) error
+	ExportUserOrders(ctx context.Context, userID string) ([]*model.Order, error)
+	EraseUserOrders(ctx context.Context, userID, pseudonym string) (int64, error)
 }
 
 type OrderService struct {
 	repo                repository.OrderRepositoryInterface
+	sagaRepo            repository.SagaRepositoryInterface
+	idempotencyRepo     repository.IdempotencyRepositoryInterface
+	idempotencyRetention time.Duration // How long a CreateOrder idempotency key is remembered
 	userServiceClient   userpb.UserServiceClient     // gRPC client for UserService
 	productServiceClient productpb.ProductServiceClient // gRPC client for ProductService
+	watchers            *orderWatchers // Live WatchOrder streams on this replica
+	watchPollInterval   time.Duration
+	pageTokens          *pagination.TokenCodec
+	requireVerifiedEmail bool // Refuse orders from users who haven't verified their email
 }
 
 func NewOrderService(
 	repo repository.OrderRepositoryInterface,
+	sagaRepo repository.SagaRepositoryInterface,
+	idempotencyRepo repository.IdempotencyRepositoryInterface,
 	userClient userpb.UserServiceClient,
 	productClient productpb.ProductServiceClient,
+	idempotencyRetention time.Duration,
+	pageTokens *pagination.TokenCodec,
+	requireVerifiedEmail bool,
 ) *OrderService {
+	if idempotencyRetention <= 0 {
+		idempotencyRetention = DefaultIdempotencyRetention
+	}
 	return &OrderService{
 		repo:                repo,
+		sagaRepo:            sagaRepo,
+		idempotencyRepo:     idempotencyRepo,
+		idempotencyRetention: idempotencyRetention,
 		userServiceClient:   userClient,
 		productServiceClient: productClient,
+		watchers:            newOrderWatchers(),
+		watchPollInterval:   defaultWatchPollInterval,
+		pageTokens:          pageTokens,
+		requireVerifiedEmail: requireVerifiedEmail,
 	}
 }
 
-func (s *OrderService) CreateOrder(ctx context.Context, userID string, requestedItems []model.OrderItem) (*model.Order, error) {
+// CreateOrder creates an order. If idempotencyKey is set, a retry with the same key and
+// the same items returns the original order instead of creating another one. If
+// shippingAddressID is set, the address is copied into the order, so later changes to the
+// address book don't change it.
+func (s *OrderService) CreateOrder(ctx context.Context, userID string, requestedItems []model.OrderItem, shippingAddressID, idempotencyKey string) (*model.Order, error) {
 	if userID == "" || len(requestedItems) == 0 {
 		return nil, ErrInvalidOrderData
 	}
+	if idempotencyKey != "" {
+		return s.createOrderIdempotent(ctx, userID, requestedItems, shippingAddressID, idempotencyKey)
+	}
+	return s.createOrder(ctx, userID, requestedItems, shippingAddressID, "")
+}
+
+// createOrder runs the CreateOrder flow. orderID may be pre-assigned (by an idempotency key)
+// or left empty to have the saga generate one.
+func (s *OrderService) createOrder(ctx context.Context, userID string, requestedItems []model.OrderItem, shippingAddressID, orderID string) (*model.Order, error) {
+
+	// 1. Fetch product details in one round trip, check stock, and calculate total amount
+	productQuantities := make(map[string]int32) // productID -> quantity to reserve
+	productIDs := []string{}
+	for _, item := range requestedItems {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity for product %s must be positive", ErrInvalidOrderData, item.ProductID)
+		}
+		productID := canonicalProductID(item.ProductID)
+		if _, ok := productQuantities[productID]; !ok {
+			productIDs = append(productIDs, productID)
+		}
+		productQuantities[productID] += item.Quantity
+	}
 
-	// 1. Validate User
-	_, err := s.userServiceClient.GetUser(ctx, &userpb.GetUserRequest{UserId: userID})
+	productsResp, err := s.productServiceClient.BatchGetProducts(ctx, &productpb.BatchGetProductsRequest{ProductIds: productIDs})
+	if err != nil {
+		log.Printf("Error fetching %d product(s): %v", len(productIDs), err)
+		return nil, fmt.Errorf("%w: %v", ErrProductFetchFailed, err)
+	}
+	if missing := productsResp.GetMissingProductIds(); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: product(s) not found: %s", ErrProductFetchFailed, strings.Join(missing, ", "))
+	}
+
+	products := make(map[string]*productpb.Product, len(productsResp.GetProducts()))
+	for _, product := range productsResp.GetProducts() {
+		log.Printf("Fetched product %s: Price=%.2f, Stock=%d, Available=%d", product.Id, product.Price, product.StockQuantity, product.AvailableQuantity)
+		products[product.Id] = product
+	}
+
+	// Check Stock (early exit only; ReserveStock re-checks atomically). Quantities are summed
+	// per product, so the same product on two lines can't slip past the check.
+	var shortages []string
+	for _, productID := range productIDs {
+		product, ok := products[productID]
+		if !ok {
+			return nil, fmt.Errorf("%w: product %s missing from response", ErrProductFetchFailed, productID)
+		}
+		if product.AvailableQuantity < productQuantities[productID] {
+			log.Printf("Insufficient stock for product %s: requested %d, available %d", product.Id, productQuantities[productID], product.AvailableQuantity)
+			shortages = append(shortages, fmt.Sprintf("product %s (requested %d, available %d)", product.Id, productQuantities[productID], product.AvailableQuantity))
+		}
+	}
+	if len(shortages) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInsufficientStockForOrder, strings.Join(shortages, "; "))
+	}
+
+	var totalAmount float64
+	processedItems := make([]model.OrderItem, 0, len(requestedItems))
+	for _, item := range requestedItems {
+		product := products[canonicalProductID(item.ProductID)]
+		totalAmount += product.Price * float64(item.Quantity)
+		processedItems = append(processedItems, model.OrderItem{
+			ProductID:       product.Id,
+			Quantity:        item.Quantity,
+			PriceAtPurchase: product.Price,
+		})
+	}
+
+	// 2. Reserve stock through a saga. Every completed step is recorded with its compensating
+	// action, so any failure from here on releases the reservation and cancels the order.
+	saga, err := startOrderSaga(ctx, s.sagaRepo, s.repo, s.productServiceClient, userID, orderID)
+	if err != nil {
+		log.Printf("Error starting order saga: %v", err)
+		return nil, err
+	}
+
+	if err := saga.reserveStock(ctx, productQuantities); err != nil {
+		return nil, s.abortOrderSaga(ctx, saga, err)
+	}
+
+	// 3. Validate User while the stock is held
+	userResp, err := s.userServiceClient.GetUser(ctx, &userpb.GetUserRequest{UserId: userID})
 	if err != nil {
 		log.Printf("Error validating user %s: %v", userID, err)
 		// Check gRPC status code
 		st, ok := status.FromError(err)
 		if ok && st.Code() == codes.NotFound {
-			return nil, fmt.Errorf("%w: user %s not found", ErrUserValidationFailed, userID)
+			return nil, s.abortOrderSaga(ctx, saga, fmt.Errorf("%w: user %s not found", ErrUserValidationFailed, userID))
 		}
-		return nil, fmt.Errorf("%w: %v", ErrUserValidationFailed, err)
+		return nil, s.abortOrderSaga(ctx, saga, fmt.Errorf("%w: %v", ErrUserValidationFailed, err))
+	}
+	if s.requireVerifiedEmail && userResp.GetUser().GetEmailVerifiedAt() == nil {
+		return nil, s.abortOrderSaga(ctx, saga, ErrEmailNotVerified)
 	}
 	log.Printf("User %s validated successfully.", userID)
 
-
-	// 2. Fetch product details, check stock, and calculate total amount concurrently
-	var totalAmount float64
-	var processedItems []model.OrderItem
-	var wg sync.WaitGroup
-	mu := sync.Mutex{} // To protect shared variables (totalAmount, processedItems, and any error flags)
-	var firstError error // To capture the first error encountered in goroutines
-
-	productStockUpdates := make(map[string]int32) // productID -> quantity to deduct
-
-	for _, item := range requestedItems {
-		if item.Quantity <= 0 {
-			return nil, fmt.Errorf("%w: quantity for product %s must be positive", ErrInvalidOrderData, item.ProductID)
-		}
-		wg.Add(1)
-		go func(currentItem model.OrderItem) {
-			defer wg.Done()
-
-			// Check if an error already occurred in another goroutine
-			mu.Lock()
-			if firstError != nil {
-				mu.Unlock()
-				return
-			}
-			mu.Unlock()
-
-			// Get Product Details
-			productResp, err := s.productServiceClient.GetProduct(ctx, &productpb.GetProductRequest{ProductId: currentItem.ProductID})
-			if err != nil {
-				log.Printf("Error fetching product %s: %v", currentItem.ProductID, err)
-				mu.Lock()
-				if firstError == nil {
-					st, ok := status.FromError(err)
-					if ok && st.Code() == codes.NotFound {
-						firstError = fmt.Errorf("%w: product %s not found", ErrProductFetchFailed, currentItem.ProductID)
-					} else {
-						firstError = fmt.Errorf("%w: %v", ErrProductFetchFailed, err)
-					}
-				}
-				mu.Unlock()
-				return
-			}
-			product := productResp.GetProduct()
-			log.Printf("Fetched product %s: Price=%.2f, Stock=%d", product.Id, product.Price, product.StockQuantity)
-
-			// Check Stock
-			if product.StockQuantity < currentItem.Quantity {
-				log.Printf("Insufficient stock for product %s: requested %d, available %d", product.Id, currentItem.Quantity, product.StockQuantity)
-				mu.Lock()
-				if firstError == nil {
-					firstError = fmt.Errorf("%w: product %s (requested %d, available %d)", ErrInsufficientStockForOrder, product.Id, currentItem.Quantity, product.StockQuantity)
-				}
-				mu.Unlock()
-				return
-			}
-
-			mu.Lock()
-			totalAmount += product.Price * float64(currentItem.Quantity)
-			processedItems = append(processedItems, model.OrderItem{
-				ProductID:       product.Id,
-				Quantity:        currentItem.Quantity,
-				PriceAtPurchase: product.Price,
-			})
-			productStockUpdates[product.Id] -= currentItem.Quantity // Negative for deduction
-			mu.Unlock()
-
-		}(item)
-	}
-	wg.Wait()
-
-	if firstError != nil {
-		return nil, firstError
-	}
-
-	if len(processedItems) != len(requestedItems) {
-		// This case should ideally be caught by firstError, but as a safeguard
-		return nil, errors.New("failed to process all items in the order")
-	}
-
-	// 3. (Important) Update stock for all products in a "transactional" manner (best effort here)
-	// In a real system, you might use a Saga pattern or a distributed transaction coordinator
-	// For this project, we'll update stock one by one. If one fails, we should ideally roll back previous stock updates.
-	// The ProductRepository's UpdateStock now uses a DB transaction for a single product.
-	var updatedProducts []*productpb.Product
-	for prodID, qtyChange := range productStockUpdates {
-		updateStockReq := &productpb.UpdateStockRequest{
-			ProductId: prodID,
-			QuantityChange: qtyChange,
-		}
-		log.Printf("Attempting to update stock for product %s by %d", prodID, qtyChange)
-		resp, err := s.productServiceClient.UpdateStock(ctx, updateStockReq)
-		if err != nil {
-			log.Printf("Failed to update stock for product %s: %v", prodID, err)
-			// Attempt to revert previous stock updates (complex, requires careful implementation)
-			// For now, we'll just return an error.
-			// This is a critical point for data consistency in microservices.
-			// For now, let's just log and potentially mark the order as "NEEDS_ATTENTION" or similar.
-			return nil, fmt.Errorf("%w for product %s: %v. Order creation aborted. Manual stock correction might be needed.", ErrProductStockUpdateFailed, prodID, err)
+	var shippingAddress *model.ShippingAddress
+	if shippingAddressID != "" {
+		if shippingAddress, err = s.fetchShippingAddress(ctx, userID, shippingAddressID); err != nil {
+			return nil, s.abortOrderSaga(ctx, saga, err)
 		}
-		log.Printf("Stock updated successfully for product %s. New stock: %d", prodID, resp.GetProduct().GetStockQuantity())
-		updatedProducts = append(updatedProducts, resp.GetProduct())
 	}
 
-
 	// 4. Create Order in DB
 	order := &model.Order{
-		UserID:      userID,
-		Items:       processedItems,
-		TotalAmount: totalAmount,
-		Status:      model.StatusPending, // Or model.StatusProcessing if payment is next
+		UserID:          userID,
+		Items:           processedItems,
+		TotalAmount:     totalAmount,
+		Status:          model.StatusPending, // Or model.StatusProcessing if payment is next
+		ShippingAddress: shippingAddress,
 	}
 
-	createdOrder, err := s.repo.CreateOrder(ctx, order)
+	createdOrder, err := saga.createOrder(ctx, order)
 	if err != nil {
 		log.Printf("Error creating order in repository: %v", err)
-		// If order creation fails after stock update, this is also a point of inconsistency.
-		// A compensating transaction (Saga) would add stock back.
-		return nil, err
+		return nil, s.abortOrderSaga(ctx, saga, err)
+	}
+
+	// 5. Commit the reservation, turning held stock into a real deduction
+	if err := saga.commit(ctx); err != nil {
+		if err := s.abortOrderSaga(ctx, saga, err); !errors.Is(err, errOrderKept) {
+			return nil, err
+		}
+		// The commit went through; only its response was lost
 	}
 
 	log.Printf("Order %s created successfully for user %s.", createdOrder.ID, userID)
+	ordersCreated.WithLabelValues(string(createdOrder.Status)).Inc()
 	return createdOrder, nil
 }
 
+// canonicalProductID is the form ProductService hands product IDs back in: it matches UUIDs
+// case-insensitively but always returns them lower-case.
+func canonicalProductID(productID string) string {
+	return strings.ToLower(productID)
+}
+
+// fetchShippingAddress looks addressID up in the user's address book and copies it. Only
+// the user's own addresses are listed, so another user's address ID is simply not found.
+func (s *OrderService) fetchShippingAddress(ctx context.Context, userID, addressID string) (*model.ShippingAddress, error) {
+	resp, err := s.userServiceClient.ListAddresses(ctx, &userpb.ListAddressesRequest{UserId: userID})
+	if err != nil {
+		log.Printf("Error fetching addresses of user %s: %v", userID, err)
+		return nil, fmt.Errorf("%w: failed to fetch shipping address: %v", ErrUserValidationFailed, err)
+	}
+	for _, addr := range resp.GetAddresses() {
+		if addr.Id == addressID {
+			return &model.ShippingAddress{
+				AddressID:     addr.Id,
+				RecipientName: addr.RecipientName,
+				Line1:         addr.Line1,
+				Line2:         addr.Line2,
+				City:          addr.City,
+				Region:        addr.Region,
+				PostalCode:    addr.PostalCode,
+				CountryCode:   addr.CountryCode,
+				Phone:         addr.Phone,
+			}, nil
+		}
+	}
+	return nil, ErrShippingAddressNotFound
+}
+
+// abortOrderSaga compensates the saga and returns the error to hand back to the caller.
+// The original cause is always preserved; a failed compensation is appended to it. If the
+// reservation turns out to be committed, it returns errOrderKept: the order stands.
+func (s *OrderService) abortOrderSaga(ctx context.Context, saga *orderSaga, cause error) error {
+	if err := saga.compensate(ctx, cause); err != nil {
+		if errors.Is(err, errOrderKept) {
+			return err
+		}
+		log.Printf("Order saga %s left for recovery: %v", saga.saga.ID, err)
+		return fmt.Errorf("%w. Order creation aborted; saga recovery will finish releasing stock: %w", cause, err)
+	}
+	return fmt.Errorf("%w. Order creation aborted and reserved stock released", cause)
+}
+
 
 func (s *OrderService) GetOrderByID(ctx context.Context, id string) (*model.Order, error) {
 	if id == "" {
@@ -211,4 +293,142 @@ func (s *OrderService) ListUserOrders(ctx context.Context, userID string, page,
 	}
 	offset := (page - 1) * pageSize
 	return s.repo.ListOrdersByUserID(ctx, userID, pageSize, offset)
+}
+
+func (s *OrderService) ListUserOrdersPage(ctx context.Context, userID, pageToken string, pageSize int) ([]*model.Order, string, error) {
+	if userID == "" {
+		return nil, "", ErrInvalidOrderData
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+	scope := "orders:" + userID // A token for one user's orders is useless for anyone else's
+	var after *pagination.Cursor
+	if pageToken != "" {
+		cursor, err := s.pageTokens.Decode(scope, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = cursor
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	orders, err := s.repo.ListOrdersByUserIDAfter(ctx, userID, after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(orders) <= pageSize {
+		return orders, "", nil
+	}
+	orders = orders[:pageSize]
+	last := orders[len(orders)-1]
+	return orders, s.pageTokens.Encode(scope, pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}), nil
+}
+
+// UpdateOrderStatus moves an order to newStatus if the transition is allowed.
+// Moving to CANCELLED goes through CancelOrder so the stock is returned.
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID string, newStatus model.OrderStatus) (*model.Order, error) {
+	if orderID == "" {
+		return nil, ErrInvalidOrderData
+	}
+	if !newStatus.IsValid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidOrderStatus, newStatus)
+	}
+	if newStatus == model.StatusCancelled {
+		return s.CancelOrder(ctx, orderID)
+	}
+
+	order, err := s.repo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return s.transitionOrder(ctx, order, newStatus)
+}
+
+// CancelOrder cancels a PENDING or PROCESSING order and returns its items to stock.
+func (s *OrderService) CancelOrder(ctx context.Context, orderID string) (*model.Order, error) {
+	if orderID == "" {
+		return nil, ErrInvalidOrderData
+	}
+	order, err := s.repo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOrderSettled(ctx, order.ID); err != nil {
+		return nil, err
+	}
+
+	// Flip the status first: the conditional update guarantees only one caller gets to restock.
+	cancelled, err := s.transitionOrder(ctx, order, model.StatusCancelled)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := restockItems(ctx, s.productServiceClient, order.Items); err != nil {
+		// Put the order back as it was so the cancellation can be retried
+		if _, revertErr := s.repo.TransitionOrderStatus(ctx, order.ID, model.StatusCancelled, order.Status); revertErr != nil {
+			log.Printf("Error reverting order %s to %s after failed restock: %v", order.ID, order.Status, revertErr)
+		}
+		return nil, err
+	}
+
+	log.Printf("Order %s cancelled and %d item(s) returned to stock.", order.ID, len(order.Items))
+	return cancelled, nil
+}
+
+// checkOrderSettled refuses orders whose CreateOrder saga has not completed. Until then
+// the reservation may not have been committed, so restocking would add stock that was
+// never taken; the saga itself cancels the order if it has to. Orders from before sagas
+// were introduced have none, and had their stock deducted directly.
+func (s *OrderService) checkOrderSettled(ctx context.Context, orderID string) error {
+	saga, err := s.sagaRepo.GetSagaByOrderID(ctx, orderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSagaNotFound) {
+			return nil
+		}
+		log.Printf("Error fetching saga of order %s: %v", orderID, err)
+		return err
+	}
+	if saga.Status != model.SagaStatusCompleted {
+		return fmt.Errorf("%w: saga %s of order %s is %s", ErrOrderNotSettled, saga.ID, orderID, saga.Status)
+	}
+	return nil
+}
+
+// transitionOrder checks the state machine and applies the change only if the order
+// is still in the status we validated against.
+func (s *OrderService) transitionOrder(ctx context.Context, order *model.Order, next model.OrderStatus) (*model.Order, error) {
+	if !order.Status.CanTransitionTo(next) {
+		return nil, fmt.Errorf("%w: cannot move order %s from %s to %s", ErrInvalidStatusTransition, order.ID, order.Status, next)
+	}
+
+	updated, err := s.repo.TransitionOrderStatus(ctx, order.ID, order.Status, next)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrderStatusConflict) {
+			return nil, fmt.Errorf("%w: order %s is no longer %s", ErrInvalidStatusTransition, order.ID, order.Status)
+		}
+		log.Printf("Error updating status of order %s: %v", order.ID, err)
+		return nil, err
+	}
+	updated.Items = order.Items
+	return updated, nil
+}
+
+// restockItems adds the ordered quantities back to stock in a single BatchUpdateStock call,
+// so either every product is restocked or none is and the caller can safely retry.
+func restockItems(ctx context.Context, productClient productpb.ProductServiceClient, items []model.OrderItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	updates := make([]*productpb.UpdateStockRequest, len(items))
+	for i, item := range items {
+		updates[i] = &productpb.UpdateStockRequest{ProductId: item.ProductID, QuantityChange: item.Quantity}
+	}
+
+	if _, err := productClient.BatchUpdateStock(ctx, &productpb.BatchUpdateStockRequest{Updates: updates}); err != nil {
+		log.Printf("Error restocking %d item(s): %v", len(items), err)
+		stockUpdateFailed(stockOpRestock, err)
+		return fmt.Errorf("%w: %v", ErrProductStockUpdateFailed, err)
+	}
+	return nil
 }
\ No newline at end of file
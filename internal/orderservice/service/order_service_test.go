@@ -0,0 +1,1001 @@
+// internal/orderservice/service/order_service_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"microservices-project/internal/orderservice/model"
+	"microservices-project/internal/orderservice/repository"
+	"microservices-project/pkg/pagination"
+	productpb "microservices-project/protos/productpb"
+	userpb "microservices-project/protos/userpb"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MockOrderRepository is a mock type for the OrderRepositoryInterface
+type MockOrderRepository struct {
+	mock.Mock
+}
+
+func (m *MockOrderRepository) CreateOrder(ctx context.Context, order *model.Order) (*model.Order, error) {
+	args := m.Called(ctx, order)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) GetOrderByID(ctx context.Context, id string) (*model.Order, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) ListOrdersByUserID(ctx context.Context, userID string, limit int, offset int) ([]*model.Order, error) {
+	args := m.Called(ctx, userID, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) ListOrdersByUserIDAfter(ctx context.Context, userID string, after *pagination.Cursor, limit int) ([]*model.Order, error) {
+	args := m.Called(ctx, userID, after, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) UpdateOrderStatus(ctx context.Context, orderID string, status model.OrderStatus) (*model.Order, error) {
+	args := m.Called(ctx, orderID, status)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) TransitionOrderStatus(ctx context.Context, orderID string, from, to model.OrderStatus) (*model.Order, error) {
+	args := m.Called(ctx, orderID, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) ListAllOrdersByUserID(ctx context.Context, userID string) ([]*model.Order, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) PseudonymiseUserOrders(ctx context.Context, userID, pseudonym string) (int64, error) {
+	args := m.Called(ctx, userID, pseudonym)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// MockSagaRepository is a mock type for the SagaRepositoryInterface
+type MockSagaRepository struct {
+	mock.Mock
+}
+
+func (m *MockSagaRepository) CreateSaga(ctx context.Context, saga *model.Saga) (*model.Saga, error) {
+	args := m.Called(ctx, saga)
+	if args.Get(0) == nil {
+		if args.Error(1) == nil {
+			return saga, nil // Echo the saga back, as the real repository does
+		}
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Saga), args.Error(1)
+}
+
+func (m *MockSagaRepository) AddStep(ctx context.Context, sagaID string, step *model.SagaStep) error {
+	return m.Called(ctx, sagaID, step).Error(0)
+}
+
+func (m *MockSagaRepository) UpdateSagaStatus(ctx context.Context, sagaID string, status model.SagaStatus, lastError string) error {
+	return m.Called(ctx, sagaID, status, lastError).Error(0)
+}
+
+func (m *MockSagaRepository) UpdateStepStatus(ctx context.Context, stepID string, status model.SagaStepStatus) error {
+	return m.Called(ctx, stepID, status).Error(0)
+}
+
+func (m *MockSagaRepository) ApplyStep(ctx context.Context, stepID, reference string) error {
+	return m.Called(ctx, stepID, reference).Error(0)
+}
+
+func (m *MockSagaRepository) GetSagaByOrderID(ctx context.Context, orderID string) (*model.Saga, error) {
+	args := m.Called(ctx, orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Saga), args.Error(1)
+}
+
+func (m *MockSagaRepository) ListUnfinishedSagas(ctx context.Context, updatedBefore time.Time) ([]*model.Saga, error) {
+	args := m.Called(ctx, updatedBefore)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Saga), args.Error(1)
+}
+
+func (m *MockSagaRepository) ClaimSaga(ctx context.Context, sagaID string, updatedBefore time.Time) (bool, error) {
+	args := m.Called(ctx, sagaID, updatedBefore)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockIdempotencyRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdempotencyRepository) ClaimKey(ctx context.Context, key *model.IdempotencyKey) (*model.IdempotencyKey, bool, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1), args.Error(2)
+	}
+	return args.Get(0).(*model.IdempotencyKey), args.Bool(1), args.Error(2)
+}
+
+func (m *MockIdempotencyRepository) ReclaimKey(ctx context.Context, userID, key, oldOrderID, newOrderID string, now time.Time) (bool, error) {
+	args := m.Called(ctx, userID, key, oldOrderID, newOrderID, now)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyRepository) CompleteKey(ctx context.Context, userID, key, orderID string) error {
+	return m.Called(ctx, userID, key, orderID).Error(0)
+}
+
+func (m *MockIdempotencyRepository) ReleaseKey(ctx context.Context, userID, key, orderID string) error {
+	return m.Called(ctx, userID, key, orderID).Error(0)
+}
+
+func (m *MockIdempotencyRepository) DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// MockUserClient mocks the UserService gRPC client. Embedding the interface lets us
+// only implement the RPCs OrderService actually calls.
+type MockUserClient struct {
+	userpb.UserServiceClient
+	mock.Mock
+}
+
+func (m *MockUserClient) GetUser(ctx context.Context, in *userpb.GetUserRequest, opts ...grpc.CallOption) (*userpb.GetUserResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*userpb.GetUserResponse), args.Error(1)
+}
+
+func (m *MockUserClient) ListAddresses(ctx context.Context, in *userpb.ListAddressesRequest, opts ...grpc.CallOption) (*userpb.ListAddressesResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*userpb.ListAddressesResponse), args.Error(1)
+}
+
+// MockProductClient mocks the ProductService gRPC client.
+type MockProductClient struct {
+	productpb.ProductServiceClient
+	mock.Mock
+}
+
+func (m *MockProductClient) GetProduct(ctx context.Context, in *productpb.GetProductRequest, opts ...grpc.CallOption) (*productpb.GetProductResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*productpb.GetProductResponse), args.Error(1)
+}
+
+func (m *MockProductClient) BatchGetProducts(ctx context.Context, in *productpb.BatchGetProductsRequest, opts ...grpc.CallOption) (*productpb.BatchGetProductsResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*productpb.BatchGetProductsResponse), args.Error(1)
+}
+
+func (m *MockProductClient) ReserveStock(ctx context.Context, in *productpb.ReserveStockRequest, opts ...grpc.CallOption) (*productpb.ReserveStockResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*productpb.ReserveStockResponse), args.Error(1)
+}
+
+func (m *MockProductClient) CommitReservation(ctx context.Context, in *productpb.CommitReservationRequest, opts ...grpc.CallOption) (*productpb.CommitReservationResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*productpb.CommitReservationResponse), args.Error(1)
+}
+
+func (m *MockProductClient) ReleaseReservation(ctx context.Context, in *productpb.ReleaseReservationRequest, opts ...grpc.CallOption) (*productpb.ReleaseReservationResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*productpb.ReleaseReservationResponse), args.Error(1)
+}
+
+func (m *MockProductClient) BatchUpdateStock(ctx context.Context, in *productpb.BatchUpdateStockRequest, opts ...grpc.CallOption) (*productpb.BatchUpdateStockResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*productpb.BatchUpdateStockResponse), args.Error(1)
+}
+
+func (m *MockProductClient) UpdateStock(ctx context.Context, in *productpb.UpdateStockRequest, opts ...grpc.CallOption) (*productpb.UpdateStockResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*productpb.UpdateStockResponse), args.Error(1)
+}
+
+var testPageTokens = pagination.NewTokenCodec([]byte("test-secret"))
+
+func reservationID(id string) interface{} {
+	return mock.MatchedBy(func(req interface{ GetReservationId() string }) bool {
+		return req.GetReservationId() == id
+	})
+}
+
+func newTestOrderService() (*OrderService, *MockOrderRepository, *MockSagaRepository, *MockUserClient, *MockProductClient) {
+	repo := new(MockOrderRepository)
+	sagaRepo := new(MockSagaRepository)
+	userClient := new(MockUserClient)
+	productClient := new(MockProductClient)
+	return NewOrderService(repo, sagaRepo, new(MockIdempotencyRepository), userClient, productClient, time.Hour, testPageTokens, false), repo, sagaRepo, userClient, productClient
+}
+
+// expectOrderUpToSaga sets up a two-product cart that gets as far as starting its saga.
+// Steps get IDs like "step-RESERVE_STOCK".
+func expectOrderUpToSaga(sagaRepo *MockSagaRepository, productClient *MockProductClient) {
+	productClient.On("BatchGetProducts", mock.Anything, &productpb.BatchGetProductsRequest{ProductIds: []string{"prod-a", "prod-b"}}).
+		Return(&productpb.BatchGetProductsResponse{Products: []*productpb.Product{
+			{Id: "prod-a", Price: 10, StockQuantity: 5, AvailableQuantity: 5},
+			{Id: "prod-b", Price: 20, StockQuantity: 5, AvailableQuantity: 5},
+		}}, nil)
+
+	sagaRepo.On("CreateSaga", mock.Anything, mock.AnythingOfType("*model.Saga")).Run(func(args mock.Arguments) {
+		args.Get(1).(*model.Saga).ID = "saga-1"
+	}).Return(nil, nil)
+	sagaRepo.On("AddStep", mock.Anything, "saga-1", mock.Anything).Run(func(args mock.Arguments) {
+		step := args.Get(2).(*model.SagaStep)
+		step.ID = "step-" + string(step.Action)
+	}).Return(nil)
+	sagaRepo.On("UpdateStepStatus", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	sagaRepo.On("UpdateSagaStatus", mock.Anything, "saga-1", mock.Anything, mock.Anything).Return(nil)
+}
+
+// expectOrderUpToReservation sets up a two-product cart that gets as far as a successful reservation.
+func expectOrderUpToReservation(sagaRepo *MockSagaRepository, productClient *MockProductClient) {
+	expectOrderUpToSaga(sagaRepo, productClient)
+	productClient.On("ReserveStock", mock.Anything, mock.MatchedBy(func(req *productpb.ReserveStockRequest) bool {
+		return req.Reference == "step-RESERVE_STOCK" && len(req.Items) == 2 &&
+			req.Items[0].ProductId == "prod-a" && req.Items[0].Quantity == 2 &&
+			req.Items[1].ProductId == "prod-b" && req.Items[1].Quantity == 1
+	})).Return(&productpb.ReserveStockResponse{Reservation: &productpb.Reservation{Id: "res-1"}}, nil).Once()
+	sagaRepo.On("ApplyStep", mock.Anything, "step-RESERVE_STOCK", "res-1").Return(nil)
+}
+
+// reservationReference matches a ReleaseReservationRequest by reference instead of ID.
+func reservationReference(reference string) interface{} {
+	return mock.MatchedBy(func(req *productpb.ReleaseReservationRequest) bool {
+		return req.ReservationId == "" && req.Reference == reference
+	})
+}
+
+var testCart = []model.OrderItem{
+	{ProductID: "prod-a", Quantity: 2},
+	{ProductID: "prod-b", Quantity: 1},
+}
+
+func TestOrderService_CreateOrder_Success(t *testing.T) {
+	svc, repo, sagaRepo, userClient, productClient := newTestOrderService()
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	repo.On("CreateOrder", mock.Anything, mock.AnythingOfType("*model.Order")).
+		Return(&model.Order{ID: "order-1", UserID: "user-1", TotalAmount: 40}, nil)
+	productClient.On("CommitReservation", mock.Anything, reservationID("res-1")).Return(&productpb.CommitReservationResponse{}, nil).Once()
+
+	order, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", order.ID)
+	productClient.AssertExpectations(t)
+	productClient.AssertNotCalled(t, "ReleaseReservation", mock.Anything, mock.Anything)
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompleted, "")
+}
+
+func TestOrderService_CreateOrder_ReleasesReservationWhenUserInvalid(t *testing.T) {
+	svc, repo, sagaRepo, userClient, productClient := newTestOrderService()
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(nil, status.Error(codes.NotFound, "user not found"))
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).Return(&productpb.ReleaseReservationResponse{}, nil).Once()
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "")
+
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrUserValidationFailed))
+	productClient.AssertExpectations(t)
+	repo.AssertNotCalled(t, "CreateOrder", mock.Anything, mock.Anything)
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompensated, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_RequiresVerifiedEmail(t *testing.T) {
+	svc, repo, sagaRepo, userClient, productClient := newTestOrderService()
+	svc.requireVerifiedEmail = true
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).Return(&productpb.ReleaseReservationResponse{}, nil).Once()
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "")
+
+	assert.True(t, errors.Is(err, ErrEmailNotVerified))
+	productClient.AssertExpectations(t)
+	repo.AssertNotCalled(t, "CreateOrder", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_CopiesShippingAddress(t *testing.T) {
+	svc, repo, sagaRepo, userClient, productClient := newTestOrderService()
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	userClient.On("ListAddresses", mock.Anything, &userpb.ListAddressesRequest{UserId: "user-1"}).
+		Return(&userpb.ListAddressesResponse{Addresses: []*userpb.Address{
+			{Id: "addr-1", UserId: "user-1", RecipientName: "Ada Lovelace", Line1: "1 Main St", City: "Springfield", PostalCode: "62701", CountryCode: "US", IsDefault: true},
+			{Id: "addr-2", UserId: "user-1", RecipientName: "Ada Lovelace", Line1: "12 St James's Sq", City: "London", PostalCode: "SW1Y 4JH", CountryCode: "GB"},
+		}}, nil)
+	repo.On("CreateOrder", mock.Anything, mock.MatchedBy(func(o *model.Order) bool {
+		return o.ShippingAddress != nil && o.ShippingAddress.AddressID == "addr-2" && o.ShippingAddress.City == "London"
+	})).Return(&model.Order{ID: "order-1", UserID: "user-1"}, nil)
+	productClient.On("CommitReservation", mock.Anything, reservationID("res-1")).Return(&productpb.CommitReservationResponse{}, nil).Once()
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "addr-2", "")
+
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+}
+
+func TestOrderService_CreateOrder_RejectsAddressOfAnotherUser(t *testing.T) {
+	svc, repo, sagaRepo, userClient, productClient := newTestOrderService()
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	// addr-9 belongs to someone else, so it isn't in user-1's address book
+	userClient.On("ListAddresses", mock.Anything, &userpb.ListAddressesRequest{UserId: "user-1"}).
+		Return(&userpb.ListAddressesResponse{Addresses: []*userpb.Address{{Id: "addr-1", UserId: "user-1"}}}, nil)
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).Return(&productpb.ReleaseReservationResponse{}, nil).Once()
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "addr-9", "")
+
+	assert.ErrorIs(t, err, ErrShippingAddressNotFound)
+	assert.ErrorIs(t, err, ErrInvalidOrderData)
+	productClient.AssertExpectations(t)
+	repo.AssertNotCalled(t, "CreateOrder", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_CancelsOrderWhenCommitFails(t *testing.T) {
+	svc, repo, sagaRepo, userClient, productClient := newTestOrderService()
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	repo.On("CreateOrder", mock.Anything, mock.AnythingOfType("*model.Order")).
+		Return(&model.Order{ID: "order-1", UserID: "user-1"}, nil)
+	productClient.On("CommitReservation", mock.Anything, reservationID("res-1")).
+		Return(nil, status.Error(codes.FailedPrecondition, "reservation expired")).Once()
+	repo.On("UpdateOrderStatus", mock.Anything, "order-1", model.StatusCancelled).Return(&model.Order{ID: "order-1"}, nil).Once()
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).Return(&productpb.ReleaseReservationResponse{}, nil).Once()
+	failures := stockUpdateFailures.WithLabelValues(stockOpCommit, "FailedPrecondition")
+	failuresBefore := testutil.ToFloat64(failures)
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "")
+
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrProductStockUpdateFailed))
+	assert.Equal(t, failuresBefore+1, testutil.ToFloat64(failures))
+	productClient.AssertExpectations(t)
+	repo.AssertExpectations(t)
+}
+
+func TestOrderService_CreateOrder_KeepsOrderWhenCommitResponseIsLost(t *testing.T) {
+	svc, repo, sagaRepo, userClient, productClient := newTestOrderService()
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	repo.On("CreateOrder", mock.Anything, mock.AnythingOfType("*model.Order")).
+		Return(&model.Order{ID: "order-1", UserID: "user-1"}, nil)
+	productClient.On("CommitReservation", mock.Anything, reservationID("res-1")).
+		Return(nil, status.Error(codes.DeadlineExceeded, "deadline exceeded")).Once()
+	// ProductService did commit, so the reservation can't be released any more
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).
+		Return(nil, status.Error(codes.FailedPrecondition, "reservation is no longer pending: status is COMMITTED")).Once()
+
+	order, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "")
+
+	require.NoError(t, err)
+	assert.Equal(t, "order-1", order.ID)
+	productClient.AssertExpectations(t)
+	repo.AssertNotCalled(t, "UpdateOrderStatus", mock.Anything, mock.Anything, mock.Anything)
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompleted, "")
+	sagaRepo.AssertNotCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompensated, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_KeepsOrderUntilReservationIsReleased(t *testing.T) {
+	svc, repo, sagaRepo, userClient, productClient := newTestOrderService()
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	repo.On("CreateOrder", mock.Anything, mock.AnythingOfType("*model.Order")).
+		Return(&model.Order{ID: "order-1", UserID: "user-1"}, nil)
+	productClient.On("CommitReservation", mock.Anything, reservationID("res-1")).
+		Return(nil, status.Error(codes.Unavailable, "down")).Once()
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).
+		Return(nil, status.Error(codes.Unavailable, "down")).Once()
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "")
+
+	assert.ErrorIs(t, err, ErrProductStockUpdateFailed)
+	// The commit may yet have happened, so the order waits for recovery
+	repo.AssertNotCalled(t, "UpdateOrderStatus", mock.Anything, mock.Anything, mock.Anything)
+	sagaRepo.AssertNotCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompensated, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_ReleasesByReferenceWhenReserveTimesOut(t *testing.T) {
+	svc, _, sagaRepo, _, productClient := newTestOrderService()
+	expectOrderUpToSaga(sagaRepo, productClient)
+
+	// ProductService may have reserved the stock before the deadline hit
+	productClient.On("ReserveStock", mock.Anything, mock.Anything).Return(nil, status.Error(codes.DeadlineExceeded, "deadline exceeded")).Once()
+	productClient.On("ReleaseReservation", mock.Anything, reservationReference("step-RESERVE_STOCK")).Return(&productpb.ReleaseReservationResponse{}, nil).Once()
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "")
+
+	assert.ErrorIs(t, err, ErrProductStockUpdateFailed)
+	productClient.AssertExpectations(t)
+	sagaRepo.AssertCalled(t, "UpdateStepStatus", mock.Anything, "step-RESERVE_STOCK", model.SagaStepCompensated)
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompensated, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_InsufficientStockReservesNothing(t *testing.T) {
+	svc, _, sagaRepo, _, productClient := newTestOrderService()
+
+	productClient.On("BatchGetProducts", mock.Anything, mock.Anything).
+		Return(&productpb.BatchGetProductsResponse{Products: []*productpb.Product{{Id: "prod-a", Price: 10, StockQuantity: 5, AvailableQuantity: 3}}}, nil)
+
+	// Two lines of 2 each fit individually, but not once they are added up
+	items := []model.OrderItem{{ProductID: "prod-a", Quantity: 2}, {ProductID: "prod-a", Quantity: 2}}
+	_, err := svc.CreateOrder(context.Background(), "user-1", items, "", "")
+
+	assert.True(t, errors.Is(err, ErrInsufficientStockForOrder))
+	sagaRepo.AssertNotCalled(t, "CreateSaga", mock.Anything, mock.Anything)
+	productClient.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_NamesEveryMissingProduct(t *testing.T) {
+	svc, _, sagaRepo, _, productClient := newTestOrderService()
+
+	productClient.On("BatchGetProducts", mock.Anything, &productpb.BatchGetProductsRequest{ProductIds: []string{"prod-a", "prod-x", "prod-y"}}).
+		Return(&productpb.BatchGetProductsResponse{
+			Products:          []*productpb.Product{{Id: "prod-a", Price: 10, StockQuantity: 5, AvailableQuantity: 5}},
+			MissingProductIds: []string{"prod-x", "prod-y"},
+		}, nil)
+
+	items := []model.OrderItem{{ProductID: "prod-a", Quantity: 1}, {ProductID: "prod-x", Quantity: 1}, {ProductID: "prod-y", Quantity: 1}}
+	_, err := svc.CreateOrder(context.Background(), "user-1", items, "", "")
+
+	assert.True(t, errors.Is(err, ErrProductFetchFailed))
+	assert.Contains(t, err.Error(), "prod-x, prod-y")
+	sagaRepo.AssertNotCalled(t, "CreateSaga", mock.Anything, mock.Anything)
+	productClient.AssertExpectations(t)
+}
+
+func TestOrderService_RecoverSagas(t *testing.T) {
+	svc, repo, sagaRepo, _, productClient := newTestOrderService()
+
+	// Crashed after writing the order but before committing: resume forward.
+	written := &model.Saga{ID: "saga-written", OrderID: "order-written", Status: model.SagaStatusStarted, Steps: []model.SagaStep{
+		{ID: "step-1", Action: model.SagaActionReserveStock, Reference: "res-written", Status: model.SagaStepApplied},
+	}}
+	// Crashed before writing the order: release the reservation.
+	orphaned := &model.Saga{ID: "saga-orphan", OrderID: "order-orphan", Status: model.SagaStatusStarted, Steps: []model.SagaStep{
+		{ID: "step-2", Action: model.SagaActionReserveStock, Reference: "res-orphan", Status: model.SagaStepApplied},
+	}}
+	sagaRepo.On("ListUnfinishedSagas", mock.Anything, mock.Anything).Return([]*model.Saga{written, orphaned}, nil)
+	sagaRepo.On("ClaimSaga", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	sagaRepo.On("UpdateSagaStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	sagaRepo.On("UpdateStepStatus", mock.Anything, "step-2", model.SagaStepCompensated).Return(nil)
+	repo.On("GetOrderByID", mock.Anything, "order-written").Return(&model.Order{ID: "order-written"}, nil)
+	repo.On("GetOrderByID", mock.Anything, "order-orphan").Return(nil, ErrOrderNotFound)
+	productClient.On("CommitReservation", mock.Anything, reservationID("res-written")).Return(&productpb.CommitReservationResponse{}, nil).Once()
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-orphan")).Return(&productpb.ReleaseReservationResponse{}, nil).Once()
+
+	err := svc.RecoverSagas(context.Background(), time.Minute)
+
+	assert.NoError(t, err)
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-written", model.SagaStatusCompleted, "")
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-orphan", model.SagaStatusCompensated, mock.Anything)
+	productClient.AssertExpectations(t)
+}
+
+// stockChanges matches a BatchUpdateStockRequest carrying exactly these changes, in order.
+// Pass product ID and quantity change pairs.
+func stockChanges(pairs ...interface{}) interface{} {
+	return mock.MatchedBy(func(req *productpb.BatchUpdateStockRequest) bool {
+		if len(req.Updates)*2 != len(pairs) {
+			return false
+		}
+		for i, update := range req.Updates {
+			if update.ProductId != pairs[2*i].(string) || update.QuantityChange != int32(pairs[2*i+1].(int)) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestOrderService_RecoverSagas_ReleasesPendingReservation(t *testing.T) {
+	svc, repo, sagaRepo, _, productClient := newTestOrderService()
+
+	// Crashed while ReserveStock was in flight: it may or may not have reserved anything
+	saga := &model.Saga{ID: "saga-1", OrderID: "order-1", Status: model.SagaStatusStarted, Steps: []model.SagaStep{
+		{ID: "step-1", Action: model.SagaActionReserveStock, Status: model.SagaStepPending},
+	}}
+	sagaRepo.On("ListUnfinishedSagas", mock.Anything, mock.Anything).Return([]*model.Saga{saga}, nil)
+	sagaRepo.On("ClaimSaga", mock.Anything, "saga-1", mock.Anything).Return(true, nil)
+	sagaRepo.On("UpdateSagaStatus", mock.Anything, "saga-1", mock.Anything, mock.Anything).Return(nil)
+	sagaRepo.On("UpdateStepStatus", mock.Anything, "step-1", model.SagaStepCompensated).Return(nil).Once()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(nil, ErrOrderNotFound)
+	productClient.On("ReleaseReservation", mock.Anything, reservationReference("step-1")).Return(&productpb.ReleaseReservationResponse{}, nil).Once()
+
+	err := svc.RecoverSagas(context.Background(), time.Minute)
+
+	assert.NoError(t, err)
+	productClient.AssertExpectations(t)
+	sagaRepo.AssertExpectations(t)
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompensated, mock.Anything)
+}
+
+func TestOrderService_RecoverSagas_RestocksCommittedReservationOfCancelledOrder(t *testing.T) {
+	svc, repo, sagaRepo, _, productClient := newTestOrderService()
+
+	// Earlier releases cancelled the order before finding out the reservation was committed
+	saga := &model.Saga{ID: "saga-1", OrderID: "order-1", Status: model.SagaStatusCompensating, Steps: []model.SagaStep{
+		{ID: "step-1", Action: model.SagaActionReserveStock, Reference: "res-1", Status: model.SagaStepApplied},
+		{ID: "step-2", Action: model.SagaActionCreateOrder, Reference: "order-1", Status: model.SagaStepCompensated},
+	}}
+	sagaRepo.On("ListUnfinishedSagas", mock.Anything, mock.Anything).Return([]*model.Saga{saga}, nil)
+	sagaRepo.On("ClaimSaga", mock.Anything, "saga-1", mock.Anything).Return(true, nil)
+	sagaRepo.On("UpdateSagaStatus", mock.Anything, "saga-1", mock.Anything, mock.Anything).Return(nil)
+	sagaRepo.On("UpdateStepStatus", mock.Anything, "step-1", model.SagaStepCompensated).Return(nil).Once()
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).
+		Return(nil, status.Error(codes.FailedPrecondition, "reservation is no longer pending: status is COMMITTED")).Once()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusCancelled, Items: []model.OrderItem{
+		{ProductID: "prod-a", Quantity: 2},
+		{ProductID: "prod-b", Quantity: 1},
+	}}, nil)
+	productClient.On("BatchUpdateStock", mock.Anything, stockChanges("prod-a", 2, "prod-b", 1)).Return(&productpb.BatchUpdateStockResponse{}, nil).Once()
+
+	err := svc.RecoverSagas(context.Background(), time.Minute)
+
+	assert.NoError(t, err)
+	productClient.AssertExpectations(t)
+	sagaRepo.AssertExpectations(t)
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompensated, mock.Anything)
+}
+
+func TestOrderService_RecoverSagas_CancelsOrderWithoutRecordedReservation(t *testing.T) {
+	svc, repo, sagaRepo, _, productClient := newTestOrderService()
+
+	// Recording the reservation failed, but the order was written
+	saga := &model.Saga{ID: "saga-1", OrderID: "order-1", Status: model.SagaStatusStarted}
+	sagaRepo.On("ListUnfinishedSagas", mock.Anything, mock.Anything).Return([]*model.Saga{saga}, nil)
+	sagaRepo.On("ClaimSaga", mock.Anything, "saga-1", mock.Anything).Return(true, nil)
+	sagaRepo.On("UpdateSagaStatus", mock.Anything, "saga-1", mock.Anything, mock.Anything).Return(nil)
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1"}, nil)
+	repo.On("UpdateOrderStatus", mock.Anything, "order-1", model.StatusCancelled).Return(&model.Order{ID: "order-1"}, nil).Once()
+
+	err := svc.RecoverSagas(context.Background(), time.Minute)
+
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+	sagaRepo.AssertCalled(t, "UpdateSagaStatus", mock.Anything, "saga-1", model.SagaStatusCompensated, mock.Anything)
+	productClient.AssertNotCalled(t, "CommitReservation", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_UpdateOrderStatus_RejectsIllegalTransition(t *testing.T) {
+	svc, repo, _, _, _ := newTestOrderService()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusCompleted}, nil)
+
+	_, err := svc.UpdateOrderStatus(context.Background(), "order-1", model.StatusProcessing)
+
+	assert.True(t, errors.Is(err, ErrInvalidStatusTransition))
+	repo.AssertNotCalled(t, "TransitionOrderStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOrderService_UpdateOrderStatus_LostRaceIsIllegalTransition(t *testing.T) {
+	svc, repo, _, _, _ := newTestOrderService()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusPending}, nil)
+	repo.On("TransitionOrderStatus", mock.Anything, "order-1", model.StatusPending, model.StatusProcessing).
+		Return(nil, repository.ErrOrderStatusConflict)
+
+	_, err := svc.UpdateOrderStatus(context.Background(), "order-1", model.StatusProcessing)
+
+	assert.True(t, errors.Is(err, ErrInvalidStatusTransition))
+}
+
+func expectSettledOrder(sagaRepo *MockSagaRepository, orderID string) {
+	sagaRepo.On("GetSagaByOrderID", mock.Anything, orderID).
+		Return(&model.Saga{ID: "saga-1", OrderID: orderID, Status: model.SagaStatusCompleted}, nil)
+}
+
+func TestOrderService_CancelOrder_RestocksItems(t *testing.T) {
+	svc, repo, sagaRepo, _, productClient := newTestOrderService()
+	expectSettledOrder(sagaRepo, "order-1")
+	order := &model.Order{ID: "order-1", Status: model.StatusProcessing, Items: testCart}
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(order, nil)
+	repo.On("TransitionOrderStatus", mock.Anything, "order-1", model.StatusProcessing, model.StatusCancelled).
+		Return(&model.Order{ID: "order-1", Status: model.StatusCancelled}, nil).Once()
+	productClient.On("BatchUpdateStock", mock.Anything, stockChanges("prod-a", 2, "prod-b", 1)).Return(&productpb.BatchUpdateStockResponse{}, nil).Once()
+
+	cancelled, err := svc.CancelOrder(context.Background(), "order-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusCancelled, cancelled.Status)
+	assert.Len(t, cancelled.Items, 2)
+	productClient.AssertExpectations(t)
+	repo.AssertExpectations(t)
+}
+
+func TestOrderService_CancelOrder_RevertsWhenRestockFails(t *testing.T) {
+	svc, repo, sagaRepo, _, productClient := newTestOrderService()
+	expectSettledOrder(sagaRepo, "order-1")
+	order := &model.Order{ID: "order-1", Status: model.StatusPending, Items: testCart}
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(order, nil)
+	repo.On("TransitionOrderStatus", mock.Anything, "order-1", model.StatusPending, model.StatusCancelled).
+		Return(&model.Order{ID: "order-1", Status: model.StatusCancelled}, nil).Once()
+	productClient.On("BatchUpdateStock", mock.Anything, stockChanges("prod-a", 2, "prod-b", 1)).Return(nil, status.Error(codes.Unavailable, "down")).Once()
+	repo.On("TransitionOrderStatus", mock.Anything, "order-1", model.StatusCancelled, model.StatusPending).
+		Return(&model.Order{ID: "order-1", Status: model.StatusPending}, nil).Once()
+
+	_, err := svc.CancelOrder(context.Background(), "order-1")
+
+	assert.True(t, errors.Is(err, ErrProductStockUpdateFailed))
+	productClient.AssertExpectations(t)
+	repo.AssertExpectations(t)
+}
+
+func TestOrderService_CancelOrder_AlreadyCancelled(t *testing.T) {
+	svc, repo, sagaRepo, _, productClient := newTestOrderService()
+	expectSettledOrder(sagaRepo, "order-1")
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusCancelled, Items: testCart}, nil)
+
+	_, err := svc.CancelOrder(context.Background(), "order-1")
+
+	assert.True(t, errors.Is(err, ErrInvalidStatusTransition))
+	productClient.AssertNotCalled(t, "BatchUpdateStock", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_CancelOrder_RefusesOrderWhoseSagaIsUnfinished(t *testing.T) {
+	for _, sagaStatus := range []model.SagaStatus{model.SagaStatusStarted, model.SagaStatusCompensating} {
+		t.Run(string(sagaStatus), func(t *testing.T) {
+			svc, repo, sagaRepo, _, productClient := newTestOrderService()
+			// The reservation may not be committed yet, so there is nothing to restock
+			repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusPending, Items: testCart}, nil)
+			sagaRepo.On("GetSagaByOrderID", mock.Anything, "order-1").
+				Return(&model.Saga{ID: "saga-1", OrderID: "order-1", Status: sagaStatus}, nil)
+
+			_, err := svc.CancelOrder(context.Background(), "order-1")
+
+			assert.ErrorIs(t, err, ErrOrderNotSettled)
+			repo.AssertNotCalled(t, "TransitionOrderStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			productClient.AssertNotCalled(t, "BatchUpdateStock", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestOrderService_CancelOrder_RestocksOrderFromBeforeSagas(t *testing.T) {
+	svc, repo, sagaRepo, _, productClient := newTestOrderService()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusPending, Items: testCart}, nil)
+	sagaRepo.On("GetSagaByOrderID", mock.Anything, "order-1").Return(nil, repository.ErrSagaNotFound)
+	repo.On("TransitionOrderStatus", mock.Anything, "order-1", model.StatusPending, model.StatusCancelled).
+		Return(&model.Order{ID: "order-1", Status: model.StatusCancelled}, nil).Once()
+	productClient.On("BatchUpdateStock", mock.Anything, stockChanges("prod-a", 2, "prod-b", 1)).Return(&productpb.BatchUpdateStockResponse{}, nil).Once()
+
+	_, err := svc.CancelOrder(context.Background(), "order-1")
+
+	assert.NoError(t, err)
+	productClient.AssertExpectations(t)
+}
+
+func TestOrderService_CreateOrder_IdempotentReplay(t *testing.T) {
+	repo, sagaRepo, idemRepo := new(MockOrderRepository), new(MockSagaRepository), new(MockIdempotencyRepository)
+	productClient := new(MockProductClient)
+	svc := NewOrderService(repo, sagaRepo, idemRepo, new(MockUserClient), productClient, time.Hour, testPageTokens, false)
+
+	completedAt := time.Now().Add(-time.Minute)
+	existing := &model.IdempotencyKey{
+		UserID: "user-1", Key: "key-1", Fingerprint: orderFingerprint("user-1", testCart, ""),
+		OrderID: "order-1", CompletedAt: &completedAt, CreatedAt: completedAt,
+	}
+	idemRepo.On("ClaimKey", mock.Anything, mock.AnythingOfType("*model.IdempotencyKey")).Return(existing, false, nil)
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1"}, nil)
+
+	// Same items in a different order must count as the same request
+	reordered := []model.OrderItem{testCart[1], testCart[0]}
+	order, err := svc.CreateOrder(context.Background(), "user-1", reordered, "", "key-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", order.ID)
+	sagaRepo.AssertNotCalled(t, "CreateSaga", mock.Anything, mock.Anything)
+	productClient.AssertNotCalled(t, "ReserveStock", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_IdempotencyKeyReusedWithDifferentBody(t *testing.T) {
+	idemRepo := new(MockIdempotencyRepository)
+	svc := NewOrderService(new(MockOrderRepository), new(MockSagaRepository), idemRepo, new(MockUserClient), new(MockProductClient), time.Hour, testPageTokens, false)
+
+	existing := &model.IdempotencyKey{UserID: "user-1", Key: "key-1", Fingerprint: orderFingerprint("user-1", testCart, ""), OrderID: "order-1", CreatedAt: time.Now()}
+	idemRepo.On("ClaimKey", mock.Anything, mock.Anything).Return(existing, false, nil)
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", []model.OrderItem{{ProductID: "prod-a", Quantity: 3}}, "", "key-1")
+
+	assert.True(t, errors.Is(err, ErrIdempotencyKeyReused))
+}
+
+func TestOrderService_CreateOrder_IdempotencyKeyInProgress(t *testing.T) {
+	idemRepo := new(MockIdempotencyRepository)
+	svc := NewOrderService(new(MockOrderRepository), new(MockSagaRepository), idemRepo, new(MockUserClient), new(MockProductClient), time.Hour, testPageTokens, false)
+
+	existing := &model.IdempotencyKey{UserID: "user-1", Key: "key-1", Fingerprint: orderFingerprint("user-1", testCart, ""), OrderID: "order-1", CreatedAt: time.Now()}
+	idemRepo.On("ClaimKey", mock.Anything, mock.Anything).Return(existing, false, nil)
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "key-1")
+
+	assert.True(t, errors.Is(err, ErrIdempotencyKeyInProgress))
+}
+
+func TestOrderService_CreateOrder_IdempotencyKeyUsesClaimedOrderID(t *testing.T) {
+	repo, sagaRepo, idemRepo := new(MockOrderRepository), new(MockSagaRepository), new(MockIdempotencyRepository)
+	userClient, productClient := new(MockUserClient), new(MockProductClient)
+	svc := NewOrderService(repo, sagaRepo, idemRepo, userClient, productClient, time.Hour, testPageTokens, false)
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	var claimedOrderID string
+	idemRepo.On("ClaimKey", mock.Anything, mock.AnythingOfType("*model.IdempotencyKey")).Run(func(args mock.Arguments) {
+		claimedOrderID = args.Get(1).(*model.IdempotencyKey).OrderID
+	}).Return(nil, true, nil)
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	var written *model.Order
+	repo.On("CreateOrder", mock.Anything, mock.AnythingOfType("*model.Order")).Run(func(args mock.Arguments) {
+		written = args.Get(1).(*model.Order)
+	}).Return(&model.Order{ID: "order-1"}, nil)
+	productClient.On("CommitReservation", mock.Anything, reservationID("res-1")).Return(&productpb.CommitReservationResponse{}, nil)
+	idemRepo.On("CompleteKey", mock.Anything, "user-1", "key-1", mock.Anything).Return(nil)
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "key-1")
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, claimedOrderID)
+	assert.Equal(t, claimedOrderID, written.ID)
+	idemRepo.AssertCalled(t, "CompleteKey", mock.Anything, "user-1", "key-1", claimedOrderID)
+}
+
+func TestOrderService_CreateOrder_IdempotencyKeyKeptWhenCompensationFails(t *testing.T) {
+	repo, sagaRepo, idemRepo := new(MockOrderRepository), new(MockSagaRepository), new(MockIdempotencyRepository)
+	userClient, productClient := new(MockUserClient), new(MockProductClient)
+	svc := NewOrderService(repo, sagaRepo, idemRepo, userClient, productClient, time.Hour, testPageTokens, false)
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	var claim *model.IdempotencyKey
+	idemRepo.On("ClaimKey", mock.Anything, mock.AnythingOfType("*model.IdempotencyKey")).Run(func(args mock.Arguments) {
+		claim = args.Get(1).(*model.IdempotencyKey)
+	}).Return(nil, true, nil).Once()
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(&userpb.GetUserResponse{User: &userpb.User{Id: "user-1"}}, nil)
+	repo.On("CreateOrder", mock.Anything, mock.AnythingOfType("*model.Order")).Run(func(args mock.Arguments) {
+		args.Get(1).(*model.Order).ID = claim.OrderID
+	}).Return(&model.Order{ID: "order-1"}, nil)
+	productClient.On("CommitReservation", mock.Anything, reservationID("res-1")).Return(nil, status.Error(codes.Unavailable, "down"))
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).Return(nil, status.Error(codes.Unavailable, "down"))
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "key-1")
+
+	assert.ErrorIs(t, err, ErrCompensationFailed)
+	// The order is still there, so the key must keep pointing at it
+	idemRepo.AssertNotCalled(t, "ReleaseKey", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// A retry after the lock timeout gets the surviving order instead of placing a second one
+	stale := *claim
+	stale.CreatedAt = time.Now().Add(-idempotencyLockTimeout - time.Second)
+	idemRepo.On("ClaimKey", mock.Anything, mock.AnythingOfType("*model.IdempotencyKey")).Return(&stale, false, nil).Once()
+	repo.On("GetOrderByID", mock.Anything, claim.OrderID).Return(&model.Order{ID: claim.OrderID, Status: model.StatusPending}, nil)
+
+	order, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "key-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, claim.OrderID, order.ID)
+	sagaRepo.AssertNumberOfCalls(t, "CreateSaga", 1)
+	idemRepo.AssertNotCalled(t, "ReclaimKey", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOrderService_CreateOrder_IdempotencyKeyReleasedWhenCompensated(t *testing.T) {
+	repo, sagaRepo, idemRepo := new(MockOrderRepository), new(MockSagaRepository), new(MockIdempotencyRepository)
+	userClient, productClient := new(MockUserClient), new(MockProductClient)
+	svc := NewOrderService(repo, sagaRepo, idemRepo, userClient, productClient, time.Hour, testPageTokens, false)
+	expectOrderUpToReservation(sagaRepo, productClient)
+
+	idemRepo.On("ClaimKey", mock.Anything, mock.AnythingOfType("*model.IdempotencyKey")).Return(nil, true, nil)
+	userClient.On("GetUser", mock.Anything, mock.Anything).Return(nil, status.Error(codes.NotFound, "no such user"))
+	productClient.On("ReleaseReservation", mock.Anything, reservationID("res-1")).Return(&productpb.ReleaseReservationResponse{}, nil)
+	idemRepo.On("ReleaseKey", mock.Anything, "user-1", "key-1", mock.Anything).Return(nil).Once()
+
+	_, err := svc.CreateOrder(context.Background(), "user-1", testCart, "", "key-1")
+
+	assert.ErrorIs(t, err, ErrUserValidationFailed)
+	idemRepo.AssertExpectations(t)
+}
+
+func TestOrderFingerprint_IgnoresProductIDCaseAndItemOrder(t *testing.T) {
+	cart := []model.OrderItem{
+		{ProductID: "6F1C2D3E-0000-4000-8000-00000000000A", Quantity: 2},
+		{ProductID: "6f1c2d3e-0000-4000-8000-00000000000b", Quantity: 1},
+	}
+	respelled := []model.OrderItem{
+		{ProductID: "6F1C2D3E-0000-4000-8000-00000000000B", Quantity: 1},
+		{ProductID: "6f1c2d3e-0000-4000-8000-00000000000a", Quantity: 2},
+	}
+
+	assert.Equal(t, orderFingerprint("user-1", cart, ""), orderFingerprint("user-1", respelled, ""))
+	assert.NotEqual(t, orderFingerprint("user-1", cart, ""), orderFingerprint("user-2", cart, ""))
+	assert.Equal(t, "6F1C2D3E-0000-4000-8000-00000000000A", cart[0].ProductID) // The caller's items are left alone
+}
+
+func TestOrderService_WatchOrder_StreamsUntilTerminal(t *testing.T) {
+	svc, repo, _, _, _ := newTestOrderService()
+	svc.watchPollInterval = time.Hour // Only events should wake the watcher
+
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusPending}, nil).Once()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusProcessing}, nil).Once()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusCompleted}, nil).Once()
+
+	sent := make(chan model.OrderStatus, 3)
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.WatchOrder(context.Background(), "order-1", func(o *model.Order) error {
+			sent <- o.Status
+			return nil
+		})
+	}()
+
+	event := &model.OutboxEvent{AggregateType: model.AggregateOrder, AggregateID: "order-1", EventType: model.EventOrderStatusChanged}
+	assert.Equal(t, model.StatusPending, <-sent)
+	assert.NoError(t, svc.HandleOrderEvent(context.Background(), event))
+	assert.Equal(t, model.StatusProcessing, <-sent)
+	assert.NoError(t, svc.HandleOrderEvent(context.Background(), event))
+	assert.Equal(t, model.StatusCompleted, <-sent)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WatchOrder did not return after a terminal status")
+	}
+}
+
+func TestOrderService_WatchOrder_EndsWhenClientLeaves(t *testing.T) {
+	svc, repo, _, _, _ := newTestOrderService()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusPending}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.WatchOrder(ctx, "order-1", func(o *model.Order) error { return nil })
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.True(t, errors.Is(err, context.Canceled))
+	case <-time.After(time.Second):
+		t.Fatal("WatchOrder did not return after the context was cancelled")
+	}
+}
+
+func TestOrderService_WatchOrder_AlreadyTerminal(t *testing.T) {
+	svc, repo, _, _, _ := newTestOrderService()
+	repo.On("GetOrderByID", mock.Anything, "order-1").Return(&model.Order{ID: "order-1", Status: model.StatusCancelled}, nil).Once()
+
+	calls := 0
+	err := svc.WatchOrder(context.Background(), "order-1", func(o *model.Order) error {
+		calls++
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestOrderService_ListUserOrdersPage_ReturnsTokenForNextPage(t *testing.T) {
+	svc, repo, _, _, _ := newTestOrderService()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	page1 := []*model.Order{
+		{ID: "order-3", CreatedAt: base.Add(3 * time.Minute)},
+		{ID: "order-2", CreatedAt: base.Add(2 * time.Minute)},
+		{ID: "order-1", CreatedAt: base.Add(1 * time.Minute)}, // The extra row: there is a next page
+	}
+	repo.On("ListOrdersByUserIDAfter", mock.Anything, "user-1", (*pagination.Cursor)(nil), 3).Return(page1, nil).Once()
+
+	orders, next, err := svc.ListUserOrdersPage(context.Background(), "user-1", "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.NotEmpty(t, next)
+
+	// The token resumes strictly after the last order returned
+	repo.On("ListOrdersByUserIDAfter", mock.Anything, "user-1", mock.MatchedBy(func(c *pagination.Cursor) bool {
+		return c != nil && c.ID == "order-2" && c.CreatedAt.Equal(base.Add(2*time.Minute))
+	}), 3).Return(page1[2:], nil).Once()
+
+	orders, next, err = svc.ListUserOrdersPage(context.Background(), "user-1", next, 2)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Empty(t, next)
+	repo.AssertExpectations(t)
+}
+
+func TestOrderService_ListUserOrdersPage_RejectsOtherUsersToken(t *testing.T) {
+	svc, _, _, _, _ := newTestOrderService()
+	token := testPageTokens.Encode("orders:user-2", pagination.Cursor{CreatedAt: time.Now(), ID: "order-9"})
+
+	_, _, err := svc.ListUserOrdersPage(context.Background(), "user-1", token, 10)
+
+	assert.True(t, errors.Is(err, ErrInvalidPageToken))
+}
+
+func TestOrderService_EraseUserOrders(t *testing.T) {
+	svc, repo, _, _, _ := newTestOrderService()
+	pseudonym := "5f0c6a0e-8d1b-4c3e-9a57-2f1e0b7c4d21"
+	repo.On("PseudonymiseUserOrders", mock.Anything, "user-1", pseudonym).Return(int64(3), nil).Once()
+
+	n, err := svc.EraseUserOrders(context.Background(), "user-1", pseudonym)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	repo.AssertExpectations(t)
+}
+
+func TestOrderService_EraseUserOrders_RejectsBadPseudonym(t *testing.T) {
+	svc, repo, _, _, _ := newTestOrderService()
+
+	for _, pseudonym := range []string{"", "user-1", "not-a-uuid"} {
+		_, err := svc.EraseUserOrders(context.Background(), "user-1", pseudonym)
+		assert.ErrorIs(t, err, ErrInvalidOrderData, pseudonym)
+	}
+	repo.AssertNotCalled(t, "PseudonymiseUserOrders", mock.Anything, mock.Anything, mock.Anything)
+}
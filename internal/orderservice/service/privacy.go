@@ -0,0 +1,39 @@
+// internal/orderservice/service/privacy.go
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"microservices-project/internal/orderservice/model"
+
+	"github.com/google/uuid"
+)
+
+// ExportUserOrders returns every order of the user with its items, for the UserService's
+// data exports.
+func (s *OrderService) ExportUserOrders(ctx context.Context, userID string) ([]*model.Order, error) {
+	if userID == "" {
+		return nil, ErrInvalidOrderData
+	}
+	return s.repo.ListAllOrdersByUserID(ctx, userID)
+}
+
+// EraseUserOrders detaches the user's orders from them for the UserService's erasures: the
+// orders move to pseudonym, which only the UserService can map back, and keep nothing of
+// the shipping address but the country. Amounts, items and statuses are kept for the
+// accounts. Calling it again with the same pseudonym changes nothing more.
+func (s *OrderService) EraseUserOrders(ctx context.Context, userID, pseudonym string) (int64, error) {
+	if userID == "" || pseudonym == "" || pseudonym == userID {
+		return 0, fmt.Errorf("%w: user_id and a different pseudonym are required", ErrInvalidOrderData)
+	}
+	if _, err := uuid.Parse(pseudonym); err != nil {
+		return 0, fmt.Errorf("%w: pseudonym must be a UUID", ErrInvalidOrderData)
+	}
+	n, err := s.repo.PseudonymiseUserOrders(ctx, userID, pseudonym)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Pseudonymised %d order(s) of an erased user", n)
+	return n, nil
+}
@@ -0,0 +1,396 @@
+// internal/orderservice/service/saga.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/orderservice/model"
+	"microservices-project/internal/orderservice/repository"
+	productpb "microservices-project/protos/productpb"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// compensationTimeout bounds how long we spend unwinding a saga.
+// Compensation runs on a context detached from the caller, because the most common
+// reason for giving up on an order is that the client's context was cancelled.
+const compensationTimeout = 30 * time.Second
+
+var ErrCompensationFailed = errors.New("failed to compensate order saga")
+
+// errOrderKept is returned by compensate when the reservation turned out to be committed,
+// so the order stands and the saga is completed instead.
+var errOrderKept = errors.New("reservation was committed; order kept")
+
+// orderSaga drives the distributed part of a single CreateOrder call:
+// reserve stock in ProductService, write the order, then commit the reservation.
+// Each completed step is persisted together with what it takes to undo it, so a failure
+// (or a crash) can always work out what to release or cancel.
+type orderSaga struct {
+	sagaRepo      repository.SagaRepositoryInterface
+	orderRepo     repository.OrderRepositoryInterface
+	productClient productpb.ProductServiceClient
+	saga          *model.Saga
+}
+
+// startOrderSaga records a new saga and pre-assigns the ID of the order it will create.
+// If orderID is empty a new one is generated.
+func startOrderSaga(
+	ctx context.Context,
+	sagaRepo repository.SagaRepositoryInterface,
+	orderRepo repository.OrderRepositoryInterface,
+	productClient productpb.ProductServiceClient,
+	userID string,
+	orderID string,
+) (*orderSaga, error) {
+	if orderID == "" {
+		orderID = uuid.New().String()
+	}
+	saga, err := sagaRepo.CreateSaga(ctx, &model.Saga{
+		OrderID: orderID,
+		UserID:  userID,
+		Status:  model.SagaStatusStarted,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record order saga: %w", err)
+	}
+	return &orderSaga{sagaRepo: sagaRepo, orderRepo: orderRepo, productClient: productClient, saga: saga}, nil
+}
+
+// recordStep adds a completed step to the saga. The step is kept in memory even if
+// persisting it fails, so that an immediate compensation still knows to undo it.
+func (o *orderSaga) recordStep(ctx context.Context, step model.SagaStep) error {
+	step.Status = model.SagaStepApplied
+	err := o.sagaRepo.AddStep(ctx, o.saga.ID, &step)
+	o.saga.Steps = append(o.saga.Steps, step)
+	if err != nil {
+		return fmt.Errorf("failed to record saga step %s: %w", step.Action, err)
+	}
+	return nil
+}
+
+// reserveStock holds every item in one all-or-nothing ReserveStock call. The step is recorded
+// as PENDING first and its ID sent as the reservation's reference, so if the call times out
+// or we crash before hearing back, compensation can still find and release the reservation.
+func (o *orderSaga) reserveStock(ctx context.Context, quantities map[string]int32) error {
+	productIDs := make([]string, 0, len(quantities))
+	for productID := range quantities {
+		productIDs = append(productIDs, productID)
+	}
+	sort.Strings(productIDs)
+
+	items := make([]*productpb.ReservationItem, 0, len(productIDs))
+	for _, productID := range productIDs {
+		items = append(items, &productpb.ReservationItem{ProductId: productID, Quantity: quantities[productID]})
+	}
+
+	step := model.SagaStep{Action: model.SagaActionReserveStock, Status: model.SagaStepPending}
+	if err := o.sagaRepo.AddStep(ctx, o.saga.ID, &step); err != nil {
+		return fmt.Errorf("failed to record saga step %s: %w", step.Action, err)
+	}
+	o.saga.Steps = append(o.saga.Steps, step)
+
+	log.Printf("Saga %s: reserving stock for %d product(s)", o.saga.ID, len(items))
+	resp, err := o.productClient.ReserveStock(ctx, &productpb.ReserveStockRequest{
+		Reference: step.ID,
+		Items:     items,
+	})
+	if err != nil {
+		log.Printf("Saga %s: failed to reserve stock: %v", o.saga.ID, err)
+		switch status.Code(err) {
+		case codes.FailedPrecondition:
+			return fmt.Errorf("%w: %s", ErrInsufficientStockForOrder, status.Convert(err).Message())
+		case codes.NotFound:
+			return fmt.Errorf("%w: %s", ErrProductFetchFailed, status.Convert(err).Message())
+		}
+		stockUpdateFailed(stockOpReserve, err)
+		return fmt.Errorf("%w: %v", ErrProductStockUpdateFailed, err)
+	}
+
+	reservationID := resp.GetReservation().GetId()
+	log.Printf("Saga %s: stock reserved as %s", o.saga.ID, reservationID)
+	o.markApplied(ctx, &o.saga.Steps[len(o.saga.Steps)-1], reservationID)
+	return nil
+}
+
+// createOrder writes the order row under the ID reserved for this saga.
+func (o *orderSaga) createOrder(ctx context.Context, order *model.Order) (*model.Order, error) {
+	order.ID = o.saga.OrderID
+	createdOrder, err := o.orderRepo.CreateOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	// Recovery looks the order up by saga.OrderID anyway, so losing this step record is harmless.
+	if err := o.recordStep(ctx, model.SagaStep{Action: model.SagaActionCreateOrder, Reference: createdOrder.ID}); err != nil {
+		log.Printf("Saga %s: %v", o.saga.ID, err)
+	}
+	return createdOrder, nil
+}
+
+// commit turns the reservation into a real stock deduction. This is the saga's pivot:
+// once it succeeds the order stands and nothing is compensated any more.
+func (o *orderSaga) commit(ctx context.Context) error {
+	reservationID := o.reservationID()
+	if reservationID == "" {
+		stockUpdateFailed(stockOpCommit, nil)
+		return fmt.Errorf("%w: saga %s has no reservation to commit", ErrProductStockUpdateFailed, o.saga.ID)
+	}
+	if _, err := o.productClient.CommitReservation(ctx, &productpb.CommitReservationRequest{ReservationId: reservationID}); err != nil {
+		log.Printf("Saga %s: failed to commit reservation %s: %v", o.saga.ID, reservationID, err)
+		stockUpdateFailed(stockOpCommit, err)
+		return fmt.Errorf("%w: could not commit reservation %s: %w", ErrProductStockUpdateFailed, reservationID, err)
+	}
+
+	o.saga.Status = model.SagaStatusCompleted
+	if err := o.sagaRepo.UpdateSagaStatus(ctx, o.saga.ID, model.SagaStatusCompleted, ""); err != nil {
+		// Recovery will find the order, re-commit (a no-op) and complete the saga.
+		log.Printf("Saga %s: failed to mark as completed (recovery will retry): %v", o.saga.ID, err)
+	}
+	return nil
+}
+
+func (o *orderSaga) reservationID() string {
+	for _, step := range o.saga.Steps {
+		if step.Action == model.SagaActionReserveStock && step.Status == model.SagaStepApplied {
+			return step.Reference
+		}
+	}
+	return ""
+}
+
+// compensate releases the saga's reservation, then cancels its order. The reservation goes
+// first because a commit whose response was lost may have gone through: then the order
+// stands, the saga is completed and errOrderKept is returned. If any compensation fails the
+// saga is left COMPENSATING so recovery can retry it later.
+func (o *orderSaga) compensate(ctx context.Context, cause error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), compensationTimeout)
+	defer cancel()
+
+	lastError := ""
+	if cause != nil {
+		lastError = cause.Error()
+	}
+	o.saga.Status = model.SagaStatusCompensating
+	if err := o.sagaRepo.UpdateSagaStatus(ctx, o.saga.ID, model.SagaStatusCompensating, lastError); err != nil {
+		log.Printf("Saga %s: failed to mark as compensating: %v", o.saga.ID, err)
+	}
+
+	if step := o.openStep(model.SagaActionReserveStock); step != nil {
+		committed, err := o.release(ctx, step)
+		if err != nil {
+			// The order is left alone until we know whether the reservation was committed
+			log.Printf("Saga %s: failed to release reservation: %v", o.saga.ID, err)
+			return fmt.Errorf("%w: saga %s could not release its reservation: %v", ErrCompensationFailed, o.saga.ID, err)
+		}
+		if committed {
+			return o.settleCommitted(ctx, step, lastError)
+		}
+		o.markCompensated(ctx, step)
+	}
+
+	if step := o.openStep(model.SagaActionCreateOrder); step != nil {
+		log.Printf("Saga %s: cancelling order %s", o.saga.ID, step.Reference)
+		_, err := o.orderRepo.UpdateOrderStatus(ctx, step.Reference, model.StatusCancelled)
+		if err != nil && !errors.Is(err, repository.ErrOrderNotFound) {
+			log.Printf("Saga %s: failed to cancel order %s: %v", o.saga.ID, step.Reference, err)
+			return fmt.Errorf("%w: saga %s could not cancel order %s: %v", ErrCompensationFailed, o.saga.ID, step.Reference, err)
+		}
+		o.markCompensated(ctx, step)
+	}
+
+	o.finishCompensation(ctx, lastError)
+	return nil
+}
+
+// openStep returns the saga's step for action unless it is missing or already compensated.
+// PENDING steps count: their call may have gone through.
+func (o *orderSaga) openStep(action model.SagaAction) *model.SagaStep {
+	for i := range o.saga.Steps {
+		if step := &o.saga.Steps[i]; step.Action == action && step.Status != model.SagaStepCompensated {
+			return step
+		}
+	}
+	return nil
+}
+
+// release gives back the stock held by a RESERVE_STOCK step. It reports committed if the
+// reservation was committed, which ReleaseReservation refuses with FailedPrecondition.
+func (o *orderSaga) release(ctx context.Context, step *model.SagaStep) (committed bool, err error) {
+	req := &productpb.ReleaseReservationRequest{ReservationId: step.Reference}
+	if step.Status == model.SagaStepPending {
+		// We never heard back from ReserveStock; release whatever it reserved under the step's ID
+		log.Printf("Saga %s: releasing any reservation made for step %s", o.saga.ID, step.ID)
+		req = &productpb.ReleaseReservationRequest{Reference: step.ID}
+	} else {
+		log.Printf("Saga %s: releasing reservation %s", o.saga.ID, step.Reference)
+	}
+	_, err = o.productClient.ReleaseReservation(ctx, req)
+	switch status.Code(err) {
+	case codes.OK, codes.NotFound: // NotFound: nothing was reserved
+		return false, nil
+	case codes.FailedPrecondition:
+		return true, nil
+	}
+	return false, err
+}
+
+// settleCommitted finishes a saga whose reservation turned out to be committed. Normally
+// the order is still there and simply stands. But if this saga already cancelled it (as
+// earlier releases did before releasing), the deducted stock belongs to no order and is
+// put back.
+func (o *orderSaga) settleCommitted(ctx context.Context, step *model.SagaStep, lastError string) error {
+	if !o.hasCancelledOrder() {
+		log.Printf("Saga %s: reservation %s was committed after all; order %s stands", o.saga.ID, step.Reference, o.saga.OrderID)
+		o.saga.Status = model.SagaStatusCompleted
+		if err := o.sagaRepo.UpdateSagaStatus(ctx, o.saga.ID, model.SagaStatusCompleted, ""); err != nil {
+			log.Printf("Saga %s: failed to mark as completed: %v", o.saga.ID, err)
+		}
+		return errOrderKept
+	}
+
+	order, err := o.orderRepo.GetOrderByID(ctx, o.saga.OrderID)
+	if err != nil {
+		return fmt.Errorf("%w: saga %s could not load cancelled order %s to restock it: %v", ErrCompensationFailed, o.saga.ID, o.saga.OrderID, err)
+	}
+	// Flip the step first, as CancelOrder flips the order: only one restock may ever happen
+	if err := o.sagaRepo.UpdateStepStatus(ctx, step.ID, model.SagaStepCompensated); err != nil {
+		return fmt.Errorf("%w: saga %s could not record restocking: %v", ErrCompensationFailed, o.saga.ID, err)
+	}
+	log.Printf("Saga %s: restocking committed reservation %s of cancelled order %s", o.saga.ID, step.Reference, order.ID)
+	if err := restockItems(ctx, o.productClient, order.Items); err != nil {
+		if revertErr := o.sagaRepo.UpdateStepStatus(ctx, step.ID, model.SagaStepApplied); revertErr != nil {
+			log.Printf("Saga %s: failed to reopen step %s after failed restock: %v", o.saga.ID, step.ID, revertErr)
+		}
+		return fmt.Errorf("%w: saga %s could not restock order %s: %v", ErrCompensationFailed, o.saga.ID, order.ID, err)
+	}
+	step.Status = model.SagaStepCompensated
+	o.finishCompensation(ctx, lastError)
+	return nil
+}
+
+// hasCancelledOrder reports whether this saga cancelled its order.
+func (o *orderSaga) hasCancelledOrder() bool {
+	for _, step := range o.saga.Steps {
+		if step.Action == model.SagaActionCreateOrder && step.Status == model.SagaStepCompensated {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *orderSaga) finishCompensation(ctx context.Context, lastError string) {
+	o.saga.Status = model.SagaStatusCompensated
+	if err := o.sagaRepo.UpdateSagaStatus(ctx, o.saga.ID, model.SagaStatusCompensated, lastError); err != nil {
+		log.Printf("Saga %s: failed to mark as compensated: %v", o.saga.ID, err)
+	}
+	log.Printf("Saga %s: compensated.", o.saga.ID)
+}
+
+// markCompensated records that a step has been undone.
+func (o *orderSaga) markCompensated(ctx context.Context, step *model.SagaStep) {
+	step.Status = model.SagaStepCompensated
+	if step.ID == "" {
+		return // Never persisted, nothing to update
+	}
+	if err := o.sagaRepo.UpdateStepStatus(ctx, step.ID, model.SagaStepCompensated); err != nil {
+		// Leaving the step APPLIED in the DB means recovery undoes it again, which is harmless:
+		// releasing and cancelling are idempotent.
+		log.Printf("Saga %s: failed to record compensation of %s: %v", o.saga.ID, step.Action, err)
+	}
+}
+
+// markApplied records that a pending step went through, and the reference it produced.
+func (o *orderSaga) markApplied(ctx context.Context, step *model.SagaStep, reference string) {
+	step.Status = model.SagaStepApplied
+	step.Reference = reference
+	if err := o.sagaRepo.ApplyStep(ctx, step.ID, reference); err != nil {
+		// Left PENDING in the DB, the step is still undone by its ID if the saga is compensated
+		log.Printf("Saga %s: failed to record %s as applied: %v", o.saga.ID, step.Action, err)
+	}
+}
+
+// RecoverSagas finishes sagas left behind by a crashed or killed orderservice.
+// A saga whose order was written is resumed by committing its reservation; everything
+// else is compensated. Only sagas untouched for staleAfter are considered, so in-flight
+// requests are left alone.
+func (s *OrderService) RecoverSagas(ctx context.Context, staleAfter time.Duration) error {
+	staleBefore := time.Now().Add(-staleAfter)
+	sagas, err := s.sagaRepo.ListUnfinishedSagas(ctx, staleBefore)
+	if err != nil {
+		return fmt.Errorf("failed to list unfinished sagas: %w", err)
+	}
+
+	var recoverErr error
+	for _, saga := range sagas {
+		claimed, err := s.sagaRepo.ClaimSaga(ctx, saga.ID, staleBefore)
+		if err != nil {
+			recoverErr = errors.Join(recoverErr, err)
+			continue
+		}
+		if !claimed {
+			continue // Another replica got there first
+		}
+		if err := s.recoverSaga(ctx, saga); err != nil {
+			recoverErr = errors.Join(recoverErr, err)
+		}
+	}
+	return recoverErr
+}
+
+func (s *OrderService) recoverSaga(ctx context.Context, saga *model.Saga) error {
+	o := &orderSaga{sagaRepo: s.sagaRepo, orderRepo: s.repo, productClient: s.productServiceClient, saga: saga}
+
+	cause := errors.New("orderservice stopped before the saga finished")
+	if saga.LastError != "" {
+		cause = errors.New(saga.LastError)
+	}
+
+	if saga.Status == model.SagaStatusStarted {
+		_, err := s.repo.GetOrderByID(ctx, saga.OrderID)
+		switch {
+		case err == nil && o.reservationID() == "":
+			// The reservation's ID was never recorded, so there is nothing we can commit.
+			cause = fmt.Errorf("order %s was written without a recorded reservation", saga.OrderID)
+			o.addOrderStep()
+		case err == nil:
+			o.addOrderStep()
+			log.Printf("Saga %s: order %s exists, resuming by committing its reservation.", saga.ID, saga.OrderID)
+			err := o.commit(ctx)
+			if err == nil {
+				return nil
+			}
+			// Expired or released reservations can never be committed; anything else may be transient.
+			if code := status.Code(err); code != codes.FailedPrecondition && code != codes.NotFound {
+				return err // Probably transient; try again on the next pass
+			}
+			cause = err
+		case !errors.Is(err, repository.ErrOrderNotFound):
+			return err
+		}
+	}
+
+	log.Printf("Saga %s: compensating unfinished order %s.", saga.ID, saga.OrderID)
+	if err := o.compensate(ctx, cause); !errors.Is(err, errOrderKept) {
+		return err
+	}
+	return nil
+}
+
+// addOrderStep records the saga's order as written, if it isn't yet, so that compensation
+// cancels it. Needed when we crashed between writing the order and recording the step.
+func (o *orderSaga) addOrderStep() {
+	for _, step := range o.saga.Steps {
+		if step.Action == model.SagaActionCreateOrder {
+			return
+		}
+	}
+	o.saga.Steps = append(o.saga.Steps, model.SagaStep{
+		Action: model.SagaActionCreateOrder, Reference: o.saga.OrderID, Status: model.SagaStepApplied,
+	})
+}
@@ -0,0 +1,127 @@
+// internal/orderservice/service/watch.go
+package service
+
+import (
+	"context"
+	"log"
+	"microservices-project/internal/orderservice/model"
+	"sync"
+	"time"
+)
+
+// defaultWatchPollInterval is how often a watched order is re-read even without an event.
+// Events only reach the replica that relays them (or every replica with LISTEN/NOTIFY, which
+// can drop notifications), so polling is what guarantees a watcher sees every change.
+const defaultWatchPollInterval = 5 * time.Second
+
+// orderWatchers fans "order changed" signals out to WatchOrder calls on this replica.
+type orderWatchers struct {
+	mu        sync.Mutex
+	subs      map[string]map[chan struct{}]struct{} // orderID -> signal channels
+	closed    chan struct{}                         // Closed on shutdown to end every stream
+	closeOnce sync.Once
+}
+
+func newOrderWatchers() *orderWatchers {
+	return &orderWatchers{
+		subs:   make(map[string]map[chan struct{}]struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+func (w *orderWatchers) subscribe(orderID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	if w.subs[orderID] == nil {
+		w.subs[orderID] = make(map[chan struct{}]struct{})
+	}
+	w.subs[orderID][ch] = struct{}{}
+	w.mu.Unlock()
+
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.subs[orderID], ch)
+		if len(w.subs[orderID]) == 0 {
+			delete(w.subs, orderID)
+		}
+		w.mu.Unlock()
+	}
+}
+
+func (w *orderWatchers) notify(orderID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subs[orderID] {
+		select {
+		case ch <- struct{}{}:
+		default: // A signal is already pending; the watcher re-reads the order anyway
+		}
+	}
+}
+
+// HandleOrderEvent wakes up watchers of the order an event refers to.
+// It has the events.Handler signature so it can be subscribed to the event bus or a Postgres listener.
+func (s *OrderService) HandleOrderEvent(ctx context.Context, event *model.OutboxEvent) error {
+	if event.AggregateType == model.AggregateOrder {
+		s.watchers.notify(event.AggregateID)
+	}
+	return nil
+}
+
+// CloseWatchers ends every WatchOrder call. Call it before stopping the servers: graceful
+// shutdown waits for open streams, and a watched order may never reach a terminal status.
+func (s *OrderService) CloseWatchers() {
+	s.watchers.closeOnce.Do(func() { close(s.watchers.closed) })
+}
+
+// WatchOrder calls send with the current order and then again after every status change.
+// It returns nil once the order reaches a terminal status or the service is shutting down,
+// and ctx's error when the caller goes away.
+func (s *OrderService) WatchOrder(ctx context.Context, orderID string, send func(*model.Order) error) error {
+	if orderID == "" {
+		return ErrInvalidOrderData
+	}
+
+	// Subscribe before the first read so a change in between is not missed
+	changed, unsubscribe := s.watchers.subscribe(orderID)
+	defer unsubscribe()
+
+	order, err := s.repo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if err := send(order); err != nil {
+		return err
+	}
+	lastStatus := order.Status
+
+	ticker := time.NewTicker(s.watchPollInterval)
+	defer ticker.Stop()
+	for !lastStatus.IsTerminal() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.watchers.closed:
+			return nil // Clients reconnect to another replica
+		case <-changed:
+		case <-ticker.C:
+		}
+
+		order, err := s.repo.GetOrderByID(ctx, orderID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Error re-reading watched order %s: %v", orderID, err)
+			return err
+		}
+		if order.Status == lastStatus {
+			continue
+		}
+		if err := send(order); err != nil {
+			return err
+		}
+		lastStatus = order.Status
+	}
+	return nil
+}
@@ -3,9 +3,11 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"log"
 	"microservices-project/internal/productservice/service"
 	"microservices-project/internal/productservice/model"
+	"microservices-project/pkg/auth"
 
 	productpb "microservices-project/protos/productpb"
 
@@ -15,6 +17,23 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// PublicMethods are the RPCs that can be called without a token. The catalog is public.
+var PublicMethods = []string{
+	productpb.ProductService_GetProduct_FullMethodName,
+	productpb.ProductService_ListProducts_FullMethodName,
+}
+
+// MethodScopes are the RPCs API keys may call, with the scope each needs. Stock reservations
+// stay with our own services.
+var MethodScopes = auth.MethodScopes{
+	productpb.ProductService_BatchGetProducts_FullMethodName: auth.ScopeProductsRead,
+	productpb.ProductService_CreateProduct_FullMethodName:    auth.ScopeProductsWrite,
+	productpb.ProductService_UpdateProduct_FullMethodName:    auth.ScopeProductsWrite,
+	productpb.ProductService_DeleteProduct_FullMethodName:    auth.ScopeProductsWrite,
+	productpb.ProductService_UpdateStock_FullMethodName:      auth.ScopeProductsWrite,
+	productpb.ProductService_BatchUpdateStock_FullMethodName: auth.ScopeProductsWrite,
+}
+
 type ProductGRPCServer struct {
 	productpb.UnimplementedProductServiceServer
 	productService service.ProductServiceInterface
@@ -27,6 +46,9 @@ func NewProductGRPCServer(productService service.ProductServiceInterface) *Produ
 }
 
 func (s *ProductGRPCServer) CreateProduct(ctx context.Context, req *productpb.CreateProductRequest) (*productpb.CreateProductResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
 	log.Printf("gRPC CreateProduct request: Name=%s, Price=%.2f", req.Name, req.Price)
 	domainProduct, err := s.productService.CreateProduct(ctx, req.Name, req.Description, req.Price, req.StockQuantity)
 	if err != nil {
@@ -55,25 +77,33 @@ func (s *ProductGRPCServer) GetProduct(ctx context.Context, req *productpb.GetPr
 	return &productpb.GetProductResponse{Product: toProtoProduct(domainProduct)}, nil
 }
 
+func (s *ProductGRPCServer) BatchGetProducts(ctx context.Context, req *productpb.BatchGetProductsRequest) (*productpb.BatchGetProductsResponse, error) {
+	log.Printf("gRPC BatchGetProducts request: %d ID(s)", len(req.ProductIds))
+	domainProducts, missing, err := s.productService.BatchGetProducts(ctx, req.ProductIds)
+	if err != nil {
+		log.Printf("Error batch getting products via gRPC: %v", err)
+		if err == service.ErrInvalidProductData {
+			return nil, status.Errorf(codes.InvalidArgument, "between 1 and %d product IDs are required", service.MaxBatchGetProducts)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get products: %v", err)
+	}
+
+	protoProducts := make([]*productpb.Product, len(domainProducts))
+	for i, p := range domainProducts {
+		protoProducts[i] = toProtoProduct(p)
+	}
+	return &productpb.BatchGetProductsResponse{Products: protoProducts, MissingProductIds: missing}, nil
+}
+
 func (s *ProductGRPCServer) ListProducts(ctx context.Context, req *productpb.ListProductsRequest) (*productpb.ListProductsResponse, error) {
 	log.Printf("gRPC ListProducts request: PageSize=%d, PageToken=%s", req.PageSize, req.PageToken)
-	// Simple pagination for now, ignoring page_token from proto for this implementation phase
-	// Page token based pagination is more complex. We'll use page number derived from token if it were numeric.
-	// For now, let's assume page_size is the limit and page_token might imply an offset or page number.
-	// Let's treat PageSize as limit and map PageToken to page number if it's a simple integer string.
-	
-	page := 1 // Default page
-	// if req.PageToken != "" {
-	// 	// A proper implementation would decode the page_token
-	// }
-	pageSize := int(req.PageSize)
-	if pageSize <= 0 {
-		pageSize = 10 // Default page size
-	}
-
-	domainProducts, err := s.productService.ListProducts(ctx, page, pageSize) // Using page 1 for now
+
+	domainProducts, nextPageToken, err := s.productService.ListProductsPage(ctx, req.PageToken, int(req.PageSize))
 	if err != nil {
 		log.Printf("Error listing products via gRPC: %v", err)
+		if errors.Is(err, service.ErrInvalidPageToken) {
+			return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Errorf(codes.Internal, "failed to list products: %v", err)
 	}
 
@@ -81,12 +111,13 @@ func (s *ProductGRPCServer) ListProducts(ctx context.Context, req *productpb.Lis
 	for _, p := range domainProducts {
 		protoProducts = append(protoProducts, toProtoProduct(p))
 	}
-	// For simplicity, not implementing next_page_token yet
-	return &productpb.ListProductsResponse{Products: protoProducts, NextPageToken: ""}, nil
+	return &productpb.ListProductsResponse{Products: protoProducts, NextPageToken: nextPageToken}, nil
 }
 
-
 func (s *ProductGRPCServer) UpdateProduct(ctx context.Context, req *productpb.UpdateProductRequest) (*productpb.UpdateProductResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
 	log.Printf("gRPC UpdateProduct request: ID=%s, Name=%s", req.ProductId, req.Name)
 	domainProduct, err := s.productService.UpdateProduct(ctx, req.ProductId, req.Name, req.Description, req.Price, req.StockQuantity)
 	if err != nil {
@@ -104,6 +135,9 @@ func (s *ProductGRPCServer) UpdateProduct(ctx context.Context, req *productpb.Up
 
 
 func (s *ProductGRPCServer) DeleteProduct(ctx context.Context, req *productpb.DeleteProductRequest) (*productpb.DeleteProductResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
 	log.Printf("gRPC DeleteProduct request: ID=%s", req.ProductId)
 	err := s.productService.DeleteProduct(ctx, req.ProductId)
 	if err != nil {
@@ -120,6 +154,9 @@ func (s *ProductGRPCServer) DeleteProduct(ctx context.Context, req *productpb.De
 }
 
 func (s *ProductGRPCServer) UpdateStock(ctx context.Context, req *productpb.UpdateStockRequest) (*productpb.UpdateStockResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
 	log.Printf("gRPC UpdateStock request: ProductID=%s, QuantityChange=%d", req.ProductId, req.QuantityChange)
 	updatedProduct, err := s.productService.UpdateStock(ctx, req.ProductId, req.QuantityChange)
 	if err != nil {
@@ -138,6 +175,123 @@ func (s *ProductGRPCServer) UpdateStock(ctx context.Context, req *productpb.Upda
 	return &productpb.UpdateStockResponse{Product: toProtoProduct(updatedProduct)}, nil
 }
 
+func (s *ProductGRPCServer) BatchUpdateStock(ctx context.Context, req *productpb.BatchUpdateStockRequest) (*productpb.BatchUpdateStockResponse, error) {
+	// OrderService restocks cancelled orders with it
+	if err := auth.CheckRole(ctx, auth.RoleAdmin, auth.RoleService); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC BatchUpdateStock request: %d update(s)", len(req.Updates))
+	changes := make([]model.StockChange, len(req.Updates))
+	for i, update := range req.Updates {
+		changes[i] = model.StockChange{ProductID: update.ProductId, QuantityChange: update.QuantityChange}
+	}
+
+	updatedProducts, err := s.productService.BatchUpdateStock(ctx, changes)
+	if err != nil {
+		log.Printf("Error batch updating stock via gRPC: %v", err)
+		switch {
+		case errors.Is(err, service.ErrProductNotFound):
+			return nil, status.Errorf(codes.NotFound, err.Error())
+		case errors.Is(err, service.ErrInsufficientStock):
+			return nil, status.Errorf(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, service.ErrInvalidProductData):
+			return nil, status.Errorf(codes.InvalidArgument, "between 1 and %d valid stock updates are required: %v", service.MaxBatchUpdateStock, err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to update stock: %v", err)
+	}
+
+	results := make([]*productpb.UpdateStockResponse, len(updatedProducts))
+	for i, p := range updatedProducts {
+		results[i] = &productpb.UpdateStockResponse{Product: toProtoProduct(p)}
+	}
+	return &productpb.BatchUpdateStockResponse{Results: results}, nil
+}
+
+func (s *ProductGRPCServer) ReserveStock(ctx context.Context, req *productpb.ReserveStockRequest) (*productpb.ReserveStockResponse, error) {
+	// Internal: the order saga
+	if err := auth.CheckRole(ctx, auth.RoleService); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC ReserveStock request: Reference=%s, Items=%d", req.Reference, len(req.Items))
+	items := make([]model.ReservationItem, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = model.ReservationItem{ProductID: item.ProductId, Quantity: item.Quantity}
+	}
+
+	reservation, err := s.productService.ReserveStock(ctx, req.Reference, items)
+	if err != nil {
+		log.Printf("Error reserving stock via gRPC: %v", err)
+		return nil, reservationError(err, "failed to reserve stock")
+	}
+	return &productpb.ReserveStockResponse{Reservation: toProtoReservation(reservation)}, nil
+}
+
+func (s *ProductGRPCServer) CommitReservation(ctx context.Context, req *productpb.CommitReservationRequest) (*productpb.CommitReservationResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleService); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC CommitReservation request: ReservationID=%s", req.ReservationId)
+	reservation, err := s.productService.CommitReservation(ctx, req.ReservationId)
+	if err != nil {
+		log.Printf("Error committing reservation via gRPC: %v", err)
+		return nil, reservationError(err, "failed to commit reservation")
+	}
+	return &productpb.CommitReservationResponse{Reservation: toProtoReservation(reservation)}, nil
+}
+
+func (s *ProductGRPCServer) ReleaseReservation(ctx context.Context, req *productpb.ReleaseReservationRequest) (*productpb.ReleaseReservationResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleService); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC ReleaseReservation request: ReservationID=%s, Reference=%s", req.ReservationId, req.Reference)
+	var reservation *model.Reservation
+	var err error
+	if req.ReservationId == "" && req.Reference != "" {
+		reservation, err = s.productService.ReleaseReservationByReference(ctx, req.Reference)
+	} else {
+		reservation, err = s.productService.ReleaseReservation(ctx, req.ReservationId)
+	}
+	if err != nil {
+		log.Printf("Error releasing reservation via gRPC: %v", err)
+		return nil, reservationError(err, "failed to release reservation")
+	}
+	return &productpb.ReleaseReservationResponse{Reservation: toProtoReservation(reservation)}, nil
+}
+
+// reservationError maps reservation service errors to gRPC status codes.
+func reservationError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidReservation):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrProductNotFound), errors.Is(err, service.ErrReservationNotFound):
+		return status.Errorf(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrInsufficientStock),
+		errors.Is(err, service.ErrReservationExpired),
+		errors.Is(err, service.ErrReservationNotPending):
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	}
+	return status.Errorf(codes.Internal, "%s: %v", msg, err)
+}
+
+// Helper to convert domain model.Reservation to productpb.Reservation
+func toProtoReservation(r *model.Reservation) *productpb.Reservation {
+	if r == nil {
+		return nil
+	}
+	items := make([]*productpb.ReservationItem, len(r.Items))
+	for i, item := range r.Items {
+		items[i] = &productpb.ReservationItem{ProductId: item.ProductID, Quantity: item.Quantity}
+	}
+	return &productpb.Reservation{
+		Id:        r.ID,
+		Reference: r.Reference,
+		Items:     items,
+		Status:    string(r.Status),
+		ExpiresAt: timestamppb.New(r.ExpiresAt),
+		CreatedAt: timestamppb.New(r.CreatedAt),
+		UpdatedAt: timestamppb.New(r.UpdatedAt),
+	}
+}
 
 // Helper to convert domain model.Product to productpb.Product
 func toProtoProduct(p *model.Product) *productpb.Product {
@@ -150,6 +304,7 @@ func toProtoProduct(p *model.Product) *productpb.Product {
 		Description:    p.Description,
 		Price:          p.Price,
 		StockQuantity:  p.StockQuantity,
+		AvailableQuantity: p.AvailableQuantity,
 		CreatedAt:      timestamppb.New(p.CreatedAt),
 		UpdatedAt:      timestamppb.New(p.UpdatedAt),
 	}
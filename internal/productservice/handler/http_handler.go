@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"microservices-project/internal/productservice/service"
+	"microservices-project/pkg/auth"
 	"net/http"
 	"strconv"
 
@@ -12,6 +13,9 @@ import (
 	"github.com/go-chi/render"
 )
 
+// nextPageTokenHeader carries the token for the next page of a keyset-paginated list.
+const nextPageTokenHeader = "X-Next-Page-Token"
+
 type ProductHTTPHandler struct {
 	productService service.ProductServiceInterface
 }
@@ -26,11 +30,16 @@ func (h *ProductHTTPHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 
-	r.Post("/products", h.createProduct)
 	r.Get("/products/{productID}", h.getProduct)
 	r.Get("/products", h.listProducts)
-	r.Put("/products/{productID}", h.updateProduct)
-	r.Delete("/products/{productID}", h.deleteProduct)
+
+	// Catalog administration (admins only)
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeProductsWrite), auth.RequireRole(auth.RoleAdmin))
+		r.Post("/products", h.createProduct)
+		r.Put("/products/{productID}", h.updateProduct)
+		r.Delete("/products/{productID}", h.deleteProduct)
+	})
 	// UpdateStock is likely internal via gRPC, but could be exposed for admin if needed
 	// r.Patch("/products/{productID}/stock", h.updateStock) // Example for PATCH to update stock
 
@@ -109,19 +118,46 @@ func (h *ProductHTTPHandler) getProduct(w http.ResponseWriter, r *http.Request)
 	render.JSON(w, r, product)
 }
 
+// listProducts pages with ?page=&pageSize= (offset based) or, when page is not given,
+// with ?pageToken=&pageSize= (keyset based). In token mode the token for the next page is
+// returned in the X-Next-Page-Token header, which is absent on the last page.
 func (h *ProductHTTPHandler) listProducts(w http.ResponseWriter, r *http.Request) {
 	pageStr := r.URL.Query().Get("page")
 	pageSizeStr := r.URL.Query().Get("pageSize")
 
-	page, _ := strconv.Atoi(pageStr)
-	if page <= 0 {
-		page = 1
-	}
 	pageSize, _ := strconv.Atoi(pageSizeStr)
 	if pageSize <= 0 || pageSize > 100 {
 		pageSize = 10
 	}
 
+	if pageStr == "" {
+		pageToken := r.URL.Query().Get("pageToken")
+		log.Printf("HTTP ListProducts request: PageToken=%q, PageSize=%d", pageToken, pageSize)
+		products, nextPageToken, err := h.productService.ListProductsPage(r.Context(), pageToken, pageSize)
+		if err != nil {
+			log.Printf("Error listing products via HTTP: %v", err)
+			if errors.Is(err, service.ErrInvalidPageToken) {
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, map[string]string{"error": err.Error()})
+				return
+			}
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]string{"error": "Failed to list products"})
+			return
+		}
+		if nextPageToken != "" {
+			w.Header().Set(nextPageTokenHeader, nextPageToken)
+		}
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, products)
+		return
+	}
+
+	page, _ := strconv.Atoi(pageStr)
+	if page <= 0 {
+		page = 1
+	}
+
 	log.Printf("HTTP ListProducts request: Page=%d, PageSize=%d", page, pageSize)
 	products, err := h.productService.ListProducts(r.Context(), page, pageSize)
 	if err != nil {
@@ -5,11 +5,18 @@ import "time"
 
 // Product represents the domain model for a product.
 type Product struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	Price          float64   `json:"price"` // Use float64 for consistency with proto, handle precision carefully
-	StockQuantity  int32     `json:"stock_quantity"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-}
\ No newline at end of file
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Description       string    `json:"description"`
+	Price             float64   `json:"price"` // Use float64 for consistency with proto, handle precision carefully
+	StockQuantity     int32     `json:"stock_quantity"`     // On-hand quantity
+	AvailableQuantity int32     `json:"available_quantity"` // On-hand minus active reservations
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// StockChange is a signed adjustment to one product's stock_quantity.
+type StockChange struct {
+	ProductID      string `json:"product_id"`
+	QuantityChange int32  `json:"quantity_change"`
+}
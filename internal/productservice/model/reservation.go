@@ -0,0 +1,32 @@
+// internal/productservice/model/reservation.go
+package model
+
+import "time"
+
+type ReservationStatus string
+
+const (
+	ReservationPending   ReservationStatus = "PENDING"   // Holding stock until committed, released or expired
+	ReservationCommitted ReservationStatus = "COMMITTED" // Stock has been deducted from products.stock_quantity
+	ReservationReleased  ReservationStatus = "RELEASED"  // Given back by the caller
+	ReservationExpired   ReservationStatus = "EXPIRED"   // TTL passed before it was committed
+)
+
+// ReservationItem is the quantity of one product held by a reservation.
+type ReservationItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int32  `json:"quantity"`
+}
+
+// Reservation holds stock for a caller (typically an order) without deducting it yet.
+// A pending reservation stops counting against available stock once ExpiresAt passes,
+// even before the sweeper has flipped its status to EXPIRED.
+type Reservation struct {
+	ID        string            `json:"id"`
+	Reference string            `json:"reference"`
+	Items     []ReservationItem `json:"items"`
+	Status    ReservationStatus `json:"status"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
@@ -8,22 +8,54 @@ import (
 	"fmt"
 	"log"
 	"microservices-project/internal/productservice/model"
+	"microservices-project/pkg/pagination"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var ErrProductNotFound = errors.New("product not found")
 var ErrInsufficientStock = errors.New("insufficient stock")
 
+// reservedQuantitySQL sums the stock held by active reservations for the product aliased as p.
+// Expired reservations are excluded here directly, so availability is correct even if the
+// sweeper has not flipped their status yet.
+const reservedQuantitySQL = `COALESCE((SELECT SUM(ri.quantity)
+	FROM stock_reservation_items ri JOIN stock_reservations sr ON sr.id = ri.reservation_id
+	WHERE ri.product_id = p.id AND sr.status = 'PENDING' AND sr.expires_at > NOW()), 0)`
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// reservedQuantity returns how much of a product is held by active reservations.
+func reservedQuantity(ctx context.Context, q rowQuerier, productID string) (int32, error) {
+	var reserved int32
+	query := `SELECT ` + reservedQuantitySQL + ` FROM products p WHERE p.id = $1`
+	if err := q.QueryRowContext(ctx, query, productID).Scan(&reserved); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrProductNotFound
+		}
+		return 0, fmt.Errorf("failed to get reserved quantity: %w", err)
+	}
+	return reserved, nil
+}
+
 
 type ProductRepositoryInterface interface {
 	CreateProduct(ctx context.Context, product *model.Product) (*model.Product, error)
 	GetProductByID(ctx context.Context, id string) (*model.Product, error)
+	GetProductsByIDs(ctx context.Context, ids []string) ([]*model.Product, error)
 	ListProducts(ctx context.Context, limit int, offset int) ([]*model.Product, error) // Simple limit/offset for now
+	ListProductsAfter(ctx context.Context, after *pagination.Cursor, limit int) ([]*model.Product, error)
 	UpdateProduct(ctx context.Context, product *model.Product) (*model.Product, error)
 	DeleteProduct(ctx context.Context, id string) error
 	UpdateStock(ctx context.Context, productID string, quantityChange int32) (*model.Product, error)
+	BatchUpdateStock(ctx context.Context, changes []model.StockChange) ([]*model.Product, error)
 }
 
 type ProductRepository struct {
@@ -38,6 +70,7 @@ func (r *ProductRepository) CreateProduct(ctx context.Context, product *model.Pr
 	product.ID = uuid.New().String()
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = time.Now()
+	product.AvailableQuantity = product.StockQuantity // Nothing can be reserved yet
 
 	query := `INSERT INTO products (id, name, description, price, stock_quantity, created_at, updated_at)
 	          VALUES ($1, $2, $3, $4, $5, $6, $7)
@@ -56,12 +89,12 @@ func (r *ProductRepository) CreateProduct(ctx context.Context, product *model.Pr
 
 func (r *ProductRepository) GetProductByID(ctx context.Context, id string) (*model.Product, error) {
 	product := &model.Product{}
-	query := `SELECT id, name, description, price, stock_quantity, created_at, updated_at
-	          FROM products WHERE id = $1`
+	query := `SELECT p.id, p.name, p.description, p.price, p.stock_quantity, p.stock_quantity - ` + reservedQuantitySQL + `, p.created_at, p.updated_at
+	          FROM products p WHERE p.id = $1`
 
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&product.ID, &product.Name, &product.Description, &product.Price,
-		&product.StockQuantity, &product.CreatedAt, &product.UpdatedAt,
+		&product.StockQuantity, &product.AvailableQuantity, &product.CreatedAt, &product.UpdatedAt,
 	)
 
 	if err != nil {
@@ -74,15 +107,54 @@ func (r *ProductRepository) GetProductByID(ctx context.Context, id string) (*mod
 	return product, nil
 }
 
+// GetProductsByIDs fetches every product whose ID is in ids with a single query.
+// IDs that do not exist are simply absent from the result; callers compare against ids.
+func (r *ProductRepository) GetProductsByIDs(ctx context.Context, ids []string) ([]*model.Product, error) {
+	query := `SELECT p.id, p.name, p.description, p.price, p.stock_quantity, p.stock_quantity - ` + reservedQuantitySQL + `, p.created_at, p.updated_at
+	          FROM products p WHERE p.id = ANY($1)`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		log.Printf("Error getting products by IDs from DB: %v", err)
+		return nil, err
+	}
+	return scanProducts(rows)
+}
+
 func (r *ProductRepository) ListProducts(ctx context.Context, limit int, offset int) ([]*model.Product, error) {
-	query := `SELECT id, name, description, price, stock_quantity, created_at, updated_at
-	          FROM products ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+	query := `SELECT p.id, p.name, p.description, p.price, p.stock_quantity, p.stock_quantity - ` + reservedQuantitySQL + `, p.created_at, p.updated_at
+	          FROM products p ORDER BY p.created_at DESC, p.id DESC LIMIT $1 OFFSET $2`
 
 	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		log.Printf("Error listing products from DB: %v", err)
 		return nil, err
 	}
+	return scanProducts(rows)
+}
+
+// ListProductsAfter returns up to limit products that come after the cursor in
+// (created_at DESC, id DESC) order, or the first page if after is nil. Unlike OFFSET,
+// this seeks straight to the cursor using idx_products_created_at_id.
+func (r *ProductRepository) ListProductsAfter(ctx context.Context, after *pagination.Cursor, limit int) ([]*model.Product, error) {
+	query := `SELECT p.id, p.name, p.description, p.price, p.stock_quantity, p.stock_quantity - ` + reservedQuantitySQL + `, p.created_at, p.updated_at
+	          FROM products p`
+	args := []interface{}{limit}
+	if after != nil {
+		query += ` WHERE (p.created_at, p.id) < ($2, $3)`
+		args = append(args, after.CreatedAt, after.ID)
+	}
+	query += ` ORDER BY p.created_at DESC, p.id DESC LIMIT $1`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Error listing products after cursor from DB: %v", err)
+		return nil, err
+	}
+	return scanProducts(rows)
+}
+
+func scanProducts(rows *sql.Rows) ([]*model.Product, error) {
 	defer rows.Close()
 
 	products := []*model.Product{}
@@ -90,14 +162,14 @@ func (r *ProductRepository) ListProducts(ctx context.Context, limit int, offset
 		product := &model.Product{}
 		if err := rows.Scan(
 			&product.ID, &product.Name, &product.Description, &product.Price,
-			&product.StockQuantity, &product.CreatedAt, &product.UpdatedAt,
+			&product.StockQuantity, &product.AvailableQuantity, &product.CreatedAt, &product.UpdatedAt,
 		); err != nil {
 			log.Printf("Error scanning product row: %v", err)
 			return nil, err // Or collect errors and continue
 		}
 		products = append(products, product)
 	}
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		log.Printf("Error after iterating product rows: %v", err)
 		return nil, err
 	}
@@ -106,14 +178,14 @@ func (r *ProductRepository) ListProducts(ctx context.Context, limit int, offset
 
 func (r *ProductRepository) UpdateProduct(ctx context.Context, product *model.Product) (*model.Product, error) {
 	product.UpdatedAt = time.Now()
-	query := `UPDATE products
+	query := `UPDATE products p
 	          SET name = $1, description = $2, price = $3, stock_quantity = $4, updated_at = $5
 	          WHERE id = $6
-	          RETURNING created_at` // So we have all fields populated
+	          RETURNING created_at, p.stock_quantity - ` + reservedQuantitySQL // So we have all fields populated
 
 	err := r.db.QueryRowContext(ctx, query,
 		product.Name, product.Description, product.Price, product.StockQuantity, product.UpdatedAt, product.ID,
-	).Scan(&product.CreatedAt) // Scan CreatedAt to keep the model consistent
+	).Scan(&product.CreatedAt, &product.AvailableQuantity) // Scan CreatedAt to keep the model consistent
 
 	if err != nil {
 		if err == sql.ErrNoRows { // If RETURNING yields no row, it means ID didn't match
@@ -147,6 +219,7 @@ func (r *ProductRepository) DeleteProduct(ctx context.Context, id string) error
 
 // UpdateStock adjusts the stock quantity for a product.
 // It uses a transaction to ensure atomicity and checks for sufficient stock if decreasing.
+// A decrease may not eat into stock that is held by active reservations.
 func (r *ProductRepository) UpdateStock(ctx context.Context, productID string, quantityChange int32) (*model.Product, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -169,12 +242,18 @@ func (r *ProductRepository) UpdateStock(ctx context.Context, productID string, q
 		return nil, fmt.Errorf("failed to get product for stock update: %w", err)
 	}
 
+	reserved, err := reservedQuantity(ctx, tx, productID)
+	if err != nil {
+		return nil, err
+	}
+
 	newStock := currentProduct.StockQuantity + quantityChange
-	if newStock < 0 {
+	if newStock < 0 || (quantityChange < 0 && newStock < reserved) {
 		return nil, ErrInsufficientStock
 	}
 
 	currentProduct.StockQuantity = newStock
+	currentProduct.AvailableQuantity = newStock - reserved
 	currentProduct.UpdatedAt = time.Now()
 
 	queryUpdate := `UPDATE products SET stock_quantity = $1, updated_at = $2 WHERE id = $3`
@@ -188,4 +267,87 @@ func (r *ProductRepository) UpdateStock(ctx context.Context, productID string, q
 	}
 
 	return currentProduct, nil
-}
\ No newline at end of file
+}
+
+// BatchUpdateStock applies every change in one transaction, or none of them.
+// Changes to the same product are added together, and rows are locked in product ID order
+// (the same order ReserveStock uses) so concurrent batches and reservations can't deadlock.
+// The same rules as UpdateStock apply per product; every unknown product is named in the
+// returned ErrProductNotFound, and every product that breaks them in ErrInsufficientStock.
+func (r *ProductRepository) BatchUpdateStock(ctx context.Context, changes []model.StockChange) ([]*model.Product, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	changes = sortedStockChanges(changes)
+	products := make([]*model.Product, 0, len(changes))
+	var missing, shortages []string
+
+	querySelect := `SELECT id, name, description, price, stock_quantity, created_at, updated_at
+	                FROM products WHERE id = $1 FOR UPDATE`
+	for _, change := range changes {
+		product := &model.Product{}
+		err := tx.QueryRowContext(ctx, querySelect, change.ProductID).Scan(
+			&product.ID, &product.Name, &product.Description, &product.Price,
+			&product.StockQuantity, &product.CreatedAt, &product.UpdatedAt,
+		)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				missing = append(missing, change.ProductID)
+				continue
+			}
+			return nil, fmt.Errorf("failed to lock product for stock update: %w", err)
+		}
+
+		reserved, err := reservedQuantity(ctx, tx, change.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		newStock := product.StockQuantity + change.QuantityChange
+		if newStock < 0 || (change.QuantityChange < 0 && newStock < reserved) {
+			shortages = append(shortages, fmt.Sprintf("product %s (change %d, stock %d, available %d)",
+				change.ProductID, change.QuantityChange, product.StockQuantity, product.StockQuantity-reserved))
+			continue // Keep going so the caller hears about every short product at once
+		}
+		product.StockQuantity = newStock
+		product.AvailableQuantity = newStock - reserved
+		products = append(products, product)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrProductNotFound, strings.Join(missing, ", "))
+	}
+	if len(shortages) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInsufficientStock, strings.Join(shortages, "; "))
+	}
+
+	now := time.Now()
+	queryUpdate := `UPDATE products SET stock_quantity = $1, updated_at = $2 WHERE id = $3`
+	for _, product := range products {
+		product.UpdatedAt = now
+		if _, err := tx.ExecContext(ctx, queryUpdate, product.StockQuantity, product.UpdatedAt, product.ID); err != nil {
+			return nil, fmt.Errorf("failed to update stock for product %s: %w", product.ID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return products, nil
+}
+
+// sortedStockChanges merges changes to the same product and sorts them by product ID.
+func sortedStockChanges(changes []model.StockChange) []model.StockChange {
+	deltas := make(map[string]int32, len(changes))
+	for _, change := range changes {
+		deltas[change.ProductID] += change.QuantityChange
+	}
+	merged := make([]model.StockChange, 0, len(deltas))
+	for productID, delta := range deltas {
+		merged = append(merged, model.StockChange{ProductID: productID, QuantityChange: delta})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ProductID < merged[j].ProductID })
+	return merged
+}
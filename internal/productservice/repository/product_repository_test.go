@@ -0,0 +1,162 @@
+// internal/productservice/repository/product_repository_test.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"microservices-project/internal/productservice/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var productColumns = []string{"id", "name", "description", "price", "stock_quantity", "available_quantity", "created_at", "updated_at"}
+
+var lockedProductColumns = []string{"id", "name", "description", "price", "stock_quantity", "created_at", "updated_at"}
+
+const (
+	productA = "6f1c2d3e-0000-4000-8000-00000000000a"
+	productB = "6f1c2d3e-0000-4000-8000-00000000000b"
+	productC = "6f1c2d3e-0000-4000-8000-00000000000c"
+)
+
+func newMockDBAndProductRepo(t *testing.T) (sqlmock.Sqlmock, *ProductRepository) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return mock, NewProductRepository(db)
+}
+
+func TestProductRepository_GetProductsByIDs_LeavesOutMissingIDs(t *testing.T) {
+	mock, repo := newMockDBAndProductRepo(t)
+
+	now := time.Now()
+	ids := []string{"6f1c2d3e-0000-4000-8000-00000000000a", "6f1c2d3e-0000-4000-8000-00000000000b"}
+	mock.ExpectQuery(`SELECT (.+) FROM products p WHERE p.id = ANY\(\$1\)`).
+		WithArgs(pq.Array(ids)).
+		WillReturnRows(sqlmock.NewRows(productColumns).
+			AddRow(ids[0], "Widget", "", 9.99, 5, 3, now, now))
+
+	products, err := repo.GetProductsByIDs(context.Background(), ids)
+
+	require.NoError(t, err)
+	require.Len(t, products, 1) // ids[1] doesn't exist and is simply absent
+	assert.Equal(t, ids[0], products[0].ID)
+	assert.Equal(t, int32(5), products[0].StockQuantity)
+	assert.Equal(t, int32(3), products[0].AvailableQuantity)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectLockProductForUpdate(mock sqlmock.Sqlmock, productID string, stock int32) {
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM products WHERE id = \$1 FOR UPDATE`).
+		WithArgs(productID).
+		WillReturnRows(sqlmock.NewRows(lockedProductColumns).AddRow(productID, "Widget", "", 9.99, stock, now, now))
+}
+
+func expectUnknownProductForUpdate(mock sqlmock.Sqlmock, productID string) {
+	mock.ExpectQuery(`SELECT (.+) FROM products WHERE id = \$1 FOR UPDATE`).
+		WithArgs(productID).
+		WillReturnRows(sqlmock.NewRows(lockedProductColumns))
+}
+
+func TestProductRepository_BatchUpdateStock_AppliesMergedChangesInIDOrder(t *testing.T) {
+	mock, repo := newMockDBAndProductRepo(t)
+
+	mock.ExpectBegin()
+	expectLockProductForUpdate(mock, productA, 5)
+	expectReservedQuantity(mock, productA, 1)
+	expectLockProductForUpdate(mock, productB, 5)
+	expectReservedQuantity(mock, productB, 0)
+	mock.ExpectExec(`UPDATE products SET stock_quantity = \$1, updated_at = \$2 WHERE id = \$3`).
+		WithArgs(int32(3), sqlmock.AnyArg(), productA).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE products SET stock_quantity = \$1, updated_at = \$2 WHERE id = \$3`).
+		WithArgs(int32(6), sqlmock.AnyArg(), productB).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	products, err := repo.BatchUpdateStock(context.Background(), []model.StockChange{
+		{ProductID: productB, QuantityChange: 1},
+		{ProductID: productA, QuantityChange: -1},
+		{ProductID: productA, QuantityChange: -1},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, products, 2)
+	assert.Equal(t, productA, products[0].ID)
+	assert.Equal(t, int32(2), products[0].AvailableQuantity)
+	assert.Equal(t, productB, products[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProductRepository_BatchUpdateStock_ShortItemRollsBackEveryUpdate(t *testing.T) {
+	mock, repo := newMockDBAndProductRepo(t)
+
+	mock.ExpectBegin()
+	expectLockProductForUpdate(mock, productA, 5)
+	expectReservedQuantity(mock, productA, 0)
+	expectLockProductForUpdate(mock, productB, 5)
+	expectReservedQuantity(mock, productB, 4) // Only 1 of productB is left
+	mock.ExpectRollback()
+
+	_, err := repo.BatchUpdateStock(context.Background(), []model.StockChange{
+		{ProductID: productA, QuantityChange: -2},
+		{ProductID: productB, QuantityChange: -2},
+	})
+
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+	assert.Contains(t, err.Error(), productB)
+	assert.NoError(t, mock.ExpectationsWereMet()) // productA was never written either
+}
+
+func TestProductRepository_BatchUpdateStock_FailedWriteRollsBackEarlierUpdates(t *testing.T) {
+	mock, repo := newMockDBAndProductRepo(t)
+
+	mock.ExpectBegin()
+	expectLockProductForUpdate(mock, productA, 5)
+	expectReservedQuantity(mock, productA, 0)
+	expectLockProductForUpdate(mock, productB, 5)
+	expectReservedQuantity(mock, productB, 0)
+	mock.ExpectExec(`UPDATE products SET stock_quantity = \$1, updated_at = \$2 WHERE id = \$3`).
+		WithArgs(int32(3), sqlmock.AnyArg(), productA).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE products SET stock_quantity = \$1, updated_at = \$2 WHERE id = \$3`).
+		WithArgs(int32(3), sqlmock.AnyArg(), productB).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback() // Takes productA's update with it
+
+	_, err := repo.BatchUpdateStock(context.Background(), []model.StockChange{
+		{ProductID: productA, QuantityChange: -2},
+		{ProductID: productB, QuantityChange: -2},
+	})
+
+	assert.ErrorContains(t, err, "connection reset")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProductRepository_BatchUpdateStock_ReportsEveryUnknownProduct(t *testing.T) {
+	mock, repo := newMockDBAndProductRepo(t)
+
+	mock.ExpectBegin()
+	expectUnknownProductForUpdate(mock, productA)
+	expectLockProductForUpdate(mock, productB, 5)
+	expectReservedQuantity(mock, productB, 0)
+	expectUnknownProductForUpdate(mock, productC)
+	mock.ExpectRollback()
+
+	_, err := repo.BatchUpdateStock(context.Background(), []model.StockChange{
+		{ProductID: productC, QuantityChange: 1},
+		{ProductID: productB, QuantityChange: 1},
+		{ProductID: productA, QuantityChange: 1},
+	})
+
+	assert.ErrorIs(t, err, ErrProductNotFound)
+	assert.Contains(t, err.Error(), productA+", "+productC)
+	assert.NoError(t, mock.ExpectationsWereMet()) // Nothing was written
+}
@@ -0,0 +1,304 @@
+// internal/productservice/repository/reservation_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/productservice/model"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrReservationNotFound   = errors.New("reservation not found")
+	ErrReservationExpired    = errors.New("reservation expired")
+	ErrReservationNotPending = errors.New("reservation is no longer pending")
+)
+
+// ReservationRepositoryInterface stores two-phase stock reservations.
+// Product rows are always locked in product ID order to avoid deadlocks between reservations.
+type ReservationRepositoryInterface interface {
+	ReserveStock(ctx context.Context, reservation *model.Reservation) (*model.Reservation, error)
+	CommitReservation(ctx context.Context, reservationID string) (*model.Reservation, error)
+	ReleaseReservation(ctx context.Context, reservationID string) (*model.Reservation, error)
+	GetReservationIDByReference(ctx context.Context, reference string) (string, error)
+	ExpireReservations(ctx context.Context, now time.Time) (int64, error)
+}
+
+type ReservationRepository struct {
+	db *sql.DB
+}
+
+func NewReservationRepository(db *sql.DB) *ReservationRepository {
+	return &ReservationRepository{db: db}
+}
+
+// ReserveStock checks availability for every item and records the reservation.
+// It is all-or-nothing: if any product is short, nothing is reserved. If a reservation with
+// the same (non-empty) reference exists, it is returned instead, so callers can retry.
+func (r *ReservationRepository) ReserveStock(ctx context.Context, reservation *model.Reservation) (*model.Reservation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	items := sortedItems(reservation.Items)
+	stock := make(map[string]int32, len(items))
+	for _, item := range items {
+		var quantity int32
+		err := tx.QueryRowContext(ctx, `SELECT stock_quantity FROM products WHERE id = $1 FOR UPDATE`, item.ProductID).Scan(&quantity)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("%w: %s", ErrProductNotFound, item.ProductID)
+			}
+			return nil, fmt.Errorf("failed to lock product for reservation: %w", err)
+		}
+		stock[item.ProductID] = quantity
+	}
+
+	// A retry locks the same products, so by now the first attempt has committed or rolled back
+	if reservation.Reference != "" {
+		existing, err := getReservationByReference(ctx, tx, reservation.Reference)
+		if !errors.Is(err, ErrReservationNotFound) {
+			return existing, err
+		}
+	}
+
+	for _, item := range items {
+		reserved, err := reservedQuantity(ctx, tx, item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		if available := stock[item.ProductID] - reserved; available < item.Quantity {
+			return nil, fmt.Errorf("%w: product %s (requested %d, available %d)", ErrInsufficientStock, item.ProductID, item.Quantity, available)
+		}
+	}
+
+	now := time.Now()
+	reservation.ID = uuid.New().String()
+	reservation.Items = items
+	reservation.Status = model.ReservationPending
+	reservation.CreatedAt = now
+	reservation.UpdatedAt = now
+
+	query := `INSERT INTO stock_reservations (id, reference, status, expires_at, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)
+	          ON CONFLICT (reference) WHERE reference <> '' DO NOTHING`
+	result, err := tx.ExecContext(ctx, query, reservation.ID, reservation.Reference, reservation.Status, reservation.ExpiresAt, reservation.CreatedAt, reservation.UpdatedAt)
+	if err != nil {
+		log.Printf("Error inserting reservation into DB: %v", err)
+		return nil, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if inserted == 0 {
+		// A concurrent retry with the same reference got in first; its reservation is the one
+		return getReservationByReference(ctx, tx, reservation.Reference)
+	}
+
+	itemQuery := `INSERT INTO stock_reservation_items (reservation_id, product_id, quantity) VALUES ($1, $2, $3)`
+	for _, item := range items {
+		if _, err = tx.ExecContext(ctx, itemQuery, reservation.ID, item.ProductID, item.Quantity); err != nil {
+			log.Printf("Error inserting reservation item into DB: %v", err)
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return reservation, nil
+}
+
+// CommitReservation deducts the reserved quantities from stock_quantity.
+// Committing an already committed reservation is a no-op, so callers can safely retry.
+func (r *ReservationRepository) CommitReservation(ctx context.Context, reservationID string) (*model.Reservation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	reservation, err := getReservationForUpdate(ctx, tx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status == model.ReservationCommitted {
+		return reservation, nil
+	}
+	if reservation.Status != model.ReservationPending {
+		return nil, fmt.Errorf("%w: status is %s", ErrReservationNotPending, reservation.Status)
+	}
+
+	now := time.Now()
+	if !reservation.ExpiresAt.After(now) {
+		// Record the expiry ourselves rather than waiting for the sweeper.
+		if err := setReservationStatus(ctx, tx, reservation, model.ReservationExpired, now); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil, ErrReservationExpired
+	}
+
+	for _, item := range reservation.Items { // Already sorted by product ID
+		result, err := tx.ExecContext(ctx,
+			`UPDATE products SET stock_quantity = stock_quantity - $1, updated_at = $2 WHERE id = $3 AND stock_quantity >= $1`,
+			item.Quantity, now, item.ProductID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deduct reserved stock: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rowsAffected == 0 {
+			// Only possible if stock was set below the reserved amount via UpdateProduct, or the product was deleted.
+			return nil, fmt.Errorf("%w: product %s", ErrInsufficientStock, item.ProductID)
+		}
+	}
+
+	if err := setReservationStatus(ctx, tx, reservation, model.ReservationCommitted, now); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return reservation, nil
+}
+
+// ReleaseReservation gives the held stock back. Releasing a reservation that was already
+// released or has expired is a no-op; releasing a committed one is an error.
+func (r *ReservationRepository) ReleaseReservation(ctx context.Context, reservationID string) (*model.Reservation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	reservation, err := getReservationForUpdate(ctx, tx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	switch reservation.Status {
+	case model.ReservationReleased, model.ReservationExpired:
+		return reservation, nil
+	case model.ReservationCommitted:
+		return nil, fmt.Errorf("%w: status is %s", ErrReservationNotPending, reservation.Status)
+	}
+
+	if err := setReservationStatus(ctx, tx, reservation, model.ReservationReleased, time.Now()); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return reservation, nil
+}
+
+// GetReservationIDByReference returns the ID of the reservation made with reference.
+func (r *ReservationRepository) GetReservationIDByReference(ctx context.Context, reference string) (string, error) {
+	var reservationID string
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM stock_reservations WHERE reference = $1`, reference).Scan(&reservationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrReservationNotFound
+		}
+		return "", fmt.Errorf("failed to look up reservation by reference: %w", err)
+	}
+	return reservationID, nil
+}
+
+// ExpireReservations marks every pending reservation past its TTL as EXPIRED.
+func (r *ReservationRepository) ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	query := `UPDATE stock_reservations SET status = $1, updated_at = $2 WHERE status = $3 AND expires_at <= $2`
+	result, err := r.db.ExecContext(ctx, query, model.ReservationExpired, now, model.ReservationPending)
+	if err != nil {
+		log.Printf("Error expiring reservations in DB: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func getReservationByReference(ctx context.Context, tx *sql.Tx, reference string) (*model.Reservation, error) {
+	var reservationID string
+	err := tx.QueryRowContext(ctx, `SELECT id FROM stock_reservations WHERE reference = $1`, reference).Scan(&reservationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReservationNotFound
+		}
+		return nil, fmt.Errorf("failed to look up reservation by reference: %w", err)
+	}
+	return getReservationForUpdate(ctx, tx, reservationID)
+}
+
+func getReservationForUpdate(ctx context.Context, tx *sql.Tx, reservationID string) (*model.Reservation, error) {
+	reservation := &model.Reservation{}
+	query := `SELECT id, reference, status, expires_at, created_at, updated_at
+	          FROM stock_reservations WHERE id = $1 FOR UPDATE`
+	err := tx.QueryRowContext(ctx, query, reservationID).Scan(
+		&reservation.ID, &reservation.Reference, &reservation.Status,
+		&reservation.ExpiresAt, &reservation.CreatedAt, &reservation.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReservationNotFound
+		}
+		return nil, fmt.Errorf("failed to get reservation: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT product_id, quantity FROM stock_reservation_items WHERE reservation_id = $1 ORDER BY product_id ASC`,
+		reservationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reservation items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item model.ReservationItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan reservation item: %w", err)
+		}
+		reservation.Items = append(reservation.Items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+func setReservationStatus(ctx context.Context, tx *sql.Tx, reservation *model.Reservation, status model.ReservationStatus, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE stock_reservations SET status = $1, updated_at = $2 WHERE id = $3`, status, now, reservation.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update reservation status: %w", err)
+	}
+	reservation.Status = status
+	reservation.UpdatedAt = now
+	return nil
+}
+
+// sortedItems merges duplicate products and sorts by product ID, which is the lock order.
+func sortedItems(items []model.ReservationItem) []model.ReservationItem {
+	quantities := make(map[string]int32, len(items))
+	for _, item := range items {
+		quantities[item.ProductID] += item.Quantity
+	}
+	merged := make([]model.ReservationItem, 0, len(quantities))
+	for productID, quantity := range quantities {
+		merged = append(merged, model.ReservationItem{ProductID: productID, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ProductID < merged[j].ProductID })
+	return merged
+}
@@ -0,0 +1,210 @@
+// internal/productservice/repository/reservation_repository_test.go
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"microservices-project/internal/productservice/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var reservationColumns = []string{"id", "reference", "status", "expires_at", "created_at", "updated_at"}
+
+func newMockDBAndReservationRepo(t *testing.T) (sqlmock.Sqlmock, *ReservationRepository) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return mock, NewReservationRepository(db)
+}
+
+func expectLockProduct(mock sqlmock.Sqlmock, productID string, stock int32) {
+	mock.ExpectQuery(`SELECT stock_quantity FROM products WHERE id = \$1 FOR UPDATE`).
+		WithArgs(productID).
+		WillReturnRows(sqlmock.NewRows([]string{"stock_quantity"}).AddRow(stock))
+}
+
+func expectReservedQuantity(mock sqlmock.Sqlmock, productID string, reserved int32) {
+	mock.ExpectQuery(`SELECT COALESCE\((.+)\) FROM products p WHERE p.id = \$1`).
+		WithArgs(productID).
+		WillReturnRows(sqlmock.NewRows([]string{"reserved"}).AddRow(reserved))
+}
+
+func expectGetReservation(mock sqlmock.Sqlmock, id, reference string, status model.ReservationStatus, expiresAt time.Time) {
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM stock_reservations WHERE id = \$1 FOR UPDATE`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(reservationColumns).AddRow(id, reference, status, expiresAt, now, now))
+	mock.ExpectQuery(`SELECT product_id, quantity FROM stock_reservation_items WHERE reservation_id = \$1 ORDER BY product_id ASC`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "quantity"}).AddRow("prod-a", 2).AddRow("prod-b", 1))
+}
+
+func TestReservationRepository_ReserveStock_LocksProductsInIDOrder(t *testing.T) {
+	mock, repo := newMockDBAndReservationRepo(t)
+
+	mock.ExpectBegin()
+	// Requested b before a (and b twice), but rows are locked a then b, once each
+	expectLockProduct(mock, "prod-a", 5)
+	expectLockProduct(mock, "prod-b", 5)
+	mock.ExpectQuery(`SELECT id FROM stock_reservations WHERE reference = \$1`).
+		WithArgs("step-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	expectReservedQuantity(mock, "prod-a", 0)
+	expectReservedQuantity(mock, "prod-b", 1)
+	mock.ExpectExec(`INSERT INTO stock_reservations (.+) ON CONFLICT \(reference\) WHERE reference <> '' DO NOTHING`).
+		WithArgs(sqlmock.AnyArg(), "step-1", model.ReservationPending, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO stock_reservation_items`).
+		WithArgs(sqlmock.AnyArg(), "prod-a", int32(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO stock_reservation_items`).
+		WithArgs(sqlmock.AnyArg(), "prod-b", int32(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reservation, err := repo.ReserveStock(context.Background(), &model.Reservation{
+		Reference: "step-1",
+		ExpiresAt: time.Now().Add(time.Minute),
+		Items: []model.ReservationItem{
+			{ProductID: "prod-b", Quantity: 3},
+			{ProductID: "prod-a", Quantity: 2},
+			{ProductID: "prod-b", Quantity: 1},
+		},
+	})
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, reservation.ID)
+	assert.Equal(t, model.ReservationPending, reservation.Status)
+	assert.Equal(t, []model.ReservationItem{{ProductID: "prod-a", Quantity: 2}, {ProductID: "prod-b", Quantity: 4}}, reservation.Items)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReservationRepository_ReserveStock_InsufficientStockRollsBack(t *testing.T) {
+	mock, repo := newMockDBAndReservationRepo(t)
+
+	mock.ExpectBegin()
+	expectLockProduct(mock, "prod-a", 5)
+	expectLockProduct(mock, "prod-b", 5)
+	expectReservedQuantity(mock, "prod-a", 0)
+	expectReservedQuantity(mock, "prod-b", 4) // Only 1 of prod-b is left
+	mock.ExpectRollback()
+
+	_, err := repo.ReserveStock(context.Background(), &model.Reservation{
+		ExpiresAt: time.Now().Add(time.Minute),
+		Items: []model.ReservationItem{
+			{ProductID: "prod-a", Quantity: 2},
+			{ProductID: "prod-b", Quantity: 2},
+		},
+	})
+
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+	assert.NoError(t, mock.ExpectationsWereMet()) // Nothing was inserted
+}
+
+func TestReservationRepository_ReserveStock_RetryReturnsSameReservation(t *testing.T) {
+	mock, repo := newMockDBAndReservationRepo(t)
+
+	expiresAt := time.Now().Add(time.Minute)
+	mock.ExpectBegin()
+	expectLockProduct(mock, "prod-a", 5)
+	expectLockProduct(mock, "prod-b", 5)
+	mock.ExpectQuery(`SELECT id FROM stock_reservations WHERE reference = \$1`).
+		WithArgs("step-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("res-1"))
+	expectGetReservation(mock, "res-1", "step-1", model.ReservationPending, expiresAt)
+	mock.ExpectRollback()
+
+	reservation, err := repo.ReserveStock(context.Background(), &model.Reservation{
+		Reference: "step-1",
+		ExpiresAt: time.Now().Add(time.Minute),
+		Items: []model.ReservationItem{
+			{ProductID: "prod-a", Quantity: 2},
+			{ProductID: "prod-b", Quantity: 1},
+		},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "res-1", reservation.ID)
+	assert.Equal(t, model.ReservationPending, reservation.Status)
+	assert.NoError(t, mock.ExpectationsWereMet()) // No second reservation, no stock check
+}
+
+func TestReservationRepository_ReserveStock_ConcurrentRetryReturnsWinnersReservation(t *testing.T) {
+	mock, repo := newMockDBAndReservationRepo(t)
+
+	mock.ExpectBegin()
+	expectLockProduct(mock, "prod-a", 5)
+	mock.ExpectQuery(`SELECT id FROM stock_reservations WHERE reference = \$1`).
+		WithArgs("step-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	expectReservedQuantity(mock, "prod-a", 0)
+	// The other retry inserted between our lookup and our insert
+	mock.ExpectExec(`INSERT INTO stock_reservations (.+) ON CONFLICT \(reference\) WHERE reference <> '' DO NOTHING`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT id FROM stock_reservations WHERE reference = \$1`).
+		WithArgs("step-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("res-1"))
+	expectGetReservation(mock, "res-1", "step-1", model.ReservationPending, time.Now().Add(time.Minute))
+	mock.ExpectRollback()
+
+	reservation, err := repo.ReserveStock(context.Background(), &model.Reservation{
+		Reference: "step-1",
+		ExpiresAt: time.Now().Add(time.Minute),
+		Items:     []model.ReservationItem{{ProductID: "prod-a", Quantity: 2}},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "res-1", reservation.ID)
+	assert.NoError(t, mock.ExpectationsWereMet()) // Our items were never inserted
+}
+
+func TestReservationRepository_ReleaseReservation_CommittedIsNotPending(t *testing.T) {
+	mock, repo := newMockDBAndReservationRepo(t)
+
+	mock.ExpectBegin()
+	expectGetReservation(mock, "res-1", "step-1", model.ReservationCommitted, time.Now().Add(time.Minute))
+	mock.ExpectRollback()
+
+	_, err := repo.ReleaseReservation(context.Background(), "res-1")
+
+	assert.ErrorIs(t, err, ErrReservationNotPending)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReservationRepository_ReleaseReservation_Pending(t *testing.T) {
+	mock, repo := newMockDBAndReservationRepo(t)
+
+	mock.ExpectBegin()
+	expectGetReservation(mock, "res-1", "step-1", model.ReservationPending, time.Now().Add(time.Minute))
+	mock.ExpectExec(`UPDATE stock_reservations SET status = \$1, updated_at = \$2 WHERE id = \$3`).
+		WithArgs(model.ReservationReleased, sqlmock.AnyArg(), "res-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reservation, err := repo.ReleaseReservation(context.Background(), "res-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, model.ReservationReleased, reservation.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReservationRepository_ExpireReservations_OnlyPending(t *testing.T) {
+	mock, repo := newMockDBAndReservationRepo(t)
+
+	now := time.Now()
+	// Committed (and released) reservations are left alone by the status filter
+	mock.ExpectExec(`UPDATE stock_reservations SET status = \$1, updated_at = \$2 WHERE status = \$3 AND expires_at <= \$2`).
+		WithArgs(model.ReservationExpired, now, model.ReservationPending).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	expired, err := repo.ExpireReservations(context.Background(), now)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), expired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,9 +4,14 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"microservices-project/internal/productservice/model"
 	"microservices-project/internal/productservice/repository"
+	"microservices-project/pkg/pagination"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 // Custom errors
@@ -14,23 +19,59 @@ var (
 	ErrProductNotFound   = repository.ErrProductNotFound // Propagate
 	ErrInvalidProductData = errors.New("invalid product data")
 	ErrInsufficientStock = repository.ErrInsufficientStock
+	ErrInvalidReservation    = errors.New("invalid reservation data")
+	ErrReservationNotFound   = repository.ErrReservationNotFound
+	ErrReservationExpired    = repository.ErrReservationExpired
+	ErrReservationNotPending = repository.ErrReservationNotPending
+	ErrInvalidPageToken      = pagination.ErrInvalidPageToken
 )
 
+// productPageTokenScope binds product page tokens to the product list.
+const productPageTokenScope = "products"
+
+// MaxBatchGetProducts caps how many IDs one BatchGetProducts call may ask for.
+const MaxBatchGetProducts = 500
+
+// MaxBatchUpdateStock caps how many changes one BatchUpdateStock call may apply.
+const MaxBatchUpdateStock = 500
+
+// DefaultReservationTTL is how long an uncommitted reservation holds stock.
+const DefaultReservationTTL = 15 * time.Minute
+
 type ProductServiceInterface interface {
 	CreateProduct(ctx context.Context, name, description string, price float64, stockQuantity int32) (*model.Product, error)
 	GetProductByID(ctx context.Context, id string) (*model.Product, error)
+	// BatchGetProducts returns the products that exist and, separately, the requested IDs that don't.
+	BatchGetProducts(ctx context.Context, ids []string) (products []*model.Product, missingIDs []string, err error)
 	ListProducts(ctx context.Context, page, pageSize int) ([]*model.Product, error) // Using page/pageSize for simplicity
+	// ListProductsPage pages with opaque tokens; nextPageToken is empty on the last page.
+	ListProductsPage(ctx context.Context, pageToken string, pageSize int) (products []*model.Product, nextPageToken string, err error)
 	UpdateProduct(ctx context.Context, id, name, description string, price float64, stockQuantity int32) (*model.Product, error)
 	DeleteProduct(ctx context.Context, id string) error
 	UpdateStock(ctx context.Context, productID string, quantityChange int32) (*model.Product, error)
+	// BatchUpdateStock applies all changes atomically; results are one per product, ordered by ID.
+	BatchUpdateStock(ctx context.Context, changes []model.StockChange) ([]*model.Product, error)
+	ReserveStock(ctx context.Context, reference string, items []model.ReservationItem) (*model.Reservation, error)
+	CommitReservation(ctx context.Context, reservationID string) (*model.Reservation, error)
+	ReleaseReservation(ctx context.Context, reservationID string) (*model.Reservation, error)
+	// ReleaseReservationByReference releases the reservation made with reference, for callers
+	// that never learnt its ID.
+	ReleaseReservationByReference(ctx context.Context, reference string) (*model.Reservation, error)
+	ExpireReservations(ctx context.Context) (int64, error)
 }
 
 type ProductService struct {
-	repo repository.ProductRepositoryInterface
+	repo            repository.ProductRepositoryInterface
+	reservationRepo repository.ReservationRepositoryInterface
+	reservationTTL  time.Duration
+	pageTokens      *pagination.TokenCodec
 }
 
-func NewProductService(repo repository.ProductRepositoryInterface) *ProductService {
-	return &ProductService{repo: repo}
+func NewProductService(repo repository.ProductRepositoryInterface, reservationRepo repository.ReservationRepositoryInterface, reservationTTL time.Duration, pageTokens *pagination.TokenCodec) *ProductService {
+	if reservationTTL <= 0 {
+		reservationTTL = DefaultReservationTTL
+	}
+	return &ProductService{repo: repo, reservationRepo: reservationRepo, reservationTTL: reservationTTL, pageTokens: pageTokens}
 }
 
 func (s *ProductService) CreateProduct(ctx context.Context, name, description string, price float64, stockQuantity int32) (*model.Product, error) {
@@ -53,6 +94,57 @@ func (s *ProductService) GetProductByID(ctx context.Context, id string) (*model.
 	return s.repo.GetProductByID(ctx, id)
 }
 
+func (s *ProductService) BatchGetProducts(ctx context.Context, ids []string) ([]*model.Product, []string, error) {
+	if len(ids) == 0 || len(ids) > MaxBatchGetProducts {
+		return nil, nil, ErrInvalidProductData
+	}
+
+	// Dedupe, and treat IDs that aren't UUIDs as missing rather than letting one bad ID
+	// fail the whole query.
+	seen := make(map[string]bool, len(ids))
+	lookup := make([]string, 0, len(ids))
+	requested := make(map[string]string, len(ids)) // Canonical ID -> ID as the caller sent it
+	var missing []string
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			missing = append(missing, id)
+			continue
+		}
+		canonical := parsed.String() // Postgres returns UUIDs in lower-case hyphenated form
+		if _, dup := requested[canonical]; dup {
+			continue
+		}
+		requested[canonical] = id
+		lookup = append(lookup, canonical)
+	}
+
+	products := []*model.Product{}
+	if len(lookup) > 0 {
+		var err error
+		products, err = s.repo.GetProductsByIDs(ctx, lookup)
+		if err != nil {
+			log.Printf("Service: Error batch getting %d products: %v", len(lookup), err)
+			return nil, nil, err
+		}
+	}
+
+	found := make(map[string]bool, len(products))
+	for _, product := range products {
+		found[product.ID] = true
+	}
+	for _, id := range lookup {
+		if !found[id] {
+			missing = append(missing, requested[id])
+		}
+	}
+	return products, missing, nil
+}
+
 func (s *ProductService) ListProducts(ctx context.Context, page, pageSize int) ([]*model.Product, error) {
 	if page <= 0 {
 		page = 1
@@ -64,6 +156,32 @@ func (s *ProductService) ListProducts(ctx context.Context, page, pageSize int) (
 	return s.repo.ListProducts(ctx, pageSize, offset)
 }
 
+func (s *ProductService) ListProductsPage(ctx context.Context, pageToken string, pageSize int) ([]*model.Product, string, error) {
+	if pageSize <= 0 || pageSize > 100 { // Max page size
+		pageSize = 10
+	}
+	var after *pagination.Cursor
+	if pageToken != "" {
+		cursor, err := s.pageTokens.Decode(productPageTokenScope, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = cursor
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	products, err := s.repo.ListProductsAfter(ctx, after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(products) <= pageSize {
+		return products, "", nil
+	}
+	products = products[:pageSize]
+	last := products[len(products)-1]
+	return products, s.pageTokens.Encode(productPageTokenScope, pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}), nil
+}
+
 func (s *ProductService) UpdateProduct(ctx context.Context, id, name, description string, price float64, stockQuantity int32) (*model.Product, error) {
 	if id == "" || name == "" || price < 0 || stockQuantity < 0 {
 		return nil, ErrInvalidProductData
@@ -103,4 +221,91 @@ func (s *ProductService) UpdateStock(ctx context.Context, productID string, quan
 	}
 	log.Printf("Service: Stock updated successfully for product %s. New stock: %d", productID, updatedProduct.StockQuantity)
 	return updatedProduct, nil
-}
\ No newline at end of file
+}
+
+func (s *ProductService) BatchUpdateStock(ctx context.Context, changes []model.StockChange) ([]*model.Product, error) {
+	if len(changes) == 0 || len(changes) > MaxBatchUpdateStock {
+		return nil, ErrInvalidProductData
+	}
+	for _, change := range changes {
+		if _, err := uuid.Parse(change.ProductID); err != nil {
+			return nil, fmt.Errorf("%w: invalid product ID %q", ErrInvalidProductData, change.ProductID)
+		}
+	}
+	log.Printf("Service: Attempting to apply %d stock change(s)", len(changes))
+	products, err := s.repo.BatchUpdateStock(ctx, changes)
+	if err != nil {
+		log.Printf("Service: Error applying stock changes: %v", err)
+		return nil, err
+	}
+	log.Printf("Service: Stock updated successfully for %d product(s)", len(products))
+	return products, nil
+}
+
+// ReserveStock holds stock for the given items until it is committed, released or expires.
+// Reserving again with the same reference returns the first reservation.
+func (s *ProductService) ReserveStock(ctx context.Context, reference string, items []model.ReservationItem) (*model.Reservation, error) {
+	if len(items) == 0 {
+		return nil, ErrInvalidReservation
+	}
+	for _, item := range items {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			return nil, ErrInvalidReservation
+		}
+	}
+
+	reservation := &model.Reservation{
+		Reference: reference,
+		Items:     items,
+		ExpiresAt: time.Now().Add(s.reservationTTL),
+	}
+	created, err := s.reservationRepo.ReserveStock(ctx, reservation)
+	if err != nil {
+		log.Printf("Service: Error reserving stock for %q: %v", reference, err)
+		return nil, err
+	}
+	log.Printf("Service: Reservation %s created for %q, expires at %s", created.ID, reference, created.ExpiresAt.Format(time.RFC3339))
+	return created, nil
+}
+
+func (s *ProductService) CommitReservation(ctx context.Context, reservationID string) (*model.Reservation, error) {
+	if reservationID == "" {
+		return nil, ErrInvalidReservation
+	}
+	reservation, err := s.reservationRepo.CommitReservation(ctx, reservationID)
+	if err != nil {
+		log.Printf("Service: Error committing reservation %s: %v", reservationID, err)
+		return nil, err
+	}
+	log.Printf("Service: Reservation %s committed", reservationID)
+	return reservation, nil
+}
+
+func (s *ProductService) ReleaseReservation(ctx context.Context, reservationID string) (*model.Reservation, error) {
+	if reservationID == "" {
+		return nil, ErrInvalidReservation
+	}
+	reservation, err := s.reservationRepo.ReleaseReservation(ctx, reservationID)
+	if err != nil {
+		log.Printf("Service: Error releasing reservation %s: %v", reservationID, err)
+		return nil, err
+	}
+	log.Printf("Service: Reservation %s is %s", reservationID, reservation.Status)
+	return reservation, nil
+}
+
+func (s *ProductService) ReleaseReservationByReference(ctx context.Context, reference string) (*model.Reservation, error) {
+	if reference == "" {
+		return nil, ErrInvalidReservation
+	}
+	reservationID, err := s.reservationRepo.GetReservationIDByReference(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	return s.ReleaseReservation(ctx, reservationID)
+}
+
+// ExpireReservations is called periodically by the sweeper in main.
+func (s *ProductService) ExpireReservations(ctx context.Context) (int64, error) {
+	return s.reservationRepo.ExpireReservations(ctx, time.Now())
+}
@@ -0,0 +1,186 @@
+// internal/productservice/service/product_service_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"microservices-project/internal/productservice/model"
+	"microservices-project/pkg/pagination"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockProductRepository is a mock type for the ProductRepositoryInterface
+type MockProductRepository struct {
+	mock.Mock
+}
+
+func (m *MockProductRepository) CreateProduct(ctx context.Context, product *model.Product) (*model.Product, error) {
+	args := m.Called(ctx, product)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) GetProductByID(ctx context.Context, id string) (*model.Product, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) GetProductsByIDs(ctx context.Context, ids []string) ([]*model.Product, error) {
+	args := m.Called(ctx, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) ListProducts(ctx context.Context, limit int, offset int) ([]*model.Product, error) {
+	args := m.Called(ctx, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) ListProductsAfter(ctx context.Context, after *pagination.Cursor, limit int) ([]*model.Product, error) {
+	args := m.Called(ctx, after, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) UpdateProduct(ctx context.Context, product *model.Product) (*model.Product, error) {
+	args := m.Called(ctx, product)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) DeleteProduct(ctx context.Context, id string) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *MockProductRepository) UpdateStock(ctx context.Context, productID string, quantityChange int32) (*model.Product, error) {
+	args := m.Called(ctx, productID, quantityChange)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) BatchUpdateStock(ctx context.Context, changes []model.StockChange) ([]*model.Product, error) {
+	args := m.Called(ctx, changes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Product), args.Error(1)
+}
+
+const (
+	productA = "6f1c2d3e-0000-4000-8000-00000000000a"
+	productB = "6f1c2d3e-0000-4000-8000-00000000000b"
+)
+
+func newTestProductService() (*ProductService, *MockProductRepository) {
+	repo := new(MockProductRepository)
+	return NewProductService(repo, nil, 0, nil), repo
+}
+
+func TestProductService_BatchGetProducts_ReportsMissingIDs(t *testing.T) {
+	svc, repo := newTestProductService()
+	// Malformed IDs never reach the query; well-formed ones that don't exist come back absent
+	repo.On("GetProductsByIDs", mock.Anything, []string{productA, productB}).
+		Return([]*model.Product{{ID: productA}}, nil).Once()
+
+	products, missing, err := svc.BatchGetProducts(context.Background(), []string{productA, "not-a-uuid", productB})
+
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	assert.Equal(t, productA, products[0].ID)
+	assert.Equal(t, []string{"not-a-uuid", productB}, missing)
+	repo.AssertExpectations(t)
+}
+
+func TestProductService_BatchGetProducts_DeduplicatesIDs(t *testing.T) {
+	svc, repo := newTestProductService()
+	upperB := "6F1C2D3E-0000-4000-8000-00000000000B"
+	// Repeats, including the same UUID in another case, are looked up and reported once
+	repo.On("GetProductsByIDs", mock.Anything, []string{productA, productB}).
+		Return([]*model.Product{{ID: productA}}, nil).Once()
+
+	products, missing, err := svc.BatchGetProducts(context.Background(), []string{productA, upperB, productA, productB, upperB})
+
+	require.NoError(t, err)
+	assert.Len(t, products, 1)
+	assert.Equal(t, []string{upperB}, missing) // As the caller first spelt it
+	repo.AssertExpectations(t)
+}
+
+func TestProductService_BatchGetProducts_OnlyMalformedIDs(t *testing.T) {
+	svc, repo := newTestProductService()
+
+	products, missing, err := svc.BatchGetProducts(context.Background(), []string{"nope", "nope"})
+
+	require.NoError(t, err)
+	assert.Empty(t, products)
+	assert.Equal(t, []string{"nope"}, missing)
+	repo.AssertNotCalled(t, "GetProductsByIDs", mock.Anything, mock.Anything)
+}
+
+func TestProductService_BatchGetProducts_RejectsEmptyAndOversizedBatches(t *testing.T) {
+	svc, repo := newTestProductService()
+
+	_, _, err := svc.BatchGetProducts(context.Background(), nil)
+	assert.True(t, errors.Is(err, ErrInvalidProductData))
+
+	_, _, err = svc.BatchGetProducts(context.Background(), make([]string, MaxBatchGetProducts+1))
+	assert.True(t, errors.Is(err, ErrInvalidProductData))
+	repo.AssertNotCalled(t, "GetProductsByIDs", mock.Anything, mock.Anything)
+}
+
+func TestProductService_BatchGetProducts_RepositoryError(t *testing.T) {
+	svc, repo := newTestProductService()
+	dbErr := errors.New("connection refused")
+	repo.On("GetProductsByIDs", mock.Anything, []string{productA}).Return(nil, dbErr)
+
+	_, _, err := svc.BatchGetProducts(context.Background(), []string{productA})
+
+	assert.ErrorIs(t, err, dbErr)
+}
+
+func TestProductService_BatchUpdateStock_ReportsMalformedIDWithoutWriting(t *testing.T) {
+	svc, repo := newTestProductService()
+
+	_, err := svc.BatchUpdateStock(context.Background(), []model.StockChange{
+		{ProductID: productA, QuantityChange: 1},
+		{ProductID: "not-a-uuid", QuantityChange: 1},
+	})
+
+	assert.True(t, errors.Is(err, ErrInvalidProductData))
+	assert.Contains(t, err.Error(), "not-a-uuid")
+	repo.AssertNotCalled(t, "BatchUpdateStock", mock.Anything, mock.Anything)
+}
+
+func TestProductService_BatchUpdateStock_PropagatesUnknownProducts(t *testing.T) {
+	svc, repo := newTestProductService()
+	changes := []model.StockChange{{ProductID: productA, QuantityChange: 1}, {ProductID: productB, QuantityChange: 1}}
+	repo.On("BatchUpdateStock", mock.Anything, changes).
+		Return(nil, fmt.Errorf("%w: %s", ErrProductNotFound, productB)).Once()
+
+	_, err := svc.BatchUpdateStock(context.Background(), changes)
+
+	assert.True(t, errors.Is(err, ErrProductNotFound))
+	assert.Contains(t, err.Error(), productB)
+	repo.AssertExpectations(t)
+}
@@ -3,15 +3,43 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"log"
+	"microservices-project/internal/userservice/model"
 	"microservices-project/internal/userservice/service" // We'll create this soon
+	"microservices-project/pkg/auth"
 	userpb "microservices-project/protos/userpb"
+	"net"
+	"time"
 
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// PublicMethods are the RPCs that can be called without a token: everything needed to get one,
+// and the flows driven by tokens from mailed links.
+var PublicMethods = []string{
+	userpb.UserService_CreateUser_FullMethodName,
+	userpb.UserService_LoginUser_FullMethodName,
+	userpb.UserService_VerifyMFA_FullMethodName,
+	userpb.UserService_ValidateToken_FullMethodName,
+	userpb.UserService_RefreshToken_FullMethodName,
+	userpb.UserService_Logout_FullMethodName,
+	userpb.UserService_LogoutAllSessions_FullMethodName,
+	userpb.UserService_RequestPasswordReset_FullMethodName,
+	userpb.UserService_ResetPassword_FullMethodName,
+	userpb.UserService_VerifyEmail_FullMethodName,
+}
+
+// MethodScopes are the RPCs API keys may call, with the scope each needs.
+var MethodScopes = auth.MethodScopes{
+	userpb.UserService_GetUser_FullMethodName:       auth.ScopeUsersRead,
+	userpb.UserService_ListUsers_FullMethodName:     auth.ScopeUsersRead,
+	userpb.UserService_ListAddresses_FullMethodName: auth.ScopeUsersRead,
+}
+
 // UserGRPCServer implements the gRPC UserServiceServer interface
 type UserGRPCServer struct {
 	userpb.UnimplementedUserServiceServer
@@ -39,6 +67,9 @@ func (s *UserGRPCServer) CreateUser(ctx context.Context, req *userpb.CreateUserR
 	if err != nil {
 		// TODO: Map service errors to gRPC status codes more granularly
 		log.Printf("Error creating user: %v", err)
+		if errors.Is(err, service.ErrUserAlreadyExists) {
+			return nil, status.Errorf(codes.AlreadyExists, err.Error())
+		}
 		return nil, status.Errorf(codes.Internal, "failed to create user: %v", err)
 	}
 
@@ -61,6 +92,10 @@ func (s *UserGRPCServer) GetUser(ctx context.Context, req *userpb.GetUserRequest
 	if req.UserId == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
 	}
+	// Users may look themselves up; admins and services anyone
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
 
 	domainUser, err := s.userService.GetUserByID(ctx, req.UserId)
 	if err != nil {
@@ -72,20 +107,802 @@ func (s *UserGRPCServer) GetUser(ctx context.Context, req *userpb.GetUserRequest
 		return nil, status.Errorf(codes.Internal, "failed to get user: %v", err)
 	}
 
-	return &userpb.GetUserResponse{
-		User: &userpb.User{
-			Id:        domainUser.ID,
-			Username:  domainUser.Username,
-			Email:     domainUser.Email,
-			CreatedAt: timestamppb.New(domainUser.CreatedAt),
-			UpdatedAt: timestamppb.New(domainUser.UpdatedAt),
-		},
-	}, nil
+	return &userpb.GetUserResponse{User: toProtoUser(domainUser)}, nil
 }
 
-// LoginUser (Stub for now)
+// LoginUser checks the user's credentials and returns a signed access token
 func (s *UserGRPCServer) LoginUser(ctx context.Context, req *userpb.LoginRequest) (*userpb.LoginResponse, error) {
-	log.Printf("Received LoginUser request for email: %s", req.Email)
-	// TODO: Implement actual login logic by calling s.userService.LoginUser(...)
-	return nil, status.Errorf(codes.Unimplemented, "method LoginUser not implemented")
-}
\ No newline at end of file
+	log.Printf("gRPC LoginUser request received for email: %s", req.Email)
+
+	if req.Email == "" || req.Password == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "email and password are required")
+	}
+
+	domainUser, tokens, err := s.userService.LoginUser(ctx, req.Email, req.Password, peerIP(ctx))
+	if err != nil {
+		log.Printf("Error logging in user: %v", err)
+		if errors.Is(err, service.ErrTooManyLoginAttempts) {
+			return nil, status.Errorf(codes.ResourceExhausted, err.Error()) // Same for unknown emails, so it reveals nothing
+		}
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid email or password")
+		}
+		return nil, status.Errorf(codes.Internal, "login failed")
+	}
+	if tokens.MFARequired() {
+		return &userpb.LoginResponse{
+			MfaRequired:           true,
+			MfaChallengeToken:     tokens.MFAChallengeToken,
+			MfaChallengeExpiresAt: timestamppb.New(tokens.MFAChallengeExpiresAt),
+		}, nil
+	}
+
+	return &userpb.LoginResponse{
+		Token:                 tokens.AccessToken,
+		User:                  toProtoUser(domainUser),
+		ExpiresAt:             timestamppb.New(tokens.ExpiresAt),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshTokenExpiresAt),
+	}, nil
+}
+
+// VerifyMFA completes a 2FA login with the challenge from LoginUser and a TOTP or recovery code
+func (s *UserGRPCServer) VerifyMFA(ctx context.Context, req *userpb.VerifyMFARequest) (*userpb.VerifyMFAResponse, error) {
+	if req.ChallengeToken == "" || req.Code == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "challenge_token and code are required")
+	}
+
+	domainUser, tokens, err := s.userService.VerifyMFA(ctx, req.ChallengeToken, req.Code, peerIP(ctx))
+	if err != nil {
+		return nil, mfaError(err, "login failed")
+	}
+
+	return &userpb.VerifyMFAResponse{
+		Token:                 tokens.AccessToken,
+		User:                  toProtoUser(domainUser),
+		ExpiresAt:             timestamppb.New(tokens.ExpiresAt),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshTokenExpiresAt),
+	}, nil
+}
+
+// RefreshToken rotates a refresh token into a new access/refresh token pair
+func (s *UserGRPCServer) RefreshToken(ctx context.Context, req *userpb.RefreshTokenRequest) (*userpb.RefreshTokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "refresh_token is required")
+	}
+
+	tokens, err := s.userService.RefreshToken(ctx, req.RefreshToken)
+	if err != nil {
+		log.Printf("Error refreshing token: %v", err)
+		return nil, sessionError(err, "failed to refresh token")
+	}
+
+	return &userpb.RefreshTokenResponse{
+		Token:                 tokens.AccessToken,
+		ExpiresAt:             timestamppb.New(tokens.ExpiresAt),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshTokenExpiresAt),
+	}, nil
+}
+
+// Logout revokes the session the refresh token belongs to
+func (s *UserGRPCServer) Logout(ctx context.Context, req *userpb.LogoutRequest) (*userpb.LogoutResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "refresh_token is required")
+	}
+	if err := s.userService.Logout(ctx, req.RefreshToken); err != nil {
+		log.Printf("Error logging out: %v", err)
+		return nil, sessionError(err, "failed to log out")
+	}
+	return &userpb.LogoutResponse{}, nil
+}
+
+// LogoutAllSessions revokes every session of the refresh token's user, e.g. after a device is lost
+func (s *UserGRPCServer) LogoutAllSessions(ctx context.Context, req *userpb.LogoutAllSessionsRequest) (*userpb.LogoutAllSessionsResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "refresh_token is required")
+	}
+	revoked, err := s.userService.LogoutAllSessions(ctx, req.RefreshToken)
+	if err != nil {
+		log.Printf("Error logging out all sessions: %v", err)
+		return nil, sessionError(err, "failed to log out all sessions")
+	}
+	return &userpb.LogoutAllSessionsResponse{RevokedSessions: revoked}, nil
+}
+
+// sessionError maps refresh token errors to gRPC status codes
+func sessionError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrRefreshTokenReused):
+		return status.Errorf(codes.Unauthenticated, "refresh token was already used; all sessions from that login have been revoked")
+	case errors.Is(err, service.ErrInvalidRefreshToken):
+		return status.Errorf(codes.Unauthenticated, err.Error())
+	}
+	return status.Errorf(codes.Internal, msg)
+}
+
+// ValidateToken verifies an access token. A bad token is a normal answer (valid=false),
+// not an RPC error.
+func (s *UserGRPCServer) ValidateToken(ctx context.Context, req *userpb.ValidateTokenRequest) (*userpb.ValidateTokenResponse, error) {
+	if req.Token == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "token is required")
+	}
+
+	claims, err := s.userService.ValidateToken(ctx, req.Token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			return &userpb.ValidateTokenResponse{Valid: false, Error: err.Error()}, nil
+		}
+		log.Printf("Error validating token: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to validate token")
+	}
+
+	return &userpb.ValidateTokenResponse{
+		Valid:     true,
+		UserId:    claims.UserID(),
+		Email:     claims.Email,
+		Username:  claims.Username,
+		ExpiresAt: timestamppb.New(claims.ExpiresAt.Time),
+		Roles:     claims.Roles,
+	}, nil
+}
+
+// AssignRole grants a role to a user (admins only)
+func (s *UserGRPCServer) AssignRole(ctx context.Context, req *userpb.AssignRoleRequest) (*userpb.AssignRoleResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	if req.UserId == "" || req.Role == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and role are required")
+	}
+	log.Printf("gRPC AssignRole request: role %s for user %s", req.Role, req.UserId)
+
+	user, err := s.userService.AssignRole(ctx, req.UserId, req.Role)
+	if err != nil {
+		return nil, roleError(err, "failed to assign role")
+	}
+	return &userpb.AssignRoleResponse{User: toProtoUser(user)}, nil
+}
+
+// RevokeRole takes a role away from a user (admins only)
+func (s *UserGRPCServer) RevokeRole(ctx context.Context, req *userpb.RevokeRoleRequest) (*userpb.RevokeRoleResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	if req.UserId == "" || req.Role == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and role are required")
+	}
+	log.Printf("gRPC RevokeRole request: role %s for user %s", req.Role, req.UserId)
+
+	user, err := s.userService.RevokeRole(ctx, req.UserId, req.Role)
+	if err != nil {
+		return nil, roleError(err, "failed to revoke role")
+	}
+	return &userpb.RevokeRoleResponse{User: toProtoUser(user)}, nil
+}
+
+// UnlockUser lifts a login lockout on a user's account, and optionally a client address (admins only)
+func (s *UserGRPCServer) UnlockUser(ctx context.Context, req *userpb.UnlockUserRequest) (*userpb.UnlockUserResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	log.Printf("gRPC UnlockUser request for ID: %s", req.UserId)
+
+	if err := s.userService.UnlockUser(ctx, req.UserId, req.IpAddress); err != nil {
+		return nil, profileError(err, "failed to unlock user")
+	}
+	return &userpb.UnlockUserResponse{}, nil
+}
+
+// peerIP is the address of the gRPC client, without the port.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// roleError maps role assignment errors to gRPC status codes
+func roleError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidRole):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Errorf(codes.NotFound, "user not found")
+	case errors.Is(err, service.ErrLastAdmin):
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	}
+	log.Printf("Error changing roles: %v", err)
+	return status.Errorf(codes.Internal, msg)
+}
+
+// UpdateUser changes a user's username and/or email (the user themselves or an admin)
+func (s *UserGRPCServer) UpdateUser(ctx context.Context, req *userpb.UpdateUserRequest) (*userpb.UpdateUserResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if req.Username == "" && req.Email == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "username or email is required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC UpdateUser request for ID: %s", req.UserId)
+
+	user, err := s.userService.UpdateUser(ctx, req.UserId, req.Username, req.Email)
+	if err != nil {
+		return nil, profileError(err, "failed to update user")
+	}
+	return &userpb.UpdateUserResponse{User: toProtoUser(user)}, nil
+}
+
+// ChangePassword replaces the user's password and logs them out everywhere
+func (s *UserGRPCServer) ChangePassword(ctx context.Context, req *userpb.ChangePasswordRequest) (*userpb.ChangePasswordResponse, error) {
+	if req.UserId == "" || req.CurrentPassword == "" || req.NewPassword == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id, current_password and new_password are required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC ChangePassword request for ID: %s", req.UserId)
+
+	revoked, err := s.userService.ChangePassword(ctx, req.UserId, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		return nil, profileError(err, "failed to change password")
+	}
+	return &userpb.ChangePasswordResponse{RevokedSessions: revoked}, nil
+}
+
+// DeleteUser soft-deletes and anonymises a user (the user themselves or an admin)
+func (s *UserGRPCServer) DeleteUser(ctx context.Context, req *userpb.DeleteUserRequest) (*userpb.DeleteUserResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC DeleteUser request for ID: %s", req.UserId)
+
+	if err := s.userService.DeleteUser(ctx, req.UserId); err != nil {
+		return nil, profileError(err, "failed to delete user")
+	}
+	return &userpb.DeleteUserResponse{}, nil
+}
+
+// ListUsers pages through users, optionally filtered by email/username prefix (admins only)
+func (s *UserGRPCServer) ListUsers(ctx context.Context, req *userpb.ListUsersRequest) (*userpb.ListUsersResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC ListUsers request: PageSize=%d, EmailPrefix=%q, UsernamePrefix=%q", req.PageSize, req.EmailPrefix, req.UsernamePrefix)
+
+	filter := model.UserFilter{EmailPrefix: req.EmailPrefix, UsernamePrefix: req.UsernamePrefix, IncludeDeleted: req.IncludeDeleted}
+	users, nextPageToken, err := s.userService.ListUsers(ctx, filter, req.PageToken, int(req.PageSize))
+	if err != nil {
+		return nil, profileError(err, "failed to list users")
+	}
+
+	protoUsers := make([]*userpb.User, 0, len(users))
+	for _, user := range users {
+		protoUsers = append(protoUsers, toProtoUser(user))
+	}
+	return &userpb.ListUsersResponse{Users: protoUsers, NextPageToken: nextPageToken}, nil
+}
+
+// RequestPasswordReset mails a reset link. It answers the same whether or not the email has an account.
+func (s *UserGRPCServer) RequestPasswordReset(ctx context.Context, req *userpb.RequestPasswordResetRequest) (*userpb.RequestPasswordResetResponse, error) {
+	if req.Email == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "email is required")
+	}
+	if err := s.userService.RequestPasswordReset(ctx, req.Email); err != nil {
+		return nil, profileError(err, "failed to request password reset")
+	}
+	return &userpb.RequestPasswordResetResponse{}, nil
+}
+
+// ResetPassword sets a new password with the token from a reset email
+func (s *UserGRPCServer) ResetPassword(ctx context.Context, req *userpb.ResetPasswordRequest) (*userpb.ResetPasswordResponse, error) {
+	if req.Token == "" || req.NewPassword == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "token and new_password are required")
+	}
+	if err := s.userService.ResetPassword(ctx, req.Token, req.NewPassword); err != nil {
+		return nil, profileError(err, "failed to reset password")
+	}
+	return &userpb.ResetPasswordResponse{}, nil
+}
+
+// SendVerificationEmail (re)sends the email verification link (the user themselves or an admin)
+func (s *UserGRPCServer) SendVerificationEmail(ctx context.Context, req *userpb.SendVerificationEmailRequest) (*userpb.SendVerificationEmailResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	if err := s.userService.SendVerificationEmail(ctx, req.UserId); err != nil {
+		return nil, profileError(err, "failed to send verification email")
+	}
+	return &userpb.SendVerificationEmailResponse{}, nil
+}
+
+// VerifyEmail marks the user's email verified with the token from a verification email
+func (s *UserGRPCServer) VerifyEmail(ctx context.Context, req *userpb.VerifyEmailRequest) (*userpb.VerifyEmailResponse, error) {
+	if req.Token == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "token is required")
+	}
+	user, err := s.userService.VerifyEmail(ctx, req.Token)
+	if err != nil {
+		return nil, profileError(err, "failed to verify email")
+	}
+	return &userpb.VerifyEmailResponse{User: toProtoUser(user)}, nil
+}
+
+// EnrollMFA starts 2FA enrolment and returns the secret for the user's authenticator app (the user only)
+func (s *UserGRPCServer) EnrollMFA(ctx context.Context, req *userpb.EnrollMFARequest) (*userpb.EnrollMFAResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckSelf(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+
+	enrollment, err := s.userService.EnrollMFA(ctx, req.UserId)
+	if err != nil {
+		return nil, mfaError(err, "failed to start 2FA enrolment")
+	}
+	return &userpb.EnrollMFAResponse{Secret: enrollment.Secret, OtpauthUri: enrollment.URI}, nil
+}
+
+// ConfirmMFA turns 2FA on with a first code from the app and returns the recovery codes (the user only)
+func (s *UserGRPCServer) ConfirmMFA(ctx context.Context, req *userpb.ConfirmMFARequest) (*userpb.ConfirmMFAResponse, error) {
+	if req.UserId == "" || req.Code == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and code are required")
+	}
+	if err := auth.CheckSelf(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+
+	recoveryCodes, err := s.userService.ConfirmMFA(ctx, req.UserId, req.Code)
+	if err != nil {
+		return nil, mfaError(err, "failed to confirm 2FA")
+	}
+	return &userpb.ConfirmMFAResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// DisableMFA turns 2FA off. The user needs a current code; an admin can do it without one,
+// for users who lost their device.
+func (s *UserGRPCServer) DisableMFA(ctx context.Context, req *userpb.DisableMFARequest) (*userpb.DisableMFAResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckSelf(ctx, req.UserId); err != nil {
+		if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+			return nil, auth.StatusError(err)
+		}
+	} else if req.Code == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "code is required")
+	}
+	log.Printf("gRPC DisableMFA request for ID: %s", req.UserId)
+
+	if err := s.userService.DisableMFA(ctx, req.UserId, req.Code); err != nil {
+		return nil, mfaError(err, "failed to disable 2FA")
+	}
+	return &userpb.DisableMFAResponse{}, nil
+}
+
+// CreateAPIKey creates an API key and returns it, the only time it is shown (admins only)
+func (s *UserGRPCServer) CreateAPIKey(ctx context.Context, req *userpb.CreateAPIKeyRequest) (*userpb.CreateAPIKeyResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		t := req.ExpiresAt.AsTime()
+		expiresAt = &t
+	}
+	p, _ := auth.FromContext(ctx)
+	log.Printf("gRPC CreateAPIKey request: Name=%s, Scopes=%v", req.Name, req.Scopes)
+
+	key, apiKey, err := s.userService.CreateAPIKey(ctx, p.UserID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		return nil, apiKeyError(err, "failed to create API key")
+	}
+	return &userpb.CreateAPIKeyResponse{ApiKey: toProtoAPIKey(apiKey), Key: key}, nil
+}
+
+// ListAPIKeys lists API keys without the keys themselves (admins only)
+func (s *UserGRPCServer) ListAPIKeys(ctx context.Context, req *userpb.ListAPIKeysRequest) (*userpb.ListAPIKeysResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
+
+	apiKeys, err := s.userService.ListAPIKeys(ctx, req.IncludeRevoked)
+	if err != nil {
+		return nil, apiKeyError(err, "failed to list API keys")
+	}
+	protoKeys := make([]*userpb.APIKey, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		protoKeys[i] = toProtoAPIKey(apiKey)
+	}
+	return &userpb.ListAPIKeysResponse{ApiKeys: protoKeys}, nil
+}
+
+// RevokeAPIKey stops an API key from working (admins only)
+func (s *UserGRPCServer) RevokeAPIKey(ctx context.Context, req *userpb.RevokeAPIKeyRequest) (*userpb.RevokeAPIKeyResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	if req.ApiKeyId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "api_key_id is required")
+	}
+	log.Printf("gRPC RevokeAPIKey request for ID: %s", req.ApiKeyId)
+
+	if err := s.userService.RevokeAPIKey(ctx, req.ApiKeyId); err != nil {
+		return nil, apiKeyError(err, "failed to revoke API key")
+	}
+	return &userpb.RevokeAPIKeyResponse{}, nil
+}
+
+// ValidateAPIKey looks up an API key for another service (services only). A bad key is a
+// normal answer (valid=false), not an RPC error.
+func (s *UserGRPCServer) ValidateAPIKey(ctx context.Context, req *userpb.ValidateAPIKeyRequest) (*userpb.ValidateAPIKeyResponse, error) {
+	if err := auth.CheckRole(ctx, auth.RoleService); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	if req.Key == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "key is required")
+	}
+
+	p, err := s.userService.AuthenticateAPIKey(ctx, req.Key)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return &userpb.ValidateAPIKeyResponse{Valid: false}, nil
+		}
+		log.Printf("Error validating API key: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to validate API key")
+	}
+	return &userpb.ValidateAPIKeyResponse{Valid: true, ApiKeyId: p.APIKeyID, Name: p.Service, Scopes: p.Scopes}, nil
+}
+
+// AddAddress adds an address to the user's address book
+func (s *UserGRPCServer) AddAddress(ctx context.Context, req *userpb.AddAddressRequest) (*userpb.AddAddressResponse, error) {
+	if req.UserId == "" || req.Address == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and address are required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC AddAddress request for user ID: %s", req.UserId)
+
+	addr, err := s.userService.AddAddress(ctx, req.UserId, fromProtoAddress(req.Address))
+	if err != nil {
+		return nil, addressError(err, "failed to add address")
+	}
+	return &userpb.AddAddressResponse{Address: toProtoAddress(addr)}, nil
+}
+
+// ListAddresses returns the user's address book, default first
+func (s *UserGRPCServer) ListAddresses(ctx context.Context, req *userpb.ListAddressesRequest) (*userpb.ListAddressesResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+
+	addrs, err := s.userService.ListAddresses(ctx, req.UserId)
+	if err != nil {
+		return nil, addressError(err, "failed to list addresses")
+	}
+	protoAddrs := make([]*userpb.Address, len(addrs))
+	for i, addr := range addrs {
+		protoAddrs[i] = toProtoAddress(addr)
+	}
+	return &userpb.ListAddressesResponse{Addresses: protoAddrs}, nil
+}
+
+// UpdateAddress replaces one of the user's addresses; past orders keep their copy
+func (s *UserGRPCServer) UpdateAddress(ctx context.Context, req *userpb.UpdateAddressRequest) (*userpb.UpdateAddressResponse, error) {
+	if req.UserId == "" || req.Address == nil || req.Address.Id == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and address with id are required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC UpdateAddress request for ID: %s", req.Address.Id)
+
+	addr, err := s.userService.UpdateAddress(ctx, req.UserId, fromProtoAddress(req.Address))
+	if err != nil {
+		return nil, addressError(err, "failed to update address")
+	}
+	return &userpb.UpdateAddressResponse{Address: toProtoAddress(addr)}, nil
+}
+
+// DeleteAddress removes one of the user's addresses
+func (s *UserGRPCServer) DeleteAddress(ctx context.Context, req *userpb.DeleteAddressRequest) (*userpb.DeleteAddressResponse, error) {
+	if req.UserId == "" || req.AddressId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and address_id are required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC DeleteAddress request for ID: %s", req.AddressId)
+
+	if err := s.userService.DeleteAddress(ctx, req.UserId, req.AddressId); err != nil {
+		return nil, addressError(err, "failed to delete address")
+	}
+	return &userpb.DeleteAddressResponse{}, nil
+}
+
+// SetDefaultAddress makes one of the user's addresses their default
+func (s *UserGRPCServer) SetDefaultAddress(ctx context.Context, req *userpb.SetDefaultAddressRequest) (*userpb.SetDefaultAddressResponse, error) {
+	if req.UserId == "" || req.AddressId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id and address_id are required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC SetDefaultAddress request for ID: %s", req.AddressId)
+
+	addr, err := s.userService.SetDefaultAddress(ctx, req.UserId, req.AddressId)
+	if err != nil {
+		return nil, addressError(err, "failed to set default address")
+	}
+	return &userpb.SetDefaultAddressResponse{Address: toProtoAddress(addr)}, nil
+}
+
+// RequestDataExport returns the user's data as a JSON archive (the user themselves or an admin)
+func (s *UserGRPCServer) RequestDataExport(ctx context.Context, req *userpb.RequestDataExportRequest) (*userpb.RequestDataExportResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC RequestDataExport request for user ID: %s", req.UserId)
+
+	archive, dataReq, err := s.userService.RequestDataExport(ctx, req.UserId, requestedBy(ctx))
+	if err != nil {
+		return nil, dataRequestError(err, "failed to export user data")
+	}
+	return &userpb.RequestDataExportResponse{RequestId: dataReq.ID, Archive: archive}, nil
+}
+
+// EraseUser anonymises the user and pseudonymises their orders (the user themselves or an admin)
+func (s *UserGRPCServer) EraseUser(ctx context.Context, req *userpb.EraseUserRequest) (*userpb.EraseUserResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckUser(ctx, req.UserId); err != nil {
+		return nil, auth.StatusError(err)
+	}
+	log.Printf("gRPC EraseUser request for user ID: %s", req.UserId)
+
+	dataReq, err := s.userService.EraseUser(ctx, req.UserId, requestedBy(ctx))
+	if err != nil {
+		return nil, dataRequestError(err, "failed to erase user")
+	}
+	return &userpb.EraseUserResponse{Request: toProtoDataRequest(dataReq)}, nil
+}
+
+// ListDataRequests returns the audit trail of a user's exports and erasures (admins only)
+func (s *UserGRPCServer) ListDataRequests(ctx context.Context, req *userpb.ListDataRequestsRequest) (*userpb.ListDataRequestsResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id is required")
+	}
+	if err := auth.CheckRole(ctx, auth.RoleAdmin); err != nil {
+		return nil, auth.StatusError(err)
+	}
+
+	dataReqs, err := s.userService.ListDataRequests(ctx, req.UserId)
+	if err != nil {
+		return nil, dataRequestError(err, "failed to list data requests")
+	}
+	protoReqs := make([]*userpb.DataRequest, len(dataReqs))
+	for i, dataReq := range dataReqs {
+		protoReqs[i] = toProtoDataRequest(dataReq)
+	}
+	return &userpb.ListDataRequestsResponse{Requests: protoReqs}, nil
+}
+
+// requestedBy names the caller in ctx for the data request audit trail: their user ID, or
+// the name of the calling service or API key.
+func requestedBy(ctx context.Context) string {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if p.UserID != "" {
+		return p.UserID
+	}
+	return p.Service
+}
+
+// dataRequestError maps data export and erasure errors to gRPC status codes
+func dataRequestError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Errorf(codes.NotFound, "user not found")
+	case errors.Is(err, service.ErrLastAdmin):
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrDataRequestFailed):
+		return status.Errorf(codes.Unavailable, err.Error())
+	}
+	log.Printf("Error handling data request: %v", err)
+	return status.Errorf(codes.Internal, msg)
+}
+
+// addressError maps address book errors to gRPC status codes
+func addressError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidAddress):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrTooManyAddresses):
+		return status.Errorf(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, service.ErrAddressNotFound):
+		return status.Errorf(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+	log.Printf("Error managing addresses: %v", err)
+	return status.Errorf(codes.Internal, msg)
+}
+
+// apiKeyError maps API key errors to gRPC status codes
+func apiKeyError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIKeyName), errors.Is(err, service.ErrInvalidScope),
+		errors.Is(err, service.ErrInvalidExpiry):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		return status.Errorf(codes.NotFound, err.Error())
+	}
+	log.Printf("Error managing API keys: %v", err)
+	return status.Errorf(codes.Internal, msg)
+}
+
+// mfaError maps two-factor errors to gRPC status codes
+func mfaError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrTooManyLoginAttempts):
+		return status.Errorf(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrInvalidMFAChallenge):
+		return status.Errorf(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrMFAAlreadyEnabled), errors.Is(err, service.ErrMFANotEnabled),
+		errors.Is(err, service.ErrMFANotEnrolled), errors.Is(err, service.ErrMFAStateChanged):
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+	log.Printf("Error with 2FA: %v", err)
+	return status.Errorf(codes.Internal, msg)
+}
+
+// profileError maps profile management errors to gRPC status codes
+func profileError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidUserToken):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrEmailAlreadyVerified):
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Errorf(codes.NotFound, "user not found")
+	case errors.Is(err, service.ErrUserAlreadyExists):
+		return status.Errorf(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrIncorrectPassword):
+		return status.Errorf(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrInvalidUserData), errors.Is(err, service.ErrInvalidPageToken):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrLastAdmin):
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	}
+	log.Printf("Error managing user profile: %v", err)
+	return status.Errorf(codes.Internal, msg)
+}
+
+// toProtoUser converts a domain user to its protobuf form (without the password hash)
+func toProtoUser(user *model.User) *userpb.User {
+	protoUser := &userpb.User{
+		Id:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+		Roles:     user.Roles,
+	}
+	if user.DeletedAt != nil {
+		protoUser.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+	if user.EmailVerifiedAt != nil {
+		protoUser.EmailVerifiedAt = timestamppb.New(*user.EmailVerifiedAt)
+	}
+	if user.MFAEnabledAt != nil {
+		protoUser.MfaEnabledAt = timestamppb.New(*user.MFAEnabledAt)
+	}
+	return protoUser
+}
+
+// toProtoAPIKey converts an API key record to its protobuf form (it never has the key)
+func toProtoAPIKey(apiKey *model.APIKey) *userpb.APIKey {
+	protoKey := &userpb.APIKey{
+		Id:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedBy: apiKey.CreatedBy,
+		CreatedAt: timestamppb.New(apiKey.CreatedAt),
+	}
+	if apiKey.ExpiresAt != nil {
+		protoKey.ExpiresAt = timestamppb.New(*apiKey.ExpiresAt)
+	}
+	if apiKey.LastUsedAt != nil {
+		protoKey.LastUsedAt = timestamppb.New(*apiKey.LastUsedAt)
+	}
+	if apiKey.RevokedAt != nil {
+		protoKey.RevokedAt = timestamppb.New(*apiKey.RevokedAt)
+	}
+	return protoKey
+}
+
+// toProtoAddress converts an address book entry to its protobuf form
+func toProtoAddress(addr *model.Address) *userpb.Address {
+	return &userpb.Address{
+		Id:            addr.ID,
+		UserId:        addr.UserID,
+		Label:         addr.Label,
+		RecipientName: addr.RecipientName,
+		Line1:         addr.Line1,
+		Line2:         addr.Line2,
+		City:          addr.City,
+		Region:        addr.Region,
+		PostalCode:    addr.PostalCode,
+		CountryCode:   addr.CountryCode,
+		Phone:         addr.Phone,
+		IsDefault:     addr.IsDefault,
+		CreatedAt:     timestamppb.New(addr.CreatedAt),
+		UpdatedAt:     timestamppb.New(addr.UpdatedAt),
+	}
+}
+
+// fromProtoAddress takes the editable fields of a protobuf address
+func fromProtoAddress(addr *userpb.Address) *model.Address {
+	return &model.Address{
+		ID:            addr.Id,
+		Label:         addr.Label,
+		RecipientName: addr.RecipientName,
+		Line1:         addr.Line1,
+		Line2:         addr.Line2,
+		City:          addr.City,
+		Region:        addr.Region,
+		PostalCode:    addr.PostalCode,
+		CountryCode:   addr.CountryCode,
+		Phone:         addr.Phone,
+		IsDefault:     addr.IsDefault,
+	}
+}
+
+// toProtoDataRequest converts a data request audit record to its protobuf form
+func toProtoDataRequest(req *model.DataRequest) *userpb.DataRequest {
+	protoReq := &userpb.DataRequest{
+		Id:             req.ID,
+		UserId:         req.UserID,
+		Kind:           string(req.Kind),
+		Status:         string(req.Status),
+		RequestedBy:    req.RequestedBy,
+		OrdersAffected: int32(req.OrdersAffected),
+		LastError:      req.LastError,
+		CreatedAt:      timestamppb.New(req.CreatedAt),
+	}
+	if req.CompletedAt != nil {
+		protoReq.CompletedAt = timestamppb.New(*req.CompletedAt)
+	}
+	return protoReq
+}
@@ -4,14 +4,22 @@ package handler
 import (
 	"errors"
 	"log"
+	"math"
 	"microservices-project/internal/userservice/model"
 	"microservices-project/internal/userservice/service"
+	"microservices-project/pkg/auth"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 )
 
+// nextPageTokenHeader carries the token for the next page of a keyset-paginated list.
+const nextPageTokenHeader = "X-Next-Page-Token"
+
 // UserHTTPHandler handles HTTP requests for the User service.
 type UserHTTPHandler struct {
 	userService service.UserServiceInterface
@@ -30,10 +38,52 @@ func (h *UserHTTPHandler) Routes() chi.Router {
 
 	r.Use(render.SetContentType(render.ContentTypeJSON)) // Set content-type headers as JSON
 
+	// Public: these are how a client gets (or gives up) a token
 	r.Post("/users/register", h.createUser)
-	r.Get("/users/{userID}", h.getUser)
 	r.Post("/users/login", h.loginUser)
-	// Add other routes like PUT /users/{userID}, DELETE /users/{userID} as needed
+	r.Post("/users/login/mfa", h.verifyMFA) // Second step for users with 2FA
+	r.Post("/users/token/refresh", h.refreshToken)
+	r.Post("/users/logout", h.logout)
+	r.Post("/users/logout-all", h.logoutAllSessions)
+	// Public: driven by the tokens in mailed links
+	r.Post("/users/password/reset-request", h.requestPasswordReset)
+	r.Post("/users/password/reset", h.resetPassword)
+	r.Post("/users/email/verify", h.verifyEmail)
+
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireAuthentication)
+		r.With(auth.RequireScope(auth.ScopeUsersRead)).Get("/users/{userID}", h.getUser)
+		r.Patch("/users/{userID}", h.updateUser)             // Change username and/or email
+		r.Delete("/users/{userID}", h.deleteUser)            // Soft-delete and anonymise
+		r.Post("/users/{userID}/password", h.changePassword) // Logs out every session
+		r.Post("/users/{userID}/email/verification", h.sendVerificationEmail)
+		r.Post("/users/{userID}/mfa/enroll", h.enrollMFA)
+		r.Post("/users/{userID}/mfa/confirm", h.confirmMFA)
+		r.Post("/users/{userID}/mfa/disable", h.disableMFA)
+		// Shipping and billing address book
+		r.With(auth.RequireScope(auth.ScopeUsersRead)).Get("/users/{userID}/addresses", h.listAddresses) // Default first
+		r.Post("/users/{userID}/addresses", h.addAddress)
+		r.Put("/users/{userID}/addresses/{addressID}", h.updateAddress)
+		r.Delete("/users/{userID}/addresses/{addressID}", h.deleteAddress)
+		r.Post("/users/{userID}/addresses/{addressID}/default", h.setDefaultAddress)
+		// GDPR data requests
+		r.Post("/users/{userID}/data-export", h.requestDataExport) // Downloads a JSON archive
+		r.Post("/users/{userID}/erase", h.eraseUser)               // Anonymise and pseudonymise orders; safe to retry
+	})
+
+	// User administration (admins only)
+	r.With(auth.RequireScope(auth.ScopeUsersRead), auth.RequireRole(auth.RoleAdmin)).Get("/users", h.listUsers)
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireRole(auth.RoleAdmin))
+		r.Post("/users/{userID}/roles", h.assignRole)
+		r.Delete("/users/{userID}/roles/{role}", h.revokeRole)
+		r.Post("/users/{userID}/unlock", h.unlockUser) // Lift a login lockout; ?ip= also unlocks that address
+		r.Get("/users/{userID}/data-requests", h.listDataRequests) // Audit trail of exports and erasures
+		// API keys for batch jobs and integrations
+		r.Post("/api-keys", h.createAPIKey) // The response is the only time the key is shown
+		r.Get("/api-keys", h.listAPIKeys)   // ?includeRevoked=true to see revoked keys too
+		r.Delete("/api-keys/{apiKeyID}", h.revokeAPIKey)
+	})
 
 	return r
 }
@@ -59,21 +109,37 @@ func (c *CreateUserHTTPRequest) Bind(r *http.Request) error {
 }
 
 type UserHTTPResponse struct {
-	ID        string `json:"id"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	CreatedAt string `json:"created_at"` // Consider RFC3339 format
-	UpdatedAt string `json:"updated_at"`
+	ID        string   `json:"id"`
+	Username  string   `json:"username"`
+	Email     string   `json:"email"`
+	Roles     []string `json:"roles"`
+	CreatedAt string   `json:"created_at"` // Consider RFC3339 format
+	UpdatedAt string   `json:"updated_at"`
+	DeletedAt string   `json:"deleted_at,omitempty"`
+	// EmailVerifiedAt is empty until the user follows the link in the verification email
+	EmailVerifiedAt string `json:"email_verified_at,omitempty"`
+	MFAEnabledAt    string `json:"mfa_enabled_at,omitempty"` // Set while 2FA is on
 }
 
 func NewUserHTTPResponse(user *model.User) *UserHTTPResponse {
-	return &UserHTTPResponse{
+	response := &UserHTTPResponse{
 		ID:        user.ID,
 		Username:  user.Username,
 		Email:     user.Email,
+		Roles:     user.Roles,
 		CreatedAt: user.CreatedAt.Format(http.TimeFormat), // Or time.RFC3339
 		UpdatedAt: user.UpdatedAt.Format(http.TimeFormat), // Or time.RFC3339
 	}
+	if user.DeletedAt != nil {
+		response.DeletedAt = user.DeletedAt.Format(http.TimeFormat)
+	}
+	if user.EmailVerifiedAt != nil {
+		response.EmailVerifiedAt = user.EmailVerifiedAt.Format(http.TimeFormat)
+	}
+	if user.MFAEnabledAt != nil {
+		response.MFAEnabledAt = user.MFAEnabledAt.Format(http.TimeFormat)
+	}
+	return response
 }
 
 type LoginHTTPRequest struct {
@@ -89,8 +155,302 @@ func (l *LoginHTTPRequest) Bind(r *http.Request) error {
 }
 
 type LoginHTTPResponse struct {
-	Token string            `json:"token"`
-	User  *UserHTTPResponse `json:"user"`
+	Token                 string            `json:"token"`
+	ExpiresAt             string            `json:"expires_at"` // RFC3339
+	RefreshToken          string            `json:"refresh_token"`
+	RefreshTokenExpiresAt string            `json:"refresh_token_expires_at"`
+	User                  *UserHTTPResponse `json:"user,omitempty"` // Not set on refresh
+}
+
+// MFAChallengeHTTPResponse is what POST /users/login returns instead of tokens for users with
+// 2FA. The challenge goes to POST /users/login/mfa together with a code.
+type MFAChallengeHTTPResponse struct {
+	MFARequired           bool   `json:"mfa_required"`
+	MFAChallengeToken     string `json:"mfa_challenge_token"`
+	MFAChallengeExpiresAt string `json:"mfa_challenge_expires_at"` // RFC3339
+}
+
+// VerifyMFAHTTPRequest is the body of POST /users/login/mfa.
+type VerifyMFAHTTPRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"` // TOTP or recovery code
+}
+
+func (v *VerifyMFAHTTPRequest) Bind(r *http.Request) error {
+	if v.ChallengeToken == "" || v.Code == "" {
+		return errors.New("challenge_token and code are required")
+	}
+	return nil
+}
+
+// MFACodeHTTPRequest is the body of the 2FA confirm and disable routes.
+type MFACodeHTTPRequest struct {
+	Code string `json:"code"`
+}
+
+func (m *MFACodeHTTPRequest) Bind(r *http.Request) error {
+	return nil // Whether the code may be empty depends on the route and the caller
+}
+
+// MFAEnrollmentHTTPResponse is returned by POST /users/{userID}/mfa/enroll.
+type MFAEnrollmentHTTPResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+// RecoveryCodesHTTPResponse is returned by POST /users/{userID}/mfa/confirm.
+type RecoveryCodesHTTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// RefreshTokenHTTPRequest is the body of the refresh, logout and logout-all routes.
+type RefreshTokenHTTPRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (rt *RefreshTokenHTTPRequest) Bind(r *http.Request) error {
+	if rt.RefreshToken == "" {
+		return errors.New("refresh_token is required")
+	}
+	return nil
+}
+
+// AssignRoleHTTPRequest is the body of POST /users/{userID}/roles.
+type AssignRoleHTTPRequest struct {
+	Role string `json:"role"`
+}
+
+func (a *AssignRoleHTTPRequest) Bind(r *http.Request) error {
+	if a.Role == "" {
+		return errors.New("role is required")
+	}
+	return nil
+}
+
+// UpdateUserHTTPRequest is the body of PATCH /users/{userID}. Omitted fields are left unchanged.
+type UpdateUserHTTPRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func (u *UpdateUserHTTPRequest) Bind(r *http.Request) error {
+	if u.Username == "" && u.Email == "" {
+		return errors.New("username or email is required")
+	}
+	return nil
+}
+
+// ChangePasswordHTTPRequest is the body of POST /users/{userID}/password.
+type ChangePasswordHTTPRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (c *ChangePasswordHTTPRequest) Bind(r *http.Request) error {
+	if c.CurrentPassword == "" || c.NewPassword == "" {
+		return errors.New("current_password and new_password are required")
+	}
+	return nil
+}
+
+// PasswordResetRequestHTTPRequest is the body of POST /users/password/reset-request.
+type PasswordResetRequestHTTPRequest struct {
+	Email string `json:"email"`
+}
+
+func (p *PasswordResetRequestHTTPRequest) Bind(r *http.Request) error {
+	if p.Email == "" {
+		return errors.New("email is required")
+	}
+	return nil
+}
+
+// ResetPasswordHTTPRequest is the body of POST /users/password/reset.
+type ResetPasswordHTTPRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+func (p *ResetPasswordHTTPRequest) Bind(r *http.Request) error {
+	if p.Token == "" || p.NewPassword == "" {
+		return errors.New("token and new_password are required")
+	}
+	return nil
+}
+
+// VerifyEmailHTTPRequest is the body of POST /users/email/verify.
+type VerifyEmailHTTPRequest struct {
+	Token string `json:"token"`
+}
+
+func (v *VerifyEmailHTTPRequest) Bind(r *http.Request) error {
+	if v.Token == "" {
+		return errors.New("token is required")
+	}
+	return nil
+}
+
+type CreateAPIKeyHTTPRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`               // e.g. ["products:write", "orders:read"]
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // RFC 3339; omit for a key that doesn't expire
+}
+
+func (c *CreateAPIKeyHTTPRequest) Bind(r *http.Request) error {
+	if c.Name == "" || len(c.Scopes) == 0 {
+		return errors.New("name and at least one scope are required")
+	}
+	return nil
+}
+
+type APIKeyHTTPResponse struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"` // Start of the key, for telling keys apart
+	Scopes     []string `json:"scopes"`
+	CreatedBy  string   `json:"created_by,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	RevokedAt  string   `json:"revoked_at,omitempty"`
+}
+
+func NewAPIKeyHTTPResponse(apiKey *model.APIKey) *APIKeyHTTPResponse {
+	response := &APIKeyHTTPResponse{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedBy: apiKey.CreatedBy,
+		CreatedAt: apiKey.CreatedAt.Format(http.TimeFormat),
+	}
+	if apiKey.ExpiresAt != nil {
+		response.ExpiresAt = apiKey.ExpiresAt.Format(http.TimeFormat)
+	}
+	if apiKey.LastUsedAt != nil {
+		response.LastUsedAt = apiKey.LastUsedAt.Format(http.TimeFormat)
+	}
+	if apiKey.RevokedAt != nil {
+		response.RevokedAt = apiKey.RevokedAt.Format(http.TimeFormat)
+	}
+	return response
+}
+
+// CreatedAPIKeyHTTPResponse is the only response that includes the key itself.
+type CreatedAPIKeyHTTPResponse struct {
+	*APIKeyHTTPResponse
+	Key string `json:"key"`
+}
+
+// AddressHTTPRequest is the body of POST and PUT on addresses. On PUT, every field is
+// replaced and is_default is ignored.
+type AddressHTTPRequest struct {
+	Label         string `json:"label"`
+	RecipientName string `json:"recipient_name"`
+	Line1         string `json:"line1"`
+	Line2         string `json:"line2"`
+	City          string `json:"city"`
+	Region        string `json:"region"`
+	PostalCode    string `json:"postal_code"`
+	CountryCode   string `json:"country_code"` // ISO 3166-1 alpha-2, e.g. "GB"
+	Phone         string `json:"phone"`
+	IsDefault     bool   `json:"is_default"`
+}
+
+// Bind leaves validation to the service, which knows the field limits.
+func (a *AddressHTTPRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+func (a *AddressHTTPRequest) toModel() *model.Address {
+	return &model.Address{
+		Label:         a.Label,
+		RecipientName: a.RecipientName,
+		Line1:         a.Line1,
+		Line2:         a.Line2,
+		City:          a.City,
+		Region:        a.Region,
+		PostalCode:    a.PostalCode,
+		CountryCode:   a.CountryCode,
+		Phone:         a.Phone,
+		IsDefault:     a.IsDefault,
+	}
+}
+
+type AddressHTTPResponse struct {
+	ID            string `json:"id"`
+	Label         string `json:"label,omitempty"`
+	RecipientName string `json:"recipient_name"`
+	Line1         string `json:"line1"`
+	Line2         string `json:"line2,omitempty"`
+	City          string `json:"city"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postal_code"`
+	CountryCode   string `json:"country_code"`
+	Phone         string `json:"phone,omitempty"`
+	IsDefault     bool   `json:"is_default"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+func NewAddressHTTPResponse(addr *model.Address) *AddressHTTPResponse {
+	return &AddressHTTPResponse{
+		ID:            addr.ID,
+		Label:         addr.Label,
+		RecipientName: addr.RecipientName,
+		Line1:         addr.Line1,
+		Line2:         addr.Line2,
+		City:          addr.City,
+		Region:        addr.Region,
+		PostalCode:    addr.PostalCode,
+		CountryCode:   addr.CountryCode,
+		Phone:         addr.Phone,
+		IsDefault:     addr.IsDefault,
+		CreatedAt:     addr.CreatedAt.Format(http.TimeFormat),
+		UpdatedAt:     addr.UpdatedAt.Format(http.TimeFormat),
+	}
+}
+
+type DataRequestHTTPResponse struct {
+	ID             string `json:"id"`
+	UserID         string `json:"user_id"`
+	Kind           string `json:"kind"`
+	Status         string `json:"status"`
+	RequestedBy    string `json:"requested_by"`
+	OrdersAffected int    `json:"orders_affected"`
+	LastError      string `json:"last_error,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	CompletedAt    string `json:"completed_at,omitempty"`
+}
+
+func NewDataRequestHTTPResponse(req *model.DataRequest) *DataRequestHTTPResponse {
+	response := &DataRequestHTTPResponse{
+		ID:             req.ID,
+		UserID:         req.UserID,
+		Kind:           string(req.Kind),
+		Status:         string(req.Status),
+		RequestedBy:    req.RequestedBy,
+		OrdersAffected: req.OrdersAffected,
+		LastError:      req.LastError,
+		CreatedAt:      req.CreatedAt.Format(http.TimeFormat),
+	}
+	if req.CompletedAt != nil {
+		response.CompletedAt = req.CompletedAt.Format(http.TimeFormat)
+	}
+	return response
+}
+
+func newTokensHTTPResponse(tokens *model.AuthTokens, user *model.User) *LoginHTTPResponse {
+	response := &LoginHTTPResponse{
+		Token:                 tokens.AccessToken,
+		ExpiresAt:             tokens.ExpiresAt.UTC().Format(time.RFC3339),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if user != nil {
+		response.User = NewUserHTTPResponse(user)
+	}
+	return response
 }
 
 
@@ -136,6 +496,13 @@ func (h *UserHTTPHandler) getUser(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("HTTP GetUser request received for ID: %s", userID)
 
+	// Users may look themselves up; admins and services anyone
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
 	user, err := h.userService.GetUserByID(r.Context(), userID)
 	if err != nil {
 		log.Printf("Error getting user via HTTP: %v", err)
@@ -166,10 +533,13 @@ func (h *UserHTTPHandler) loginUser(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("HTTP LoginUser request received for email: %s", data.Email)
 
-	user, token, err := h.userService.LoginUser(r.Context(), data.Email, data.Password)
+	user, tokens, err := h.userService.LoginUser(r.Context(), data.Email, data.Password, clientIP(r))
 	if err != nil {
 		log.Printf("Error during login via HTTP: %v", err)
-		if errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrUserNotFound) {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			renderLoginLocked(w, r, locked) // Same for unknown emails, so it reveals nothing
+		} else if errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrUserNotFound) {
 			render.Status(r, http.StatusUnauthorized) // 401 Unauthorized
 			render.JSON(w, r, map[string]string{"error": "Invalid email or password"})
 		} else {
@@ -179,10 +549,730 @@ func (h *UserHTTPHandler) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := LoginHTTPResponse{
-		Token: token,
-		User:  NewUserHTTPResponse(user),
+	if tokens.MFARequired() {
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, &MFAChallengeHTTPResponse{
+			MFARequired:           true,
+			MFAChallengeToken:     tokens.MFAChallengeToken,
+			MFAChallengeExpiresAt: tokens.MFAChallengeExpiresAt.UTC().Format(time.RFC3339),
+		})
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, newTokensHTTPResponse(tokens, user))
+}
+
+// verifyMFA handles POST /users/login/mfa
+func (h *UserHTTPHandler) verifyMFA(w http.ResponseWriter, r *http.Request) {
+	data := &VerifyMFAHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, tokens, err := h.userService.VerifyMFA(r.Context(), data.ChallengeToken, data.Code, clientIP(r))
+	if err != nil {
+		renderMFAError(w, r, err, "Login failed")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, newTokensHTTPResponse(tokens, user))
+}
+
+// renderLoginLocked answers a login attempt during a lockout with 429 and Retry-After.
+func renderLoginLocked(w http.ResponseWriter, r *http.Request, locked *service.LoginLockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	render.Status(r, http.StatusTooManyRequests)
+	render.JSON(w, r, map[string]string{"error": locked.Error()})
+}
+
+// refreshToken handles POST /users/token/refresh
+func (h *UserHTTPHandler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	data := &RefreshTokenHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.userService.RefreshToken(r.Context(), data.RefreshToken)
+	if err != nil {
+		log.Printf("Error refreshing token via HTTP: %v", err)
+		renderSessionError(w, r, err, "Failed to refresh token")
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, newTokensHTTPResponse(tokens, nil))
+}
+
+// logout handles POST /users/logout
+func (h *UserHTTPHandler) logout(w http.ResponseWriter, r *http.Request) {
+	data := &RefreshTokenHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.userService.Logout(r.Context(), data.RefreshToken); err != nil {
+		log.Printf("Error logging out via HTTP: %v", err)
+		renderSessionError(w, r, err, "Failed to log out")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutAllSessions handles POST /users/logout-all
+func (h *UserHTTPHandler) logoutAllSessions(w http.ResponseWriter, r *http.Request) {
+	data := &RefreshTokenHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	revoked, err := h.userService.LogoutAllSessions(r.Context(), data.RefreshToken)
+	if err != nil {
+		log.Printf("Error logging out all sessions via HTTP: %v", err)
+		renderSessionError(w, r, err, "Failed to log out all sessions")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, map[string]int64{"revoked_sessions": revoked})
+}
+
+// renderSessionError maps refresh token errors to HTTP status codes
+func renderSessionError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrRefreshTokenReused):
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]string{"error": "Refresh token was already used; all sessions from that login have been revoked"})
+	case errors.Is(err, service.ErrInvalidRefreshToken):
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	default:
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": msg})
+	}
+}
+
+// assignRole handles POST /users/{userID}/roles
+func (h *UserHTTPHandler) assignRole(w http.ResponseWriter, r *http.Request) {
+	data := &AssignRoleHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.AssignRole(r.Context(), chi.URLParam(r, "userID"), data.Role)
+	if err != nil {
+		renderRoleError(w, r, err, "Failed to assign role")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, NewUserHTTPResponse(user))
+}
+
+// revokeRole handles DELETE /users/{userID}/roles/{role}
+func (h *UserHTTPHandler) revokeRole(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.RevokeRole(r.Context(), chi.URLParam(r, "userID"), chi.URLParam(r, "role"))
+	if err != nil {
+		renderRoleError(w, r, err, "Failed to revoke role")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, NewUserHTTPResponse(user))
+}
+
+// unlockUser handles POST /users/{userID}/unlock
+func (h *UserHTTPHandler) unlockUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.userService.UnlockUser(r.Context(), chi.URLParam(r, "userID"), r.URL.Query().Get("ip")); err != nil {
+		renderProfileError(w, r, err, "Failed to unlock user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientIP is the caller's address as set by the realip middleware, without the port.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// enrollMFA handles POST /users/{userID}/mfa/enroll (the user only)
+func (h *UserHTTPHandler) enrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckSelf(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := h.userService.EnrollMFA(r.Context(), userID)
+	if err != nil {
+		renderMFAError(w, r, err, "Failed to start 2FA enrolment")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, &MFAEnrollmentHTTPResponse{Secret: enrollment.Secret, OtpauthURI: enrollment.URI})
+}
+
+// confirmMFA handles POST /users/{userID}/mfa/confirm (the user only)
+func (h *UserHTTPHandler) confirmMFA(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckSelf(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	data := &MFACodeHTTPRequest{}
+	if err := render.Bind(r, data); err != nil || data.Code == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "code is required"})
+		return
+	}
+
+	recoveryCodes, err := h.userService.ConfirmMFA(r.Context(), userID, data.Code)
+	if err != nil {
+		renderMFAError(w, r, err, "Failed to confirm 2FA")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, &RecoveryCodesHTTPResponse{RecoveryCodes: recoveryCodes})
+}
+
+// disableMFA handles POST /users/{userID}/mfa/disable. The user needs a current code; an
+// admin can leave it out for users who lost their device.
+func (h *UserHTTPHandler) disableMFA(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	data := &MFACodeHTTPRequest{}
+	if r.ContentLength != 0 {
+		if err := render.Bind(r, data); err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if err := auth.CheckSelf(r.Context(), userID); err != nil {
+		if err := auth.CheckRole(r.Context(), auth.RoleAdmin); err != nil {
+			render.Status(r, auth.HTTPStatus(err))
+			render.JSON(w, r, map[string]string{"error": err.Error()})
+			return
+		}
+	} else if data.Code == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "code is required"})
+		return
+	}
+
+	if err := h.userService.DisableMFA(r.Context(), userID, data.Code); err != nil {
+		renderMFAError(w, r, err, "Failed to disable 2FA")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createAPIKey handles POST /api-keys
+func (h *UserHTTPHandler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	data := &CreateAPIKeyHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	p, _ := auth.FromContext(r.Context())
+	log.Printf("HTTP CreateAPIKey request: Name=%s, Scopes=%v", data.Name, data.Scopes)
+
+	key, apiKey, err := h.userService.CreateAPIKey(r.Context(), p.UserID, data.Name, data.Scopes, data.ExpiresAt)
+	if err != nil {
+		renderAPIKeyError(w, r, err, "Failed to create API key")
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, &CreatedAPIKeyHTTPResponse{APIKeyHTTPResponse: NewAPIKeyHTTPResponse(apiKey), Key: key})
+}
+
+// listAPIKeys handles GET /api-keys
+func (h *UserHTTPHandler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	includeRevoked, _ := strconv.ParseBool(r.URL.Query().Get("includeRevoked"))
+	apiKeys, err := h.userService.ListAPIKeys(r.Context(), includeRevoked)
+	if err != nil {
+		renderAPIKeyError(w, r, err, "Failed to list API keys")
+		return
+	}
+
+	response := make([]*APIKeyHTTPResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response = append(response, NewAPIKeyHTTPResponse(apiKey))
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, response)
+}
+
+// revokeAPIKey handles DELETE /api-keys/{apiKeyID}
+func (h *UserHTTPHandler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := h.userService.RevokeAPIKey(r.Context(), chi.URLParam(r, "apiKeyID")); err != nil {
+		renderAPIKeyError(w, r, err, "Failed to revoke API key")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listAddresses handles GET /users/{userID}/addresses
+func (h *UserHTTPHandler) listAddresses(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	addrs, err := h.userService.ListAddresses(r.Context(), userID)
+	if err != nil {
+		renderAddressError(w, r, err, "Failed to list addresses")
+		return
+	}
+	response := make([]*AddressHTTPResponse, 0, len(addrs))
+	for _, addr := range addrs {
+		response = append(response, NewAddressHTTPResponse(addr))
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, response)
+}
+
+// addAddress handles POST /users/{userID}/addresses
+func (h *UserHTTPHandler) addAddress(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	data := &AddressHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("HTTP AddAddress request received for user ID: %s", userID)
+	addr, err := h.userService.AddAddress(r.Context(), userID, data.toModel())
+	if err != nil {
+		renderAddressError(w, r, err, "Failed to add address")
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, NewAddressHTTPResponse(addr))
+}
+
+// updateAddress handles PUT /users/{userID}/addresses/{addressID}
+func (h *UserHTTPHandler) updateAddress(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	data := &AddressHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	addr := data.toModel()
+	addr.ID = chi.URLParam(r, "addressID")
+	log.Printf("HTTP UpdateAddress request received for ID: %s", addr.ID)
+	updated, err := h.userService.UpdateAddress(r.Context(), userID, addr)
+	if err != nil {
+		renderAddressError(w, r, err, "Failed to update address")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, NewAddressHTTPResponse(updated))
+}
+
+// deleteAddress handles DELETE /users/{userID}/addresses/{addressID}
+func (h *UserHTTPHandler) deleteAddress(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	addressID := chi.URLParam(r, "addressID")
+	log.Printf("HTTP DeleteAddress request received for ID: %s", addressID)
+	if err := h.userService.DeleteAddress(r.Context(), userID, addressID); err != nil {
+		renderAddressError(w, r, err, "Failed to delete address")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setDefaultAddress handles POST /users/{userID}/addresses/{addressID}/default
+func (h *UserHTTPHandler) setDefaultAddress(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	addr, err := h.userService.SetDefaultAddress(r.Context(), userID, chi.URLParam(r, "addressID"))
+	if err != nil {
+		renderAddressError(w, r, err, "Failed to set default address")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, NewAddressHTTPResponse(addr))
+}
+
+// renderAddressError maps address book errors to HTTP status codes
+func renderAddressError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAddress):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrTooManyAddresses):
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrAddressNotFound), errors.Is(err, service.ErrUserNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Error managing addresses via HTTP: %v", err)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": msg})
+	}
+}
+
+// requestDataExport handles POST /users/{userID}/data-export. The archive is sent as a JSON
+// attachment; X-Data-Request-ID names its audit record.
+func (h *UserHTTPHandler) requestDataExport(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("HTTP RequestDataExport request received for user ID: %s", userID)
+	archive, req, err := h.userService.RequestDataExport(r.Context(), userID, requestedBy(r.Context()))
+	if err != nil {
+		renderDataRequestError(w, r, err, "Failed to export user data")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="user-`+userID+`-export.json"`)
+	w.Header().Set("X-Data-Request-ID", req.ID)
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// eraseUser handles POST /users/{userID}/erase
+func (h *UserHTTPHandler) eraseUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("HTTP EraseUser request received for user ID: %s", userID)
+	req, err := h.userService.EraseUser(r.Context(), userID, requestedBy(r.Context()))
+	if err != nil {
+		renderDataRequestError(w, r, err, "Failed to erase user")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, NewDataRequestHTTPResponse(req))
+}
+
+// listDataRequests handles GET /users/{userID}/data-requests (admins only)
+func (h *UserHTTPHandler) listDataRequests(w http.ResponseWriter, r *http.Request) {
+	reqs, err := h.userService.ListDataRequests(r.Context(), chi.URLParam(r, "userID"))
+	if err != nil {
+		renderDataRequestError(w, r, err, "Failed to list data requests")
+		return
+	}
+	response := make([]*DataRequestHTTPResponse, 0, len(reqs))
+	for _, req := range reqs {
+		response = append(response, NewDataRequestHTTPResponse(req))
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, response)
+}
+
+// renderDataRequestError maps data export and erasure errors to HTTP status codes
+func renderDataRequestError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrLastAdmin):
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrDataRequestFailed):
+		render.Status(r, http.StatusServiceUnavailable)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Error handling data request via HTTP: %v", err)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": msg})
+	}
+}
+
+// renderAPIKeyError maps API key errors to HTTP status codes
+func renderAPIKeyError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIKeyName), errors.Is(err, service.ErrInvalidScope),
+		errors.Is(err, service.ErrInvalidExpiry):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Error managing API keys via HTTP: %v", err)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": msg})
+	}
+}
+
+// renderMFAError maps two-factor errors to HTTP status codes
+func renderMFAError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var locked *service.LoginLockedError
+	switch {
+	case errors.As(err, &locked):
+		renderLoginLocked(w, r, locked)
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrInvalidMFAChallenge):
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled), errors.Is(err, service.ErrMFANotEnabled),
+		errors.Is(err, service.ErrMFANotEnrolled), errors.Is(err, service.ErrMFAStateChanged):
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Error with 2FA: %v", err)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": msg})
+	}
+}
+
+// renderRoleError maps role assignment errors to HTTP status codes
+func renderRoleError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRole):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrLastAdmin):
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Error changing roles via HTTP: %v", err)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": msg})
+	}
+}
+
+// updateUser handles PATCH /users/{userID}
+func (h *UserHTTPHandler) updateUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	data := &UpdateUserHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("HTTP UpdateUser request received for ID: %s", userID)
+	user, err := h.userService.UpdateUser(r.Context(), userID, data.Username, data.Email)
+	if err != nil {
+		renderProfileError(w, r, err, "Failed to update user")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, NewUserHTTPResponse(user))
+}
+
+// changePassword handles POST /users/{userID}/password
+func (h *UserHTTPHandler) changePassword(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	data := &ChangePasswordHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("HTTP ChangePassword request received for ID: %s", userID)
+	revoked, err := h.userService.ChangePassword(r.Context(), userID, data.CurrentPassword, data.NewPassword)
+	if err != nil {
+		renderProfileError(w, r, err, "Failed to change password")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, map[string]int64{"revoked_sessions": revoked})
+}
+
+// deleteUser handles DELETE /users/{userID}
+func (h *UserHTTPHandler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("HTTP DeleteUser request received for ID: %s", userID)
+	if err := h.userService.DeleteUser(r.Context(), userID); err != nil {
+		renderProfileError(w, r, err, "Failed to delete user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listUsers handles GET /users?emailPrefix=&usernamePrefix=&includeDeleted=&pageToken=&pageSize=.
+// The token for the next page is returned in the X-Next-Page-Token header, which is absent on
+// the last page.
+func (h *UserHTTPHandler) listUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageSize, _ := strconv.Atoi(query.Get("pageSize"))
+	includeDeleted, _ := strconv.ParseBool(query.Get("includeDeleted"))
+	filter := model.UserFilter{
+		EmailPrefix:    query.Get("emailPrefix"),
+		UsernamePrefix: query.Get("usernamePrefix"),
+		IncludeDeleted: includeDeleted,
+	}
+
+	log.Printf("HTTP ListUsers request: PageSize=%d, EmailPrefix=%q, UsernamePrefix=%q", pageSize, filter.EmailPrefix, filter.UsernamePrefix)
+	users, nextPageToken, err := h.userService.ListUsers(r.Context(), filter, query.Get("pageToken"), pageSize)
+	if err != nil {
+		renderProfileError(w, r, err, "Failed to list users")
+		return
+	}
+
+	response := make([]*UserHTTPResponse, 0, len(users))
+	for _, user := range users {
+		response = append(response, NewUserHTTPResponse(user))
+	}
+	if nextPageToken != "" {
+		w.Header().Set(nextPageTokenHeader, nextPageToken)
 	}
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, response)
-}
\ No newline at end of file
+}
+
+// requestPasswordReset handles POST /users/password/reset-request. It answers 202 whether or
+// not the email has an account.
+func (h *UserHTTPHandler) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	data := &PasswordResetRequestHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := h.userService.RequestPasswordReset(r.Context(), data.Email); err != nil {
+		renderProfileError(w, r, err, "Failed to request password reset")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// resetPassword handles POST /users/password/reset
+func (h *UserHTTPHandler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	data := &ResetPasswordHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := h.userService.ResetPassword(r.Context(), data.Token, data.NewPassword); err != nil {
+		renderProfileError(w, r, err, "Failed to reset password")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendVerificationEmail handles POST /users/{userID}/email/verification
+func (h *UserHTTPHandler) sendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := auth.CheckUser(r.Context(), userID); err != nil {
+		render.Status(r, auth.HTTPStatus(err))
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := h.userService.SendVerificationEmail(r.Context(), userID); err != nil {
+		renderProfileError(w, r, err, "Failed to send verification email")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verifyEmail handles POST /users/email/verify
+func (h *UserHTTPHandler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	data := &VerifyEmailHTTPRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	user, err := h.userService.VerifyEmail(r.Context(), data.Token)
+	if err != nil {
+		renderProfileError(w, r, err, "Failed to verify email")
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, NewUserHTTPResponse(user))
+}
+
+// renderProfileError maps profile management errors to HTTP status codes
+func renderProfileError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidUserToken):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailAlreadyVerified):
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotFound):
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrUserAlreadyExists), errors.Is(err, service.ErrLastAdmin):
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrIncorrectPassword):
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidUserData), errors.Is(err, service.ErrInvalidPageToken):
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Error managing user profile via HTTP: %v", err)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": msg})
+	}
+}
@@ -0,0 +1,23 @@
+// internal/userservice/model/address.go
+package model
+
+import "time"
+
+// Address is an entry in a user's shipping and billing address book. Orders copy the
+// address they ship to, so changing it here only affects future orders.
+type Address struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	Label         string    `json:"label,omitempty"` // "Home", "Office", ...
+	RecipientName string    `json:"recipient_name"`
+	Line1         string    `json:"line1"`
+	Line2         string    `json:"line2,omitempty"`
+	City          string    `json:"city"`
+	Region        string    `json:"region,omitempty"` // State, province or county
+	PostalCode    string    `json:"postal_code"`
+	CountryCode   string    `json:"country_code"` // ISO 3166-1 alpha-2, upper case
+	Phone         string    `json:"phone,omitempty"`
+	IsDefault     bool      `json:"is_default"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,24 @@
+// internal/userservice/model/api_key.go
+package model
+
+import "time"
+
+// APIKey is a credential for a batch job or partner integration. It authorises by scope
+// (see pkg/auth) rather than by role. The key itself is only known when it is created.
+type APIKey struct {
+	ID         string
+	Name       string
+	Prefix     string // Start of the key, for telling keys apart
+	KeyHash    string
+	Scopes     []string
+	CreatedBy  string // Admin who created it; empty if that user is gone
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // Nil for keys that don't expire
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// Active reports whether the key can still be used at now.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,35 @@
+// internal/userservice/model/data_request.go
+package model
+
+import "time"
+
+// DataRequestKind is the kind of GDPR request.
+type DataRequestKind string
+
+const (
+	DataRequestExport  DataRequestKind = "EXPORT"  // Right of access: a JSON archive of the user's data
+	DataRequestErasure DataRequestKind = "ERASURE" // Right to erasure: anonymise the user, pseudonymise their orders
+)
+
+// DataRequestStatus tracks a request through to completion.
+type DataRequestStatus string
+
+const (
+	DataRequestPending   DataRequestStatus = "PENDING"
+	DataRequestCompleted DataRequestStatus = "COMPLETED"
+	DataRequestFailed    DataRequestStatus = "FAILED" // Safe to ask again; erasures pick up where they stopped
+)
+
+// DataRequest is the audit record of one data export or erasure.
+type DataRequest struct {
+	ID             string            `json:"id"`
+	UserID         string            `json:"user_id"`
+	Kind           DataRequestKind   `json:"kind"`
+	Status         DataRequestStatus `json:"status"`
+	RequestedBy    string            `json:"requested_by"` // User ID, or the calling service's name
+	Pseudonym      string            `json:"-"`            // Erasures only; never leaves the UserService
+	OrdersAffected int               `json:"orders_affected"`
+	LastError      string            `json:"last_error,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	CompletedAt    *time.Time        `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,14 @@
+// internal/userservice/model/login_attempt.go
+package model
+
+// Scopes that failed logins are counted in.
+const (
+	LoginScopeAccount = "account" // Keyed by lower-cased email, whether or not a user has it
+	LoginScopeIP      = "ip"      // Keyed by client IP address
+)
+
+// LoginAttemptKey identifies one failed login counter.
+type LoginAttemptKey struct {
+	Scope string
+	Key   string
+}
@@ -0,0 +1,18 @@
+// internal/userservice/model/mfa.go
+package model
+
+import "time"
+
+// MFAState is a user's TOTP setup. It is kept out of User so the secret is only read when a
+// code is checked.
+type MFAState struct {
+	UserID    string
+	Secret    string     // Base32; empty if the user never enrolled
+	EnabledAt *time.Time // Nil while enrolment is unconfirmed or 2FA is off
+	LastStep  int64      // TOTP time step of the last accepted code; 0 if none
+}
+
+// Enabled reports whether logins need a second factor.
+func (m *MFAState) Enabled() bool {
+	return m.EnabledAt != nil
+}
@@ -0,0 +1,18 @@
+// internal/userservice/model/session.go
+package model
+
+import "time"
+
+// Session is one refresh token. Every refresh replaces the token with a new one in the same
+// family, so a family is a single login on a single device. The raw token is never stored,
+// only its SHA-256 hash.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	FamilyID   string     `json:"family_id"` // The ID of the family's first session
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReplacedBy string     `json:"replaced_by,omitempty"` // Set once the token has been used to refresh
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,21 @@
+// internal/userservice/model/token.go
+package model
+
+import "time"
+
+// AuthTokens is what a successful login or refresh hands back to the client.
+// For users with 2FA, the password login only returns an MFA challenge; the access and
+// refresh tokens come from trading it in with a code (UserService.VerifyMFA).
+type AuthTokens struct {
+	AccessToken           string    `json:"access_token"` // Signed JWT
+	ExpiresAt             time.Time `json:"expires_at"`
+	RefreshToken          string    `json:"refresh_token"` // Opaque, single use
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	MFAChallengeToken     string    `json:"mfa_challenge_token,omitempty"` // Opaque, single use
+	MFAChallengeExpiresAt time.Time `json:"mfa_challenge_expires_at,omitempty"`
+}
+
+// MFARequired reports whether these are an MFA challenge rather than usable tokens.
+func (t *AuthTokens) MFARequired() bool {
+	return t.MFAChallengeToken != ""
+}
@@ -3,6 +3,12 @@ package model
 
 import "time"
 
+// Roles a user can hold. They match the roles in pkg/auth.
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+)
+
 // User represents the domain model for a user.
 // This is separate from the protobuf User message to allow for domain-specific fields
 // or different representations (e.g., password hash is here, not in proto).
@@ -11,6 +17,33 @@ type User struct {
 	Username     string    `json:"username"`
 	Email        string    `json:"email"`
 	PasswordHash string    `json:"-"` // "-" means don't include in JSON if marshaled directly
+	Roles        []string  `json:"roles"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
-}
\ No newline at end of file
+	// EmailVerifiedAt is set once the user follows the link mailed to Email. Changing the
+	// email clears it.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// MFAEnabledAt is set while two-factor authentication is on; logins then need a TOTP
+	// or recovery code as well as the password.
+	MFAEnabledAt *time.Time `json:"mfa_enabled_at,omitempty"`
+	// DeletedAt is set once the account is deleted. Deleted users are anonymised in place
+	// (so orders keep pointing at them) and can no longer log in.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UserFilter narrows ListUsers. Empty prefixes match everything.
+type UserFilter struct {
+	EmailPrefix    string
+	UsernamePrefix string
+	IncludeDeleted bool
+}
+
+// HasRole reports whether the user holds role.
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
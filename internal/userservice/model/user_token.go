@@ -0,0 +1,24 @@
+// internal/userservice/model/user_token.go
+package model
+
+import "time"
+
+// Purposes of user tokens.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMFAChallenge      = "mfa_challenge" // Handed out by a password login, traded in with a 2FA code
+)
+
+// UserToken is a single-use token for a user, e.g. mailed in a password reset link. The raw
+// token is never stored, only its SHA-256 hash.
+type UserToken struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	Email     string     `json:"email"` // The address it was sent to; the token is void once the user's email changes
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
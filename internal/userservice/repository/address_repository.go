@@ -0,0 +1,220 @@
+// internal/userservice/repository/address_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrAddressNotFound is returned for addresses that don't exist or belong to another user.
+	ErrAddressNotFound = errors.New("address not found")
+	// ErrTooManyAddresses is returned when adding an address to a full address book.
+	ErrTooManyAddresses = errors.New("too many addresses")
+)
+
+// addressColumns are the columns scanAddress expects, in order.
+const addressColumns = `id, user_id, label, recipient_name, line1, line2, city, region, postal_code, country_code, phone, is_default, created_at, updated_at`
+
+// AddressRepositoryInterface stores users' address books. Every method is scoped to a user,
+// so an address ID alone never reaches another user's address.
+type AddressRepositoryInterface interface {
+	// AddAddress adds addr to the user's address book unless it already holds maxAddresses.
+	// The first address becomes the default, as does any address added with IsDefault.
+	AddAddress(ctx context.Context, addr *model.Address, maxAddresses int) (*model.Address, error)
+	GetAddress(ctx context.Context, userID, id string) (*model.Address, error)
+	// ListAddresses returns the default address first, then the rest oldest first.
+	ListAddresses(ctx context.Context, userID string) ([]*model.Address, error)
+	// UpdateAddress replaces every field of the address but IsDefault.
+	UpdateAddress(ctx context.Context, addr *model.Address) (*model.Address, error)
+	// DeleteAddress deletes the address. Deleting the default leaves the user without one.
+	DeleteAddress(ctx context.Context, userID, id string) error
+	// SetDefaultAddress makes the address the user's default in place of the current one.
+	SetDefaultAddress(ctx context.Context, userID, id string) (*model.Address, error)
+}
+
+type AddressRepository struct {
+	db *sql.DB
+}
+
+func NewAddressRepository(db *sql.DB) *AddressRepository {
+	return &AddressRepository{db: db}
+}
+
+func (r *AddressRepository) AddAddress(ctx context.Context, addr *model.Address, maxAddresses int) (*model.Address, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	// Locking the user serialises concurrent adds, so the count and the default stay right
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, addr.UserID).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		log.Printf("Error locking user %s in DB: %v", addr.UserID, err)
+		return nil, err
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_addresses WHERE user_id = $1`, addr.UserID).Scan(&count); err != nil {
+		log.Printf("Error counting addresses of user %s in DB: %v", addr.UserID, err)
+		return nil, err
+	}
+	if count >= maxAddresses {
+		return nil, ErrTooManyAddresses
+	}
+	if count == 0 {
+		addr.IsDefault = true
+	} else if addr.IsDefault {
+		if err := clearDefaultAddress(ctx, tx, addr.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	addr.ID = uuid.New().String()
+	addr.CreatedAt = time.Now()
+	addr.UpdatedAt = addr.CreatedAt
+	query := `INSERT INTO user_addresses (` + addressColumns + `)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	_, err = tx.ExecContext(ctx, query,
+		addr.ID, addr.UserID, addr.Label, addr.RecipientName, addr.Line1, addr.Line2, addr.City, addr.Region,
+		addr.PostalCode, addr.CountryCode, addr.Phone, addr.IsDefault, addr.CreatedAt, addr.UpdatedAt,
+	)
+	if err != nil {
+		log.Printf("Error adding address for user %s in DB: %v", addr.UserID, err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return addr, nil
+}
+
+func (r *AddressRepository) GetAddress(ctx context.Context, userID, id string) (*model.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM user_addresses WHERE id = $1 AND user_id = $2`
+	addr, err := scanAddress(r.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAddressNotFound
+		}
+		log.Printf("Error getting address %s from DB: %v", id, err)
+		return nil, err
+	}
+	return addr, nil
+}
+
+func (r *AddressRepository) ListAddresses(ctx context.Context, userID string) ([]*model.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM user_addresses
+	          WHERE user_id = $1
+	          ORDER BY is_default DESC, created_at, id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		log.Printf("Error listing addresses of user %s from DB: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addrs []*model.Address
+	for rows.Next() {
+		addr, err := scanAddress(rows)
+		if err != nil {
+			log.Printf("Error scanning address row: %v", err)
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating address rows: %v", err)
+		return nil, err
+	}
+	return addrs, nil
+}
+
+func (r *AddressRepository) UpdateAddress(ctx context.Context, addr *model.Address) (*model.Address, error) {
+	addr.UpdatedAt = time.Now()
+	query := `UPDATE user_addresses
+	          SET label = $3, recipient_name = $4, line1 = $5, line2 = $6, city = $7, region = $8,
+	              postal_code = $9, country_code = $10, phone = $11, updated_at = $12
+	          WHERE id = $1 AND user_id = $2
+	          RETURNING is_default, created_at`
+	err := r.db.QueryRowContext(ctx, query,
+		addr.ID, addr.UserID, addr.Label, addr.RecipientName, addr.Line1, addr.Line2, addr.City, addr.Region,
+		addr.PostalCode, addr.CountryCode, addr.Phone, addr.UpdatedAt,
+	).Scan(&addr.IsDefault, &addr.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAddressNotFound
+		}
+		log.Printf("Error updating address %s in DB: %v", addr.ID, err)
+		return nil, err
+	}
+	return addr, nil
+}
+
+func (r *AddressRepository) DeleteAddress(ctx context.Context, userID, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_addresses WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		log.Printf("Error deleting address %s in DB: %v", id, err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrAddressNotFound
+	}
+	return nil
+}
+
+func (r *AddressRepository) SetDefaultAddress(ctx context.Context, userID, id string) (*model.Address, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	// Clear the old default first; the unique index allows only one per user at any time
+	if err := clearDefaultAddress(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+	query := `UPDATE user_addresses SET is_default = TRUE, updated_at = $3
+	          WHERE id = $1 AND user_id = $2
+	          RETURNING ` + addressColumns
+	addr, err := scanAddress(tx.QueryRowContext(ctx, query, id, userID, time.Now()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAddressNotFound
+		}
+		log.Printf("Error setting default address %s in DB: %v", id, err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return addr, nil
+}
+
+func clearDefaultAddress(ctx context.Context, tx *sql.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE user_addresses SET is_default = FALSE WHERE user_id = $1 AND is_default`, userID)
+	if err != nil {
+		log.Printf("Error clearing default address of user %s in DB: %v", userID, err)
+	}
+	return err
+}
+
+func scanAddress(row rowScanner) (*model.Address, error) {
+	addr := &model.Address{}
+	err := row.Scan(&addr.ID, &addr.UserID, &addr.Label, &addr.RecipientName, &addr.Line1, &addr.Line2, &addr.City,
+		&addr.Region, &addr.PostalCode, &addr.CountryCode, &addr.Phone, &addr.IsDefault, &addr.CreatedAt, &addr.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
@@ -0,0 +1,110 @@
+// internal/userservice/repository/address_repository_test.go
+package repository
+
+import (
+	"context"
+	"microservices-project/internal/userservice/model"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressRepository_AddAddress_FirstBecomesDefault(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewAddressRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`)).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM user_addresses WHERE user_id = $1`)).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_addresses`)).
+		WithArgs(sqlmock.AnyArg(), "user-1", "Home", "Ada Lovelace", "12 St James's Sq", "", "London", "", "SW1Y 4JH", "GB", "", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	addr, err := repo.AddAddress(context.Background(), &model.Address{
+		UserID: "user-1", Label: "Home", RecipientName: "Ada Lovelace", Line1: "12 St James's Sq",
+		City: "London", PostalCode: "SW1Y 4JH", CountryCode: "GB",
+	}, 20)
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, addr.ID)
+	assert.True(t, addr.IsDefault)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddressRepository_AddAddress_Full(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewAddressRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE`)).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM user_addresses`)).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(20))
+	mock.ExpectRollback()
+
+	_, err = repo.AddAddress(context.Background(), &model.Address{UserID: "user-1"}, 20)
+
+	assert.ErrorIs(t, err, ErrTooManyAddresses)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddressRepository_SetDefaultAddress_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewAddressRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_addresses SET is_default = FALSE WHERE user_id = $1 AND is_default`)).
+		WithArgs("user-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE user_addresses SET is_default = TRUE`)).
+		WithArgs("addr-2", "user-1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback() // The old default stays
+
+	_, err = repo.SetDefaultAddress(context.Background(), "user-1", "addr-2")
+
+	assert.ErrorIs(t, err, ErrAddressNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddressRepository_ListAddresses(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewAddressRepository(db)
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "user_id", "label", "recipient_name", "line1", "line2", "city", "region", "postal_code", "country_code", "phone", "is_default", "created_at", "updated_at"}).
+		AddRow("addr-2", "user-1", "Office", "Ada Lovelace", "1 Main St", "", "Springfield", "IL", "62701", "US", "", true, now, now).
+		AddRow("addr-1", "user-1", "Home", "Ada Lovelace", "12 St James's Sq", "", "London", "", "SW1Y 4JH", "GB", "", false, now, now)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM user_addresses
+	          WHERE user_id = $1
+	          ORDER BY is_default DESC, created_at, id`)).
+		WithArgs("user-1").
+		WillReturnRows(rows)
+
+	addrs, err := repo.ListAddresses(context.Background(), "user-1")
+
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+	assert.True(t, addrs[0].IsDefault)
+	assert.Equal(t, "GB", addrs[1].CountryCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
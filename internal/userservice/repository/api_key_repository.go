@@ -0,0 +1,150 @@
+// internal/userservice/repository/api_key_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrAPIKeyNotFound is returned for API keys that don't exist.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// apiKeyTouchInterval is how stale last_used_at may get; updating it on every request would
+// turn each authenticated read into a write.
+const apiKeyTouchInterval = time.Minute
+
+// apiKeyColumns are the columns scanAPIKey expects, in order.
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+// APIKeyRepositoryInterface stores API keys by the SHA-256 of the key.
+type APIKeyRepositoryInterface interface {
+	CreateAPIKey(ctx context.Context, key *model.APIKey) (*model.APIKey, error)
+	// GetAPIKeyByHash returns the key with keyHash, revoked or expired or not.
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	// ListAPIKeys returns keys newest first, leaving out revoked ones unless includeRevoked.
+	ListAPIKeys(ctx context.Context, includeRevoked bool) ([]*model.APIKey, error)
+	// RevokeAPIKey revokes the key; revoking it again keeps the first revocation time.
+	RevokeAPIKey(ctx context.Context, id string) error
+	// TouchAPIKey records that the key was used at usedAt, at most once a minute.
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) (*model.APIKey, error) {
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now()
+	var createdBy sql.NullString
+	if key.CreatedBy != "" {
+		createdBy = sql.NullString{String: key.CreatedBy, Valid: true}
+	}
+
+	query := `INSERT INTO api_keys (id, name, prefix, key_hash, scopes, created_by, created_at, expires_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := r.db.ExecContext(ctx, query,
+		key.ID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), createdBy, key.CreatedAt, key.ExpiresAt,
+	)
+	if err != nil {
+		log.Printf("Error creating API key %q in DB: %v", key.Name, err)
+		return nil, err
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAPIKeyNotFound
+		}
+		log.Printf("Error getting API key by hash from DB: %v", err)
+		return nil, err
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context, includeRevoked bool) ([]*model.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys
+	          WHERE $1 OR revoked_at IS NULL
+	          ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.QueryContext(ctx, query, includeRevoked)
+	if err != nil {
+		log.Printf("Error listing API keys from DB: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*model.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			log.Printf("Error scanning API key row: %v", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating API key rows: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id, time.Now())
+	if err != nil {
+		log.Printf("Error revoking API key %s in DB: %v", id, err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = $2
+	          WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)`
+	if _, err := r.db.ExecContext(ctx, query, id, usedAt, usedAt.Add(-apiKeyTouchInterval)); err != nil {
+		log.Printf("Error recording use of API key %s in DB: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	var createdBy sql.NullString
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, pq.Array(&key.Scopes), &createdBy,
+		&key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.CreatedBy = createdBy.String
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
@@ -0,0 +1,52 @@
+// internal/userservice/repository/api_key_repository_test.go
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyRepository_GetAPIKeyByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewAPIKeyRepository(db)
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "name", "prefix", "key_hash", "scopes", "created_by", "created_at", "expires_at", "last_used_at", "revoked_at"}).
+		AddRow("key-1", "nightly export", "mk_ab12cd34", "hash-1", "{orders:read,products:read}", nil, now, nil, nil, nil)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_keys WHERE key_hash = $1`)).
+		WithArgs("hash-1").
+		WillReturnRows(rows)
+
+	key, err := repo.GetAPIKeyByHash(context.Background(), "hash-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", key.ID)
+	assert.Equal(t, []string{"orders:read", "products:read"}, key.Scopes)
+	assert.Empty(t, key.CreatedBy)
+	assert.True(t, key.Active(now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyRepository_RevokeAPIKey_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewAPIKeyRepository(db)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`)).
+		WithArgs("key-404", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repo.RevokeAPIKey(context.Background(), "key-404")
+
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
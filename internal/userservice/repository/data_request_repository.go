@@ -0,0 +1,137 @@
+// internal/userservice/repository/data_request_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// dataRequestColumns are the columns scanDataRequest expects, in order.
+const dataRequestColumns = `id, user_id, kind, status, requested_by, pseudonym, orders_affected, last_error, created_at, completed_at`
+
+// DataRequestRepositoryInterface keeps the audit trail of data exports and erasures. Rows
+// are only ever added and finished, never deleted.
+type DataRequestRepositoryInterface interface {
+	// CreateDataRequest records a new request. It fails with ErrUserNotFound if there is no
+	// such user; deleted users still count, so they can be erased.
+	CreateDataRequest(ctx context.Context, req *model.DataRequest) (*model.DataRequest, error)
+	// FinishDataRequest saves the request's status, orders affected and last error, and
+	// stamps it completed.
+	FinishDataRequest(ctx context.Context, req *model.DataRequest) error
+	// ListDataRequests returns the user's requests, newest first.
+	ListDataRequests(ctx context.Context, userID string) ([]*model.DataRequest, error)
+	// GetErasurePseudonym returns the pseudonym of the user's latest erasure, or "" if they
+	// were never erased, so a repeated erasure moves orders to the same pseudonym.
+	GetErasurePseudonym(ctx context.Context, userID string) (string, error)
+}
+
+type DataRequestRepository struct {
+	db *sql.DB
+}
+
+func NewDataRequestRepository(db *sql.DB) *DataRequestRepository {
+	return &DataRequestRepository{db: db}
+}
+
+func (r *DataRequestRepository) CreateDataRequest(ctx context.Context, req *model.DataRequest) (*model.DataRequest, error) {
+	req.ID = uuid.New().String()
+	req.CreatedAt = time.Now()
+	if req.Status == "" {
+		req.Status = model.DataRequestPending
+	}
+	var pseudonym sql.NullString
+	if req.Pseudonym != "" {
+		pseudonym = sql.NullString{String: req.Pseudonym, Valid: true}
+	}
+
+	query := `INSERT INTO data_requests (id, user_id, kind, status, requested_by, pseudonym, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, req.ID, req.UserID, req.Kind, req.Status, req.RequestedBy, pseudonym, req.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+			return nil, ErrUserNotFound
+		}
+		log.Printf("Error creating data request for user %s in DB: %v", req.UserID, err)
+		return nil, err
+	}
+	return req, nil
+}
+
+func (r *DataRequestRepository) FinishDataRequest(ctx context.Context, req *model.DataRequest) error {
+	now := time.Now()
+	query := `UPDATE data_requests SET status = $2, orders_affected = $3, last_error = $4, completed_at = $5
+	          WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, req.ID, req.Status, req.OrdersAffected, req.LastError, now); err != nil {
+		log.Printf("Error finishing data request %s in DB: %v", req.ID, err)
+		return err
+	}
+	req.CompletedAt = &now
+	return nil
+}
+
+func (r *DataRequestRepository) ListDataRequests(ctx context.Context, userID string) ([]*model.DataRequest, error) {
+	query := `SELECT ` + dataRequestColumns + ` FROM data_requests
+	          WHERE user_id = $1
+	          ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		log.Printf("Error listing data requests of user %s from DB: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reqs []*model.DataRequest
+	for rows.Next() {
+		req, err := scanDataRequest(rows)
+		if err != nil {
+			log.Printf("Error scanning data request row: %v", err)
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating data request rows: %v", err)
+		return nil, err
+	}
+	return reqs, nil
+}
+
+func (r *DataRequestRepository) GetErasurePseudonym(ctx context.Context, userID string) (string, error) {
+	query := `SELECT pseudonym FROM data_requests
+	          WHERE user_id = $1 AND kind = $2 AND pseudonym IS NOT NULL
+	          ORDER BY created_at DESC LIMIT 1`
+	var pseudonym string
+	err := r.db.QueryRowContext(ctx, query, userID, model.DataRequestErasure).Scan(&pseudonym)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		log.Printf("Error getting erasure pseudonym of user %s from DB: %v", userID, err)
+		return "", err
+	}
+	return pseudonym, nil
+}
+
+func scanDataRequest(row rowScanner) (*model.DataRequest, error) {
+	req := &model.DataRequest{}
+	var pseudonym sql.NullString
+	var completedAt sql.NullTime
+	err := row.Scan(&req.ID, &req.UserID, &req.Kind, &req.Status, &req.RequestedBy, &pseudonym,
+		&req.OrdersAffected, &req.LastError, &req.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	req.Pseudonym = pseudonym.String
+	if completedAt.Valid {
+		req.CompletedAt = &completedAt.Time
+	}
+	return req, nil
+}
@@ -0,0 +1,56 @@
+// internal/userservice/repository/data_request_repository_test.go
+package repository
+
+import (
+	"context"
+	"microservices-project/internal/userservice/model"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataRequestRepository_CreateDataRequest_UnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewDataRequestRepository(db)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO data_requests`)).
+		WithArgs(sqlmock.AnyArg(), "user-404", model.DataRequestExport, model.DataRequestPending, "user-404", nil, sqlmock.AnyArg()).
+		WillReturnError(&pq.Error{Code: "23503", Constraint: "data_requests_user_id_fkey"})
+
+	_, err = repo.CreateDataRequest(context.Background(), &model.DataRequest{
+		UserID: "user-404", Kind: model.DataRequestExport, RequestedBy: "user-404",
+	})
+
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDataRequestRepository_GetErasurePseudonym(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewDataRequestRepository(db)
+
+	query := regexp.QuoteMeta(`SELECT pseudonym FROM data_requests`)
+	mock.ExpectQuery(query).
+		WithArgs("user-1", model.DataRequestErasure).
+		WillReturnRows(sqlmock.NewRows([]string{"pseudonym"}).AddRow("5f0c6a0e-8d1b-4c3e-9a57-2f1e0b7c4d21"))
+	mock.ExpectQuery(query).
+		WithArgs("user-2", model.DataRequestErasure).
+		WillReturnRows(sqlmock.NewRows([]string{"pseudonym"}))
+
+	pseudonym, err := repo.GetErasurePseudonym(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "5f0c6a0e-8d1b-4c3e-9a57-2f1e0b7c4d21", pseudonym)
+
+	pseudonym, err = repo.GetErasurePseudonym(context.Background(), "user-2")
+	require.NoError(t, err)
+	assert.Empty(t, pseudonym)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
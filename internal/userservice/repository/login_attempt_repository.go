@@ -0,0 +1,106 @@
+// internal/userservice/repository/login_attempt_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"strings"
+	"time"
+)
+
+// LoginAttemptRepositoryInterface counts failed logins and stores lockouts, so that every
+// replica sees the same state.
+type LoginAttemptRepositoryInterface interface {
+	// LockedUntil returns the latest lockout among keys that is still in force at now, or the
+	// zero time if none of them is locked.
+	LockedUntil(ctx context.Context, now time.Time, keys ...model.LoginAttemptKey) (time.Time, error)
+	// RecordLoginFailure counts a failure against key and returns the number of failures so
+	// far. Failures before windowStart are forgotten and the count starts again at 1.
+	RecordLoginFailure(ctx context.Context, key model.LoginAttemptKey, now, windowStart time.Time) (int, error)
+	// LockLogin locks key until the given time. An existing longer lockout is kept.
+	LockLogin(ctx context.Context, key model.LoginAttemptKey, until time.Time) error
+	// ResetLoginAttempts clears the failure count and any lockout of key.
+	ResetLoginAttempts(ctx context.Context, key model.LoginAttemptKey) error
+	// DeleteStaleLoginAttempts removes counters with no failure and no lockout since before.
+	DeleteStaleLoginAttempts(ctx context.Context, before time.Time) (int64, error)
+}
+
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+func (r *LoginAttemptRepository) LockedUntil(ctx context.Context, now time.Time, keys ...model.LoginAttemptKey) (time.Time, error) {
+	if len(keys) == 0 {
+		return time.Time{}, nil
+	}
+	args := []interface{}{now}
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key.Scope, key.Key)
+		pairs = append(pairs, fmt.Sprintf("($%d, $%d)", len(args)-1, len(args)))
+	}
+	query := `SELECT MAX(locked_until) FROM login_attempts
+	          WHERE locked_until > $1 AND (scope, key) IN (` + strings.Join(pairs, ", ") + `)`
+
+	var lockedUntil sql.NullTime
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&lockedUntil); err != nil {
+		log.Printf("Error checking login lockouts in DB: %v", err)
+		return time.Time{}, err
+	}
+	if !lockedUntil.Valid {
+		return time.Time{}, nil
+	}
+	return lockedUntil.Time, nil
+}
+
+// RecordLoginFailure increments the counter in a single upsert, so concurrent failures on
+// different replicas are all counted.
+func (r *LoginAttemptRepository) RecordLoginFailure(ctx context.Context, key model.LoginAttemptKey, now, windowStart time.Time) (int, error) {
+	query := `INSERT INTO login_attempts (scope, key, failed_count, last_failed_at)
+	          VALUES ($1, $2, 1, $3)
+	          ON CONFLICT (scope, key) DO UPDATE SET
+	              failed_count = CASE WHEN login_attempts.last_failed_at < $4 THEN 1 ELSE login_attempts.failed_count + 1 END,
+	              last_failed_at = $3
+	          RETURNING failed_count`
+	var failures int
+	if err := r.db.QueryRowContext(ctx, query, key.Scope, key.Key, now, windowStart).Scan(&failures); err != nil {
+		log.Printf("Error recording failed login for %s %s in DB: %v", key.Scope, key.Key, err)
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (r *LoginAttemptRepository) LockLogin(ctx context.Context, key model.LoginAttemptKey, until time.Time) error {
+	// GREATEST ignores NULL, so an unlocked row simply takes the new time
+	query := `UPDATE login_attempts SET locked_until = GREATEST(locked_until, $3) WHERE scope = $1 AND key = $2`
+	if _, err := r.db.ExecContext(ctx, query, key.Scope, key.Key, until); err != nil {
+		log.Printf("Error locking logins for %s %s in DB: %v", key.Scope, key.Key, err)
+		return err
+	}
+	return nil
+}
+
+func (r *LoginAttemptRepository) ResetLoginAttempts(ctx context.Context, key model.LoginAttemptKey) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE scope = $1 AND key = $2`, key.Scope, key.Key); err != nil {
+		log.Printf("Error resetting failed logins for %s %s in DB: %v", key.Scope, key.Key, err)
+		return err
+	}
+	return nil
+}
+
+func (r *LoginAttemptRepository) DeleteStaleLoginAttempts(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM login_attempts WHERE last_failed_at < $1 AND (locked_until IS NULL OR locked_until < $1)`, before)
+	if err != nil {
+		log.Printf("Error deleting stale login attempts from DB: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
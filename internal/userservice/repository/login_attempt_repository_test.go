@@ -0,0 +1,72 @@
+// internal/userservice/repository/login_attempt_repository_test.go
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"microservices-project/internal/userservice/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginAttemptRepository_LockedUntil(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewLoginAttemptRepository(db)
+
+	now := time.Now()
+	until := now.Add(time.Minute)
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE locked_until > $1 AND (scope, key) IN (($2, $3), ($4, $5))`)).
+		WithArgs(now, model.LoginScopeAccount, "a@example.com", model.LoginScopeIP, "203.0.113.7").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(until))
+
+	lockedUntil, err := repo.LockedUntil(context.Background(), now,
+		model.LoginAttemptKey{Scope: model.LoginScopeAccount, Key: "a@example.com"},
+		model.LoginAttemptKey{Scope: model.LoginScopeIP, Key: "203.0.113.7"})
+
+	assert.NoError(t, err)
+	assert.True(t, until.Equal(lockedUntil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginAttemptRepository_LockedUntil_NotLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewLoginAttemptRepository(db)
+
+	// MAX over no rows is NULL
+	mock.ExpectQuery(`SELECT MAX\(locked_until\) FROM login_attempts`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+
+	lockedUntil, err := repo.LockedUntil(context.Background(), time.Now(), model.LoginAttemptKey{Scope: model.LoginScopeAccount, Key: "a@example.com"})
+
+	assert.NoError(t, err)
+	assert.True(t, lockedUntil.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginAttemptRepository_RecordLoginFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewLoginAttemptRepository(db)
+
+	now := time.Now()
+	windowStart := now.Add(-24 * time.Hour)
+	mock.ExpectQuery(`INSERT INTO login_attempts (.+) ON CONFLICT \(scope, key\) DO UPDATE`).
+		WithArgs(model.LoginScopeAccount, "a@example.com", now, windowStart).
+		WillReturnRows(sqlmock.NewRows([]string{"failed_count"}).AddRow(3))
+
+	failures, err := repo.RecordLoginFailure(context.Background(), model.LoginAttemptKey{Scope: model.LoginScopeAccount, Key: "a@example.com"}, now, windowStart)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, failures)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
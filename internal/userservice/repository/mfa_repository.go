@@ -0,0 +1,181 @@
+// internal/userservice/repository/mfa_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"time"
+)
+
+var (
+	// ErrMFACodeReused is returned for a TOTP code whose time step was already used.
+	ErrMFACodeReused = errors.New("two-factor code was already used")
+	// ErrRecoveryCodeInvalid is returned for a recovery code the user doesn't have (any more).
+	ErrRecoveryCodeInvalid = errors.New("invalid or already used recovery code")
+	// ErrMFAStateChanged is returned when 2FA was confirmed or turned off concurrently.
+	ErrMFAStateChanged = errors.New("two-factor authentication state changed, try again")
+)
+
+// MFARepositoryInterface stores the TOTP secrets and recovery codes of users.
+type MFARepositoryInterface interface {
+	GetMFAState(ctx context.Context, userID string) (*model.MFAState, error)
+	// SetMFASecret starts (or restarts) enrolment with a new, unconfirmed secret. It fails with
+	// ErrMFAStateChanged if 2FA is already on.
+	SetMFASecret(ctx context.Context, userID, secret string) error
+	// EnableMFA confirms enrolment: it turns 2FA on, records step as used and replaces the
+	// user's recovery codes with codeHashes.
+	EnableMFA(ctx context.Context, userID string, step int64, codeHashes []string) error
+	// UseMFAStep records that a code for step was accepted. Steps can only move forward, so a
+	// code can't be used twice.
+	UseMFAStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode deletes the recovery code, failing with ErrRecoveryCodeInvalid if the user
+	// doesn't have it.
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+	// DisableMFA turns 2FA off and forgets the secret and recovery codes.
+	DisableMFA(ctx context.Context, userID string) error
+}
+
+type MFARepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+func (r *MFARepository) GetMFAState(ctx context.Context, userID string) (*model.MFAState, error) {
+	query := `SELECT COALESCE(mfa_secret, ''), mfa_enabled_at, COALESCE(mfa_last_step, 0)
+	          FROM users WHERE id = $1 AND deleted_at IS NULL`
+	state := &model.MFAState{UserID: userID}
+	var enabledAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&state.Secret, &enabledAt, &state.LastStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		log.Printf("Error getting 2FA state of user %s from DB: %v", userID, err)
+		return nil, err
+	}
+	if enabledAt.Valid {
+		state.EnabledAt = &enabledAt.Time
+	}
+	return state, nil
+}
+
+func (r *MFARepository) SetMFASecret(ctx context.Context, userID, secret string) error {
+	query := `UPDATE users SET mfa_secret = $2, mfa_last_step = NULL, updated_at = $3
+	          WHERE id = $1 AND deleted_at IS NULL AND mfa_enabled_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, userID, secret, time.Now())
+	if err != nil {
+		log.Printf("Error storing 2FA secret of user %s in DB: %v", userID, err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrMFAStateChanged
+	}
+	return nil
+}
+
+func (r *MFARepository) EnableMFA(ctx context.Context, userID string, step int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET mfa_enabled_at = $2, mfa_last_step = $3, updated_at = $2
+		 WHERE id = $1 AND deleted_at IS NULL AND mfa_secret IS NOT NULL AND mfa_enabled_at IS NULL`,
+		userID, now, step)
+	if err != nil {
+		log.Printf("Error enabling 2FA for user %s in DB: %v", userID, err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrMFAStateChanged
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes, now); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores codeHashes instead.
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, codeHashes []string, now time.Time) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error deleting recovery codes of user %s in DB: %v", userID, err)
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, $3)`,
+			userID, hash, now); err != nil {
+			log.Printf("Error storing recovery code of user %s in DB: %v", userID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MFARepository) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	query := `UPDATE users SET mfa_last_step = $2
+	          WHERE id = $1 AND mfa_enabled_at IS NOT NULL AND (mfa_last_step IS NULL OR mfa_last_step < $2)`
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		log.Printf("Error recording 2FA code use of user %s in DB: %v", userID, err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrMFACodeReused
+	}
+	return nil
+}
+
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1 AND code_hash = $2`, userID, codeHash)
+	if err != nil {
+		log.Printf("Error using recovery code of user %s in DB: %v", userID, err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+func (r *MFARepository) DisableMFA(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET mfa_secret = NULL, mfa_enabled_at = NULL, mfa_last_step = NULL, updated_at = $2
+		 WHERE id = $1 AND deleted_at IS NULL`,
+		userID, time.Now())
+	if err != nil {
+		log.Printf("Error disabling 2FA for user %s in DB: %v", userID, err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrUserNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error deleting recovery codes of user %s in DB: %v", userID, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
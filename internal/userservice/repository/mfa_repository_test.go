@@ -0,0 +1,53 @@
+// internal/userservice/repository/mfa_repository_test.go
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFARepository_UseMFAStep_RejectsReplay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewMFARepository(db)
+
+	// The step only moves forward, so the same code a second time updates nothing
+	mock.ExpectExec(regexp.QuoteMeta(`(mfa_last_step IS NULL OR mfa_last_step < $2)`)).
+		WithArgs("user-1", int64(56666666)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repo.UseMFAStep(context.Background(), "user-1", 56666666)
+
+	assert.ErrorIs(t, err, ErrMFACodeReused)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFARepository_EnableMFA(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewMFARepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET mfa_enabled_at = $2, mfa_last_step = $3`)).
+		WithArgs("user-1", sqlmock.AnyArg(), int64(42)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`)).
+		WithArgs("user-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, hash := range []string{"hash-1", "hash-2"} {
+		mock.ExpectExec(`INSERT INTO mfa_recovery_codes`).
+			WithArgs("user-1", hash, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.EnableMFA(context.Background(), "user-1", 42, []string{"hash-1", "hash-2"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
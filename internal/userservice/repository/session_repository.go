@@ -0,0 +1,227 @@
+// internal/userservice/repository/session_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+	ErrSessionRevoked  = errors.New("session revoked")
+	// ErrSessionReused means an already rotated refresh token was presented again. Either the
+	// client or an attacker holds a stolen copy, so the whole family has been revoked.
+	ErrSessionReused = errors.New("refresh token reused")
+)
+
+// SessionRepositoryInterface stores refresh token sessions (see model.Session).
+type SessionRepositoryInterface interface {
+	CreateSession(ctx context.Context, session *model.Session) (*model.Session, error)
+	GetActiveSession(ctx context.Context, tokenHash string) (*model.Session, error)
+	// RotateSession swaps the session with tokenHash for next, which joins the same family.
+	// It returns the old session.
+	RotateSession(ctx context.Context, tokenHash string, next *model.Session) (*model.Session, error)
+	RevokeFamily(ctx context.Context, tokenHash string) error
+	RevokeAllUserSessions(ctx context.Context, userID string) (int64, error)
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error)
+}
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// CreateSession inserts a session. A session without a FamilyID starts a new family.
+func (r *SessionRepository) CreateSession(ctx context.Context, session *model.Session) (*model.Session, error) {
+	if err := insertSession(ctx, r.db, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetActiveSession returns the session for tokenHash if it can still be used to refresh.
+func (r *SessionRepository) GetActiveSession(ctx context.Context, tokenHash string) (*model.Session, error) {
+	session, err := getSession(ctx, r.db, tokenHash, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSessionUsable(session, time.Now()); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// RotateSession consumes the refresh token with tokenHash and records next as its successor.
+// Presenting a token that was already rotated revokes every session in its family and
+// returns ErrSessionReused.
+func (r *SessionRepository) RotateSession(ctx context.Context, tokenHash string, next *model.Session) (*model.Session, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	// Lock the row so two concurrent refreshes with the same token can't both succeed
+	current, err := getSession(ctx, tx, tokenHash, true)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := checkSessionUsable(current, now); err != nil {
+		if !errors.Is(err, ErrSessionReused) {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE user_sessions SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`, now, current.FamilyID); err != nil {
+			log.Printf("Error revoking session family %s in DB: %v", current.FamilyID, err)
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		log.Printf("Refresh token reuse detected for user %s; revoked session family %s", current.UserID, current.FamilyID)
+		return nil, ErrSessionReused
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	if err := insertSession(ctx, tx, next); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE user_sessions SET replaced_by = $1 WHERE id = $2`, next.ID, current.ID); err != nil {
+		log.Printf("Error marking session %s as rotated in DB: %v", current.ID, err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	current.ReplacedBy = next.ID
+	return current, nil
+}
+
+// RevokeFamily ends the login that tokenHash belongs to, whichever generation it is.
+func (r *SessionRepository) RevokeFamily(ctx context.Context, tokenHash string) error {
+	query := `UPDATE user_sessions SET revoked_at = $1
+	          WHERE family_id = (SELECT family_id FROM user_sessions WHERE token_hash = $2) AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, time.Now(), tokenHash)
+	if err != nil {
+		log.Printf("Error revoking session family in DB: %v", err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSessionNotFound // Unknown token, or already logged out
+	}
+	return nil
+}
+
+// RevokeAllUserSessions logs the user out everywhere and returns how many sessions were live.
+// Already rotated sessions are stamped too, so later reuse of any old token is still rejected.
+func (r *SessionRepository) RevokeAllUserSessions(ctx context.Context, userID string) (int64, error) {
+	return revokeUserSessions(ctx, r.db, userID, time.Now())
+}
+
+// DeleteExpiredSessions removes sessions that expired before the cutoff.
+func (r *SessionRepository) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_sessions WHERE expires_at < $1`, before)
+	if err != nil {
+		log.Printf("Error deleting expired sessions from DB: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// checkSessionUsable reports why a session can't be used to refresh, if it can't.
+func checkSessionUsable(session *model.Session, now time.Time) error {
+	switch {
+	case session.ReplacedBy != "":
+		return ErrSessionReused
+	case session.RevokedAt != nil:
+		return ErrSessionRevoked
+	case !session.ExpiresAt.After(now):
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+// sessionQuerier is satisfied by both *sql.DB and *sql.Tx.
+type sessionQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// revokeUserSessions is RevokeAllUserSessions on q, so it can also run in a user transaction.
+func revokeUserSessions(ctx context.Context, q sessionQuerier, userID string, now time.Time) (int64, error) {
+	query := `WITH revoked AS (
+	              UPDATE user_sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL
+	              RETURNING replaced_by, expires_at)
+	          SELECT COUNT(*) FROM revoked WHERE replaced_by IS NULL AND expires_at > $1`
+	var live int64
+	if err := q.QueryRowContext(ctx, query, now, userID).Scan(&live); err != nil {
+		log.Printf("Error revoking sessions of user %s in DB: %v", userID, err)
+		return 0, err
+	}
+	return live, nil
+}
+
+func insertSession(ctx context.Context, q sessionQuerier, session *model.Session) error {
+	session.ID = uuid.New().String()
+	if session.FamilyID == "" {
+		session.FamilyID = session.ID
+	}
+	session.CreatedAt = time.Now()
+
+	query := `INSERT INTO user_sessions (id, user_id, family_id, token_hash, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := q.ExecContext(ctx, query,
+		session.ID, session.UserID, session.FamilyID, session.TokenHash, session.ExpiresAt, session.CreatedAt,
+	)
+	if err != nil {
+		log.Printf("Error creating session in DB: %v", err)
+		return err
+	}
+	return nil
+}
+
+func getSession(ctx context.Context, q sessionQuerier, tokenHash string, forUpdate bool) (*model.Session, error) {
+	query := `SELECT id, user_id, family_id, token_hash, expires_at, created_at, replaced_by, revoked_at
+	          FROM user_sessions WHERE token_hash = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	session := &model.Session{}
+	var replacedBy sql.NullString
+	var revokedAt sql.NullTime
+	err := q.QueryRowContext(ctx, query, tokenHash).Scan(
+		&session.ID, &session.UserID, &session.FamilyID, &session.TokenHash,
+		&session.ExpiresAt, &session.CreatedAt, &replacedBy, &revokedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSessionNotFound
+		}
+		log.Printf("Error getting session from DB: %v", err)
+		return nil, err
+	}
+	session.ReplacedBy = replacedBy.String
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, nil
+}
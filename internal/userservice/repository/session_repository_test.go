@@ -0,0 +1,87 @@
+// internal/userservice/repository/session_repository_test.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"microservices-project/internal/userservice/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sessionColumns = []string{"id", "user_id", "family_id", "token_hash", "expires_at", "created_at", "replaced_by", "revoked_at"}
+
+func TestSessionRepository_RotateSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSessionRepository(db)
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM user_sessions WHERE token_hash = \$1 FOR UPDATE`).
+		WithArgs("old-hash").
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("session-1", "user-1", "family-1", "old-hash", now.Add(time.Hour), now, nil, nil))
+	mock.ExpectExec(`INSERT INTO user_sessions`).
+		WithArgs(sqlmock.AnyArg(), "user-1", "family-1", "new-hash", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE user_sessions SET replaced_by = \$1 WHERE id = \$2`).
+		WithArgs(sqlmock.AnyArg(), "session-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	next := &model.Session{TokenHash: "new-hash", ExpiresAt: now.Add(time.Hour)}
+	old, err := repo.RotateSession(context.Background(), "old-hash", next)
+
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", next.UserID)
+	assert.Equal(t, "family-1", next.FamilyID)
+	assert.Equal(t, next.ID, old.ReplacedBy)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionRepository_RotateSession_ReuseRevokesFamily(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSessionRepository(db)
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM user_sessions WHERE token_hash = \$1 FOR UPDATE`).
+		WithArgs("old-hash").
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("session-1", "user-1", "family-1", "old-hash", now.Add(time.Hour), now, "session-2", nil))
+	// The revocation must be committed even though the call fails
+	mock.ExpectExec(`UPDATE user_sessions SET revoked_at = \$1 WHERE family_id = \$2`).
+		WithArgs(sqlmock.AnyArg(), "family-1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	_, err = repo.RotateSession(context.Background(), "old-hash", &model.Session{TokenHash: "new-hash"})
+
+	assert.True(t, errors.Is(err, ErrSessionReused))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionRepository_RevokeFamily_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSessionRepository(db)
+
+	mock.ExpectExec(`UPDATE user_sessions SET revoked_at`).
+		WithArgs(sqlmock.AnyArg(), "unknown-hash").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repo.RevokeFamily(context.Background(), "unknown-hash")
+
+	assert.True(t, errors.Is(err, ErrSessionNotFound))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -5,23 +5,53 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
-	"microservices-project/internal/database" // Our database package
 	"microservices-project/internal/userservice/model"
+	"microservices-project/pkg/pagination"
+	"strings"
 	"time"
 
 	"github.com/google/uuid" // For generating UUIDs if not handled by DB default
+	"github.com/lib/pq"
 )
 
 // ErrUserNotFound is returned when a user is not found.
 var ErrUserNotFound = errors.New("user not found")
 
+// ErrUserAlreadyExists is returned when the username or email is taken by another user.
+var ErrUserAlreadyExists = errors.New("user with this email or username already exists")
+
+// ErrLastAdmin is returned when removing a role would leave nobody able to administer the system.
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
+// userColumns are the columns scanUser expects, in order.
+const userColumns = `id, username, email, password_hash, roles, created_at, updated_at, deleted_at, email_verified_at, mfa_enabled_at`
+
 // UserRepositoryInterface defines the operations for user data storage.
 type UserRepositoryInterface interface {
 	CreateUser(ctx context.Context, user *model.User) (*model.User, error)
 	GetUserByID(ctx context.Context, id string) (*model.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
-	// UpdateUser, DeleteUser, etc. can be added later
+	// IsUserDeleted reports whether the user has been deleted. It fails with ErrUserNotFound
+	// if there has never been such a user.
+	IsUserDeleted(ctx context.Context, id string) (bool, error)
+	// AddUserRole and RemoveUserRole return the updated user. Adding a role the user already
+	// has, or removing one they don't, is not an error.
+	AddUserRole(ctx context.Context, id, role string) (*model.User, error)
+	RemoveUserRole(ctx context.Context, id, role string) (*model.User, error)
+	CountUsersWithRole(ctx context.Context, role string) (int64, error)
+	// UpdateUser saves the user's username and email. A new email starts out unverified.
+	UpdateUser(ctx context.Context, user *model.User) (*model.User, error)
+	// MarkEmailVerified verifies the user's email, provided it is still email.
+	MarkEmailVerified(ctx context.Context, id, email string) (*model.User, error)
+	// UpdatePassword sets a new password hash and revokes all of the user's sessions and
+	// unused password reset tokens.
+	UpdatePassword(ctx context.Context, id, passwordHash string) (revokedSessions int64, err error)
+	// DeleteUser soft-deletes and anonymises the user, revokes their sessions and forgets the
+	// failed logins counted against their email.
+	DeleteUser(ctx context.Context, id string) error
+	ListUsersAfter(ctx context.Context, filter model.UserFilter, after *pagination.Cursor, limit int) ([]*model.User, error)
 }
 
 // UserRepository implements UserRepositoryInterface using PostgreSQL.
@@ -42,19 +72,22 @@ func (r *UserRepository) CreateUser(ctx context.Context, user *model.User) (*mod
 	}
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	if len(user.Roles) == 0 {
+		user.Roles = []string{model.RoleCustomer}
+	}
 
-	query := `INSERT INTO users (id, username, email, password_hash, created_at, updated_at)
-	          VALUES ($1, $2, $3, $4, $5, $6)
+	query := `INSERT INTO users (id, username, email, password_hash, roles, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)
 	          RETURNING id, created_at, updated_at` // Return DB generated values if any
 
-	// Use database.DB directly (or pass it in NewUserRepository)
-	// For this example, we'll assume database.DB is initialized
-	err := database.DB.QueryRowContext(ctx, query,
-		user.ID, user.Username, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt,
+	err := r.db.QueryRowContext(ctx, query,
+		user.ID, user.Username, user.Email, user.PasswordHash, pq.Array(user.Roles), user.CreatedAt, user.UpdatedAt,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt) // Update with any values returned by RETURNING
 
 	if err != nil {
-		// TODO: Check for specific DB errors like unique constraint violation
+		if isUniqueViolation(err) {
+			return nil, ErrUserAlreadyExists
+		}
 		log.Printf("Error creating user in DB: %v", err)
 		return nil, err
 	}
@@ -63,14 +96,10 @@ func (r *UserRepository) CreateUser(ctx context.Context, user *model.User) (*mod
 
 // GetUserByID retrieves a user by their ID.
 func (r *UserRepository) GetUserByID(ctx context.Context, id string) (*model.User, error) {
-	user := &model.User{}
-	query := `SELECT id, username, email, password_hash, created_at, updated_at
-	          FROM users WHERE id = $1`
-
-	err := database.DB.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + `
+	          FROM users WHERE id = $1 AND deleted_at IS NULL`
 
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -81,16 +110,27 @@ func (r *UserRepository) GetUserByID(ctx context.Context, id string) (*model.Use
 	return user, nil
 }
 
+// IsUserDeleted reports whether the user's deleted_at is set. Unlike the other lookups it
+// finds deleted users too.
+func (r *UserRepository) IsUserDeleted(ctx context.Context, id string) (bool, error) {
+	var deleted bool
+	err := r.db.QueryRowContext(ctx, `SELECT deleted_at IS NOT NULL FROM users WHERE id = $1`, id).Scan(&deleted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, ErrUserNotFound
+		}
+		log.Printf("Error checking whether user %s is deleted in DB: %v", id, err)
+		return false, err
+	}
+	return deleted, nil
+}
+
 // GetUserByEmail retrieves a user by their email.
 func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
-	user := &model.User{}
-	query := `SELECT id, username, email, password_hash, created_at, updated_at
-	          FROM users WHERE email = $1`
-
-	err := database.DB.QueryRowContext(ctx, query, email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + `
+	          FROM users WHERE email = $1 AND deleted_at IS NULL`
 
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -99,4 +139,303 @@ func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 		return nil, err
 	}
 	return user, nil
-}
\ No newline at end of file
+}
+
+// AddUserRole grants role to the user.
+func (r *UserRepository) AddUserRole(ctx context.Context, id, role string) (*model.User, error) {
+	query := `UPDATE users
+	          SET roles = CASE WHEN $2 = ANY(roles) THEN roles ELSE array_append(roles, $2) END, updated_at = $3
+	          WHERE id = $1 AND deleted_at IS NULL
+	          RETURNING ` + userColumns
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id, role, time.Now()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		log.Printf("Error adding role %s to user %s in DB: %v", role, id, err)
+		return nil, err
+	}
+	return user, nil
+}
+
+// RemoveUserRole takes role away from the user. Removing the admin role from the last admin
+// fails with ErrLastAdmin, so there is always someone who can appoint new admins.
+func (r *UserRepository) RemoveUserRole(ctx context.Context, id, role string) (*model.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if role == model.RoleAdmin {
+		if err := checkNotLastAdmin(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `UPDATE users SET roles = array_remove(roles, $2), updated_at = $3
+	          WHERE id = $1 AND deleted_at IS NULL
+	          RETURNING ` + userColumns
+	user, err := scanUser(tx.QueryRowContext(ctx, query, id, role, time.Now()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		log.Printf("Error removing role %s from user %s in DB: %v", role, id, err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return user, nil
+}
+
+// CountUsersWithRole returns how many users hold role.
+func (r *UserRepository) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	var count int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE $1 = ANY(roles)`, role).Scan(&count); err != nil {
+		log.Printf("Error counting users with role %s in DB: %v", role, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// UpdateUser saves the user's username and email. Taking another user's username or email
+// fails with ErrUserAlreadyExists; the unique constraints decide, so concurrent updates can't
+// both win.
+func (r *UserRepository) UpdateUser(ctx context.Context, user *model.User) (*model.User, error) {
+	query := `UPDATE users
+	          SET username = $2, email = $3, updated_at = $4,
+	              email_verified_at = CASE WHEN email = $3 THEN email_verified_at END
+	          WHERE id = $1 AND deleted_at IS NULL
+	          RETURNING ` + userColumns
+
+	updated, err := scanUser(r.db.QueryRowContext(ctx, query, user.ID, user.Username, user.Email, time.Now()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		if isUniqueViolation(err) {
+			return nil, ErrUserAlreadyExists
+		}
+		log.Printf("Error updating user %s in DB: %v", user.ID, err)
+		return nil, err
+	}
+	return updated, nil
+}
+
+// MarkEmailVerified sets email_verified_at, unless the user has since changed their email away
+// from email (then ErrUserNotFound). Verifying twice keeps the first time.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id, email string) (*model.User, error) {
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, $3), updated_at = $3
+	          WHERE id = $1 AND email = $2 AND deleted_at IS NULL
+	          RETURNING ` + userColumns
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id, email, time.Now()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		log.Printf("Error verifying email of user %s in DB: %v", id, err)
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdatePassword sets a new password hash and revokes all of the user's sessions in the same
+// transaction, so refresh tokens obtained with the old password stop working with it. Unused
+// reset links are voided too.
+func (r *UserRepository) UpdatePassword(ctx context.Context, id, passwordHash string) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET password_hash = $2, updated_at = $3 WHERE id = $1 AND deleted_at IS NULL`,
+		id, passwordHash, now)
+	if err != nil {
+		log.Printf("Error updating password of user %s in DB: %v", id, err)
+		return 0, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, ErrUserNotFound
+	}
+	revoked, err := revokeUserSessions(ctx, tx, id, now)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		id, model.TokenPurposePasswordReset); err != nil {
+		log.Printf("Error voiding password reset tokens of user %s in DB: %v", id, err)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return revoked, nil
+}
+
+// DeleteUser soft-deletes the user. The row stays so orders keep a valid user_id, but the
+// username, email, password and roles are wiped, all sessions and mailed tokens revoked and the address book
+// deleted. Deleting the last admin fails with ErrLastAdmin.
+func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if err := checkNotLastAdmin(ctx, tx, id); err != nil {
+		return err
+	}
+
+	// Failed logins are keyed by the email, which is about to be anonymised
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM login_attempts WHERE scope = $2 AND key = (SELECT LOWER(TRIM(email)) FROM users WHERE id = $1 AND deleted_at IS NULL)`,
+		id, model.LoginScopeAccount)
+	if err != nil {
+		log.Printf("Error deleting failed logins of user %s in DB: %v", id, err)
+		return err
+	}
+
+	// The id keeps the anonymised username and email unique (and within the column sizes)
+	now := time.Now()
+	query := `UPDATE users
+	          SET username = 'deleted-' || id::text, email = id::text || '@deleted.invalid',
+	              email_verified_at = NULL, password_hash = '', roles = '{}', updated_at = $2, deleted_at = $2,
+	              mfa_secret = NULL, mfa_enabled_at = NULL, mfa_last_step = NULL
+	          WHERE id = $1 AND deleted_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, id, now)
+	if err != nil {
+		log.Printf("Error deleting user %s in DB: %v", id, err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrUserNotFound
+	}
+	if _, err := revokeUserSessions(ctx, tx, id, now); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_tokens WHERE user_id = $1`, id); err != nil {
+		log.Printf("Error deleting tokens of user %s in DB: %v", id, err)
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, id); err != nil {
+		log.Printf("Error deleting recovery codes of user %s in DB: %v", id, err)
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_addresses WHERE user_id = $1`, id); err != nil {
+		log.Printf("Error deleting addresses of user %s in DB: %v", id, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ListUsersAfter returns up to limit users matching filter that come after the cursor in
+// (created_at DESC, id DESC) order, or the first page if after is nil.
+func (r *UserRepository) ListUsersAfter(ctx context.Context, filter model.UserFilter, after *pagination.Cursor, limit int) ([]*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE TRUE`
+	args := []interface{}{limit}
+	if !filter.IncludeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	if filter.EmailPrefix != "" {
+		args = append(args, escapeLike(filter.EmailPrefix)+"%")
+		query += fmt.Sprintf(` AND email LIKE $%d`, len(args))
+	}
+	if filter.UsernamePrefix != "" {
+		args = append(args, escapeLike(filter.UsernamePrefix)+"%")
+		query += fmt.Sprintf(` AND username LIKE $%d`, len(args))
+	}
+	if after != nil {
+		args = append(args, after.CreatedAt, after.ID)
+		query += fmt.Sprintf(` AND (created_at, id) < ($%d, $%d)`, len(args)-1, len(args))
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT $1`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Error listing users from DB: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			log.Printf("Error scanning user row: %v", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error after iterating user rows: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// checkNotLastAdmin fails with ErrLastAdmin if the user is the only admin. It locks the admins
+// so two admins can't demote (or delete) each other at the same time.
+func checkNotLastAdmin(ctx context.Context, tx *sql.Tx, id string) error {
+	var admins int64
+	var isAdmin bool
+	query := `SELECT COUNT(*), COALESCE(BOOL_OR(id = $2), FALSE)
+	          FROM (SELECT id FROM users WHERE $1 = ANY(roles) FOR UPDATE) admins`
+	if err := tx.QueryRowContext(ctx, query, model.RoleAdmin, id).Scan(&admins, &isAdmin); err != nil {
+		log.Printf("Error counting admins in DB: %v", err)
+		return err
+	}
+	if isAdmin && admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads a row selected with userColumns.
+func scanUser(row rowScanner) (*model.User, error) {
+	user := &model.User{}
+	var deletedAt, emailVerifiedAt, mfaEnabledAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, pq.Array(&user.Roles), &user.CreatedAt, &user.UpdatedAt,
+		&deletedAt, &emailVerifiedAt, &mfaEnabledAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if mfaEnabledAt.Valid {
+		user.MFAEnabledAt = &mfaEnabledAt.Time
+	}
+	return user, nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// escapeLike escapes the LIKE wildcards in s, so a prefix search matches it literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -10,9 +10,11 @@ import (
 	"time"
 
 	"microservices-project/internal/userservice/model"
+	"microservices-project/pkg/pagination"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -41,12 +43,12 @@ func TestUserRepository_CreateUser(t *testing.T) {
 	// We expect an INSERT query. Use regexp.QuoteMeta for fixed parts of the query.
 	// The actual query will have placeholders like $1, $2, etc.
 	// sqlmock expects the exact query string or a regex.
-	expectedSQL := regexp.QuoteMeta(`INSERT INTO users (id, username, email, password_hash, created_at, updated_at)
-	          VALUES ($1, $2, $3, $4, $5, $6)
+	expectedSQL := regexp.QuoteMeta(`INSERT INTO users (id, username, email, password_hash, roles, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)
 	          RETURNING id, created_at, updated_at`)
 
 	mock.ExpectQuery(expectedSQL). // ExpectQuery for QueryRowContext
-					WithArgs(sqlmock.AnyArg(), userToCreate.Username, userToCreate.Email, userToCreate.PasswordHash, sqlmock.AnyArg(), sqlmock.AnyArg()). // Match arguments
+					WithArgs(sqlmock.AnyArg(), userToCreate.Username, userToCreate.Email, userToCreate.PasswordHash, `{"customer"}`, sqlmock.AnyArg(), sqlmock.AnyArg()). // Match arguments
 					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
 						AddRow(userID, now, now)) // Values returned by RETURNING
 
@@ -59,6 +61,7 @@ func TestUserRepository_CreateUser(t *testing.T) {
 	assert.Equal(t, userToCreate.Email, createdUser.Email)
 	assert.WithinDuration(t, now, createdUser.CreatedAt, time.Second) // Check time is close
 	assert.WithinDuration(t, now, createdUser.UpdatedAt, time.Second)
+	assert.Equal(t, []string{model.RoleCustomer}, createdUser.Roles) // New users are customers by default
 
 	// Ensure all expectations were met
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -75,15 +78,16 @@ func TestUserRepository_GetUserByID_Found(t *testing.T) {
 		Username:     "testuser",
 		Email:        "test@example.com",
 		PasswordHash: "hashedpassword",
+		Roles:        []string{model.RoleCustomer},
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
 
-	expectedSQL := regexp.QuoteMeta(`SELECT id, username, email, password_hash, created_at, updated_at
-	          FROM users WHERE id = $1`)
+	expectedSQL := regexp.QuoteMeta(`SELECT id, username, email, password_hash, roles, created_at, updated_at, deleted_at, email_verified_at, mfa_enabled_at
+	          FROM users WHERE id = $1 AND deleted_at IS NULL`)
 
-	rows := sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "created_at", "updated_at"}).
-		AddRow(expectedUser.ID, expectedUser.Username, expectedUser.Email, expectedUser.PasswordHash, expectedUser.CreatedAt, expectedUser.UpdatedAt)
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "roles", "created_at", "updated_at", "deleted_at", "email_verified_at", "mfa_enabled_at"}).
+		AddRow(expectedUser.ID, expectedUser.Username, expectedUser.Email, expectedUser.PasswordHash, "{customer}", expectedUser.CreatedAt, expectedUser.UpdatedAt, nil, nil, nil)
 
 	mock.ExpectQuery(expectedSQL).WithArgs(userID).WillReturnRows(rows)
 
@@ -100,8 +104,8 @@ func TestUserRepository_GetUserByID_NotFound(t *testing.T) {
 	defer db.Close()
 
 	userID := uuid.New().String()
-	expectedSQL := regexp.QuoteMeta(`SELECT id, username, email, password_hash, created_at, updated_at
-	          FROM users WHERE id = $1`)
+	expectedSQL := regexp.QuoteMeta(`SELECT id, username, email, password_hash, roles, created_at, updated_at, deleted_at, email_verified_at, mfa_enabled_at
+	          FROM users WHERE id = $1 AND deleted_at IS NULL`)
 
 	mock.ExpectQuery(expectedSQL).WithArgs(userID).WillReturnError(sql.ErrNoRows)
 
@@ -124,15 +128,16 @@ func TestUserRepository_GetUserByEmail_Found(t *testing.T) {
 		Username:     "testuser",
 		Email:        email,
 		PasswordHash: "hashedpassword",
+		Roles:        []string{model.RoleCustomer},
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
 
-	expectedSQL := regexp.QuoteMeta(`SELECT id, username, email, password_hash, created_at, updated_at
-	          FROM users WHERE email = $1`)
+	expectedSQL := regexp.QuoteMeta(`SELECT id, username, email, password_hash, roles, created_at, updated_at, deleted_at, email_verified_at, mfa_enabled_at
+	          FROM users WHERE email = $1 AND deleted_at IS NULL`)
 
-	rows := sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "created_at", "updated_at"}).
-		AddRow(expectedUser.ID, expectedUser.Username, expectedUser.Email, expectedUser.PasswordHash, expectedUser.CreatedAt, expectedUser.UpdatedAt)
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "roles", "created_at", "updated_at", "deleted_at", "email_verified_at", "mfa_enabled_at"}).
+		AddRow(expectedUser.ID, expectedUser.Username, expectedUser.Email, expectedUser.PasswordHash, "{customer}", expectedUser.CreatedAt, expectedUser.UpdatedAt, nil, nil, nil)
 
 	mock.ExpectQuery(expectedSQL).WithArgs(email).WillReturnRows(rows)
 
@@ -142,4 +147,105 @@ func TestUserRepository_GetUserByEmail_Found(t *testing.T) {
 	assert.NotNil(t, user)
 	assert.Equal(t, expectedUser, user)
 	assert.NoError(t, mock.ExpectationsWereMet())
-}
\ No newline at end of file
+}
+
+func TestUserRepository_RemoveUserRole_LastAdmin(t *testing.T) {
+	db, mock, repo := newMockDBAndRepo(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*), COALESCE(BOOL_OR(id = $2), FALSE)`)).
+		WithArgs(model.RoleAdmin, "admin-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "is_admin"}).AddRow(1, true))
+	mock.ExpectRollback()
+
+	user, err := repo.RemoveUserRole(context.Background(), "admin-1", model.RoleAdmin)
+
+	assert.True(t, errors.Is(err, ErrLastAdmin))
+	assert.Nil(t, user)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_UpdateUser_Taken(t *testing.T) {
+	db, mock, repo := newMockDBAndRepo(t)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE users SET username = $2, email = $3, updated_at = $4`)).
+		WithArgs("user-1", "taken", "user@example.com", sqlmock.AnyArg()).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "users_username_key"})
+
+	user, err := repo.UpdateUser(context.Background(), &model.User{ID: "user-1", Username: "taken", Email: "user@example.com"})
+
+	assert.True(t, errors.Is(err, ErrUserAlreadyExists))
+	assert.Nil(t, user)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_IsUserDeleted(t *testing.T) {
+	db, mock, repo := newMockDBAndRepo(t)
+	defer db.Close()
+
+	query := regexp.QuoteMeta(`SELECT deleted_at IS NOT NULL FROM users WHERE id = $1`)
+	mock.ExpectQuery(query).WithArgs("user-1").WillReturnRows(sqlmock.NewRows([]string{"deleted"}).AddRow(true))
+	mock.ExpectQuery(query).WithArgs("user-2").WillReturnError(sql.ErrNoRows)
+
+	deleted, err := repo.IsUserDeleted(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	_, err = repo.IsUserDeleted(context.Background(), "user-2")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_DeleteUser(t *testing.T) {
+	db, mock, repo := newMockDBAndRepo(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*), COALESCE(BOOL_OR(id = $2), FALSE)`)).
+		WithArgs(model.RoleAdmin, "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "is_admin"}).AddRow(1, false))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM login_attempts WHERE scope = $2 AND key = (SELECT LOWER(TRIM(email)) FROM users WHERE id = $1 AND deleted_at IS NULL)`)).
+		WithArgs("user-1", model.LoginScopeAccount).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`SET username = 'deleted-' || id::text, email = id::text || '@deleted.invalid'`)).
+		WithArgs("user-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE user_sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_tokens WHERE user_id = $1`)).
+		WithArgs("user-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`)).
+		WithArgs("user-1").
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_addresses WHERE user_id = $1`)).
+		WithArgs("user-1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.DeleteUser(context.Background(), "user-1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_ListUsersAfter_Filters(t *testing.T) {
+	db, mock, repo := newMockDBAndRepo(t)
+	defer db.Close()
+
+	now := time.Now()
+	cursor := &pagination.Cursor{CreatedAt: now, ID: "user-9"}
+	// Wildcards in the prefix are matched literally
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM users WHERE TRUE AND deleted_at IS NULL AND email LIKE $2 AND (created_at, id) < ($3, $4) ORDER BY created_at DESC, id DESC LIMIT $1`)).
+		WithArgs(11, `a\_b%`, now, "user-9").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "roles", "created_at", "updated_at", "deleted_at", "email_verified_at", "mfa_enabled_at"}).
+			AddRow("user-8", "ab", "a_b@example.com", "hash", "{customer}", now, now, nil, nil, nil))
+
+	users, err := repo.ListUsersAfter(context.Background(), model.UserFilter{EmailPrefix: "a_b"}, cursor, 11)
+
+	assert.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "a_b@example.com", users[0].Email)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
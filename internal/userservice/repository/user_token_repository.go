@@ -0,0 +1,97 @@
+// internal/userservice/repository/user_token_repository.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrUserTokenInvalid is returned for a token that doesn't exist, has expired or was used.
+var ErrUserTokenInvalid = errors.New("invalid, expired or already used token")
+
+// UserTokenRepositoryInterface stores single-use user tokens (see model.UserToken).
+type UserTokenRepositoryInterface interface {
+	// CreateUserToken stores token and voids the user's other unused tokens for the same
+	// purpose, so only the latest link works.
+	CreateUserToken(ctx context.Context, token *model.UserToken) (*model.UserToken, error)
+	// ConsumeUserToken marks the token used and returns it. Each token can be consumed once.
+	ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error)
+	DeleteExpiredUserTokens(ctx context.Context, before time.Time) (int64, error)
+}
+
+type UserTokenRepository struct {
+	db *sql.DB
+}
+
+func NewUserTokenRepository(db *sql.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+func (r *UserTokenRepository) CreateUserToken(ctx context.Context, token *model.UserToken) (*model.UserToken, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		token.UserID, token.Purpose); err != nil {
+		log.Printf("Error voiding old %s tokens of user %s in DB: %v", token.Purpose, token.UserID, err)
+		return nil, err
+	}
+
+	token.ID = uuid.New().String()
+	token.CreatedAt = time.Now()
+	query := `INSERT INTO user_tokens (id, user_id, purpose, token_hash, email, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := tx.ExecContext(ctx, query,
+		token.ID, token.UserID, token.Purpose, token.TokenHash, token.Email, token.ExpiresAt, token.CreatedAt,
+	); err != nil {
+		log.Printf("Error creating %s token for user %s in DB: %v", token.Purpose, token.UserID, err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return token, nil
+}
+
+// ConsumeUserToken marks the token used in a single UPDATE, so two requests racing with the
+// same token can't both succeed.
+func (r *UserTokenRepository) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error) {
+	now := time.Now()
+	query := `UPDATE user_tokens SET used_at = $3
+	          WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+	          RETURNING id, user_id, purpose, token_hash, email, expires_at, created_at`
+	token := &model.UserToken{}
+	err := r.db.QueryRowContext(ctx, query, tokenHash, purpose, now).Scan(
+		&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.Email, &token.ExpiresAt, &token.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserTokenInvalid
+		}
+		log.Printf("Error consuming %s token in DB: %v", purpose, err)
+		return nil, err
+	}
+	token.UsedAt = &now
+	return token, nil
+}
+
+// DeleteExpiredUserTokens removes tokens that expired before the cutoff, used or not.
+func (r *UserTokenRepository) DeleteExpiredUserTokens(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_tokens WHERE expires_at < $1`, before)
+	if err != nil {
+		log.Printf("Error deleting expired user tokens from DB: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,52 @@
+// internal/userservice/repository/user_token_repository_test.go
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"microservices-project/internal/userservice/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserTokenRepository_ConsumeUserToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewUserTokenRepository(db)
+
+	now := time.Now()
+	mock.ExpectQuery(`UPDATE user_tokens SET used_at = \$3`).
+		WithArgs("token-hash", model.TokenPurposePasswordReset, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "purpose", "token_hash", "email", "expires_at", "created_at"}).
+			AddRow("token-1", "user-1", model.TokenPurposePasswordReset, "token-hash", "test@example.com", now.Add(time.Hour), now))
+
+	token, err := repo.ConsumeUserToken(context.Background(), model.TokenPurposePasswordReset, "token-hash")
+
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", token.UserID)
+	assert.Equal(t, "test@example.com", token.Email)
+	assert.NotNil(t, token.UsedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserTokenRepository_ConsumeUserToken_UsedOrExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewUserTokenRepository(db)
+
+	// Used, expired and unknown tokens all fail the WHERE clause and return no row
+	mock.ExpectQuery(`UPDATE user_tokens SET used_at = \$3`).
+		WithArgs("token-hash", model.TokenPurposeEmailVerification, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err = repo.ConsumeUserToken(context.Background(), model.TokenPurposeEmailVerification, "token-hash")
+
+	assert.ErrorIs(t, err, ErrUserTokenInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,186 @@
+// internal/userservice/service/account_email.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"microservices-project/internal/userservice/repository"
+	"microservices-project/pkg/mail"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultPasswordResetTTL     = time.Hour
+	DefaultEmailVerificationTTL = 48 * time.Hour
+)
+
+var (
+	ErrInvalidUserToken     = repository.ErrUserTokenInvalid
+	ErrEmailAlreadyVerified = errors.New("email address is already verified")
+)
+
+// AccountEmailConfig says where the links in account emails point and how long they work.
+// The token is added to the URLs as ?token=, and the page behind them is expected to hand it
+// to ResetPassword or VerifyEmail.
+type AccountEmailConfig struct {
+	PasswordResetURL     string
+	EmailVerificationURL string
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+}
+
+// RequestPasswordReset mails a password reset link to email if it belongs to a user. It
+// succeeds either way, so the answer doesn't tell whether an account exists.
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Printf("Password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.newUserToken(ctx, user, model.TokenPurposePasswordReset, s.emails.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Someone asked to reset the password of your account (%s). To choose a new password, open:\n\n"+
+		"%s\n\nThe link works once and expires in %s. If you didn't ask for this, ignore this email; your password stays the same.\n",
+		user.Username, withToken(s.emails.PasswordResetURL, token), s.emails.PasswordResetTTL)
+	if err := s.mailer.Send(ctx, mail.Message{To: user.Email, Subject: "Reset your password", Body: body}); err != nil {
+		log.Printf("Error sending password reset email to user %s: %v", user.ID, err)
+		return err
+	}
+	log.Printf("Sent password reset email to user %s", user.ID)
+	return nil
+}
+
+// ResetPassword sets a new password with a token from a reset email. Like ChangePassword it
+// logs the user out everywhere. A token works once, and only while the user's email is still
+// the address it was sent to.
+func (s *UserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if newPassword == "" {
+		return ErrInvalidUserData
+	}
+	if token == "" {
+		return ErrInvalidUserToken
+	}
+	userToken, err := s.tokenRepo.ConsumeUserToken(ctx, model.TokenPurposePasswordReset, hashToken(token))
+	if err != nil {
+		return err
+	}
+	user, err := s.repo.GetUserByID(ctx, userToken.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidUserToken
+		}
+		return err
+	}
+	if user.Email != userToken.Email {
+		return ErrInvalidUserToken
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		return errors.New("failed to process password")
+	}
+	revoked, err := s.repo.UpdatePassword(ctx, user.ID, hashedPassword)
+	if err != nil {
+		return err
+	}
+	log.Printf("Reset password of user %s; revoked %d sessions", user.ID, revoked)
+	// Whoever reset it controls the mailbox, so lift any lockout earned by guessing the old one
+	s.clearAccountLockout(ctx, user.Email)
+	return nil
+}
+
+// SendVerificationEmail mails the user a link that verifies their email address. Asking again
+// voids the previous link.
+func (s *UserService) SendVerificationEmail(ctx context.Context, userID string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	return s.sendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail marks the email the token was sent to as verified, provided it is still the
+// user's email.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) (*model.User, error) {
+	if token == "" {
+		return nil, ErrInvalidUserToken
+	}
+	userToken, err := s.tokenRepo.ConsumeUserToken(ctx, model.TokenPurposeEmailVerification, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.repo.MarkEmailVerified(ctx, userToken.UserID, userToken.Email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidUserToken // Deleted, or the email changed since
+		}
+		return nil, err
+	}
+	log.Printf("Verified email of user %s", user.ID)
+	return user, nil
+}
+
+// PurgeExpiredUserTokens deletes user tokens that expired more than retention ago.
+func (s *UserService) PurgeExpiredUserTokens(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.tokenRepo.DeleteExpiredUserTokens(ctx, time.Now().Add(-retention))
+}
+
+func (s *UserService) sendVerificationEmail(ctx context.Context, user *model.User) error {
+	token, err := s.newUserToken(ctx, user, model.TokenPurposeEmailVerification, s.emails.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Please confirm that %s is your email address by opening:\n\n%s\n\nThe link expires in %s.\n",
+		user.Email, withToken(s.emails.EmailVerificationURL, token), s.emails.EmailVerificationTTL)
+	if err := s.mailer.Send(ctx, mail.Message{To: user.Email, Subject: "Verify your email address", Body: body}); err != nil {
+		return err
+	}
+	log.Printf("Sent verification email to user %s", user.ID)
+	return nil
+}
+
+// newUserToken stores a fresh token for the user's current email and returns the raw token.
+func (s *UserService) newUserToken(ctx context.Context, user *model.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate %s token: %w", purpose, err)
+	}
+	_, err = s.tokenRepo.CreateUserToken(ctx, &model.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		log.Printf("Error storing %s token for user %s: %v", purpose, user.ID, err)
+		return "", err
+	}
+	return token, nil
+}
+
+// withToken adds token to link as the token query parameter.
+func withToken(link, token string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link + "?token=" + url.QueryEscape(token)
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,127 @@
+// internal/userservice/service/addresses.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"microservices-project/internal/userservice/repository"
+	"strings"
+)
+
+// MaxAddressesPerUser caps the size of an address book.
+const MaxAddressesPerUser = 20
+
+var (
+	ErrAddressNotFound  = repository.ErrAddressNotFound
+	ErrTooManyAddresses = fmt.Errorf("%w: an address book holds at most %d addresses", repository.ErrTooManyAddresses, MaxAddressesPerUser)
+	ErrInvalidAddress   = errors.New("invalid address")
+)
+
+// addressFieldLimits are the column sizes in user_addresses.
+var addressFieldLimits = []struct {
+	name     string
+	field    func(*model.Address) *string
+	max      int
+	required bool
+}{
+	{"label", func(a *model.Address) *string { return &a.Label }, 50, false},
+	{"recipient_name", func(a *model.Address) *string { return &a.RecipientName }, 100, true},
+	{"line1", func(a *model.Address) *string { return &a.Line1 }, 200, true},
+	{"line2", func(a *model.Address) *string { return &a.Line2 }, 200, false},
+	{"city", func(a *model.Address) *string { return &a.City }, 100, true},
+	{"region", func(a *model.Address) *string { return &a.Region }, 100, false},
+	{"postal_code", func(a *model.Address) *string { return &a.PostalCode }, 20, true},
+	{"phone", func(a *model.Address) *string { return &a.Phone }, 30, false},
+}
+
+// AddAddress adds addr to the user's address book. The first address, or one added with
+// IsDefault, becomes the default.
+func (s *UserService) AddAddress(ctx context.Context, userID string, addr *model.Address) (*model.Address, error) {
+	if err := normalizeAddress(addr); err != nil {
+		return nil, err
+	}
+	addr.UserID = userID
+	added, err := s.addressRepo.AddAddress(ctx, addr, MaxAddressesPerUser)
+	if err != nil {
+		if errors.Is(err, repository.ErrTooManyAddresses) {
+			return nil, ErrTooManyAddresses
+		}
+		return nil, err
+	}
+	log.Printf("Added address %s for user %s", added.ID, userID)
+	return added, nil
+}
+
+// ListAddresses returns the user's addresses, default first.
+func (s *UserService) ListAddresses(ctx context.Context, userID string) ([]*model.Address, error) {
+	return s.addressRepo.ListAddresses(ctx, userID)
+}
+
+// GetAddress returns one of the user's addresses, or ErrAddressNotFound if addressID
+// belongs to someone else.
+func (s *UserService) GetAddress(ctx context.Context, userID, addressID string) (*model.Address, error) {
+	return s.addressRepo.GetAddress(ctx, userID, addressID)
+}
+
+// UpdateAddress replaces the fields of one of the user's addresses. Whether it is the
+// default is changed with SetDefaultAddress instead.
+func (s *UserService) UpdateAddress(ctx context.Context, userID string, addr *model.Address) (*model.Address, error) {
+	if addr.ID == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrInvalidAddress)
+	}
+	if err := normalizeAddress(addr); err != nil {
+		return nil, err
+	}
+	addr.UserID = userID
+	return s.addressRepo.UpdateAddress(ctx, addr)
+}
+
+// DeleteAddress removes one of the user's addresses. Orders already shipped to it keep
+// their copy.
+func (s *UserService) DeleteAddress(ctx context.Context, userID, addressID string) error {
+	if err := s.addressRepo.DeleteAddress(ctx, userID, addressID); err != nil {
+		return err
+	}
+	log.Printf("Deleted address %s of user %s", addressID, userID)
+	return nil
+}
+
+// SetDefaultAddress makes one of the user's addresses their default.
+func (s *UserService) SetDefaultAddress(ctx context.Context, userID, addressID string) (*model.Address, error) {
+	return s.addressRepo.SetDefaultAddress(ctx, userID, addressID)
+}
+
+// normalizeAddress trims addr's fields, upper-cases the country code and checks them
+// against the column sizes.
+func normalizeAddress(addr *model.Address) error {
+	for _, f := range addressFieldLimits {
+		value := f.field(addr)
+		*value = strings.TrimSpace(*value)
+		if f.required && *value == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidAddress, f.name)
+		}
+		if len(*value) > f.max {
+			return fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidAddress, f.name, f.max)
+		}
+	}
+	addr.CountryCode = strings.ToUpper(strings.TrimSpace(addr.CountryCode))
+	if !isCountryCode(addr.CountryCode) {
+		return fmt.Errorf("%w: country_code must be a two-letter ISO 3166-1 code", ErrInvalidAddress)
+	}
+	return nil
+}
+
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
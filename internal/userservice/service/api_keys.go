@@ -0,0 +1,136 @@
+// internal/userservice/service/api_keys.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"microservices-project/internal/userservice/repository"
+	"microservices-project/pkg/auth"
+	"strings"
+	"time"
+)
+
+const maxAPIKeyNameLength = 100
+
+var (
+	ErrAPIKeyNotFound    = repository.ErrAPIKeyNotFound
+	ErrInvalidAPIKeyName = errors.New("API key name is required and must be at most 100 characters")
+	ErrInvalidScope      = errors.New("invalid scope")
+	ErrInvalidExpiry     = errors.New("API key expiry must be in the future")
+	// ErrInvalidAPIKey covers unknown, revoked and expired keys alike.
+	ErrInvalidAPIKey = fmt.Errorf("%w: unknown, revoked or expired API key", auth.ErrInvalidToken)
+)
+
+// CreateAPIKey creates an API key with scopes for a batch job or integration, and returns the
+// key along with what is stored about it. The key can't be recovered later. A nil expiresAt
+// means the key works until it is revoked.
+func (s *UserService) CreateAPIKey(ctx context.Context, createdBy, name string, scopes []string, expiresAt *time.Time) (string, *model.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return "", nil, ErrInvalidAPIKeyName
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrInvalidExpiry
+	}
+
+	key, prefix, err := newAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		return "", nil, errors.New("failed to generate API key")
+	}
+	apiKey, err := s.apiKeyRepo.CreateAPIKey(ctx, &model.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashToken(key),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	log.Printf("Created API key %s (%s) with scopes %v", apiKey.ID, apiKey.Name, apiKey.Scopes)
+	return key, apiKey, nil
+}
+
+// ListAPIKeys returns the API keys, newest first, without revoked ones unless includeRevoked.
+func (s *UserService) ListAPIKeys(ctx context.Context, includeRevoked bool) ([]*model.APIKey, error) {
+	return s.apiKeyRepo.ListAPIKeys(ctx, includeRevoked)
+}
+
+// RevokeAPIKey stops the key from working. Services that cache keys may still accept it for
+// up to auth.DefaultAPIKeyCacheTTL.
+func (s *UserService) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := s.apiKeyRepo.RevokeAPIKey(ctx, id); err != nil {
+		return err
+	}
+	log.Printf("Revoked API key %s", id)
+	return nil
+}
+
+// AuthenticateAPIKey looks up an API key and returns the principal it stands for, or
+// ErrInvalidAPIKey. It is an auth.APIKeyValidator.
+func (s *UserService) AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error) {
+	if !auth.IsAPIKey(key) {
+		return nil, ErrInvalidAPIKey
+	}
+	apiKey, err := s.apiKeyRepo.GetAPIKeyByHash(ctx, hashToken(key))
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if !apiKey.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+	// Only for display, so a failure doesn't fail the request
+	_ = s.apiKeyRepo.TouchAPIKey(ctx, apiKey.ID, now)
+
+	return &auth.Principal{APIKeyID: apiKey.ID, Service: apiKey.Name, Scopes: apiKey.Scopes, Token: key}, nil
+}
+
+// newAPIKey returns a new key, "mk_" + 8 hex characters + "_" + 256 random bits, and the
+// part before the secret, which is stored for display.
+func newAPIKey() (key, prefix string, err error) {
+	raw := make([]byte, 4)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	prefix = auth.APIKeyPrefix + hex.EncodeToString(raw)
+	return prefix + "_" + secret, prefix, nil
+}
+
+// normalizeScopes checks scopes against auth.KnownScopes and drops duplicates.
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	seen := make(map[string]bool, len(scopes))
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !auth.IsValidScope(scope) {
+			return nil, fmt.Errorf("%w: %q (known scopes: %s)", ErrInvalidScope, scope, strings.Join(auth.KnownScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
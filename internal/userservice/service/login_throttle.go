@@ -0,0 +1,170 @@
+// internal/userservice/service/login_throttle.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"strings"
+	"time"
+)
+
+// Defaults for LoginThrottleConfig.
+const (
+	DefaultLoginAccountFailures = 5
+	DefaultLoginIPFailures      = 50 // Many users can share an address behind NAT
+	DefaultLoginBaseLockout     = 30 * time.Second
+	DefaultLoginMaxLockout      = 1 * time.Hour
+	DefaultLoginFailureWindow   = 24 * time.Hour
+)
+
+// ErrTooManyLoginAttempts is returned (wrapped in a *LoginLockedError) while an account or
+// client address is locked out.
+var ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+
+// LoginLockedError says how long until logins are accepted again. It is the same for accounts
+// that don't exist, so it gives nothing away about which emails are registered.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%v; try again in %s", ErrTooManyLoginAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrTooManyLoginAttempts
+}
+
+// LoginThrottleConfig sets how failed logins are punished. Once an account (or client address)
+// reaches its failure limit, every further failure locks it for BaseLockout, doubled each
+// time up to MaxLockout. Failures are forgotten after a quiet FailureWindow, and a successful
+// login clears the account's count.
+type LoginThrottleConfig struct {
+	AccountFailures int
+	IPFailures      int
+	BaseLockout     time.Duration
+	MaxLockout      time.Duration
+	FailureWindow   time.Duration
+}
+
+// withDefaults fills in unset fields.
+func (c LoginThrottleConfig) withDefaults() LoginThrottleConfig {
+	if c.AccountFailures <= 0 {
+		c.AccountFailures = DefaultLoginAccountFailures
+	}
+	if c.IPFailures <= 0 {
+		c.IPFailures = DefaultLoginIPFailures
+	}
+	if c.BaseLockout <= 0 {
+		c.BaseLockout = DefaultLoginBaseLockout
+	}
+	if c.MaxLockout <= 0 {
+		c.MaxLockout = DefaultLoginMaxLockout
+	}
+	if c.MaxLockout < c.BaseLockout {
+		c.MaxLockout = c.BaseLockout
+	}
+	if c.FailureWindow <= 0 {
+		c.FailureWindow = DefaultLoginFailureWindow
+	}
+	return c
+}
+
+// lockoutFor returns how long to lock after the given number of failures; zero below limit.
+func (c LoginThrottleConfig) lockoutFor(failures, limit int) time.Duration {
+	if failures < limit {
+		return 0
+	}
+	lockout := c.BaseLockout
+	for i := limit; i < failures && lockout < c.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > c.MaxLockout {
+		lockout = c.MaxLockout
+	}
+	return lockout
+}
+
+// accountLoginKey is the counter for an email, registered or not.
+func accountLoginKey(email string) model.LoginAttemptKey {
+	return model.LoginAttemptKey{Scope: model.LoginScopeAccount, Key: strings.ToLower(strings.TrimSpace(email))}
+}
+
+// loginKeys returns the counters a login attempt is checked and counted against.
+func loginKeys(email, clientIP string) []model.LoginAttemptKey {
+	keys := []model.LoginAttemptKey{accountLoginKey(email)}
+	if clientIP != "" {
+		keys = append(keys, model.LoginAttemptKey{Scope: model.LoginScopeIP, Key: clientIP})
+	}
+	return keys
+}
+
+// checkLoginLockout fails with a *LoginLockedError if any of keys is locked out.
+func (s *UserService) checkLoginLockout(ctx context.Context, keys []model.LoginAttemptKey) error {
+	now := time.Now()
+	lockedUntil, err := s.loginAttempts.LockedUntil(ctx, now, keys...)
+	if err != nil {
+		return err
+	}
+	if lockedUntil.After(now) {
+		loginFailures.WithLabelValues(loginFailureLockedOut).Inc()
+		return &LoginLockedError{RetryAfter: lockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login against keys, and in the metrics by reason, and
+// locks keys over their limit. It only logs errors: the caller is refusing the login anyway.
+func (s *UserService) recordLoginFailure(ctx context.Context, keys []model.LoginAttemptKey, reason string) {
+	loginFailures.WithLabelValues(reason).Inc()
+	now := time.Now()
+	for _, key := range keys {
+		failures, err := s.loginAttempts.RecordLoginFailure(ctx, key, now, now.Add(-s.loginThrottle.FailureWindow))
+		if err != nil {
+			continue // Logged by the repository
+		}
+		limit := s.loginThrottle.AccountFailures
+		if key.Scope == model.LoginScopeIP {
+			limit = s.loginThrottle.IPFailures
+		}
+		if lockout := s.loginThrottle.lockoutFor(failures, limit); lockout > 0 {
+			log.Printf("Locking logins for %s %s for %s after %d failed attempt(s)", key.Scope, key.Key, lockout, failures)
+			s.loginAttempts.LockLogin(ctx, key, now.Add(lockout))
+		}
+	}
+}
+
+// clearAccountLockout forgets the failed logins of email, after it has been proven to belong
+// to the person logging in.
+func (s *UserService) clearAccountLockout(ctx context.Context, email string) {
+	if err := s.loginAttempts.ResetLoginAttempts(ctx, accountLoginKey(email)); err != nil {
+		log.Printf("Error clearing failed logins for %s: %v", email, err)
+	}
+}
+
+// UnlockUser clears the failed logins and lockout of the user's account and, if clientIP is
+// set, of that address.
+func (s *UserService) UnlockUser(ctx context.Context, userID, clientIP string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loginAttempts.ResetLoginAttempts(ctx, accountLoginKey(user.Email)); err != nil {
+		return err
+	}
+	if clientIP != "" {
+		if err := s.loginAttempts.ResetLoginAttempts(ctx, model.LoginAttemptKey{Scope: model.LoginScopeIP, Key: clientIP}); err != nil {
+			return err
+		}
+	}
+	log.Printf("Unlocked logins for user %s", userID)
+	return nil
+}
+
+// PurgeStaleLoginAttempts deletes failure counters that are past their window and not locked.
+func (s *UserService) PurgeStaleLoginAttempts(ctx context.Context) (int64, error) {
+	return s.loginAttempts.DeleteStaleLoginAttempts(ctx, time.Now().Add(-s.loginThrottle.FailureWindow))
+}
@@ -0,0 +1,20 @@
+// internal/userservice/service/metrics.go
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons a login fails, for the reason label of login failures.
+const (
+	loginFailureUnknownEmail   = "unknown_email"
+	loginFailureWrongPassword  = "wrong_password"
+	loginFailureInvalidMFACode = "invalid_mfa_code"
+	loginFailureLockedOut      = "locked_out" // Refused without checking the password
+)
+
+var loginFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "user_login_failures_total",
+	Help: "Failed logins (password or 2FA step), by reason.",
+}, []string{"reason"})
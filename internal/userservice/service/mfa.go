@@ -0,0 +1,259 @@
+// internal/userservice/service/mfa.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"microservices-project/internal/userservice/repository"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// DefaultMFAChallengeTTL is how long the challenge from a password login can be traded in.
+	DefaultMFAChallengeTTL = 5 * time.Minute
+	// DefaultMFAIssuer names the account in authenticator apps.
+	DefaultMFAIssuer = "microservices-project"
+
+	// TOTP parameters (RFC 6238 defaults, which every authenticator app supports). Codes from
+	// one step either side of now are accepted to allow for clock drift.
+	mfaPeriod = 30
+	mfaDigits = otp.DigitsSix
+
+	recoveryCodeCount = 10
+	recoveryCodeChars = "abcdefghjkmnpqrstuvwxyz23456789" // No 0/o, 1/l/i
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolled      = errors.New("start two-factor enrolment first")
+	ErrMFAStateChanged     = repository.ErrMFAStateChanged
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor challenge; log in again")
+)
+
+// MFAConfig configures TOTP two-factor authentication.
+type MFAConfig struct {
+	Issuer       string        // Shown in authenticator apps next to the user's email
+	ChallengeTTL time.Duration // How long a password login's MFA challenge stays valid
+}
+
+// MFAEnrollment is what a user needs to add their account to an authenticator app.
+type MFAEnrollment struct {
+	Secret string // Base32, for typing in by hand
+	URI    string // otpauth:// URI, usually shown as a QR code
+}
+
+// EnrollMFA starts two-factor enrolment with a new secret. 2FA stays off until ConfirmMFA
+// proves the user's app generates matching codes; enrolling again replaces the secret.
+func (s *UserService) EnrollMFA(ctx context.Context, userID string) (*MFAEnrollment, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.mfa.Issuer,
+		AccountName: user.Email,
+		Period:      mfaPeriod,
+		Digits:      mfaDigits,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate 2FA secret: %w", err)
+	}
+	if err := s.mfaRepo.SetMFASecret(ctx, userID, key.Secret()); err != nil {
+		if errors.Is(err, ErrMFAStateChanged) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+	return &MFAEnrollment{Secret: key.Secret(), URI: key.URL()}, nil
+}
+
+// ConfirmMFA turns 2FA on once code matches the enrolled secret, and returns the user's
+// recovery codes. They are only ever shown here; each one works once in place of a code.
+func (s *UserService) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	state, err := s.mfaRepo.GetMFAState(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Enabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if state.Secret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	step, ok := matchTOTP(state.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.EnableMFA(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	log.Printf("Enabled 2FA for user %s", userID)
+	return codes, nil
+}
+
+// DisableMFA turns 2FA off. code (a TOTP or recovery code) is checked unless it is empty,
+// which callers must only allow for an admin acting on someone who lost their device.
+func (s *UserService) DisableMFA(ctx context.Context, userID, code string) error {
+	if code != "" {
+		if err := s.checkMFACode(ctx, userID, code); err != nil {
+			return err
+		}
+	}
+	if err := s.mfaRepo.DisableMFA(ctx, userID); err != nil {
+		return err
+	}
+	log.Printf("Disabled 2FA for user %s", userID)
+	return nil
+}
+
+// VerifyMFA completes a login: it trades the challenge from LoginUser and a TOTP or recovery
+// code for access and refresh tokens. The challenge is used up even if the code is wrong, and
+// wrong codes count towards the login lockout, so codes can't be guessed for free.
+func (s *UserService) VerifyMFA(ctx context.Context, challengeToken, code, clientIP string) (*model.User, *model.AuthTokens, error) {
+	if challengeToken == "" {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+	challenge, err := s.tokenRepo.ConsumeUserToken(ctx, model.TokenPurposeMFAChallenge, hashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			return nil, nil, ErrInvalidMFAChallenge
+		}
+		return nil, nil, err
+	}
+	user, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, nil, ErrInvalidMFAChallenge
+		}
+		return nil, nil, err
+	}
+	if user.Email != challenge.Email {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	keys := loginKeys(user.Email, clientIP)
+	if err := s.checkLoginLockout(ctx, keys); err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkMFACode(ctx, user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordLoginFailure(ctx, keys, loginFailureInvalidMFACode)
+		}
+		return nil, nil, err
+	}
+	s.clearAccountLockout(ctx, user.Email)
+
+	tokens, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("User %s logged in successfully with 2FA", user.Email)
+	return user, tokens, nil
+}
+
+// startMFAChallenge hands out the challenge a 2FA user gets for a correct password.
+func (s *UserService) startMFAChallenge(ctx context.Context, user *model.User) (*model.AuthTokens, error) {
+	token, err := s.newUserToken(ctx, user, model.TokenPurposeMFAChallenge, s.mfa.ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuthTokens{
+		MFAChallengeToken:     token,
+		MFAChallengeExpiresAt: time.Now().Add(s.mfa.ChallengeTTL),
+	}, nil
+}
+
+// checkMFACode accepts a current TOTP code or one of the user's recovery codes, and uses it up.
+func (s *UserService) checkMFACode(ctx context.Context, userID, code string) error {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if code == "" {
+		return ErrInvalidMFACode
+	}
+	state, err := s.mfaRepo.GetMFAState(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !state.Enabled() {
+		return ErrMFANotEnabled
+	}
+
+	if step, ok := matchTOTP(state.Secret, code, time.Now()); ok {
+		if err := s.mfaRepo.UseMFAStep(ctx, userID, step); err != nil {
+			if errors.Is(err, repository.ErrMFACodeReused) {
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+		return nil
+	}
+
+	if err := s.mfaRepo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+		if errors.Is(err, repository.ErrRecoveryCodeInvalid) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+	log.Printf("User %s used a 2FA recovery code", userID)
+	return nil
+}
+
+// matchTOTP returns the time step that code is valid for, trying now and one step either side.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	if len(code) != mfaDigits.Length() {
+		return 0, false
+	}
+	opts := totp.ValidateOpts{Period: mfaPeriod, Digits: mfaDigits, Algorithm: otp.AlgorithmSHA1}
+	current := now.Unix() / mfaPeriod
+	for _, step := range []int64{current, current - 1, current + 1} {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*mfaPeriod, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// newRecoveryCodes generates recovery codes ("xxxxx-xxxxx") and the hashes to store.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+		}
+		for j, b := range raw {
+			raw[j] = recoveryCodeChars[int(b)%len(recoveryCodeChars)]
+		}
+		code := string(raw[:5]) + "-" + string(raw[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode makes "ABCDE-FGHJK", "abcde fghjk" and "abcdefghjk" the same code.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
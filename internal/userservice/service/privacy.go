@@ -0,0 +1,191 @@
+// internal/userservice/service/privacy.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"microservices-project/protos/orderpb"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrDataRequestFailed is returned when a data request couldn't be finished because the
+// OrderService failed. The request is recorded as FAILED and can be asked for again.
+var ErrDataRequestFailed = errors.New("data request failed")
+
+// dataExport is the layout of a data export archive.
+type dataExport struct {
+	RequestID   string           `json:"request_id"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	User        *model.User      `json:"user"`
+	Addresses   []*model.Address `json:"addresses"`
+	Orders      []exportOrder    `json:"orders"`
+}
+
+type exportOrder struct {
+	ID              string                 `json:"id"`
+	Status          string                 `json:"status"`
+	TotalAmount     float64                `json:"total_amount"`
+	Items           []exportOrderItem      `json:"items"`
+	ShippingAddress *exportShippingAddress `json:"shipping_address,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+type exportShippingAddress struct {
+	RecipientName string `json:"recipient_name"`
+	Line1         string `json:"line1"`
+	Line2         string `json:"line2,omitempty"`
+	City          string `json:"city"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postal_code"`
+	CountryCode   string `json:"country_code"`
+	Phone         string `json:"phone,omitempty"`
+}
+
+type exportOrderItem struct {
+	ProductID       string  `json:"product_id"`
+	Quantity        int32   `json:"quantity"`
+	PriceAtPurchase float64 `json:"price_at_purchase"`
+}
+
+// RequestDataExport gathers the user's profile, address book and orders into a JSON
+// archive. requestedBy (the caller's user ID or service name) is kept in the audit record.
+func (s *UserService) RequestDataExport(ctx context.Context, userID, requestedBy string) ([]byte, *model.DataRequest, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := s.dataRequestRepo.CreateDataRequest(ctx, &model.DataRequest{
+		UserID: userID, Kind: model.DataRequestExport, RequestedBy: requestedBy,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addresses, err := s.addressRepo.ListAddresses(ctx, userID)
+	if err != nil {
+		return nil, nil, s.failDataRequest(ctx, req, err)
+	}
+	resp, err := s.orders.ExportUserOrders(ctx, &orderpb.ExportUserOrdersRequest{UserId: userID})
+	if err != nil {
+		return nil, nil, s.failDataRequest(ctx, req, fmt.Errorf("%w: exporting orders: %v", ErrDataRequestFailed, err))
+	}
+
+	export := dataExport{
+		RequestID:   req.ID,
+		GeneratedAt: time.Now().UTC(),
+		User:        user,
+		Addresses:   addresses,
+		Orders:      make([]exportOrder, 0, len(resp.GetOrders())),
+	}
+	if export.Addresses == nil {
+		export.Addresses = []*model.Address{}
+	}
+	for _, o := range resp.GetOrders() {
+		order := exportOrder{
+			ID:          o.GetId(),
+			Status:      o.GetStatus(),
+			TotalAmount: o.GetTotalAmount(),
+			Items:       make([]exportOrderItem, 0, len(o.GetItems())),
+			CreatedAt:   o.GetCreatedAt().AsTime(),
+			UpdatedAt:   o.GetUpdatedAt().AsTime(),
+		}
+		if addr := o.GetShippingAddress(); addr != nil {
+			order.ShippingAddress = &exportShippingAddress{
+				RecipientName: addr.GetRecipientName(),
+				Line1:         addr.GetLine1(),
+				Line2:         addr.GetLine2(),
+				City:          addr.GetCity(),
+				Region:        addr.GetRegion(),
+				PostalCode:    addr.GetPostalCode(),
+				CountryCode:   addr.GetCountryCode(),
+				Phone:         addr.GetPhone(),
+			}
+		}
+		for _, item := range o.GetItems() {
+			order.Items = append(order.Items, exportOrderItem{
+				ProductID:       item.GetProductId(),
+				Quantity:        item.GetQuantity(),
+				PriceAtPurchase: item.GetPriceAtPurchase(),
+			})
+		}
+		export.Orders = append(export.Orders, order)
+	}
+	archive, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, nil, s.failDataRequest(ctx, req, err)
+	}
+
+	req.Status = model.DataRequestCompleted
+	req.OrdersAffected = len(export.Orders)
+	if err := s.dataRequestRepo.FinishDataRequest(ctx, req); err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Exported data of user %s (request %s)", userID, req.ID)
+	return archive, req, nil
+}
+
+// EraseUser anonymises the user and moves their orders to a pseudonym in the OrderService,
+// so the accounts still add up but no longer point at a person. Erasing a user again
+// reuses the pseudonym, which makes a FAILED erasure safe to retry. Deleted users can still
+// be erased, since their orders may not have been; IDs that were never a user fail with
+// ErrUserNotFound. The last admin can't be erased.
+func (s *UserService) EraseUser(ctx context.Context, userID, requestedBy string) (*model.DataRequest, error) {
+	deleted, err := s.repo.IsUserDeleted(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pseudonym, err := s.dataRequestRepo.GetErasurePseudonym(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if pseudonym == "" {
+		pseudonym = uuid.New().String()
+	}
+	req, err := s.dataRequestRepo.CreateDataRequest(ctx, &model.DataRequest{
+		UserID: userID, Kind: model.DataRequestErasure, RequestedBy: requestedBy, Pseudonym: pseudonym,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !deleted {
+		// ErrUserNotFound here means the user was deleted since we looked
+		if err := s.repo.DeleteUser(ctx, userID); err != nil && !errors.Is(err, ErrUserNotFound) {
+			return nil, s.failDataRequest(ctx, req, err)
+		}
+	}
+	resp, err := s.orders.EraseUserOrders(ctx, &orderpb.EraseUserOrdersRequest{UserId: userID, Pseudonym: pseudonym})
+	if err != nil {
+		return nil, s.failDataRequest(ctx, req, fmt.Errorf("%w: pseudonymising orders: %v", ErrDataRequestFailed, err))
+	}
+
+	req.Status = model.DataRequestCompleted
+	req.OrdersAffected = int(resp.GetOrdersPseudonymised())
+	if err := s.dataRequestRepo.FinishDataRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	log.Printf("Erased user %s (request %s); pseudonymised %d order(s)", userID, req.ID, req.OrdersAffected)
+	return req, nil
+}
+
+// ListDataRequests returns the audit trail of the user's data requests, newest first.
+func (s *UserService) ListDataRequests(ctx context.Context, userID string) ([]*model.DataRequest, error) {
+	return s.dataRequestRepo.ListDataRequests(ctx, userID)
+}
+
+// failDataRequest records req as FAILED with cause, and returns cause.
+func (s *UserService) failDataRequest(ctx context.Context, req *model.DataRequest, cause error) error {
+	req.Status = model.DataRequestFailed
+	req.LastError = cause.Error()
+	if err := s.dataRequestRepo.FinishDataRequest(ctx, req); err != nil {
+		log.Printf("Error recording failure of data request %s: %v", req.ID, err)
+	}
+	return cause
+}
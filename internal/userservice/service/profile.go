@@ -0,0 +1,109 @@
+// internal/userservice/service/profile.go
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"microservices-project/pkg/pagination"
+	"strconv"
+)
+
+var (
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrInvalidUserData   = errors.New("invalid user data")
+	ErrInvalidPageToken  = pagination.ErrInvalidPageToken
+)
+
+// UpdateUser changes the user's username and/or email; empty values are left unchanged.
+// Taking a username or email another user has fails with ErrUserAlreadyExists. Access tokens
+// already issued keep the old values until they expire.
+func (s *UserService) UpdateUser(ctx context.Context, userID, username, email string) (*model.User, error) {
+	if username == "" && email == "" {
+		return nil, ErrInvalidUserData
+	}
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" {
+		user.Username = username
+	}
+	if email != "" {
+		user.Email = email
+	}
+
+	updated, err := s.repo.UpdateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Updated profile of user %s", userID)
+	return updated, nil
+}
+
+// ChangePassword replaces the user's password after checking the current one, and logs the
+// user out of every session so anyone holding an old refresh token has to log in again.
+func (s *UserService) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) (int64, error) {
+	if newPassword == "" {
+		return 0, ErrInvalidUserData
+	}
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if !CheckPasswordHash(currentPassword, user.PasswordHash) {
+		return 0, ErrIncorrectPassword
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		return 0, errors.New("failed to process password")
+	}
+	revoked, err := s.repo.UpdatePassword(ctx, userID, hashedPassword)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Changed password of user %s; revoked %d sessions", userID, revoked)
+	return revoked, nil
+}
+
+// DeleteUser soft-deletes the user: the account is anonymised and logged out everywhere, but
+// the row stays so their orders still resolve. The last admin can't be deleted.
+func (s *UserService) DeleteUser(ctx context.Context, userID string) error {
+	if err := s.repo.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	log.Printf("Deleted user %s", userID)
+	return nil
+}
+
+// ListUsers returns a page of users matching filter, newest first.
+func (s *UserService) ListUsers(ctx context.Context, filter model.UserFilter, pageToken string, pageSize int) ([]*model.User, string, error) {
+	if pageSize <= 0 || pageSize > 100 { // Max page size
+		pageSize = 10
+	}
+	// Tokens are bound to the filter, so a page token can't be used with a different search
+	scope := "users:" + filter.EmailPrefix + "\x00" + filter.UsernamePrefix + "\x00" + strconv.FormatBool(filter.IncludeDeleted)
+	var after *pagination.Cursor
+	if pageToken != "" {
+		cursor, err := s.pageTokens.Decode(scope, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = cursor
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	users, err := s.repo.ListUsersAfter(ctx, filter, after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(users) <= pageSize {
+		return users, "", nil
+	}
+	users = users[:pageSize]
+	last := users[len(users)-1]
+	return users, s.pageTokens.Encode(scope, pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}), nil
+}
@@ -0,0 +1,81 @@
+// internal/userservice/service/roles.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"microservices-project/internal/userservice/repository"
+	"microservices-project/pkg/auth"
+)
+
+var (
+	ErrInvalidRole = errors.New("invalid role")
+	ErrLastAdmin   = repository.ErrLastAdmin
+)
+
+// AssignRole grants role to the user. It shows up in their access tokens from the next
+// login or refresh on.
+func (s *UserService) AssignRole(ctx context.Context, userID, role string) (*model.User, error) {
+	if !auth.IsValidUserRole(role) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	user, err := s.repo.AddUserRole(ctx, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Assigned role %s to user %s", role, userID)
+	return user, nil
+}
+
+// RevokeRole takes role away from the user. Access tokens already issued keep the role until
+// they expire.
+func (s *UserService) RevokeRole(ctx context.Context, userID, role string) (*model.User, error) {
+	if !auth.IsValidUserRole(role) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	user, err := s.repo.RemoveUserRole(ctx, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Revoked role %s from user %s", role, userID)
+	return user, nil
+}
+
+// BootstrapAdmin makes sure there is at least one admin, since only admins can appoint
+// others. If there is none yet, the user with email is made admin, and created first
+// (with username and password) if it doesn't exist. Once an admin exists it does nothing,
+// so it is safe to leave configured. Returns the new admin, or nil if nothing was done.
+func (s *UserService) BootstrapAdmin(ctx context.Context, username, email, password string) (*model.User, error) {
+	admins, err := s.repo.CountUsersWithRole(ctx, model.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if admins > 0 {
+		return nil, nil
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err == nil {
+		return s.AssignRole(ctx, user.ID, model.RoleAdmin)
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("user %s does not exist; a username and password are needed to create it", email)
+	}
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return nil, errors.New("failed to process password")
+	}
+	return s.repo.CreateUser(ctx, &model.User{
+		Username:     username,
+		Email:        email,
+		PasswordHash: hashedPassword,
+		Roles:        []string{model.RoleCustomer, model.RoleAdmin},
+	})
+}
@@ -0,0 +1,162 @@
+// internal/userservice/service/session.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/internal/userservice/model"
+	"microservices-project/internal/userservice/repository"
+	"microservices-project/pkg/auth"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultRefreshTokenTTL is how long a refresh token stays usable. Each refresh issues a new
+// token with a fresh TTL, so an active client stays logged in indefinitely.
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = repository.ErrSessionReused
+)
+
+// startSession opens a new session family for a fresh login.
+func (s *UserService) startSession(ctx context.Context, user *model.User) (*model.AuthTokens, error) {
+	refreshToken, session, err := s.newSession()
+	if err != nil {
+		return nil, err
+	}
+	session.UserID = user.ID
+	if _, err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		log.Printf("Error creating session for user %s: %v", user.ID, err)
+		return nil, err
+	}
+	return s.issueTokens(user, refreshToken, session)
+}
+
+// RefreshToken trades a refresh token for a new access token and a new refresh token.
+// The old refresh token is used up; presenting it again revokes the whole session.
+func (s *UserService) RefreshToken(ctx context.Context, refreshToken string) (*model.AuthTokens, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	nextToken, next, err := s.newSession()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.sessionRepo.RotateSession(ctx, hashToken(refreshToken), next); err != nil {
+		return nil, sessionError(err)
+	}
+
+	user, err := s.repo.GetUserByID(ctx, next.UserID)
+	if err != nil {
+		log.Printf("Error loading user %s for token refresh: %v", next.UserID, err)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return s.issueTokens(user, nextToken, next)
+}
+
+// Logout ends the session the refresh token belongs to. Access tokens already handed out
+// stay valid until they expire, which is why they are short-lived.
+func (s *UserService) Logout(ctx context.Context, refreshToken string) error {
+	if refreshToken == "" {
+		return ErrInvalidRefreshToken
+	}
+	if err := s.sessionRepo.RevokeFamily(ctx, hashToken(refreshToken)); err != nil {
+		return sessionError(err)
+	}
+	return nil
+}
+
+func (s *UserService) LogoutAllSessions(ctx context.Context, refreshToken string) (int64, error) {
+	if refreshToken == "" {
+		return 0, ErrInvalidRefreshToken
+	}
+	session, err := s.sessionRepo.GetActiveSession(ctx, hashToken(refreshToken))
+	if err != nil {
+		return 0, sessionError(err)
+	}
+	revoked, err := s.sessionRepo.RevokeAllUserSessions(ctx, session.UserID)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Revoked %d session(s) of user %s", revoked, session.UserID)
+	return revoked, nil
+}
+
+// PurgeExpiredSessions deletes sessions that expired more than retention ago.
+func (s *UserService) PurgeExpiredSessions(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.sessionRepo.DeleteExpiredSessions(ctx, time.Now().Add(-retention))
+}
+
+// newSession generates a refresh token and the session row that stores its hash.
+func (s *UserService) newSession() (string, *model.Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return token, &model.Session{
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	}, nil
+}
+
+func (s *UserService) issueTokens(user *model.User, refreshToken string, session *model.Session) (*model.AuthTokens, error) {
+	accessToken, expiresAt, err := s.issuer.Issue(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: user.ID},
+		Email:            user.Email,
+		Username:         user.Username,
+		Roles:            user.Roles,
+	})
+	if err != nil {
+		log.Printf("Error issuing token for user %s: %v", user.ID, err)
+		return nil, err
+	}
+	return &model.AuthTokens{
+		AccessToken:           accessToken,
+		ExpiresAt:             expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// randomToken returns 256 random bits, URL-safe encoded.
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken is how refresh and user tokens are looked up; the tokens are random, so a plain
+// SHA-256 is enough (no salt or slow hash needed).
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionError collapses the reasons a refresh token can't be used into ErrInvalidRefreshToken,
+// except reuse, which callers may want to report separately.
+func sessionError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrSessionReused):
+		return ErrRefreshTokenReused
+	case errors.Is(err, repository.ErrSessionNotFound),
+		errors.Is(err, repository.ErrSessionExpired),
+		errors.Is(err, repository.ErrSessionRevoked):
+		return ErrInvalidRefreshToken
+	}
+	return err
+}
@@ -7,15 +7,21 @@ import (
 	"log"
 	"microservices-project/internal/userservice/model"
 	"microservices-project/internal/userservice/repository"
+	"microservices-project/pkg/auth"
+	"microservices-project/pkg/mail"
+	"microservices-project/pkg/pagination"
+	"microservices-project/protos/orderpb"
+	"time"
 
 	"golang.org/x/crypto/bcrypt" // For password hashing
 )
 
 // Custom errors for the service layer
 var (
-	ErrUserAlreadyExists = errors.New("user with this email or username already exists")
+	ErrUserAlreadyExists = repository.ErrUserAlreadyExists
 	ErrUserNotFound      = repository.ErrUserNotFound // Propagate repository error
 	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidToken       = auth.ErrInvalidToken
 )
 
 
@@ -23,17 +29,132 @@ var (
 type UserServiceInterface interface {
 	CreateUser(ctx context.Context, username, email, password string) (*model.User, error)
 	GetUserByID(ctx context.Context, id string) (*model.User, error)
-	LoginUser(ctx context.Context, email, password string) (*model.User, string, error) // Returns user and token
+	// LoginUser returns the user and tokens. clientIP (may be empty) is used for lockouts.
+	// For users with 2FA, it returns only an MFA challenge (no user) to pass to VerifyMFA.
+	LoginUser(ctx context.Context, email, password, clientIP string) (*model.User, *model.AuthTokens, error)
+	VerifyMFA(ctx context.Context, challengeToken, code, clientIP string) (*model.User, *model.AuthTokens, error)
+	ValidateToken(ctx context.Context, token string) (*auth.Claims, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*model.AuthTokens, error)
+	Logout(ctx context.Context, refreshToken string) error
+	// LogoutAllSessions revokes every session of the user that refreshToken belongs to.
+	LogoutAllSessions(ctx context.Context, refreshToken string) (revoked int64, err error)
+	AssignRole(ctx context.Context, userID, role string) (*model.User, error)
+	RevokeRole(ctx context.Context, userID, role string) (*model.User, error)
+	// UpdateUser changes the username and/or email; empty values are left unchanged.
+	UpdateUser(ctx context.Context, userID, username, email string) (*model.User, error)
+	ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) (revokedSessions int64, err error)
+	DeleteUser(ctx context.Context, userID string) error
+	// ListUsers pages with opaque tokens; nextPageToken is empty on the last page.
+	ListUsers(ctx context.Context, filter model.UserFilter, pageToken string, pageSize int) (users []*model.User, nextPageToken string, err error)
+	// RequestPasswordReset mails a reset link if the email belongs to a user, and succeeds
+	// either way so it can't be used to find out who has an account.
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	SendVerificationEmail(ctx context.Context, userID string) error
+	VerifyEmail(ctx context.Context, token string) (*model.User, error)
+	UnlockUser(ctx context.Context, userID, clientIP string) error
+	EnrollMFA(ctx context.Context, userID string) (*MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, userID, code string) (recoveryCodes []string, err error)
+	DisableMFA(ctx context.Context, userID, code string) error
+	// CreateAPIKey returns the new key itself, which is not stored, and its record.
+	CreateAPIKey(ctx context.Context, createdBy, name string, scopes []string, expiresAt *time.Time) (key string, apiKey *model.APIKey, err error)
+	ListAPIKeys(ctx context.Context, includeRevoked bool) ([]*model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error)
+	AddAddress(ctx context.Context, userID string, addr *model.Address) (*model.Address, error)
+	ListAddresses(ctx context.Context, userID string) ([]*model.Address, error)
+	GetAddress(ctx context.Context, userID, addressID string) (*model.Address, error)
+	UpdateAddress(ctx context.Context, userID string, addr *model.Address) (*model.Address, error)
+	DeleteAddress(ctx context.Context, userID, addressID string) error
+	SetDefaultAddress(ctx context.Context, userID, addressID string) (*model.Address, error)
+	// RequestDataExport returns the user's data, orders included, as a JSON archive.
+	RequestDataExport(ctx context.Context, userID, requestedBy string) (archive []byte, req *model.DataRequest, err error)
+	EraseUser(ctx context.Context, userID, requestedBy string) (*model.DataRequest, error)
+	ListDataRequests(ctx context.Context, userID string) ([]*model.DataRequest, error)
 }
 
 // UserService implements UserServiceInterface.
 type UserService struct {
-	repo repository.UserRepositoryInterface // Dependency on the repository
+	repo            repository.UserRepositoryInterface      // Dependency on the repository
+	sessionRepo     repository.SessionRepositoryInterface   // Refresh token sessions
+	tokenRepo       repository.UserTokenRepositoryInterface // Password reset and email verification tokens
+	issuer          *auth.Issuer                            // Signs access tokens on login
+	verifier        *auth.Verifier                          // Checks them for ValidateToken
+	refreshTokenTTL time.Duration
+	pageTokens      *pagination.TokenCodec // Signs ListUsers page tokens
+	mailer          mail.Mailer
+	emails          AccountEmailConfig
+	loginAttempts   repository.LoginAttemptRepositoryInterface // Failed login counters and lockouts
+	loginThrottle   LoginThrottleConfig
+	mfaRepo         repository.MFARepositoryInterface // TOTP secrets and recovery codes
+	mfa             MFAConfig
+	apiKeyRepo      repository.APIKeyRepositoryInterface // Keys for batch jobs and integrations
+	addressRepo     repository.AddressRepositoryInterface // Shipping and billing address books
+	dataRequestRepo repository.DataRequestRepositoryInterface // Audit trail of data exports and erasures
+	orders          orderpb.OrderServiceClient                // Exports and pseudonymises orders for data requests
+}
+
+// UserServiceDeps are the repositories, clients and settings a UserService is built from.
+// Zero durations and an empty MFA issuer fall back to their defaults.
+type UserServiceDeps struct {
+	Users           repository.UserRepositoryInterface
+	Sessions        repository.SessionRepositoryInterface   // Refresh token sessions
+	Tokens          repository.UserTokenRepositoryInterface // Password reset and email verification tokens
+	Issuer          *auth.Issuer                            // Signs access tokens on login
+	Verifier        *auth.Verifier                          // Checks them for ValidateToken
+	RefreshTokenTTL time.Duration
+	PageTokens      *pagination.TokenCodec // Signs ListUsers page tokens
+	Mailer          mail.Mailer
+	Emails          AccountEmailConfig
+	LoginAttempts   repository.LoginAttemptRepositoryInterface // Failed login counters and lockouts
+	LoginThrottle   LoginThrottleConfig
+	MFA             repository.MFARepositoryInterface // TOTP secrets and recovery codes
+	MFAConfig       MFAConfig
+	APIKeys         repository.APIKeyRepositoryInterface      // Keys for batch jobs and integrations
+	Addresses       repository.AddressRepositoryInterface     // Shipping and billing address books
+	DataRequests    repository.DataRequestRepositoryInterface // Audit trail of data exports and erasures
+	Orders          orderpb.OrderServiceClient                // Exports and pseudonymises orders for data requests
 }
 
 // NewUserService creates a new UserService.
-func NewUserService(repo repository.UserRepositoryInterface) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(deps UserServiceDeps) *UserService {
+	refreshTokenTTL := deps.RefreshTokenTTL
+	if refreshTokenTTL <= 0 {
+		refreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	emails := deps.Emails
+	if emails.PasswordResetTTL <= 0 {
+		emails.PasswordResetTTL = DefaultPasswordResetTTL
+	}
+	if emails.EmailVerificationTTL <= 0 {
+		emails.EmailVerificationTTL = DefaultEmailVerificationTTL
+	}
+	mfa := deps.MFAConfig
+	if mfa.Issuer == "" {
+		mfa.Issuer = DefaultMFAIssuer
+	}
+	if mfa.ChallengeTTL <= 0 {
+		mfa.ChallengeTTL = DefaultMFAChallengeTTL
+	}
+	return &UserService{
+		repo:            deps.Users,
+		sessionRepo:     deps.Sessions,
+		tokenRepo:       deps.Tokens,
+		issuer:          deps.Issuer,
+		verifier:        deps.Verifier,
+		refreshTokenTTL: refreshTokenTTL,
+		pageTokens:      deps.PageTokens,
+		mailer:          deps.Mailer,
+		emails:          emails,
+		loginAttempts:   deps.LoginAttempts,
+		loginThrottle:   deps.LoginThrottle.withDefaults(),
+		mfaRepo:         deps.MFA,
+		mfa:             mfa,
+		apiKeyRepo:      deps.APIKeys,
+		addressRepo:     deps.Addresses,
+		dataRequestRepo: deps.DataRequests,
+		orders:          deps.Orders,
+	}
 }
 
 // HashPassword generates a bcrypt hash of the password.
@@ -42,6 +163,11 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
+// dummyPasswordHash is a bcrypt hash (at bcrypt.DefaultCost) that no password is expected to
+// match. LoginUser checks passwords for unknown emails against it, so they take as long to
+// refuse as wrong passwords and response times don't reveal which emails are registered.
+const dummyPasswordHash = "$2a$10$HbAG73kCXm/UVH3NjFjoS.on.yGibB35/4YSOG2KVrCLjXjSwNi2K"
+
 // CheckPasswordHash compares a plain text password with a bcrypt hash.
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
@@ -79,6 +205,11 @@ func (s *UserService) CreateUser(ctx context.Context, username, email, password
 		log.Printf("Error creating user in service: %v", err)
 		return nil, err
 	}
+
+	// The account works without it; the user can ask for another link via SendVerificationEmail
+	if err := s.sendVerificationEmail(ctx, createdUser); err != nil {
+		log.Printf("Error sending verification email to new user %s: %v", createdUser.ID, err)
+	}
 	return createdUser, nil
 }
 
@@ -95,24 +226,57 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*model.User,
 	return user, nil
 }
 
-// LoginUser authenticates a user and returns the user and a token (placeholder for token).
-func (s *UserService) LoginUser(ctx context.Context, email, password string) (*model.User, string, error) {
+// LoginUser authenticates a user and returns the user and a signed access token.
+// Failed attempts are counted per email and per client IP; past the limits, logins are
+// refused with a *LoginLockedError without checking the password.
+func (s *UserService) LoginUser(ctx context.Context, email, password, clientIP string) (*model.User, *model.AuthTokens, error) {
+	keys := loginKeys(email, clientIP)
+	if err := s.checkLoginLockout(ctx, keys); err != nil {
+		return nil, nil, err
+	}
+
 	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
 		if err == ErrUserNotFound {
-			return nil, "", ErrInvalidCredentials
+			// Checked and counted like a wrong password, so unknown emails take as long and
+			// get locked out the same way
+			CheckPasswordHash(password, dummyPasswordHash)
+			s.recordLoginFailure(ctx, keys, loginFailureUnknownEmail)
+			return nil, nil, ErrInvalidCredentials
 		}
 		log.Printf("Error during login (GetUserByEmail): %v", err)
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	if !CheckPasswordHash(password, user.PasswordHash) {
-		return nil, "", ErrInvalidCredentials
+		s.recordLoginFailure(ctx, keys, loginFailureWrongPassword)
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	// The password alone isn't enough with 2FA; the lockout is cleared once the code checks out
+	if user.MFAEnabledAt != nil {
+		challenge, err := s.startMFAChallenge(ctx, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("User %s passed the password check; waiting for 2FA", user.Email)
+		return nil, challenge, nil
 	}
+	s.clearAccountLockout(ctx, email)
 
-	// TODO: Generate JWT token here
-	token := "mock-jwt-token-for-" + user.ID
+	tokens, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
 	log.Printf("User %s logged in successfully", user.Email)
 
-	return user, token, nil
-}
\ No newline at end of file
+	return user, tokens, nil
+}
+
+// ValidateToken verifies an access token and returns its claims.
+func (s *UserService) ValidateToken(ctx context.Context, token string) (*auth.Claims, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+	return s.verifier.Verify(token)
+}
@@ -6,13 +6,68 @@ import (
 	"errors"
 	"microservices-project/internal/userservice/model"
 	"microservices-project/internal/userservice/repository" // For ErrUserNotFound
+	"microservices-project/pkg/auth"
+	"microservices-project/pkg/mail"
+	"microservices-project/pkg/pagination"
+	"microservices-project/protos/orderpb"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/pquerna/otp/totp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// Tokens in these tests are signed with a fixed HS256 key
+var (
+	testKeys, _    = auth.NewKeySet("test", auth.NewHS256Key("test", []byte("test-secret")))
+	testJWT        = auth.Config{Issuer: "test-issuer", Audience: "test-audience", TTL: time.Hour}
+	testIssuer     = auth.NewIssuer(testKeys, testJWT)
+	testVerifier   = auth.NewVerifier(testKeys, testJWT)
+	testPageTokens = pagination.NewTokenCodec([]byte("test-page-secret"))
+)
+
+// newTestUserService builds a UserService on the given mocks. The mailer records sent emails.
+// Logins are never locked out; tests of the lockout replace loginAttempts with their own mock,
+// and 2FA tests set mfaRepo.
+func newTestUserService(repo *MockUserRepository, sessionRepo *MockSessionRepository) (*UserService, *MockUserTokenRepository, *mail.MemoryMailer) {
+	tokenRepo := new(MockUserTokenRepository)
+	mailer := mail.NewMemoryMailer()
+	emails := AccountEmailConfig{
+		PasswordResetURL:     "https://shop.example.com/reset-password",
+		EmailVerificationURL: "https://shop.example.com/verify-email",
+	}
+	loginAttempts := new(MockLoginAttemptRepository)
+	loginAttempts.On("LockedUntil", mock.Anything, mock.Anything, mock.Anything).Return(time.Time{}, nil).Maybe()
+	loginAttempts.On("RecordLoginFailure", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(1, nil).Maybe()
+	loginAttempts.On("ResetLoginAttempts", mock.Anything, mock.Anything).Return(nil).Maybe()
+	userService := NewUserService(UserServiceDeps{
+		Users:           repo,
+		Sessions:        sessionRepo,
+		Tokens:          tokenRepo,
+		Issuer:          testIssuer,
+		Verifier:        testVerifier,
+		RefreshTokenTTL: time.Hour,
+		PageTokens:      testPageTokens,
+		Mailer:          mailer,
+		Emails:          emails,
+		LoginAttempts:   loginAttempts,
+		MFA:             new(MockMFARepository),
+		APIKeys:         new(MockAPIKeyRepository),
+		Addresses:       new(MockAddressRepository),
+		DataRequests:    new(MockDataRequestRepository),
+		Orders:          new(MockOrderClient),
+	})
+	return userService, tokenRepo, mailer
+}
+
 // MockUserRepository is a mock type for the UserRepositoryInterface
 type MockUserRepository struct {
 	mock.Mock
@@ -43,10 +98,347 @@ func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
+func (m *MockUserRepository) AddUserRole(ctx context.Context, userID, role string) (*model.User, error) {
+	args := m.Called(ctx, userID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *MockUserRepository) RemoveUserRole(ctx context.Context, userID, role string) (*model.User, error) {
+	args := m.Called(ctx, userID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *MockUserRepository) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, user *model.User) (*model.User, error) {
+	args := m.Called(ctx, user)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *MockUserRepository) MarkEmailVerified(ctx context.Context, id, email string) (*model.User, error) {
+	args := m.Called(ctx, id, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id, passwordHash string) (int64, error) {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) IsUserDeleted(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserRepository) DeleteUser(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) ListUsersAfter(ctx context.Context, filter model.UserFilter, after *pagination.Cursor, limit int) ([]*model.User, error) {
+	args := m.Called(ctx, filter, after, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.User), args.Error(1)
+}
+
+// MockUserTokenRepository is a mock type for the UserTokenRepositoryInterface
+type MockUserTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserTokenRepository) CreateUserToken(ctx context.Context, token *model.UserToken) (*model.UserToken, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.UserToken), args.Error(1)
+}
+
+func (m *MockUserTokenRepository) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error) {
+	args := m.Called(ctx, purpose, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.UserToken), args.Error(1)
+}
+
+func (m *MockUserTokenRepository) DeleteExpiredUserTokens(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockLoginAttemptRepository struct {
+	mock.Mock
+}
+
+func (m *MockLoginAttemptRepository) LockedUntil(ctx context.Context, now time.Time, keys ...model.LoginAttemptKey) (time.Time, error) {
+	args := m.Called(ctx, now, keys)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockLoginAttemptRepository) RecordLoginFailure(ctx context.Context, key model.LoginAttemptKey, now, windowStart time.Time) (int, error) {
+	args := m.Called(ctx, key, now, windowStart)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockLoginAttemptRepository) LockLogin(ctx context.Context, key model.LoginAttemptKey, until time.Time) error {
+	args := m.Called(ctx, key, until)
+	return args.Error(0)
+}
+
+func (m *MockLoginAttemptRepository) ResetLoginAttempts(ctx context.Context, key model.LoginAttemptKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockLoginAttemptRepository) DeleteStaleLoginAttempts(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockMFARepository struct {
+	mock.Mock
+}
+
+func (m *MockMFARepository) GetMFAState(ctx context.Context, userID string) (*model.MFAState, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.MFAState), args.Error(1)
+}
+
+func (m *MockMFARepository) SetMFASecret(ctx context.Context, userID, secret string) error {
+	args := m.Called(ctx, userID, secret)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) EnableMFA(ctx context.Context, userID string, step int64, codeHashes []string) error {
+	args := m.Called(ctx, userID, step, codeHashes)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	args := m.Called(ctx, userID, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) DisableMFA(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) (*model.APIKey, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	args := m.Called(ctx, keyHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) ListAPIKeys(ctx context.Context, includeRevoked bool) ([]*model.APIKey, error) {
+	args := m.Called(ctx, includeRevoked)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	args := m.Called(ctx, id, usedAt)
+	return args.Error(0)
+}
+
+type MockAddressRepository struct {
+	mock.Mock
+}
+
+func (m *MockAddressRepository) AddAddress(ctx context.Context, addr *model.Address, maxAddresses int) (*model.Address, error) {
+	args := m.Called(ctx, addr, maxAddresses)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Address), args.Error(1)
+}
+
+func (m *MockAddressRepository) GetAddress(ctx context.Context, userID, id string) (*model.Address, error) {
+	args := m.Called(ctx, userID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Address), args.Error(1)
+}
+
+func (m *MockAddressRepository) ListAddresses(ctx context.Context, userID string) ([]*model.Address, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Address), args.Error(1)
+}
+
+func (m *MockAddressRepository) UpdateAddress(ctx context.Context, addr *model.Address) (*model.Address, error) {
+	args := m.Called(ctx, addr)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Address), args.Error(1)
+}
+
+func (m *MockAddressRepository) DeleteAddress(ctx context.Context, userID, id string) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockAddressRepository) SetDefaultAddress(ctx context.Context, userID, id string) (*model.Address, error) {
+	args := m.Called(ctx, userID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Address), args.Error(1)
+}
+
+type MockDataRequestRepository struct {
+	mock.Mock
+}
+
+// CreateDataRequest gives req the ID passed to Return and returns it.
+func (m *MockDataRequestRepository) CreateDataRequest(ctx context.Context, req *model.DataRequest) (*model.DataRequest, error) {
+	args := m.Called(ctx, req)
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+	req.ID = args.String(0)
+	return req, nil
+}
+
+func (m *MockDataRequestRepository) FinishDataRequest(ctx context.Context, req *model.DataRequest) error {
+	args := m.Called(ctx, req)
+	return args.Error(0)
+}
+
+func (m *MockDataRequestRepository) ListDataRequests(ctx context.Context, userID string) ([]*model.DataRequest, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.DataRequest), args.Error(1)
+}
+
+func (m *MockDataRequestRepository) GetErasurePseudonym(ctx context.Context, userID string) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+// MockOrderClient mocks the OrderService gRPC client.
+type MockOrderClient struct {
+	orderpb.OrderServiceClient
+	mock.Mock
+}
+
+func (m *MockOrderClient) ExportUserOrders(ctx context.Context, in *orderpb.ExportUserOrdersRequest, opts ...grpc.CallOption) (*orderpb.ExportUserOrdersResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orderpb.ExportUserOrdersResponse), args.Error(1)
+}
+
+func (m *MockOrderClient) EraseUserOrders(ctx context.Context, in *orderpb.EraseUserOrdersRequest, opts ...grpc.CallOption) (*orderpb.EraseUserOrdersResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orderpb.EraseUserOrdersResponse), args.Error(1)
+}
+
+// MockSessionRepository is a mock type for the SessionRepositoryInterface
+type MockSessionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepository) CreateSession(ctx context.Context, session *model.Session) (*model.Session, error) {
+	args := m.Called(ctx, session)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func (m *MockSessionRepository) GetActiveSession(ctx context.Context, tokenHash string) (*model.Session, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func (m *MockSessionRepository) RotateSession(ctx context.Context, tokenHash string, next *model.Session) (*model.Session, error) {
+	args := m.Called(ctx, tokenHash, next)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func (m *MockSessionRepository) RevokeFamily(ctx context.Context, tokenHash string) error {
+	args := m.Called(ctx, tokenHash)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepository) RevokeAllUserSessions(ctx context.Context, userID string) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionRepository) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 
 func TestUserService_CreateUser_Success(t *testing.T) {
 	mockRepo := new(MockUserRepository)
-	userService := NewUserService(mockRepo)
+	userService, tokenRepo, mailer := newTestUserService(mockRepo, new(MockSessionRepository))
 
 	username := "newuser"
 	email := "new@example.com"
@@ -73,6 +465,7 @@ func TestUserService_CreateUser_Success(t *testing.T) {
 	mockRepo.On("CreateUser", mock.Anything, mock.MatchedBy(func(user *model.User) bool {
 		return user.Username == username && user.Email == email && user.PasswordHash != ""
 	})).Return(expectedUserAfterRepo, nil)
+	tokenRepo.On("CreateUserToken", mock.Anything, mock.AnythingOfType("*model.UserToken")).Return(&model.UserToken{}, nil)
 
 	createdUser, err := userService.CreateUser(context.Background(), username, email, password)
 
@@ -83,11 +476,15 @@ func TestUserService_CreateUser_Success(t *testing.T) {
 	assert.Equal(t, email, createdUser.Email)
 
 	mockRepo.AssertExpectations(t)
+	// New users get a verification email
+	if assert.Len(t, mailer.Messages(), 1) {
+		assert.Equal(t, email, mailer.Messages()[0].To)
+	}
 }
 
 func TestUserService_CreateUser_AlreadyExists(t *testing.T) {
 	mockRepo := new(MockUserRepository)
-	userService := NewUserService(mockRepo)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
 
 	email := "existing@example.com"
 	existingUser := &model.User{Email: email}
@@ -106,7 +503,7 @@ func TestUserService_CreateUser_AlreadyExists(t *testing.T) {
 
 func TestUserService_GetUserByID_Success(t *testing.T) {
 	mockRepo := new(MockUserRepository)
-	userService := NewUserService(mockRepo)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
 
 	userID := "user123"
 	expectedUser := &model.User{ID: userID, Username: "test"}
@@ -122,7 +519,7 @@ func TestUserService_GetUserByID_Success(t *testing.T) {
 
 func TestUserService_GetUserByID_NotFound(t *testing.T) {
 	mockRepo := new(MockUserRepository)
-	userService := NewUserService(mockRepo)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
 
 	userID := "nonexistent"
 	mockRepo.On("GetUserByID", mock.Anything, userID).Return(nil, repository.ErrUserNotFound)
@@ -136,7 +533,8 @@ func TestUserService_GetUserByID_NotFound(t *testing.T) {
 
 func TestUserService_LoginUser_Success(t *testing.T) {
 	mockRepo := new(MockUserRepository)
-	userService := NewUserService(mockRepo)
+	sessionRepo := new(MockSessionRepository)
+	userService, _, _ := newTestUserService(mockRepo, sessionRepo)
 
 	email := "login@example.com"
 	password := "password123"
@@ -150,20 +548,51 @@ func TestUserService_LoginUser_Success(t *testing.T) {
 	}
 
 	mockRepo.On("GetUserByEmail", mock.Anything, email).Return(dbUser, nil)
+	// Only the hash of the refresh token is stored
+	var stored *model.Session
+	sessionRepo.On("CreateSession", mock.Anything, mock.MatchedBy(func(session *model.Session) bool {
+		stored = session
+		return session.UserID == dbUser.ID && len(session.TokenHash) == 64
+	})).Return(&model.Session{}, nil)
 
-	user, token, err := userService.LoginUser(context.Background(), email, password)
+	user, tokens, err := userService.LoginUser(context.Background(), email, password, "203.0.113.7")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
 	assert.Equal(t, dbUser.ID, user.ID)
-	assert.NotEmpty(t, token)
-	assert.Contains(t, token, "mock-jwt-token-for-") // Check our mock token format
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.True(t, tokens.ExpiresAt.After(time.Now()))
+
+	// The token is a real JWT for this user
+	claims, err := userService.ValidateToken(context.Background(), tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, dbUser.ID, claims.UserID())
+	assert.Equal(t, email, claims.Email)
+
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, hashToken(tokens.RefreshToken), stored.TokenHash)
+	assert.NotEqual(t, tokens.RefreshToken, stored.TokenHash)
 	mockRepo.AssertExpectations(t)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestUserService_ValidateToken_RejectsForeignToken(t *testing.T) {
+	userService, _, _ := newTestUserService(new(MockUserRepository), new(MockSessionRepository))
+
+	otherKeys, _ := auth.NewKeySet("test", auth.NewHS256Key("test", []byte("someone-elses-secret")))
+	token, _, err := auth.NewIssuer(otherKeys, testJWT).Issue(auth.Claims{Email: "x@example.com"})
+	assert.NoError(t, err)
+
+	_, err = userService.ValidateToken(context.Background(), token)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+
+	_, err = userService.ValidateToken(context.Background(), "")
+	assert.True(t, errors.Is(err, ErrInvalidToken))
 }
 
 func TestUserService_LoginUser_WrongPassword(t *testing.T) {
 	mockRepo := new(MockUserRepository)
-	userService := NewUserService(mockRepo)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
 
 	email := "login@example.com"
 	correctPassword := "password123"
@@ -173,24 +602,762 @@ func TestUserService_LoginUser_WrongPassword(t *testing.T) {
 	dbUser := &model.User{Email: email, PasswordHash: hashedPassword}
 
 	mockRepo.On("GetUserByEmail", mock.Anything, email).Return(dbUser, nil)
+	failures := loginFailures.WithLabelValues(loginFailureWrongPassword)
+	failuresBefore := testutil.ToFloat64(failures)
 
-	_, _, err := userService.LoginUser(context.Background(), email, wrongPassword)
+	_, _, err := userService.LoginUser(context.Background(), email, wrongPassword, "203.0.113.7")
 
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	assert.Equal(t, failuresBefore+1, testutil.ToFloat64(failures))
 	mockRepo.AssertExpectations(t)
 }
 
 func TestUserService_LoginUser_UserNotFound(t *testing.T) {
 	mockRepo := new(MockUserRepository)
-	userService := NewUserService(mockRepo)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
 	email := "nonexistent@example.com"
 
 	mockRepo.On("GetUserByEmail", mock.Anything, email).Return(nil, repository.ErrUserNotFound)
 
-	_, _, err := userService.LoginUser(context.Background(), email, "anypassword")
+	_, _, err := userService.LoginUser(context.Background(), email, "anypassword", "203.0.113.7")
 	
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, ErrInvalidCredentials)) // Service maps UserNotFound to InvalidCredentials for login
 	mockRepo.AssertExpectations(t)
-}
\ No newline at end of file
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+	// Unknown emails must cost a full bcrypt comparison, like a registered user's password
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+	assert.False(t, CheckPasswordHash("", dummyPasswordHash))
+}
+
+func TestUserService_LoginUser_LockedOut(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+	loginAttempts := new(MockLoginAttemptRepository)
+	userService.loginAttempts = loginAttempts
+
+	keys := []model.LoginAttemptKey{
+		{Scope: model.LoginScopeAccount, Key: "login@example.com"},
+		{Scope: model.LoginScopeIP, Key: "203.0.113.7"},
+	}
+	loginAttempts.On("LockedUntil", mock.Anything, mock.Anything, keys).Return(time.Now().Add(time.Minute), nil)
+
+	_, _, err := userService.LoginUser(context.Background(), "Login@Example.com", "password123", "203.0.113.7")
+
+	var locked *LoginLockedError
+	require.True(t, errors.As(err, &locked))
+	assert.True(t, errors.Is(err, ErrTooManyLoginAttempts))
+	assert.True(t, locked.RetryAfter > 0 && locked.RetryAfter <= time.Minute)
+	// The password isn't even checked while locked
+	mockRepo.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+}
+
+func TestUserService_LoginUser_LocksAfterRepeatedFailures(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+	loginAttempts := new(MockLoginAttemptRepository)
+	userService.loginAttempts = loginAttempts
+
+	account := model.LoginAttemptKey{Scope: model.LoginScopeAccount, Key: "nobody@example.com"}
+	ip := model.LoginAttemptKey{Scope: model.LoginScopeIP, Key: "203.0.113.7"}
+	mockRepo.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(nil, repository.ErrUserNotFound)
+	loginAttempts.On("LockedUntil", mock.Anything, mock.Anything, mock.Anything).Return(time.Time{}, nil)
+	// The account reaches its limit of 5 on this attempt; the address is far from its 50
+	loginAttempts.On("RecordLoginFailure", mock.Anything, account, mock.Anything, mock.Anything).Return(DefaultLoginAccountFailures, nil)
+	loginAttempts.On("RecordLoginFailure", mock.Anything, ip, mock.Anything, mock.Anything).Return(3, nil)
+	loginAttempts.On("LockLogin", mock.Anything, account, mock.MatchedBy(func(until time.Time) bool {
+		return time.Until(until) > 25*time.Second && time.Until(until) <= DefaultLoginBaseLockout
+	})).Return(nil).Once()
+
+	// An unknown email is counted and locked just like a wrong password
+	_, _, err := userService.LoginUser(context.Background(), "nobody@example.com", "guess", "203.0.113.7")
+
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	loginAttempts.AssertExpectations(t)
+	loginAttempts.AssertNotCalled(t, "LockLogin", mock.Anything, ip, mock.Anything)
+}
+
+func TestLoginThrottleConfig_LockoutFor(t *testing.T) {
+	config := LoginThrottleConfig{}.withDefaults()
+
+	assert.Equal(t, time.Duration(0), config.lockoutFor(4, 5))
+	assert.Equal(t, 30*time.Second, config.lockoutFor(5, 5))
+	assert.Equal(t, 60*time.Second, config.lockoutFor(6, 5))
+	assert.Equal(t, 120*time.Second, config.lockoutFor(7, 5))
+	assert.Equal(t, time.Hour, config.lockoutFor(1000, 5))
+}
+
+func TestUserService_UnlockUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+	loginAttempts := new(MockLoginAttemptRepository)
+	userService.loginAttempts = loginAttempts
+
+	mockRepo.On("GetUserByID", mock.Anything, "user-1").Return(&model.User{ID: "user-1", Email: "Alice@Example.com"}, nil)
+	loginAttempts.On("ResetLoginAttempts", mock.Anything, model.LoginAttemptKey{Scope: model.LoginScopeAccount, Key: "alice@example.com"}).Return(nil).Once()
+	loginAttempts.On("ResetLoginAttempts", mock.Anything, model.LoginAttemptKey{Scope: model.LoginScopeIP, Key: "203.0.113.7"}).Return(nil).Once()
+
+	err := userService.UnlockUser(context.Background(), "user-1", "203.0.113.7")
+
+	assert.NoError(t, err)
+	loginAttempts.AssertExpectations(t)
+}
+
+func TestUserService_RefreshToken_Rotates(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	sessionRepo := new(MockSessionRepository)
+	userService, _, _ := newTestUserService(mockRepo, sessionRepo)
+
+	dbUser := &model.User{ID: "user-refresh-id", Email: "refresh@example.com"}
+	sessionRepo.On("RotateSession", mock.Anything, hashToken("old-token"), mock.AnythingOfType("*model.Session")).
+		Run(func(args mock.Arguments) {
+			args.Get(2).(*model.Session).UserID = dbUser.ID // The repository copies the user from the old session
+		}).
+		Return(&model.Session{UserID: dbUser.ID}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, dbUser.ID).Return(dbUser, nil)
+
+	tokens, err := userService.RefreshToken(context.Background(), "old-token")
+
+	assert.NoError(t, err)
+	assert.NotEqual(t, "old-token", tokens.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), tokens.RefreshTokenExpiresAt, time.Minute)
+	claims, err := userService.ValidateToken(context.Background(), tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, dbUser.ID, claims.UserID())
+	mockRepo.AssertExpectations(t)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestUserService_RefreshToken_Errors(t *testing.T) {
+	tests := map[string]struct {
+		repoErr error
+		want    error
+	}{
+		"reused":     {repository.ErrSessionReused, ErrRefreshTokenReused},
+		"unknown":    {repository.ErrSessionNotFound, ErrInvalidRefreshToken},
+		"expired":    {repository.ErrSessionExpired, ErrInvalidRefreshToken},
+		"logged out": {repository.ErrSessionRevoked, ErrInvalidRefreshToken},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sessionRepo := new(MockSessionRepository)
+			userService, _, _ := newTestUserService(new(MockUserRepository), sessionRepo)
+			sessionRepo.On("RotateSession", mock.Anything, hashToken("token"), mock.Anything).Return(nil, tc.repoErr)
+
+			_, err := userService.RefreshToken(context.Background(), "token")
+			assert.True(t, errors.Is(err, tc.want), "got %v", err)
+		})
+	}
+}
+
+func TestUserService_LogoutAllSessions(t *testing.T) {
+	sessionRepo := new(MockSessionRepository)
+	userService, _, _ := newTestUserService(new(MockUserRepository), sessionRepo)
+
+	sessionRepo.On("GetActiveSession", mock.Anything, hashToken("token")).Return(&model.Session{UserID: "user-1"}, nil)
+	sessionRepo.On("RevokeAllUserSessions", mock.Anything, "user-1").Return(int64(3), nil)
+
+	revoked, err := userService.LogoutAllSessions(context.Background(), "token")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), revoked)
+	sessionRepo.AssertExpectations(t)
+
+	// A token that can't refresh can't log anyone out either
+	sessionRepo.On("GetActiveSession", mock.Anything, hashToken("stale")).Return(nil, repository.ErrSessionRevoked)
+	_, err = userService.LogoutAllSessions(context.Background(), "stale")
+	assert.True(t, errors.Is(err, ErrInvalidRefreshToken))
+}
+
+func TestUserService_AssignRole(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+
+	promoted := &model.User{ID: "user-1", Roles: []string{model.RoleCustomer, model.RoleAdmin}}
+	mockRepo.On("AddUserRole", mock.Anything, "user-1", model.RoleAdmin).Return(promoted, nil)
+
+	user, err := userService.AssignRole(context.Background(), "user-1", model.RoleAdmin)
+	assert.NoError(t, err)
+	assert.True(t, user.HasRole(model.RoleAdmin))
+
+	// "service" belongs to service tokens, not users
+	_, err = userService.AssignRole(context.Background(), "user-1", "service")
+	assert.True(t, errors.Is(err, ErrInvalidRole))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_BootstrapAdmin(t *testing.T) {
+	t.Run("admin exists", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+		mockRepo.On("CountUsersWithRole", mock.Anything, model.RoleAdmin).Return(int64(1), nil)
+
+		user, err := userService.BootstrapAdmin(context.Background(), "root", "root@example.com", "password123")
+		assert.NoError(t, err)
+		assert.Nil(t, user)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("creates the first admin", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+		mockRepo.On("CountUsersWithRole", mock.Anything, model.RoleAdmin).Return(int64(0), nil)
+		mockRepo.On("GetUserByEmail", mock.Anything, "root@example.com").Return(nil, ErrUserNotFound)
+		mockRepo.On("CreateUser", mock.Anything, mock.MatchedBy(func(u *model.User) bool {
+			return u.Email == "root@example.com" && u.HasRole(model.RoleAdmin) && CheckPasswordHash("password123", u.PasswordHash)
+		})).Return(&model.User{ID: "admin-1", Roles: []string{model.RoleCustomer, model.RoleAdmin}}, nil)
+
+		user, err := userService.BootstrapAdmin(context.Background(), "root", "root@example.com", "password123")
+		assert.NoError(t, err)
+		assert.Equal(t, "admin-1", user.ID)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUserService_UpdateUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+
+	mockRepo.On("GetUserByID", mock.Anything, "user-1").Return(&model.User{ID: "user-1", Username: "old", Email: "old@example.com"}, nil)
+	mockRepo.On("UpdateUser", mock.Anything, &model.User{ID: "user-1", Username: "old", Email: "new@example.com"}).
+		Return(&model.User{ID: "user-1", Username: "old", Email: "new@example.com"}, nil)
+
+	user, err := userService.UpdateUser(context.Background(), "user-1", "", "new@example.com")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "old", user.Username) // Empty fields are left alone
+	assert.Equal(t, "new@example.com", user.Email)
+	mockRepo.AssertExpectations(t)
+
+	_, err = userService.UpdateUser(context.Background(), "user-1", "", "")
+	assert.True(t, errors.Is(err, ErrInvalidUserData))
+}
+
+func TestUserService_UpdateUser_Taken(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+
+	mockRepo.On("GetUserByID", mock.Anything, "user-1").Return(&model.User{ID: "user-1", Username: "old"}, nil)
+	mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(nil, repository.ErrUserAlreadyExists)
+
+	_, err := userService.UpdateUser(context.Background(), "user-1", "taken", "")
+	assert.True(t, errors.Is(err, ErrUserAlreadyExists))
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+
+	hash, _ := HashPassword("old-password")
+	mockRepo.On("GetUserByID", mock.Anything, "user-1").Return(&model.User{ID: "user-1", PasswordHash: hash}, nil)
+	mockRepo.On("UpdatePassword", mock.Anything, "user-1", mock.MatchedBy(func(h string) bool {
+		return CheckPasswordHash("new-password", h)
+	})).Return(int64(2), nil).Once()
+
+	_, err := userService.ChangePassword(context.Background(), "user-1", "wrong", "new-password")
+	assert.True(t, errors.Is(err, ErrIncorrectPassword))
+
+	revoked, err := userService.ChangePassword(context.Background(), "user-1", "old-password", "new-password")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), revoked)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_ListUsers_Pages(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+
+	now := time.Now()
+	filter := model.UserFilter{EmailPrefix: "a"}
+	page := []*model.User{
+		{ID: "u3", CreatedAt: now},
+		{ID: "u2", CreatedAt: now.Add(-time.Minute)},
+		{ID: "u1", CreatedAt: now.Add(-2 * time.Minute)},
+	}
+	mockRepo.On("ListUsersAfter", mock.Anything, filter, (*pagination.Cursor)(nil), 3).Return(page, nil)
+
+	users, next, err := userService.ListUsers(context.Background(), filter, "", 2)
+
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.NotEmpty(t, next)
+
+	// The token only works with the filter it was issued for
+	_, _, err = userService.ListUsers(context.Background(), model.UserFilter{EmailPrefix: "b"}, next, 2)
+	assert.True(t, errors.Is(err, ErrInvalidPageToken))
+}
+
+// tokenFromEmail pulls the token out of the link in a mailed message.
+func tokenFromEmail(t *testing.T, msg mail.Message) string {
+	_, rest, found := strings.Cut(msg.Body, "?token=")
+	require.True(t, found, "no link in %q", msg.Body)
+	return strings.Fields(rest)[0]
+}
+
+func TestUserService_PasswordReset(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, tokenRepo, mailer := newTestUserService(mockRepo, new(MockSessionRepository))
+
+	user := &model.User{ID: "user-1", Email: "alice@example.com"}
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	var stored *model.UserToken
+	tokenRepo.On("CreateUserToken", mock.Anything, mock.AnythingOfType("*model.UserToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*model.UserToken) }).
+		Return(&model.UserToken{}, nil)
+
+	require.NoError(t, userService.RequestPasswordReset(context.Background(), user.Email))
+	require.Len(t, mailer.Messages(), 1)
+	token := tokenFromEmail(t, mailer.Messages()[0])
+	assert.Equal(t, hashToken(token), stored.TokenHash, "only the hash is stored")
+	assert.Equal(t, model.TokenPurposePasswordReset, stored.Purpose)
+	assert.WithinDuration(t, time.Now().Add(DefaultPasswordResetTTL), stored.ExpiresAt, time.Minute)
+
+	tokenRepo.On("ConsumeUserToken", mock.Anything, model.TokenPurposePasswordReset, hashToken(token)).Return(stored, nil).Once()
+	mockRepo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+	mockRepo.On("UpdatePassword", mock.Anything, user.ID, mock.MatchedBy(func(h string) bool {
+		return CheckPasswordHash("new-password", h)
+	})).Return(int64(1), nil)
+
+	require.NoError(t, userService.ResetPassword(context.Background(), token, "new-password"))
+
+	// Second use
+	tokenRepo.On("ConsumeUserToken", mock.Anything, model.TokenPurposePasswordReset, hashToken(token)).Return(nil, repository.ErrUserTokenInvalid)
+	err := userService.ResetPassword(context.Background(), token, "other-password")
+	assert.True(t, errors.Is(err, ErrInvalidUserToken))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_RequestPasswordReset_UnknownEmail(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, _, mailer := newTestUserService(mockRepo, new(MockSessionRepository))
+	mockRepo.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(nil, repository.ErrUserNotFound)
+
+	// Same answer as for a real account, but nothing is sent
+	assert.NoError(t, userService.RequestPasswordReset(context.Background(), "nobody@example.com"))
+	assert.Empty(t, mailer.Messages())
+}
+
+func TestUserService_ResetPassword_EmailChanged(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, tokenRepo, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+
+	tokenRepo.On("ConsumeUserToken", mock.Anything, model.TokenPurposePasswordReset, hashToken("token")).
+		Return(&model.UserToken{UserID: "user-1", Email: "old@example.com"}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user-1").Return(&model.User{ID: "user-1", Email: "new@example.com"}, nil)
+
+	err := userService.ResetPassword(context.Background(), "token", "new-password")
+	assert.True(t, errors.Is(err, ErrInvalidUserToken))
+	mockRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUserService_VerifyEmail(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, tokenRepo, mailer := newTestUserService(mockRepo, new(MockSessionRepository))
+
+	user := &model.User{ID: "user-1", Email: "alice@example.com"}
+	mockRepo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+	tokenRepo.On("CreateUserToken", mock.Anything, mock.AnythingOfType("*model.UserToken")).Return(&model.UserToken{}, nil)
+
+	require.NoError(t, userService.SendVerificationEmail(context.Background(), user.ID))
+	require.Len(t, mailer.Messages(), 1)
+	token := tokenFromEmail(t, mailer.Messages()[0])
+
+	verifiedAt := time.Now()
+	tokenRepo.On("ConsumeUserToken", mock.Anything, model.TokenPurposeEmailVerification, hashToken(token)).
+		Return(&model.UserToken{UserID: user.ID, Email: user.Email}, nil)
+	mockRepo.On("MarkEmailVerified", mock.Anything, user.ID, user.Email).
+		Return(&model.User{ID: user.ID, Email: user.Email, EmailVerifiedAt: &verifiedAt}, nil)
+
+	verified, err := userService.VerifyEmail(context.Background(), token)
+	assert.NoError(t, err)
+	assert.NotNil(t, verified.EmailVerifiedAt)
+
+	// Nothing more to send once verified
+	mockRepo.On("GetUserByID", mock.Anything, "user-2").Return(&model.User{ID: "user-2", EmailVerifiedAt: &verifiedAt}, nil)
+	err = userService.SendVerificationEmail(context.Background(), "user-2")
+	assert.True(t, errors.Is(err, ErrEmailAlreadyVerified))
+}
+
+func TestUserService_MFA_EnrollConfirmAndLogin(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	sessionRepo := new(MockSessionRepository)
+	userService, tokenRepo, _ := newTestUserService(mockRepo, sessionRepo)
+	mfaRepo := new(MockMFARepository)
+	userService.mfaRepo = mfaRepo
+
+	hashedPassword, _ := HashPassword("password123")
+	user := &model.User{ID: "user-1", Email: "alice@example.com", PasswordHash: hashedPassword}
+	mockRepo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil).Once()
+
+	// Enrol: the secret goes into the otpauth URI and is stored unconfirmed
+	var secret string
+	mfaRepo.On("SetMFASecret", mock.Anything, user.ID, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		secret = args.String(2)
+	}).Return(nil)
+	enrollment, err := userService.EnrollMFA(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, secret, enrollment.Secret)
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/"))
+	assert.Contains(t, enrollment.URI, "secret="+secret)
+
+	// Confirm with a code from the "app"; only hashes of the recovery codes are stored
+	mfaRepo.On("GetMFAState", mock.Anything, user.ID).Return(&model.MFAState{UserID: user.ID, Secret: secret}, nil).Once()
+	var storedHashes []string
+	mfaRepo.On("EnableMFA", mock.Anything, user.ID, mock.AnythingOfType("int64"), mock.Anything).Run(func(args mock.Arguments) {
+		storedHashes = args.Get(3).([]string)
+	}).Return(nil)
+	code, err := totp.GenerateCode(secret, time.Now())
+	require.NoError(t, err)
+	recoveryCodes, err := userService.ConfirmMFA(context.Background(), user.ID, code)
+	require.NoError(t, err)
+	require.Len(t, recoveryCodes, recoveryCodeCount)
+	assert.Contains(t, storedHashes, hashToken(normalizeRecoveryCode(recoveryCodes[0])))
+	assert.NotContains(t, storedHashes, recoveryCodes[0])
+
+	// The password alone now only gets a challenge
+	enabledAt := time.Now()
+	user.MFAEnabledAt = &enabledAt
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	tokenRepo.On("CreateUserToken", mock.Anything, mock.MatchedBy(func(token *model.UserToken) bool {
+		return token.Purpose == model.TokenPurposeMFAChallenge && token.UserID == user.ID
+	})).Return(&model.UserToken{}, nil)
+	loggedIn, challenge, err := userService.LoginUser(context.Background(), user.Email, "password123", "203.0.113.7")
+	require.NoError(t, err)
+	assert.Nil(t, loggedIn)
+	assert.True(t, challenge.MFARequired())
+	assert.Empty(t, challenge.AccessToken)
+	assert.Empty(t, challenge.RefreshToken)
+
+	// Trading in the challenge with a recovery code, typed sloppily, completes the login
+	tokenRepo.On("ConsumeUserToken", mock.Anything, model.TokenPurposeMFAChallenge, hashToken(challenge.MFAChallengeToken)).
+		Return(&model.UserToken{UserID: user.ID, Email: user.Email}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+	mfaRepo.On("GetMFAState", mock.Anything, user.ID).Return(&model.MFAState{UserID: user.ID, Secret: secret, EnabledAt: &enabledAt}, nil)
+	mfaRepo.On("UseRecoveryCode", mock.Anything, user.ID, hashToken(normalizeRecoveryCode(recoveryCodes[3]))).Return(nil).Once()
+	sessionRepo.On("CreateSession", mock.Anything, mock.AnythingOfType("*model.Session")).Return(&model.Session{}, nil)
+
+	loggedIn, tokens, err := userService.VerifyMFA(context.Background(), challenge.MFAChallengeToken, " "+strings.ToUpper(recoveryCodes[3]), "203.0.113.7")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	mfaRepo.AssertExpectations(t)
+}
+
+func TestUserService_VerifyMFA_WrongCode(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	userService, tokenRepo, _ := newTestUserService(mockRepo, new(MockSessionRepository))
+	mfaRepo := new(MockMFARepository)
+	userService.mfaRepo = mfaRepo
+	loginAttempts := new(MockLoginAttemptRepository)
+	userService.loginAttempts = loginAttempts
+
+	enabledAt := time.Now()
+	user := &model.User{ID: "user-1", Email: "alice@example.com", MFAEnabledAt: &enabledAt}
+	tokenRepo.On("ConsumeUserToken", mock.Anything, model.TokenPurposeMFAChallenge, hashToken("challenge")).
+		Return(&model.UserToken{UserID: user.ID, Email: user.Email}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+	mfaRepo.On("GetMFAState", mock.Anything, user.ID).Return(&model.MFAState{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP", EnabledAt: &enabledAt}, nil)
+	mfaRepo.On("UseRecoveryCode", mock.Anything, user.ID, mock.Anything).Return(repository.ErrRecoveryCodeInvalid)
+	loginAttempts.On("LockedUntil", mock.Anything, mock.Anything, mock.Anything).Return(time.Time{}, nil)
+	loginAttempts.On("RecordLoginFailure", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(1, nil).Twice()
+
+	_, _, err := userService.VerifyMFA(context.Background(), "challenge", "not-a-code", "203.0.113.7")
+
+	assert.True(t, errors.Is(err, ErrInvalidMFACode))
+	// A wrong code counts against the account and address like a wrong password
+	loginAttempts.AssertExpectations(t)
+	loginAttempts.AssertNotCalled(t, "ResetLoginAttempts", mock.Anything, mock.Anything)
+}
+
+func TestUserService_VerifyMFA_UnknownChallenge(t *testing.T) {
+	userService, tokenRepo, _ := newTestUserService(new(MockUserRepository), new(MockSessionRepository))
+	tokenRepo.On("ConsumeUserToken", mock.Anything, model.TokenPurposeMFAChallenge, mock.Anything).Return(nil, repository.ErrUserTokenInvalid)
+
+	_, _, err := userService.VerifyMFA(context.Background(), "used-or-expired", "123456", "")
+
+	assert.True(t, errors.Is(err, ErrInvalidMFAChallenge))
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1_700_000_000, 0)
+	current := now.Unix() / mfaPeriod
+
+	previous, _ := totp.GenerateCode(secret, now.Add(-mfaPeriod*time.Second))
+	step, ok := matchTOTP(secret, previous, now)
+	assert.True(t, ok, "a code from the previous step allows for clock drift")
+	assert.Equal(t, current-1, step)
+
+	stale, _ := totp.GenerateCode(secret, now.Add(-3*mfaPeriod*time.Second))
+	_, ok = matchTOTP(secret, stale, now)
+	assert.False(t, ok)
+
+	_, ok = matchTOTP(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestUserService_APIKeys_CreateAndAuthenticate(t *testing.T) {
+	userService, _, _ := newTestUserService(new(MockUserRepository), new(MockSessionRepository))
+	apiKeyRepo := new(MockAPIKeyRepository)
+	userService.apiKeyRepo = apiKeyRepo
+
+	stored := &model.APIKey{}
+	apiKeyRepo.On("CreateAPIKey", mock.Anything, mock.AnythingOfType("*model.APIKey")).
+		Run(func(args mock.Arguments) {
+			*stored = *args.Get(1).(*model.APIKey)
+			stored.ID = "key-1"
+		}).
+		Return(stored, nil)
+
+	key, apiKey, err := userService.CreateAPIKey(context.Background(), "admin-1", " nightly export ", []string{"orders:read", "products:read", "orders:read"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "nightly export", apiKey.Name)
+	assert.Equal(t, []string{"orders:read", "products:read"}, apiKey.Scopes)
+	// Only the hash and the prefix are kept
+	assert.True(t, strings.HasPrefix(key, apiKey.Prefix+"_"))
+	assert.Equal(t, hashToken(key), stored.KeyHash)
+
+	apiKeyRepo.On("GetAPIKeyByHash", mock.Anything, hashToken(key)).Return(stored, nil)
+	apiKeyRepo.On("TouchAPIKey", mock.Anything, "key-1", mock.AnythingOfType("time.Time")).Return(nil)
+
+	p, err := userService.AuthenticateAPIKey(context.Background(), key)
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", p.APIKeyID)
+	assert.True(t, p.IsAPIKey())
+	assert.Empty(t, p.Roles)
+	assert.True(t, p.HasScope("orders:read"))
+	assert.False(t, p.HasScope("orders:write"))
+}
+
+func TestUserService_CreateAPIKey_RejectsUnknownScope(t *testing.T) {
+	userService, _, _ := newTestUserService(new(MockUserRepository), new(MockSessionRepository))
+
+	_, _, err := userService.CreateAPIKey(context.Background(), "admin-1", "partner", []string{"orders:delete"}, nil)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	_, _, err = userService.CreateAPIKey(context.Background(), "admin-1", "partner", nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	past := time.Now().Add(-time.Hour)
+	_, _, err = userService.CreateAPIKey(context.Background(), "admin-1", "partner", []string{"orders:read"}, &past)
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+}
+
+func TestUserService_AuthenticateAPIKey_RevokedOrExpired(t *testing.T) {
+	userService, _, _ := newTestUserService(new(MockUserRepository), new(MockSessionRepository))
+	apiKeyRepo := new(MockAPIKeyRepository)
+	userService.apiKeyRepo = apiKeyRepo
+
+	past := time.Now().Add(-time.Minute)
+	apiKeyRepo.On("GetAPIKeyByHash", mock.Anything, hashToken("mk_revoked_x")).
+		Return(&model.APIKey{ID: "key-1", Scopes: []string{"orders:read"}, RevokedAt: &past}, nil)
+	apiKeyRepo.On("GetAPIKeyByHash", mock.Anything, hashToken("mk_expired_x")).
+		Return(&model.APIKey{ID: "key-2", Scopes: []string{"orders:read"}, ExpiresAt: &past}, nil)
+	apiKeyRepo.On("GetAPIKeyByHash", mock.Anything, hashToken("mk_unknown_x")).
+		Return(nil, repository.ErrAPIKeyNotFound)
+
+	for _, key := range []string{"mk_revoked_x", "mk_expired_x", "mk_unknown_x", "not-a-key"} {
+		_, err := userService.AuthenticateAPIKey(context.Background(), key)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken, key)
+	}
+	apiKeyRepo.AssertNotCalled(t, "TouchAPIKey", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUserService_AddAddress_Normalizes(t *testing.T) {
+	userService, _, _ := newTestUserService(new(MockUserRepository), new(MockSessionRepository))
+	addressRepo := new(MockAddressRepository)
+	userService.addressRepo = addressRepo
+
+	addressRepo.On("AddAddress", mock.Anything, mock.MatchedBy(func(a *model.Address) bool {
+		return a.UserID == "user-1" && a.RecipientName == "Ada Lovelace" && a.CountryCode == "GB"
+	}), MaxAddressesPerUser).Return(&model.Address{ID: "addr-1", UserID: "user-1", IsDefault: true}, nil)
+
+	addr, err := userService.AddAddress(context.Background(), "user-1", &model.Address{
+		UserID: "someone-else", RecipientName: "  Ada Lovelace ", Line1: "12 St James's Sq",
+		City: "London", PostalCode: "SW1Y 4JH", CountryCode: " gb",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "addr-1", addr.ID)
+	addressRepo.AssertExpectations(t)
+}
+
+func TestUserService_AddAddress_Invalid(t *testing.T) {
+	userService, _, _ := newTestUserService(new(MockUserRepository), new(MockSessionRepository))
+	addressRepo := new(MockAddressRepository)
+	userService.addressRepo = addressRepo
+	valid := model.Address{RecipientName: "Ada", Line1: "1 Main St", City: "Springfield", PostalCode: "62701", CountryCode: "US"}
+
+	for name, edit := range map[string]func(*model.Address){
+		"missing city":     func(a *model.Address) { a.City = " " },
+		"country name":     func(a *model.Address) { a.CountryCode = "USA" },
+		"non-letter code":  func(a *model.Address) { a.CountryCode = "U1" },
+		"long postal code": func(a *model.Address) { a.PostalCode = strings.Repeat("9", 21) },
+	} {
+		addr := valid
+		edit(&addr)
+		_, err := userService.AddAddress(context.Background(), "user-1", &addr)
+		assert.ErrorIs(t, err, ErrInvalidAddress, name)
+	}
+	addressRepo.AssertNotCalled(t, "AddAddress", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUserService_AddAddress_TooMany(t *testing.T) {
+	userService, _, _ := newTestUserService(new(MockUserRepository), new(MockSessionRepository))
+	addressRepo := new(MockAddressRepository)
+	userService.addressRepo = addressRepo
+	addressRepo.On("AddAddress", mock.Anything, mock.Anything, MaxAddressesPerUser).Return(nil, repository.ErrTooManyAddresses)
+
+	_, err := userService.AddAddress(context.Background(), "user-1", &model.Address{
+		RecipientName: "Ada", Line1: "1 Main St", City: "Springfield", PostalCode: "62701", CountryCode: "US",
+	})
+
+	assert.ErrorIs(t, err, ErrTooManyAddresses)
+}
+
+// newDataRequestMocks replaces the data request repository and order client of userService
+// with fresh mocks. Created requests get ID "req-1".
+func newDataRequestMocks(userService *UserService) (*MockDataRequestRepository, *MockOrderClient) {
+	dataRequestRepo := new(MockDataRequestRepository)
+	dataRequestRepo.On("CreateDataRequest", mock.Anything, mock.Anything).Return("req-1", nil).Maybe()
+	orders := new(MockOrderClient)
+	userService.dataRequestRepo = dataRequestRepo
+	userService.orders = orders
+	return dataRequestRepo, orders
+}
+
+func TestUserService_RequestDataExport(t *testing.T) {
+	repo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(repo, new(MockSessionRepository))
+	addressRepo := new(MockAddressRepository)
+	userService.addressRepo = addressRepo
+	dataRequestRepo, orders := newDataRequestMocks(userService)
+
+	repo.On("GetUserByID", mock.Anything, "user-1").Return(&model.User{ID: "user-1", Email: "ada@example.com", PasswordHash: "secret-hash"}, nil)
+	addressRepo.On("ListAddresses", mock.Anything, "user-1").Return([]*model.Address{{ID: "addr-1", City: "London"}}, nil)
+	orders.On("ExportUserOrders", mock.Anything, &orderpb.ExportUserOrdersRequest{UserId: "user-1"}).Return(&orderpb.ExportUserOrdersResponse{
+		Orders: []*orderpb.Order{{
+			Id: "order-1", Status: "COMPLETED", TotalAmount: 20,
+			Items:           []*orderpb.OrderItem{{ProductId: "prod-1", Quantity: 2, PriceAtPurchase: 10}},
+			ShippingAddress: &orderpb.ShippingAddress{AddressId: "addr-1", City: "London", CountryCode: "GB"},
+		}},
+	}, nil)
+	dataRequestRepo.On("FinishDataRequest", mock.Anything, mock.MatchedBy(func(req *model.DataRequest) bool {
+		return req.Status == model.DataRequestCompleted && req.OrdersAffected == 1
+	})).Return(nil)
+
+	archive, req, err := userService.RequestDataExport(context.Background(), "user-1", "user-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", req.ID)
+	assert.Equal(t, model.DataRequestExport, req.Kind)
+	assert.Contains(t, string(archive), `"email": "ada@example.com"`)
+	assert.Contains(t, string(archive), `"product_id": "prod-1"`)
+	assert.Contains(t, string(archive), `"city": "London"`)
+	assert.NotContains(t, string(archive), "secret-hash")
+	dataRequestRepo.AssertExpectations(t)
+}
+
+func TestUserService_RequestDataExport_OrderServiceDown(t *testing.T) {
+	repo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(repo, new(MockSessionRepository))
+	addressRepo := new(MockAddressRepository)
+	userService.addressRepo = addressRepo
+	dataRequestRepo, orders := newDataRequestMocks(userService)
+
+	repo.On("GetUserByID", mock.Anything, "user-1").Return(&model.User{ID: "user-1"}, nil)
+	addressRepo.On("ListAddresses", mock.Anything, "user-1").Return([]*model.Address{}, nil)
+	orders.On("ExportUserOrders", mock.Anything, mock.Anything).Return(nil, status.Error(codes.Unavailable, "connection refused"))
+	dataRequestRepo.On("FinishDataRequest", mock.Anything, mock.MatchedBy(func(req *model.DataRequest) bool {
+		return req.Status == model.DataRequestFailed && strings.Contains(req.LastError, "connection refused")
+	})).Return(nil)
+
+	_, _, err := userService.RequestDataExport(context.Background(), "user-1", "user-1")
+
+	assert.ErrorIs(t, err, ErrDataRequestFailed)
+	dataRequestRepo.AssertExpectations(t)
+}
+
+func TestUserService_EraseUser(t *testing.T) {
+	repo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(repo, new(MockSessionRepository))
+	dataRequestRepo, orders := newDataRequestMocks(userService)
+
+	var pseudonym string
+	repo.On("IsUserDeleted", mock.Anything, "user-1").Return(false, nil)
+	dataRequestRepo.On("GetErasurePseudonym", mock.Anything, "user-1").Return("", nil)
+	repo.On("DeleteUser", mock.Anything, "user-1").Return(nil)
+	orders.On("EraseUserOrders", mock.Anything, mock.MatchedBy(func(in *orderpb.EraseUserOrdersRequest) bool {
+		pseudonym = in.Pseudonym
+		return in.UserId == "user-1" && in.Pseudonym != ""
+	})).Return(&orderpb.EraseUserOrdersResponse{OrdersPseudonymised: 3}, nil)
+	dataRequestRepo.On("FinishDataRequest", mock.Anything, mock.Anything).Return(nil)
+
+	req, err := userService.EraseUser(context.Background(), "user-1", "admin-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, model.DataRequestCompleted, req.Status)
+	assert.Equal(t, 3, req.OrdersAffected)
+	assert.Equal(t, "admin-1", req.RequestedBy)
+	assert.Equal(t, pseudonym, req.Pseudonym)
+}
+
+func TestUserService_EraseUser_RetryReusesPseudonym(t *testing.T) {
+	repo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(repo, new(MockSessionRepository))
+	dataRequestRepo, orders := newDataRequestMocks(userService)
+	const pseudonym = "5f0c6a0e-8d1b-4c3e-9a57-2f1e0b7c4d21"
+
+	// The user was deleted by the failed attempt, but their orders weren't pseudonymised
+	repo.On("IsUserDeleted", mock.Anything, "user-1").Return(true, nil)
+	dataRequestRepo.On("GetErasurePseudonym", mock.Anything, "user-1").Return(pseudonym, nil)
+	orders.On("EraseUserOrders", mock.Anything, &orderpb.EraseUserOrdersRequest{UserId: "user-1", Pseudonym: pseudonym}).
+		Return(&orderpb.EraseUserOrdersResponse{OrdersPseudonymised: 2}, nil)
+	dataRequestRepo.On("FinishDataRequest", mock.Anything, mock.Anything).Return(nil)
+
+	req, err := userService.EraseUser(context.Background(), "user-1", "user-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, model.DataRequestCompleted, req.Status)
+	orders.AssertExpectations(t)
+	repo.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything)
+}
+
+func TestUserService_EraseUser_UnknownUser(t *testing.T) {
+	repo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(repo, new(MockSessionRepository))
+	dataRequestRepo, orders := newDataRequestMocks(userService)
+
+	repo.On("IsUserDeleted", mock.Anything, "user-404").Return(false, repository.ErrUserNotFound)
+
+	_, err := userService.EraseUser(context.Background(), "user-404", "admin-1")
+
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	dataRequestRepo.AssertNotCalled(t, "CreateDataRequest", mock.Anything, mock.Anything)
+	orders.AssertNotCalled(t, "EraseUserOrders", mock.Anything, mock.Anything)
+}
+
+func TestUserService_EraseUser_LastAdmin(t *testing.T) {
+	repo := new(MockUserRepository)
+	userService, _, _ := newTestUserService(repo, new(MockSessionRepository))
+	dataRequestRepo, orders := newDataRequestMocks(userService)
+
+	repo.On("IsUserDeleted", mock.Anything, "admin-1").Return(false, nil)
+	dataRequestRepo.On("GetErasurePseudonym", mock.Anything, "admin-1").Return("", nil)
+	repo.On("DeleteUser", mock.Anything, "admin-1").Return(repository.ErrLastAdmin)
+	dataRequestRepo.On("FinishDataRequest", mock.Anything, mock.MatchedBy(func(req *model.DataRequest) bool {
+		return req.Status == model.DataRequestFailed
+	})).Return(nil)
+
+	_, err := userService.EraseUser(context.Background(), "admin-1", "admin-1")
+
+	assert.ErrorIs(t, err, ErrLastAdmin)
+	orders.AssertNotCalled(t, "EraseUserOrders", mock.Anything, mock.Anything)
+	dataRequestRepo.AssertExpectations(t)
+}
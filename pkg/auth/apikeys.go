@@ -0,0 +1,89 @@
+// pkg/auth/apikeys.go
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so they can be told apart from access and service tokens.
+const APIKeyPrefix = "mk_"
+
+// DefaultAPIKeyCacheTTL is how long services that check keys with the UserService remember a
+// valid key. A revoked key keeps working for at most this long.
+const DefaultAPIKeyCacheTTL = 30 * time.Second
+
+// maxCachedAPIKeys bounds the cache; it is emptied if that many keys are live at once.
+const maxCachedAPIKeys = 1024
+
+// IsAPIKey reports whether token looks like an API key.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// APIKeyValidator looks up an API key and returns the principal it stands for. Unknown,
+// revoked and expired keys are reported as ErrInvalidToken.
+type APIKeyValidator func(ctx context.Context, key string) (*Principal, error)
+
+// APIKeys authenticates API keys with a validator: the UserService itself, or a call to it
+// from other services. Valid keys are cached for a while so not every request needs a lookup.
+type APIKeys struct {
+	validate APIKeyValidator
+	ttl      time.Duration // Zero disables the cache
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	principal *Principal
+	expires   time.Time
+}
+
+// NewAPIKeys returns an authenticator that checks keys with validate and caches valid ones
+// for ttl.
+func NewAPIKeys(validate APIKeyValidator, ttl time.Duration) *APIKeys {
+	return &APIKeys{validate: validate, ttl: ttl, cache: make(map[[sha256.Size]byte]cachedAPIKey)}
+}
+
+func (a *APIKeys) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if !IsAPIKey(token) {
+		return nil, fmt.Errorf("%w: not an API key", ErrInvalidToken)
+	}
+	if a.ttl <= 0 {
+		return a.validate(ctx, token)
+	}
+
+	// Keyed by hash so the cache doesn't hold the keys themselves
+	id := sha256.Sum256([]byte(token))
+	now := time.Now()
+	a.mu.Lock()
+	cached, ok := a.cache[id]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.principal, nil
+	}
+
+	p, err := a.validate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.cache) >= maxCachedAPIKeys {
+		for key, entry := range a.cache {
+			if !now.Before(entry.expires) {
+				delete(a.cache, key)
+			}
+		}
+		if len(a.cache) >= maxCachedAPIKeys {
+			a.cache = make(map[[sha256.Size]byte]cachedAPIKey)
+		}
+	}
+	a.cache[id] = cachedAPIKey{principal: p, expires: now.Add(a.ttl)}
+	return p, nil
+}
@@ -0,0 +1,129 @@
+// pkg/auth/grpc.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationMetadata is the metadata key bearer tokens travel in (gRPC lowercases keys).
+const authorizationMetadata = "authorization"
+
+// alwaysPublic are method prefixes of infrastructure services that never need a token.
+var alwaysPublic = []string{"/grpc.reflection.", "/grpc.health."}
+
+// UnaryServerInterceptor authenticates unary calls. Methods listed in publicMethods (full
+// names, e.g. "/user.UserService/LoginUser") may be called without a token; a token that is
+// sent must still verify.
+func UnaryServerInterceptor(authn Authenticator, publicMethods ...string) grpc.UnaryServerInterceptor {
+	public := methodSet(publicMethods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticateIncoming(ctx, authn, info.FullMethod, public)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls.
+func StreamServerInterceptor(authn Authenticator, publicMethods ...string) grpc.StreamServerInterceptor {
+	public := methodSet(publicMethods)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticateIncoming(ss.Context(), authn, info.FullMethod, public)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// UnaryClientInterceptor forwards the caller's token on outgoing calls. Calls made outside
+// a request (no principal in the context) use serviceToken instead, if one is set, and so do
+// serviceMethods: internal RPCs that only services may call, whoever the request is for.
+func UnaryClientInterceptor(serviceToken string, serviceMethods ...string) grpc.UnaryClientInterceptor {
+	asService := methodSet(serviceMethods)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingContext(ctx, serviceToken, asService[method]), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor is UnaryClientInterceptor for streaming calls.
+func StreamClientInterceptor(serviceToken string, serviceMethods ...string) grpc.StreamClientInterceptor {
+	asService := methodSet(serviceMethods)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingContext(ctx, serviceToken, asService[method]), desc, cc, method, opts...)
+	}
+}
+
+func authenticateIncoming(ctx context.Context, authn Authenticator, method string, public map[string]bool) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(authorizationMetadata); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	token, err := bearerToken(header)
+	if errors.Is(err, ErrMissingToken) {
+		if public[method] || isAlwaysPublic(method) {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if err == nil {
+		var p *Principal
+		if p, err = authn.Authenticate(ctx, token); err == nil {
+			return NewContext(ctx, p), nil
+		}
+	}
+	log.Printf("Rejected call to %s: %v", method, err)
+	return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+}
+
+// outgoingContext picks the token for an outgoing call. API keys aren't forwarded: their scope
+// was checked here, and what the call does on their behalf is done as this service.
+func outgoingContext(ctx context.Context, serviceToken string, asService bool) context.Context {
+	token := serviceToken
+	if p, ok := FromContext(ctx); ok && p.Token != "" && !asService && !p.IsAPIKey() {
+		token = p.Token
+	}
+	if token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, authorizationMetadata, "Bearer "+token)
+}
+
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		set[method] = true
+	}
+	return set
+}
+
+func isAlwaysPublic(method string) bool {
+	for _, prefix := range alwaysPublic {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticatedStream swaps in the context that carries the principal.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
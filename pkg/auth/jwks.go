@@ -0,0 +1,84 @@
+// pkg/auth/jwks.go
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+// JWKSPath is where the user service publishes its public keys.
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWK is a JSON Web Key (RFC 7517). Only RSA signing keys are published; HS256 secrets
+// are shared out of band and never leave the services that hold them.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set document.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every RS256 key in the set, including inactive ones, so
+// tokens signed before a rotation keep verifying until they expire.
+func (s *KeySet) JWKS() JWKS {
+	doc := JWKS{Keys: []JWK{}}
+	for _, key := range s.publicKeys() {
+		doc.Keys = append(doc.Keys, JWK{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: AlgRS256,
+			KeyID:     key.ID,
+			N:         base64.RawURLEncoding.EncodeToString(key.public.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.public.E)).Bytes()),
+		})
+	}
+	return doc
+}
+
+// ServeJWKS serves the key set's JWKS document.
+func (s *KeySet) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(s.JWKS()); err != nil {
+		http.Error(w, "failed to encode JWKS", http.StatusInternalServerError)
+	}
+}
+
+// KeySetFromJWKS builds a verification-only key set from a JWKS document.
+// Keys of a type or algorithm we don't use are skipped.
+func KeySetFromJWKS(doc JWKS) (*KeySet, error) {
+	var keys []*Key
+	for _, jwk := range doc.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Algorithm != "" && jwk.Algorithm != AlgRS256) || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid modulus: %w", jwk.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid exponent: %w", jwk.KeyID, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %q: unsupported exponent", jwk.KeyID)
+		}
+		keys = append(keys, NewRS256PublicKey(jwk.KeyID, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}))
+	}
+	return NewKeySet("", keys...)
+}
@@ -0,0 +1,128 @@
+// pkg/auth/jwks_client.go
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksCacheTTL is how long a fetched JWKS is used before it is fetched again.
+	jwksCacheTTL = 10 * time.Minute
+	// jwksMinRefreshInterval limits refetches triggered by unknown kids, so a flood of
+	// forged tokens can't turn into a flood of requests to the user service.
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+// JWKSClient is a KeySource backed by a remote JWKS document. Keys are fetched on first use,
+// cached, and refetched when a token names a kid we haven't seen (i.e. after a rotation).
+type JWKSClient struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      *KeySet
+	fetchedAt time.Time
+}
+
+func NewJWKSClient(url string) *JWKSClient {
+	return &JWKSClient{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Lookup returns the key with the given kid, fetching the JWKS if needed.
+func (c *JWKSClient) Lookup(id string) (*Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	age := time.Since(c.fetchedAt)
+	if c.keys != nil && age < jwksCacheTTL {
+		if key, err := c.keys.Lookup(id); err == nil {
+			return key, nil
+		}
+	}
+	if c.keys == nil || age >= jwksMinRefreshInterval {
+		if err := c.refresh(); err != nil {
+			log.Printf("Error fetching JWKS from %s: %v", c.url, err)
+			// Keep verifying with the keys we have until the user service is back
+			if c.keys == nil {
+				return nil, err
+			}
+		}
+	}
+	return c.keys.Lookup(id)
+}
+
+// refresh fetches the JWKS document. The caller holds c.mu.
+func (c *JWKSClient) refresh() error {
+	c.fetchedAt = time.Now() // Also on failure, so an outage doesn't mean a request per token
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var doc JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+	keys, err := KeySetFromJWKS(doc)
+	if err != nil {
+		return err
+	}
+	c.keys = keys
+	return nil
+}
+
+// keySources looks a kid up in each source in turn.
+type keySources []KeySource
+
+func (s keySources) Lookup(id string) (*Key, error) {
+	err := fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	for _, source := range s {
+		key, lookupErr := source.Lookup(id)
+		if lookupErr == nil {
+			return key, nil
+		}
+		if !errors.Is(lookupErr, ErrUnknownKey) {
+			err = lookupErr
+		}
+	}
+	return nil, err
+}
+
+// KeySourceFromEnv returns the keys a service that verifies tokens but doesn't issue them
+// should trust: the user service's JWKS at JWT_JWKS_URL (defaultJWKSURL if unset), plus any
+// HS256 secrets shared through JWT_HS256_KEYS, since those are never published.
+func KeySourceFromEnv(defaultJWKSURL string) (KeySource, error) {
+	url := os.Getenv("JWT_JWKS_URL")
+	if url == "" {
+		url = defaultJWKSURL
+	}
+	sources := keySources{NewJWKSClient(url)}
+
+	hsPairs, err := parseKeyPairs(os.Getenv("JWT_HS256_KEYS"))
+	if err != nil {
+		return nil, fmt.Errorf("JWT_HS256_KEYS: %w", err)
+	}
+	if len(hsPairs) > 0 {
+		var keys []*Key
+		for _, pair := range hsPairs {
+			keys = append(keys, NewHS256Key(pair[0], []byte(pair[1])))
+		}
+		shared, err := NewKeySet("", keys...)
+		if err != nil {
+			return nil, err
+		}
+		// Shared secrets first: they are local, the JWKS may need a round trip
+		sources = append(keySources{shared}, sources...)
+	}
+	return sources, nil
+}
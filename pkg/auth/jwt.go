@@ -0,0 +1,160 @@
+// pkg/auth/jwt.go
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Defaults used when the JWT_* environment variables are not set.
+const (
+	DefaultIssuer   = "microservices-project/userservice"
+	DefaultAudience = "microservices-project"
+	DefaultTokenTTL = 15 * time.Minute // Short, since logging out only revokes refresh tokens
+)
+
+// clockSkew is how far apart the issuer's and verifier's clocks may drift.
+const clockSkew = 30 * time.Second
+
+// Claims are the claims carried by our access tokens. The subject is the user ID.
+type Claims struct {
+	jwt.RegisteredClaims
+	Email    string   `json:"email,omitempty"`
+	Username string   `json:"preferred_username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// UserID returns the subject of the token.
+func (c *Claims) UserID() string {
+	return c.Subject
+}
+
+// Config holds what both ends of a token need to agree on.
+type Config struct {
+	Issuer   string
+	Audience string
+	TTL      time.Duration // Only used by the issuer
+}
+
+// ConfigFromEnv reads JWT_ISSUER, JWT_AUDIENCE and JWT_EXPIRY (a Go duration, e.g. "15m").
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Issuer: DefaultIssuer, Audience: DefaultAudience, TTL: DefaultTokenTTL}
+	if value := os.Getenv("JWT_ISSUER"); value != "" {
+		cfg.Issuer = value
+	}
+	if value := os.Getenv("JWT_AUDIENCE"); value != "" {
+		cfg.Audience = value
+	}
+	if value := os.Getenv("JWT_EXPIRY"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return cfg, fmt.Errorf("invalid JWT_EXPIRY %q", value)
+		}
+		cfg.TTL = ttl
+	}
+	return cfg, nil
+}
+
+// Issuer signs access tokens with the active key of its key set.
+type Issuer struct {
+	keys *KeySet
+	cfg  Config
+	now  func() time.Time
+}
+
+func NewIssuer(keys *KeySet, cfg Config) *Issuer {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTokenTTL
+	}
+	return &Issuer{keys: keys, cfg: cfg, now: time.Now}
+}
+
+// Issue signs a token for claims, filling in the registered claims (iss, aud, exp, ...).
+// Only the subject and the custom claims need to be set by the caller.
+func (i *Issuer) Issue(claims Claims) (string, time.Time, error) {
+	key, err := i.keys.Active()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	signingKey, err := key.signingKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := i.now()
+	expiresAt := now.Add(i.cfg.TTL)
+	claims.Issuer = i.cfg.Issuer
+	claims.Audience = jwt.ClaimStrings{i.cfg.Audience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	claims.ID = uuid.New().String()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// KeySource finds the key for a kid. *KeySet is one; a JWKS client that refreshes on
+// unknown kids is another.
+type KeySource interface {
+	Lookup(id string) (*Key, error)
+}
+
+// Verifier checks tokens signed by any key its key source knows about.
+type Verifier struct {
+	keys KeySource
+	cfg  Config
+}
+
+func NewVerifier(keys KeySource, cfg Config) *Verifier {
+	return &Verifier{keys: keys, cfg: cfg}
+}
+
+// Verify checks the signature, issuer, audience and lifetime of a token and returns its claims.
+// Every failure is reported as ErrInvalidToken, wrapping the reason.
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, v.keyFunc,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256}),
+		jwt.WithIssuer(v.cfg.Issuer),
+		jwt.WithAudience(v.cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+	key, err := v.keys.Lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	// The kid decides the algorithm, never the token: otherwise an RS256 public key could be
+	// passed off as an HS256 secret.
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("token algorithm %s does not match key %q (%s)", token.Method.Alg(), kid, key.Algorithm)
+	}
+	return key.verificationKey(), nil
+}
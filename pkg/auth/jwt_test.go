@@ -0,0 +1,174 @@
+// pkg/auth/jwt_test.go
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{Issuer: "test-issuer", Audience: "test-audience", TTL: time.Minute}
+
+func newRSAKey(t *testing.T, id string) *Key {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return NewRS256Key(id, private)
+}
+
+func userClaims() Claims {
+	return Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}, Email: "a@example.com", Username: "alice"}
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	for _, key := range []*Key{NewHS256Key("hs-1", []byte("secret")), newRSAKey(t, "rs-1")} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			keys, err := NewKeySet(key.ID, key)
+			require.NoError(t, err)
+
+			token, expiresAt, err := NewIssuer(keys, testConfig).Issue(userClaims())
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, 5*time.Second)
+
+			claims, err := NewVerifier(keys, testConfig).Verify(token)
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims.UserID())
+			assert.Equal(t, "alice", claims.Username)
+			assert.NotEmpty(t, claims.ID)
+		})
+	}
+}
+
+func TestVerify_OldKeyStillValidAfterRotation(t *testing.T) {
+	oldKey, newKey := NewHS256Key("2024-01", []byte("old")), NewHS256Key("2024-02", []byte("new"))
+	before, err := NewKeySet(oldKey.ID, oldKey)
+	require.NoError(t, err)
+	token, _, err := NewIssuer(before, testConfig).Issue(userClaims())
+	require.NoError(t, err)
+
+	after, err := NewKeySet(newKey.ID, oldKey, newKey)
+	require.NoError(t, err)
+	_, err = NewVerifier(after, testConfig).Verify(token)
+	assert.NoError(t, err)
+
+	// Once the old key is retired its tokens stop verifying
+	retired, err := NewKeySet(newKey.ID, newKey)
+	require.NoError(t, err)
+	_, err = NewVerifier(retired, testConfig).Verify(token)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	key := NewHS256Key("hs-1", []byte("secret"))
+	keys, err := NewKeySet(key.ID, key)
+	require.NoError(t, err)
+	token, _, err := NewIssuer(keys, testConfig).Issue(userClaims())
+	require.NoError(t, err)
+
+	expiredIssuer := NewIssuer(keys, testConfig)
+	expiredIssuer.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	expired, _, err := expiredIssuer.Issue(userClaims())
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		token string
+		cfg   Config
+	}{
+		"wrong audience": {token, Config{Issuer: testConfig.Issuer, Audience: "someone-else"}},
+		"wrong issuer":   {token, Config{Issuer: "someone-else", Audience: testConfig.Audience}},
+		"expired":        {expired, testConfig},
+		"tampered":       {tamper(token), testConfig},
+		"garbage":        {"not-a-token", testConfig},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewVerifier(keys, tc.cfg).Verify(tc.token)
+			assert.True(t, errors.Is(err, ErrInvalidToken), "got %v", err)
+		})
+	}
+}
+
+func TestVerify_RejectsAlgorithmConfusion(t *testing.T) {
+	// An attacker signs an HS256 token using the (public) RSA key as the HMAC secret
+	rsKey := newRSAKey(t, "rs-1")
+	keys, err := NewKeySet(rsKey.ID, rsKey)
+	require.NoError(t, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPublic(t, rsKey.public)})
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject: "admin", Issuer: testConfig.Issuer, Audience: jwt.ClaimStrings{testConfig.Audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	forged.Header["kid"] = rsKey.ID
+	signed, err := forged.SignedString(publicPEM)
+	require.NoError(t, err)
+
+	_, err = NewVerifier(keys, testConfig).Verify(signed)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+}
+
+func TestJWKS_VerifiesOffline(t *testing.T) {
+	hsKey, rsKey := NewHS256Key("hs-1", []byte("secret")), newRSAKey(t, "rs-1")
+	keys, err := NewKeySet(rsKey.ID, hsKey, rsKey)
+	require.NoError(t, err)
+	token, _, err := NewIssuer(keys, testConfig).Issue(userClaims())
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	keys.ServeJWKS(rec, httptest.NewRequest("GET", JWKSPath, nil))
+	var doc JWKS
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	require.Len(t, doc.Keys, 1, "HS256 secrets must never be published")
+	assert.Equal(t, "rs-1", doc.Keys[0].KeyID)
+
+	published, err := KeySetFromJWKS(doc)
+	require.NoError(t, err)
+	claims, err := NewVerifier(published, testConfig).Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID())
+}
+
+func TestKeySetFromEnv(t *testing.T) {
+	t.Setenv("JWT_HS256_KEYS", "a=one, b=two")
+	t.Setenv("JWT_RS256_KEY_FILES", "")
+	t.Setenv("JWT_ACTIVE_KID", "")
+	_, err := KeySetFromEnv()
+	assert.Error(t, err, "two keys and no active kid is ambiguous")
+
+	t.Setenv("JWT_ACTIVE_KID", "b")
+	keys, err := KeySetFromEnv()
+	require.NoError(t, err)
+	active, err := keys.Active()
+	require.NoError(t, err)
+	assert.Equal(t, "b", active.ID)
+
+	t.Setenv("JWT_ACTIVE_KID", "missing")
+	_, err = KeySetFromEnv()
+	assert.True(t, errors.Is(err, ErrUnknownKey))
+}
+
+// tamper flips the first character of the signature. (The last one may only carry padding bits.)
+func tamper(token string) string {
+	i := strings.LastIndex(token, ".") + 1
+	replacement := "A"
+	if token[i] == 'A' {
+		replacement = "B"
+	}
+	return token[:i] + replacement + token[i+1:]
+}
+
+func mustMarshalPublic(t *testing.T, public *rsa.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	return der
+}
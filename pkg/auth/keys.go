@@ -0,0 +1,225 @@
+// pkg/auth/keys.go
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is one signing or verification key, identified by the kid header of the tokens it signs.
+// HS256 keys hold a shared secret; RS256 keys hold a public key and, on the issuer, the private key.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   *rsa.PrivateKey
+	public    *rsa.PublicKey
+}
+
+func NewHS256Key(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: AlgHS256, secret: secret}
+}
+
+func NewRS256Key(id string, private *rsa.PrivateKey) *Key {
+	return &Key{ID: id, Algorithm: AlgRS256, private: private, public: &private.PublicKey}
+}
+
+// NewRS256PublicKey is a verification-only key, e.g. one read from a JWKS document.
+func NewRS256PublicKey(id string, public *rsa.PublicKey) *Key {
+	return &Key{ID: id, Algorithm: AlgRS256, public: public}
+}
+
+// signingKey returns what jwt needs to sign with this key.
+func (k *Key) signingKey() (interface{}, error) {
+	switch {
+	case k.Algorithm == AlgHS256:
+		return k.secret, nil
+	case k.Algorithm == AlgRS256 && k.private != nil:
+		return k.private, nil
+	}
+	return nil, fmt.Errorf("key %q cannot sign", k.ID)
+}
+
+// verificationKey returns what jwt needs to verify a signature made with this key.
+func (k *Key) verificationKey() interface{} {
+	if k.Algorithm == AlgHS256 {
+		return k.secret
+	}
+	return k.public
+}
+
+// KeySet holds every key tokens may be verified with, plus the one new tokens are signed with.
+// Rotating keys is a matter of adding the new key, making it active, and dropping the old one
+// once every token it signed has expired.
+type KeySet struct {
+	keys   map[string]*Key
+	active string
+}
+
+// NewKeySet builds a key set. active names the signing key; it may be empty for a
+// verification-only set.
+func NewKeySet(active string, keys ...*Key) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key, len(keys)), active: active}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing keys must have an ID")
+		}
+		if _, dup := set.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate signing key ID %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+	if active != "" {
+		if _, ok := set.keys[active]; !ok {
+			return nil, fmt.Errorf("%w: active key %q is not in the key set", ErrUnknownKey, active)
+		}
+	}
+	return set, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (s *KeySet) Active() (*Key, error) {
+	if s.active == "" {
+		return nil, fmt.Errorf("%w: key set has no active signing key", ErrUnknownKey)
+	}
+	return s.keys[s.active], nil
+}
+
+// Lookup returns the key with the given kid.
+func (s *KeySet) Lookup(id string) (*Key, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// publicKeys returns the RS256 keys, sorted by ID so the JWKS document is stable.
+func (s *KeySet) publicKeys() []*Key {
+	var keys []*Key
+	for _, key := range s.keys {
+		if key.Algorithm == AlgRS256 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// ParseRSAPrivateKeyPEM reads a PKCS#1 ("RSA PRIVATE KEY") or PKCS#8 ("PRIVATE KEY") PEM block.
+func ParseRSAPrivateKeyPEM(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// KeySetFromEnv builds the issuer's key set from the environment:
+//
+//	JWT_HS256_KEYS      comma-separated kid=secret pairs
+//	JWT_RS256_KEY_FILES comma-separated kid=/path/to/private.pem pairs
+//	JWT_ACTIVE_KID      the kid to sign with (defaults to the only key, if there is just one)
+//
+// If no keys are configured a random RS256 key is generated. That works for a single
+// instance (and still publishes a JWKS), but tokens do not survive a restart.
+func KeySetFromEnv() (*KeySet, error) {
+	var keys []*Key
+
+	hsPairs, err := parseKeyPairs(os.Getenv("JWT_HS256_KEYS"))
+	if err != nil {
+		return nil, fmt.Errorf("JWT_HS256_KEYS: %w", err)
+	}
+	for _, pair := range hsPairs {
+		keys = append(keys, NewHS256Key(pair[0], []byte(pair[1])))
+	}
+
+	rsPairs, err := parseKeyPairs(os.Getenv("JWT_RS256_KEY_FILES"))
+	if err != nil {
+		return nil, fmt.Errorf("JWT_RS256_KEY_FILES: %w", err)
+	}
+	for _, pair := range rsPairs {
+		data, err := os.ReadFile(pair[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key %q: %w", pair[0], err)
+		}
+		private, err := ParseRSAPrivateKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", pair[0], err)
+		}
+		keys = append(keys, NewRS256Key(pair[0], private))
+	}
+
+	active := os.Getenv("JWT_ACTIVE_KID")
+	switch {
+	case len(keys) == 0:
+		log.Println("No JWT signing keys configured; using a random RS256 key (tokens will not survive restarts or work across replicas)")
+		key, err := generateRS256Key()
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet(key.ID, key)
+	case active == "" && len(keys) == 1:
+		active = keys[0].ID
+	case active == "":
+		return nil, errors.New("JWT_ACTIVE_KID must be set when more than one signing key is configured")
+	}
+	return NewKeySet(active, keys...)
+}
+
+func generateRS256Key() (*Key, error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	return NewRS256Key("dev-"+hex.EncodeToString(id), private), nil
+}
+
+// parseKeyPairs splits "a=1,b=2" into [[a 1] [b 2]].
+func parseKeyPairs(value string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, "=")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("expected kid=value, got %q", entry)
+		}
+		pairs = append(pairs, [2]string{id, secret})
+	}
+	return pairs, nil
+}
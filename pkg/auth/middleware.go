@@ -0,0 +1,54 @@
+// pkg/auth/middleware.go
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Middleware authenticates requests that carry an Authorization header and stores the
+// principal in the request context. Requests without one pass through anonymously; routes
+// that need a caller add RequireAuthentication. A header that doesn't verify is rejected
+// with 401 either way, so a client with an expired token finds out immediately.
+func Middleware(authn Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := bearerToken(r.Header.Get("Authorization"))
+			if errors.Is(err, ErrMissingToken) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err == nil {
+				var p *Principal
+				if p, err = authn.Authenticate(r.Context(), token); err == nil {
+					next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+					return
+				}
+			}
+			log.Printf("Rejected request to %s: %v", r.URL.Path, err)
+			writeError(w, http.StatusUnauthorized, "invalid or expired token")
+		})
+	}
+}
+
+// RequireAuthentication rejects requests that Middleware didn't authenticate.
+func RequireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := FromContext(r.Context()); !ok {
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,274 @@
+// pkg/auth/middleware_test.go
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestAuthenticator(t *testing.T) (Authenticator, string) {
+	key := NewHS256Key("hs-1", []byte("secret"))
+	keys, err := NewKeySet(key.ID, key)
+	require.NoError(t, err)
+	token, _, err := NewIssuer(keys, testConfig).Issue(userClaims())
+	require.NoError(t, err)
+	return Authenticators{ServiceTokens{"svc-token": "orderservice"}, NewVerifier(keys, testConfig)}, token
+}
+
+func TestMiddleware(t *testing.T) {
+	authn, token := newTestAuthenticator(t)
+	var seen *Principal
+	protected := Middleware(authn)(RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+	})))
+
+	tests := map[string]struct {
+		header string
+		want   int
+		userID string
+	}{
+		"user token":    {"Bearer " + token, http.StatusOK, "user-1"},
+		"service token": {"Bearer svc-token", http.StatusOK, ""},
+		"no token":      {"", http.StatusUnauthorized, ""},
+		"bad token":     {"Bearer nope", http.StatusUnauthorized, ""},
+		"basic auth":    {"Basic dXNlcjpwYXNz", http.StatusUnauthorized, ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest("GET", "/orders", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			protected.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want, rec.Code)
+			if tc.want == http.StatusOK {
+				require.NotNil(t, seen)
+				assert.Equal(t, tc.userID, seen.UserID)
+			}
+		})
+	}
+}
+
+func TestMiddleware_AnonymousOnPublicRoutes(t *testing.T) {
+	authn, _ := newTestAuthenticator(t)
+	public := Middleware(authn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	public.ServeHTTP(rec, httptest.NewRequest("GET", "/products", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	authn, token := newTestAuthenticator(t)
+	interceptor := UnaryServerInterceptor(authn, "/user.UserService/LoginUser")
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		p, _ := FromContext(ctx)
+		return p, nil
+	}
+	call := func(method, authorization string) (*Principal, error) {
+		ctx := context.Background()
+		if authorization != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+		}
+		resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		if err != nil {
+			return nil, err
+		}
+		return resp.(*Principal), nil
+	}
+
+	p, err := call("/user.UserService/GetUser", "Bearer "+token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", p.UserID)
+
+	_, err = call("/user.UserService/GetUser", "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Public methods work without a token, but not with a bad one
+	p, err = call("/user.UserService/LoginUser", "")
+	require.NoError(t, err)
+	assert.Nil(t, p)
+	_, err = call("/user.UserService/LoginUser", "Bearer nope")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = call("/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", "")
+	assert.NoError(t, err)
+}
+
+func TestUnaryClientInterceptor_ForwardsToken(t *testing.T) {
+	interceptor := UnaryClientInterceptor("svc-token", "/product.ProductService/ReserveStock")
+	var sent []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = md.Get("authorization")
+		return nil
+	}
+
+	ctx := NewContext(context.Background(), &Principal{UserID: "user-1", Token: "user-token"})
+	require.NoError(t, interceptor(ctx, "/product.ProductService/BatchGetProducts", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"Bearer user-token"}, sent)
+
+	// Without a caller (background work) the service token is used
+	require.NoError(t, interceptor(context.Background(), "/product.ProductService/BatchGetProducts", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"Bearer svc-token"}, sent)
+
+	// Internal RPCs always go out as the service
+	require.NoError(t, interceptor(ctx, "/product.ProductService/ReserveStock", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"Bearer svc-token"}, sent)
+}
+
+func TestUnaryClientInterceptor_DoesNotForwardAPIKeys(t *testing.T) {
+	interceptor := UnaryClientInterceptor("svc-token")
+	var sent []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = md.Get("authorization")
+		return nil
+	}
+
+	ctx := NewContext(context.Background(), &Principal{APIKeyID: "key-1", Token: "mk_abc_secret"})
+	require.NoError(t, interceptor(ctx, "/user.UserService/GetUser", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"Bearer svc-token"}, sent)
+}
+
+func TestAPIKeys_CachesValidKeys(t *testing.T) {
+	lookups := 0
+	keys := NewAPIKeys(func(ctx context.Context, key string) (*Principal, error) {
+		lookups++
+		if key != "mk_abc_secret" {
+			return nil, ErrInvalidToken
+		}
+		return &Principal{APIKeyID: "key-1", Scopes: []string{ScopeOrdersRead}, Token: key}, nil
+	}, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		p, err := keys.Authenticate(context.Background(), "mk_abc_secret")
+		require.NoError(t, err)
+		assert.Equal(t, "key-1", p.APIKeyID)
+	}
+	assert.Equal(t, 1, lookups)
+
+	_, err := keys.Authenticate(context.Background(), "mk_abc_wrong")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Other tokens aren't looked up at all
+	_, err = keys.Authenticate(context.Background(), "eyJhbGciOi")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, 2, lookups)
+}
+
+func TestUnaryScopeInterceptor(t *testing.T) {
+	interceptor := UnaryScopeInterceptor(MethodScopes{"/order.OrderService/GetOrder": ScopeOrdersRead})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if err := CheckUser(ctx, "user-1"); err != nil {
+			return nil, StatusError(err)
+		}
+		return nil, nil
+	}
+	call := func(method string, p *Principal) error {
+		_, err := interceptor(NewContext(context.Background(), p), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	key := &Principal{APIKeyID: "key-1", Scopes: []string{ScopeOrdersRead, ScopeUsersImpersonate}}
+
+	assert.NoError(t, call("/order.OrderService/GetOrder", key))
+	// A key without the scope, or calling a method no scope covers, gets no further
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/order.OrderService/GetOrder", &Principal{APIKeyID: "key-2", Scopes: []string{ScopeProductsRead, ScopeUsersImpersonate}})))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/order.OrderService/ListUserOrders", key)))
+	// Users are left to the handlers' own checks
+	assert.NoError(t, call("/order.OrderService/ListUserOrders", &Principal{UserID: "user-1", Roles: []string{RoleCustomer}}))
+}
+
+func TestCheckUser_APIKeyNeedsImpersonateScope(t *testing.T) {
+	tests := map[string]struct {
+		scopes  []string
+		wantErr bool
+	}{
+		"call scope only":              {[]string{ScopeOrdersRead}, true},
+		"call scope and impersonation": {[]string{ScopeOrdersRead, ScopeUsersImpersonate}, false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, err := grantScope(NewContext(context.Background(), &Principal{APIKeyID: "key-1", Scopes: tc.scopes}), ScopeOrdersRead)
+			require.NoError(t, err)
+
+			// The call's own scope still stands in for a role either way
+			assert.NoError(t, CheckRole(ctx, RoleAdmin))
+			if err := CheckUser(ctx, "user-1"); tc.wantErr {
+				assert.ErrorIs(t, err, ErrForbidden)
+				assert.Contains(t, err.Error(), ScopeUsersImpersonate)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// Impersonation alone opens nothing: the call's scope is checked first
+	_, err := grantScope(NewContext(context.Background(), &Principal{APIKeyID: "key-1", Scopes: []string{ScopeUsersImpersonate}}), ScopeOrdersRead)
+	assert.ErrorIs(t, err, ErrForbidden)
+	// And a key whose scope wasn't checked for the call is nobody's user
+	assert.ErrorIs(t, CheckUser(NewContext(context.Background(), &Principal{APIKeyID: "key-1", Scopes: []string{ScopeUsersImpersonate}}), "user-1"), ErrForbidden)
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(ScopeProductsWrite)(RequireRole(RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	tests := map[string]struct {
+		principal *Principal
+		want      int
+	}{
+		"key with scope":    {&Principal{APIKeyID: "key-1", Scopes: []string{ScopeProductsWrite}}, http.StatusOK},
+		"key without scope": {&Principal{APIKeyID: "key-1", Scopes: []string{ScopeProductsRead}}, http.StatusForbidden},
+		"admin":             {&Principal{UserID: "user-1", Roles: []string{RoleAdmin}}, http.StatusOK},
+		"customer":          {&Principal{UserID: "user-2", Roles: []string{RoleCustomer}}, http.StatusForbidden},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/products", nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req.WithContext(NewContext(req.Context(), tc.principal)))
+			assert.Equal(t, tc.want, rec.Code)
+		})
+	}
+}
+
+func TestJWKSClient_RefetchesOnUnknownKid(t *testing.T) {
+	first, second := newRSAKey(t, "rs-1"), newRSAKey(t, "rs-2")
+	published, err := NewKeySet(first.ID, first)
+	require.NoError(t, err)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		published.ServeJWKS(w, r)
+	}))
+	defer server.Close()
+
+	client := NewJWKSClient(server.URL)
+	_, err = client.Lookup("rs-1")
+	require.NoError(t, err)
+	_, err = client.Lookup("rs-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetches, "known kids are served from the cache")
+
+	// After a rotation the new kid shows up once the refresh interval has passed
+	published, err = NewKeySet(second.ID, first, second)
+	require.NoError(t, err)
+	_, err = client.Lookup("rs-2")
+	assert.ErrorIs(t, err, ErrUnknownKey, "refetches are rate limited")
+	client.fetchedAt = client.fetchedAt.Add(-jwksMinRefreshInterval)
+	_, err = client.Lookup("rs-2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetches)
+}
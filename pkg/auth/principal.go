@@ -0,0 +1,120 @@
+// pkg/auth/principal.go
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrMissingToken = errors.New("missing bearer token")
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID   string // Empty for service principals
+	Email    string
+	Username string
+	Service  string // Name of the calling service, for service tokens, or of the API key
+	Roles    []string
+	Token    string // The credential the caller presented, forwarded on downstream calls
+
+	// API key callers have no roles; they may only use the RPCs and routes their scopes
+	// cover (see MethodScopes and RequireScope).
+	APIKeyID string
+	Scopes   []string
+
+	scopeGranted bool // Set for this call once an API key's scope has been checked
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx by the middleware or interceptors.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticator turns a bearer token into a principal. Tokens it doesn't accept are
+// reported as ErrInvalidToken.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Authenticate makes the verifier an Authenticator for access tokens.
+func (v *Verifier) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	roles := claims.Roles
+	if len(roles) == 0 {
+		roles = []string{RoleCustomer} // Tokens issued before roles existed
+	}
+	return &Principal{UserID: claims.UserID(), Email: claims.Email, Username: claims.Username, Roles: roles, Token: token}, nil
+}
+
+// ServiceTokens authenticates our own services by pre-shared token, so background work
+// that has no user behind it (saga recovery, for one) can still call other services.
+// It maps each token to the name of the service holding it.
+type ServiceTokens map[string]string
+
+// ServiceTokensFromEnv reads SERVICE_TOKENS, comma-separated name=token pairs.
+func ServiceTokensFromEnv() (ServiceTokens, error) {
+	pairs, err := parseKeyPairs(os.Getenv("SERVICE_TOKENS"))
+	if err != nil {
+		return nil, fmt.Errorf("SERVICE_TOKENS: %w", err)
+	}
+	tokens := make(ServiceTokens, len(pairs))
+	for _, pair := range pairs {
+		tokens[pair[1]] = pair[0]
+	}
+	return tokens, nil
+}
+
+func (s ServiceTokens) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	// Compare against every token so timing doesn't reveal how close a guess was
+	var service string
+	for known, name := range s {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			service = name
+		}
+	}
+	if service == "" {
+		return nil, fmt.Errorf("%w: unknown service token", ErrInvalidToken)
+	}
+	return &Principal{Service: service, Roles: []string{RoleService}, Token: token}, nil
+}
+
+// Authenticators tries each authenticator in turn and returns the first principal.
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	err := fmt.Errorf("%w: no authenticator configured", ErrInvalidToken)
+	for _, authn := range a {
+		var p *Principal
+		if p, err = authn.Authenticate(ctx, token); err == nil {
+			return p, nil
+		}
+	}
+	return nil, err
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" value.
+func bearerToken(header string) (string, error) {
+	if header == "" {
+		return "", ErrMissingToken
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", fmt.Errorf("%w: expected a Bearer authorization header", ErrInvalidToken)
+	}
+	return strings.TrimSpace(token), nil
+}
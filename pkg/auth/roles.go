@@ -0,0 +1,118 @@
+// pkg/auth/roles.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Roles carried in access tokens. Every user is a customer; admins are appointed through
+// UserService.AssignRole. The service role is held by our own services (see ServiceTokens)
+// and is never issued to users.
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+	RoleService  = "service"
+)
+
+var ErrForbidden = errors.New("permission denied")
+
+// IsValidUserRole reports whether role can be given to a user.
+func IsValidUserRole(role string) bool {
+	return role == RoleCustomer || role == RoleAdmin
+}
+
+// HasRole reports whether the principal holds role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRole returns nil if the caller in ctx holds one of roles, ErrMissingToken if there is
+// no caller, and ErrForbidden otherwise. API keys pass if their scope was checked for the call.
+func CheckRole(ctx context.Context, roles ...string) error {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return ErrMissingToken
+	}
+	if p.scopeGranted {
+		return nil
+	}
+	for _, role := range roles {
+		if p.HasRole(role) {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// CheckUser returns nil if the caller in ctx is the user with userID, or an admin or service
+// acting on their behalf. API keys belong to no user, so one whose scope was checked for the
+// call may only act on a user's behalf if it was also given ScopeUsersImpersonate.
+func CheckUser(ctx context.Context, userID string) error {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return ErrMissingToken
+	}
+	if (p.UserID != "" && p.UserID == userID) || p.HasRole(RoleAdmin) || p.HasRole(RoleService) {
+		return nil
+	}
+	if p.scopeGranted {
+		if p.HasScope(ScopeUsersImpersonate) {
+			return nil
+		}
+		return fmt.Errorf("%w: API key lacks scope %s", ErrForbidden, ScopeUsersImpersonate)
+	}
+	return ErrForbidden
+}
+
+// CheckSelf returns nil only if the caller in ctx is the user with userID, for things nobody
+// should do on a user's behalf, like enrolling their second factor.
+func CheckSelf(ctx context.Context, userID string) error {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return ErrMissingToken
+	}
+	if p.UserID != "" && p.UserID == userID {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// StatusError converts a CheckRole/CheckUser error into a gRPC status.
+func StatusError(err error) error {
+	if errors.Is(err, ErrMissingToken) {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	return status.Error(codes.PermissionDenied, err.Error())
+}
+
+// HTTPStatus converts a CheckRole/CheckUser error into an HTTP status code.
+func HTTPStatus(err error) int {
+	if errors.Is(err, ErrMissingToken) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+// RequireRole rejects requests whose caller holds none of roles. Use it after Middleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := CheckRole(r.Context(), roles...); err != nil {
+				writeError(w, HTTPStatus(err), err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// pkg/filewatch/filewatch.go
+package filewatch
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultInterval is how often files are checked for changes.
+const DefaultInterval = 2 * time.Second
+
+// fileState is what a change is detected by. A missing file has the zero state.
+type fileState struct {
+	modTime int64 // UnixNano
+	size    int64
+}
+
+func stat(path string) fileState {
+	info, err := os.Stat(path) // Follows symlinks, so swapped ConfigMap/Secret mounts count as changes
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime().UnixNano(), size: info.Size()}
+}
+
+// Watch calls onChange whenever one of paths is created, modified, replaced or removed,
+// until ctx is done. It polls every interval (DefaultInterval if 0 or less) rather than
+// relying on filesystem events, which are lost when files are replaced by renames and
+// don't work on every volume type. A file that changes twice within an interval may be
+// reported once.
+func Watch(ctx context.Context, interval time.Duration, onChange func(), paths ...string) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	states := make([]fileState, len(paths))
+	for i, path := range paths {
+		states[i] = stat(path)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed := false
+		for i, path := range paths {
+			if state := stat(path); state != states[i] {
+				states[i] = state
+				changed = true
+			}
+		}
+		if changed {
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// pkg/filewatch/filewatch_test.go
+package filewatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch_ReportsWritesAndRemovals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{}`), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Watch(ctx, 10*time.Millisecond, func() { changes <- struct{}{} }, path)
+	}()
+
+	waitForChange := func() {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatal("no change reported")
+		}
+	}
+	time.Sleep(30 * time.Millisecond) // Let Watch record the initial state
+	require.NoError(t, os.WriteFile(path, []byte(`{"users": []}`), 0o644))
+	waitForChange()
+	require.NoError(t, os.Remove(path))
+	waitForChange()
+
+	cancel()
+	<-done
+}
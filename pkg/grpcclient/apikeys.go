@@ -0,0 +1,24 @@
+// pkg/grpcclient/apikeys.go
+package grpcclient
+
+import (
+	"context"
+	"fmt"
+	"microservices-project/pkg/auth"
+	userpb "microservices-project/protos/userpb"
+)
+
+// UserServiceAPIKeys checks API keys with the UserService, which stores them, for services
+// that accept API keys from their callers. The client must authenticate as a service.
+func UserServiceAPIKeys(client userpb.UserServiceClient) auth.APIKeyValidator {
+	return func(ctx context.Context, key string) (*auth.Principal, error) {
+		resp, err := client.ValidateAPIKey(ctx, &userpb.ValidateAPIKeyRequest{Key: key})
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate API key with UserService: %w", err)
+		}
+		if !resp.Valid {
+			return nil, fmt.Errorf("%w: unknown, revoked or expired API key", auth.ErrInvalidToken)
+		}
+		return &auth.Principal{APIKeyID: resp.ApiKeyId, Service: resp.Name, Scopes: resp.Scopes, Token: key}, nil
+	}
+}
@@ -0,0 +1,175 @@
+// pkg/grpcclient/breaker.go
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen is returned, as an UNAVAILABLE status, for calls the circuit breaker
+// rejects without trying them.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Calls go through
+	BreakerOpen                         // Calls fail fast until OpenTimeout has passed
+	BreakerHalfOpen                     // One probe call goes through to see if the service is back
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig configures a CircuitBreaker. A FailureThreshold of 0 or less disables it.
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failed calls that open the circuit
+	OpenTimeout      time.Duration // How long the circuit stays open before a probe call
+}
+
+// DefaultBreakerConfig opens the circuit after 5 failed calls in a row, for 10 seconds.
+var DefaultBreakerConfig = BreakerConfig{FailureThreshold: 5, OpenTimeout: 10 * time.Second}
+
+// CircuitBreaker fails calls fast while a service is down, instead of letting every caller
+// wait out its deadline. Only UNAVAILABLE and DEADLINE_EXCEEDED count as failures: other
+// errors mean the service is up and answering.
+type CircuitBreaker struct {
+	name string
+	cfg  BreakerConfig
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // When the circuit last opened
+	probing  bool      // A half-open probe call is in flight
+}
+
+// NewCircuitBreaker creates a closed circuit breaker. name identifies the service in
+// errors and logs.
+func NewCircuitBreaker(name string, cfg BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{name: name, cfg: cfg, now: time.Now}
+}
+
+// State returns the breaker's current state.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be followed by Record.
+func (b *CircuitBreaker) Allow() error {
+	if b.cfg.FailureThreshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return status.Errorf(codes.Unavailable, "%s: %v", b.name, ErrCircuitOpen)
+		}
+		b.state = BreakerHalfOpen
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return status.Errorf(codes.Unavailable, "%s: %v", b.name, ErrCircuitOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record updates the breaker with the result of a call that Allow let through.
+func (b *CircuitBreaker) Record(err error) {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+	failed := isBreakerFailure(err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		log.Printf("Circuit breaker for %s closed; the service is answering again", b.name)
+		b.state = BreakerClosed
+		b.failures = 0
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+// open opens the circuit. b.mu must be held.
+func (b *CircuitBreaker) open() {
+	if b.state != BreakerOpen {
+		log.Printf("Circuit breaker for %s opened; failing calls fast for %s", b.name, b.cfg.OpenTimeout)
+	}
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.failures = 0
+}
+
+// UnaryClientInterceptor applies the breaker to unary calls.
+func (b *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := b.Allow(); err != nil {
+			return err
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.Record(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor applies the breaker to opening streams. Errors later in the
+// stream don't count.
+func (b *CircuitBreaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := b.Allow(); err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		b.Record(err)
+		return stream, err
+	}
+}
+
+func isBreakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+// pkg/grpcclient/breaker_test.go
+package grpcclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestBreaker(threshold int) (*CircuitBreaker, *time.Time) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := NewCircuitBreaker("TestService", BreakerConfig{FailureThreshold: threshold, OpenTimeout: 10 * time.Second})
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(3)
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.Allow())
+		b.Record(unavailable)
+	}
+	assert.NoError(t, b.Allow())
+	b.Record(nil) // A success resets the count
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.Allow())
+		b.Record(unavailable)
+	}
+
+	assert.Equal(t, BreakerOpen, b.State())
+	err := b.Allow()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Contains(t, err.Error(), ErrCircuitOpen.Error())
+}
+
+func TestCircuitBreaker_IgnoresApplicationErrors(t *testing.T) {
+	b, _ := newTestBreaker(1)
+
+	assert.NoError(t, b.Allow())
+	b.Record(status.Error(codes.NotFound, "no such user"))
+	assert.NoError(t, b.Allow())
+	b.Record(status.Error(codes.FailedPrecondition, "insufficient stock"))
+
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	b, now := newTestBreaker(1)
+	assert.NoError(t, b.Allow())
+	b.Record(status.Error(codes.DeadlineExceeded, "deadline exceeded"))
+	assert.Error(t, b.Allow())
+
+	*now = now.Add(10 * time.Second)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.NoError(t, b.Allow()) // The probe
+	assert.Error(t, b.Allow())   // Only one at a time
+	b.Record(status.Error(codes.Unavailable, "still down"))
+	assert.Equal(t, BreakerOpen, b.State())
+
+	*now = now.Add(10 * time.Second)
+	assert.NoError(t, b.Allow())
+	b.Record(nil)
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.NoError(t, b.Allow())
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b, _ := newTestBreaker(0)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, b.Allow())
+		b.Record(status.Error(codes.Unavailable, "down"))
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+}
@@ -0,0 +1,312 @@
+// pkg/grpcclient/builder.go
+package grpcclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/balancer/leastrequest" // Registers LeastRequest
+	"google.golang.org/grpc/credentials/insecure"    // Unless replaced, see WithDialOptions
+	_ "google.golang.org/grpc/health"                // Registers client-side health checking
+	"google.golang.org/grpc/keepalive"
+)
+
+// DefaultDeadline is the deadline of calls made without one, unless the method has its own.
+const DefaultDeadline = 5 * time.Second
+
+// Balancer is a policy for spreading calls over the addresses a target resolves to.
+type Balancer string
+
+const (
+	RoundRobin   Balancer = "round_robin"                // Each call goes to the next address
+	LeastRequest Balancer = "least_request_experimental" // The one with fewer calls in flight, of two picked at random
+	PickFirst    Balancer = "pick_first"                 // Every call goes to the first address that works
+)
+
+// ParseBalancer parses a balancer name: round_robin, least_request or pick_first. An
+// empty name is RoundRobin.
+func ParseBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", "round_robin":
+		return RoundRobin, nil
+	case "least_request":
+		return LeastRequest, nil
+	case "pick_first":
+		return PickFirst, nil
+	}
+	return "", fmt.Errorf("unknown load balancing policy %q (want round_robin, least_request or pick_first)", name)
+}
+
+// BalancerFromEnv parses the balancer named by the environment variable key.
+func BalancerFromEnv(key string) (Balancer, error) {
+	b, err := ParseBalancer(os.Getenv(key))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
+
+// RetryPolicy is how gRPC retries a failed call. Only give it to idempotent methods: a call
+// that timed out may have been carried out.
+type RetryPolicy struct {
+	MaxAttempts       int           // Including the first; gRPC caps it at 5
+	InitialBackoff    time.Duration // Backoffs are randomised between 0 and the current value
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	RetryableCodes    []string // Status code names, e.g. "UNAVAILABLE"
+}
+
+// DefaultRetryPolicy tries a call up to 3 times while the service is unavailable.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:       3,
+	InitialBackoff:    100 * time.Millisecond,
+	MaxBackoff:        time.Second,
+	BackoffMultiplier: 2,
+	RetryableCodes:    []string{"UNAVAILABLE"},
+}
+
+// DefaultKeepalive pings idle connections every 30s, so a dead peer is noticed before the
+// next call rather than by it. Servers must allow it; see KeepaliveEnforcementPolicy.
+var DefaultKeepalive = keepalive.ClientParameters{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// KeepaliveEnforcementPolicy lets clients ping as often as DefaultKeepalive does. Servers
+// reject faster pings by default, closing the connection.
+var KeepaliveEnforcementPolicy = keepalive.EnforcementPolicy{
+	MinTime:             DefaultKeepalive.Time / 2,
+	PermitWithoutStream: true,
+}
+
+// Builder configures a connection to a service: deadlines and retries (sent to gRPC as a
+// service config), a circuit breaker, and keepalives. The zero value is not usable; start
+// with NewBuilder.
+type Builder struct {
+	name      string // For logs and errors, e.g. "UserService"
+	target    string
+	balancer  Balancer
+	deadline  time.Duration
+	methods   map[string]*methodSettings // By full method name
+	breaker   BreakerConfig
+	keepalive keepalive.ClientParameters
+	dialOpts  []grpc.DialOption
+}
+
+type methodSettings struct {
+	deadline *time.Duration // nil: the default deadline
+	retry    *RetryPolicy
+}
+
+// NewBuilder starts configuring a connection to the service called name at target (see
+// resolver.go for the schemes it may use), with RoundRobin balancing, DefaultDeadline,
+// DefaultBreakerConfig and DefaultKeepalive. Methods are not retried.
+func NewBuilder(name, target string) *Builder {
+	return &Builder{
+		name:      name,
+		target:    target,
+		balancer:  RoundRobin,
+		deadline:  DefaultDeadline,
+		methods:   make(map[string]*methodSettings),
+		breaker:   DefaultBreakerConfig,
+		keepalive: DefaultKeepalive,
+	}
+}
+
+// WithBalancer sets how calls are spread over the target's addresses.
+func (b *Builder) WithBalancer(balancer Balancer) *Builder {
+	b.balancer = balancer
+	return b
+}
+
+// WithDefaultDeadline sets the deadline of calls made without one. 0 means none.
+func (b *Builder) WithDefaultDeadline(d time.Duration) *Builder {
+	b.deadline = d
+	return b
+}
+
+// WithMethodDeadline sets the deadline of calls to method (a full method name, like
+// userpb.UserService_GetUser_FullMethodName) made without one. 0 means none, e.g. for
+// long-lived streams.
+func (b *Builder) WithMethodDeadline(method string, d time.Duration) *Builder {
+	b.method(method).deadline = &d
+	return b
+}
+
+// WithRetry retries calls to methods, which must be idempotent, according to policy.
+func (b *Builder) WithRetry(policy RetryPolicy, methods ...string) *Builder {
+	for _, method := range methods {
+		p := policy
+		b.method(method).retry = &p
+	}
+	return b
+}
+
+// WithCircuitBreaker replaces DefaultBreakerConfig. A zero config disables the breaker.
+func (b *Builder) WithCircuitBreaker(cfg BreakerConfig) *Builder {
+	b.breaker = cfg
+	return b
+}
+
+// WithKeepalive replaces DefaultKeepalive.
+func (b *Builder) WithKeepalive(params keepalive.ClientParameters) *Builder {
+	b.keepalive = params
+	return b
+}
+
+// WithDialOptions adds options (e.g. interceptors), applied after the builder's own. Options
+// that can only be set once replace the builder's: grpc.WithTransportCredentials, for TLS,
+// replaces plaintext.
+func (b *Builder) WithDialOptions(opts ...grpc.DialOption) *Builder {
+	b.dialOpts = append(b.dialOpts, opts...)
+	return b
+}
+
+func (b *Builder) method(name string) *methodSettings {
+	m, ok := b.methods[name]
+	if !ok {
+		m = &methodSettings{}
+		b.methods[name] = m
+	}
+	return m
+}
+
+// Dial creates the connection without waiting for it: calls made before the service is
+// reachable fail (or are retried) like calls made while it is down. Conn.Ready tells
+// whether it is connected.
+func (b *Builder) Dial() (*Conn, error) {
+	serviceConfig, err := b.ServiceConfig()
+	if err != nil {
+		return nil, err
+	}
+	breaker := NewCircuitBreaker(b.name, b.breaker)
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithKeepaliveParams(b.keepalive),
+		grpc.WithIdleTimeout(0), // Stay connected, so readiness reflects the service's
+		grpc.WithChainUnaryInterceptor(breaker.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(breaker.StreamClientInterceptor()),
+	}
+	cc, err := grpc.NewClient(b.target, append(opts, b.dialOpts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for %s at %s: %w", b.name, b.target, err)
+	}
+	return newConn(b.name, cc, breaker), nil
+}
+
+// Service config JSON, as documented in https://github.com/grpc/grpc/blob/master/doc/service_config.md
+type serviceConfigJSON struct {
+	LoadBalancingConfig []map[Balancer]struct{} `json:"loadBalancingConfig"`
+	HealthCheckConfig   healthCheckConfigJSON   `json:"healthCheckConfig"`
+	MethodConfig        []methodConfigJSON      `json:"methodConfig"`
+}
+
+type healthCheckConfigJSON struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type methodConfigJSON struct {
+	Name        []methodNameJSON `json:"name"`
+	Timeout     string           `json:"timeout,omitempty"`
+	RetryPolicy *retryPolicyJSON `json:"retryPolicy,omitempty"`
+}
+
+type methodNameJSON struct {
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+}
+
+type retryPolicyJSON struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// ServiceConfig returns the service config that carries the builder's balancer, health
+// checking, deadlines and retry policies. A method's entry replaces the default one, so it
+// repeats the default deadline unless it has its own.
+func (b *Builder) ServiceConfig() (string, error) {
+	switch b.balancer {
+	case RoundRobin, LeastRequest, PickFirst:
+	default:
+		return "", fmt.Errorf("unknown load balancing policy %q for %s", b.balancer, b.name)
+	}
+	cfg := serviceConfigJSON{
+		LoadBalancingConfig: []map[Balancer]struct{}{{b.balancer: {}}},
+		// Addresses whose server reports NOT_SERVING (say, while draining) get no calls.
+		// Servers without the health service count as serving.
+		HealthCheckConfig: healthCheckConfigJSON{ServiceName: ""},
+		MethodConfig: []methodConfigJSON{{
+			Name:    []methodNameJSON{{}}, // Empty name: the default for every method
+			Timeout: protoDuration(b.deadline),
+		}},
+	}
+
+	names := make([]string, 0, len(b.methods))
+	for name := range b.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Stable output for tests and logs
+	for _, name := range names {
+		service, method, ok := splitMethodName(name)
+		if !ok {
+			return "", fmt.Errorf("invalid gRPC method name %q for %s", name, b.name)
+		}
+		m := b.methods[name]
+		deadline := b.deadline
+		if m.deadline != nil {
+			deadline = *m.deadline
+		}
+		mc := methodConfigJSON{
+			Name:    []methodNameJSON{{Service: service, Method: method}},
+			Timeout: protoDuration(deadline),
+		}
+		if p := m.retry; p != nil {
+			if p.MaxAttempts < 2 || len(p.RetryableCodes) == 0 || p.InitialBackoff <= 0 || p.MaxBackoff <= 0 || p.BackoffMultiplier <= 0 {
+				return "", fmt.Errorf("invalid retry policy for %s: needs at least 2 attempts, backoffs and retryable codes", name)
+			}
+			mc.RetryPolicy = &retryPolicyJSON{
+				MaxAttempts:          p.MaxAttempts,
+				InitialBackoff:       protoDuration(p.InitialBackoff),
+				MaxBackoff:           protoDuration(p.MaxBackoff),
+				BackoffMultiplier:    p.BackoffMultiplier,
+				RetryableStatusCodes: p.RetryableCodes,
+			}
+		}
+		cfg.MethodConfig = append(cfg.MethodConfig, mc)
+	}
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// splitMethodName splits "/package.Service/Method" into its service and method.
+func splitMethodName(fullMethod string) (service, method string, ok bool) {
+	if !strings.HasPrefix(fullMethod, "/") {
+		return "", "", false
+	}
+	service, method, ok = strings.Cut(fullMethod[1:], "/")
+	return service, method, ok && service != "" && method != "" && !strings.Contains(method, "/")
+}
+
+// protoDuration formats d the way durations are written in JSON protobufs ("1.5s"). 0 is
+// written as "", which leaves the field out.
+func protoDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
@@ -0,0 +1,63 @@
+// pkg/grpcclient/builder_test.go
+package grpcclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder_ServiceConfig(t *testing.T) {
+	b := NewBuilder("UserService", "localhost:50051").
+		WithDefaultDeadline(2*time.Second).
+		WithMethodDeadline("/user.UserService/WatchSomething", 0).
+		WithRetry(DefaultRetryPolicy, "/user.UserService/GetUser")
+
+	cfg, err := b.ServiceConfig()
+
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"loadBalancingConfig": [{"round_robin": {}}], "healthCheckConfig": {"serviceName": ""}, "methodConfig": [
+		{"name": [{}], "timeout": "2s"},
+		{"name": [{"service": "user.UserService", "method": "GetUser"}], "timeout": "2s",
+		 "retryPolicy": {"maxAttempts": 3, "initialBackoff": "0.1s", "maxBackoff": "1s",
+		                 "backoffMultiplier": 2, "retryableStatusCodes": ["UNAVAILABLE"]}},
+		{"name": [{"service": "user.UserService", "method": "WatchSomething"}]}
+	]}`, cfg)
+}
+
+func TestBuilder_ServiceConfig_Invalid(t *testing.T) {
+	_, err := NewBuilder("UserService", "localhost:50051").WithMethodDeadline("GetUser", time.Second).ServiceConfig()
+	assert.Error(t, err)
+
+	_, err = NewBuilder("UserService", "localhost:50051").
+		WithRetry(RetryPolicy{MaxAttempts: 1}, "/user.UserService/GetUser").
+		ServiceConfig()
+	assert.Error(t, err)
+}
+
+func TestBuilder_Dial_DoesNotWait(t *testing.T) {
+	// Nothing listens here; Dial must return anyway
+	for _, balancer := range []Balancer{RoundRobin, LeastRequest, PickFirst} {
+		conn, err := NewBuilder("UserService", "static:///127.0.0.1:1,127.0.0.1:2").
+			WithBalancer(balancer).
+			WithRetry(DefaultRetryPolicy, "/user.UserService/GetUser").
+			Dial()
+		require.NoError(t, err, balancer)
+
+		assert.False(t, conn.Ready())
+		assert.Equal(t, "UserService", conn.Name())
+		conn.Close()
+	}
+}
+
+func TestParseBalancer(t *testing.T) {
+	for name, want := range map[string]Balancer{"": RoundRobin, "round_robin": RoundRobin, "least_request": LeastRequest, "pick_first": PickFirst} {
+		got, err := ParseBalancer(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseBalancer("random")
+	assert.Error(t, err)
+}
@@ -3,33 +3,82 @@ package grpcclient
 
 import (
 	"log"
-	userpb "microservices-project/protos/userpb"
+	orderpb "microservices-project/protos/orderpb"
 	productpb "microservices-project/protos/productpb"
+	userpb "microservices-project/protos/userpb"
+	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure" // For non-TLS connection
 )
 
-// NewUserServiceClient creates a new gRPC client for the UserService.
-func NewUserServiceClient(userServiceAddr string) (userpb.UserServiceClient, *grpc.ClientConn, error) {
-	conn, err := grpc.Dial(userServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+// The addresses may be any target NewBuilder accepts, to reach several replicas, which calls
+// are spread over by balancer.
+
+// NewUserServiceClient creates a new gRPC client for the UserService. Lookups are retried
+// while the service is unavailable. Extra options (e.g. interceptors) are applied after the
+// defaults.
+func NewUserServiceClient(userServiceAddr string, balancer Balancer, opts ...grpc.DialOption) (userpb.UserServiceClient, *Conn, error) {
+	conn, err := NewBuilder("UserService", userServiceAddr).
+		WithBalancer(balancer).
+		WithRetry(DefaultRetryPolicy,
+			userpb.UserService_GetUser_FullMethodName,
+			userpb.UserService_ListAddresses_FullMethodName,
+			userpb.UserService_ValidateAPIKey_FullMethodName,
+		).
+		WithDialOptions(opts...).
+		Dial()
 	if err != nil {
-		log.Printf("Failed to connect to UserService at %s: %v", userServiceAddr, err)
+		log.Printf("Failed to set up connection to UserService at %s: %v", userServiceAddr, err)
 		return nil, nil, err
 	}
-	log.Printf("Successfully connected to UserService at %s", userServiceAddr)
-	client := userpb.NewUserServiceClient(conn)
-	return client, conn, nil
+	return userpb.NewUserServiceClient(conn), conn, nil
 }
 
-// NewProductServiceClient creates a new gRPC client for the ProductService.
-func NewProductServiceClient(productServiceAddr string) (productpb.ProductServiceClient, *grpc.ClientConn, error) {
-	conn, err := grpc.Dial(productServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+// NewProductServiceClient creates a new gRPC client for the ProductService. Reads are
+// retried while the service is unavailable, and so are ReserveStock (a retry with the same
+// reference returns the same reservation), CommitReservation and ReleaseReservation; direct
+// stock changes are not, since they aren't idempotent. Extra options (e.g. interceptors) are applied after
+// the defaults.
+func NewProductServiceClient(productServiceAddr string, balancer Balancer, opts ...grpc.DialOption) (productpb.ProductServiceClient, *Conn, error) {
+	conn, err := NewBuilder("ProductService", productServiceAddr).
+		WithBalancer(balancer).
+		WithRetry(DefaultRetryPolicy,
+			productpb.ProductService_GetProduct_FullMethodName,
+			productpb.ProductService_BatchGetProducts_FullMethodName,
+			productpb.ProductService_ListProducts_FullMethodName,
+			productpb.ProductService_ReserveStock_FullMethodName,
+			productpb.ProductService_CommitReservation_FullMethodName,
+			productpb.ProductService_ReleaseReservation_FullMethodName,
+		).
+		WithDialOptions(opts...).
+		Dial()
 	if err != nil {
-		log.Printf("Failed to connect to ProductService at %s: %v", productServiceAddr, err)
+		log.Printf("Failed to set up connection to ProductService at %s: %v", productServiceAddr, err)
 		return nil, nil, err
 	}
-	log.Printf("Successfully connected to ProductService at %s", productServiceAddr)
-	client := productpb.NewProductServiceClient(conn)
-	return client, conn, nil
-}
\ No newline at end of file
+	return productpb.NewProductServiceClient(conn), conn, nil
+}
+
+// NewOrderServiceClient creates a new gRPC client for the OrderService. Data exports and
+// erasures are retried while the service is unavailable (erasing with the same pseudonym is
+// idempotent), and get longer deadlines since they cover every order of a user. Extra
+// options (e.g. interceptors) are applied after the defaults.
+func NewOrderServiceClient(orderServiceAddr string, balancer Balancer, opts ...grpc.DialOption) (orderpb.OrderServiceClient, *Conn, error) {
+	conn, err := NewBuilder("OrderService", orderServiceAddr).
+		WithBalancer(balancer).
+		WithMethodDeadline(orderpb.OrderService_ExportUserOrders_FullMethodName, 30*time.Second).
+		WithMethodDeadline(orderpb.OrderService_EraseUserOrders_FullMethodName, 30*time.Second).
+		WithMethodDeadline(orderpb.OrderService_WatchOrder_FullMethodName, 0). // Lasts until the order is done
+		WithRetry(DefaultRetryPolicy,
+			orderpb.OrderService_GetOrder_FullMethodName,
+			orderpb.OrderService_ExportUserOrders_FullMethodName,
+			orderpb.OrderService_EraseUserOrders_FullMethodName,
+		).
+		WithDialOptions(opts...).
+		Dial()
+	if err != nil {
+		log.Printf("Failed to set up connection to OrderService at %s: %v", orderServiceAddr, err)
+		return nil, nil, err
+	}
+	return orderpb.NewOrderServiceClient(conn), conn, nil
+}
@@ -0,0 +1,93 @@
+// pkg/grpcclient/conn.go
+package grpcclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Conn is a connection made by a Builder. It tracks whether the service is reachable, for
+// readiness checks, and logs when that changes.
+type Conn struct {
+	*grpc.ClientConn
+	name    string
+	breaker *CircuitBreaker
+	ready   atomic.Bool
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+func newConn(name string, cc *grpc.ClientConn, breaker *CircuitBreaker) *Conn {
+	ctx, stop := context.WithCancel(context.Background())
+	c := &Conn{ClientConn: cc, name: name, breaker: breaker, stop: stop, stopped: make(chan struct{})}
+	cc.Connect() // Start connecting now rather than on the first call
+	go c.watch(ctx)
+	return c
+}
+
+// Name returns the name of the service the connection is to.
+func (c *Conn) Name() string {
+	return c.name
+}
+
+// Ready reports whether the connection is up.
+func (c *Conn) Ready() bool {
+	return c.ready.Load()
+}
+
+// Check returns an error unless the connection is up, for readiness checks.
+func (c *Conn) Check(context.Context) error {
+	if !c.Ready() {
+		return fmt.Errorf("not connected to %s (%s)", c.name, c.GetState())
+	}
+	return nil
+}
+
+// WaitUntilReady waits for the connection to come up, or for ctx to be done.
+func (c *Conn) WaitUntilReady(ctx context.Context) error {
+	for {
+		state := c.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !c.WaitForStateChange(ctx, state) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Breaker returns the connection's circuit breaker.
+func (c *Conn) Breaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// Close stops tracking the connection and closes it.
+func (c *Conn) Close() error {
+	c.stop()
+	<-c.stopped
+	return c.ClientConn.Close()
+}
+
+func (c *Conn) watch(ctx context.Context) {
+	defer close(c.stopped)
+	state := c.GetState()
+	for {
+		ready := state == connectivity.Ready
+		if c.ready.Swap(ready) != ready {
+			if ready {
+				log.Printf("Connected to %s at %s", c.name, c.Target())
+			} else {
+				log.Printf("Lost connection to %s at %s (%s)", c.name, c.Target(), state)
+			}
+		}
+		if state == connectivity.Shutdown || !c.WaitForStateChange(ctx, state) {
+			return
+		}
+		state = c.GetState()
+	}
+}
@@ -0,0 +1,270 @@
+// pkg/grpcclient/resolver.go
+package grpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/pkg/filewatch"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Besides gRPC's own "dns:///host:port" (the default) and "passthrough:///host:port",
+// targets can use these schemes to reach several replicas of a service:
+//
+//	static:///host1:50051,host2:50051            a fixed list of addresses
+//	dnssrv:///_grpc._tcp.userservice.example.com the targets of a DNS SRV record, re-read every DNSSRVRefreshInterval
+//	registry:///etc/registry.json?service=users  the "users" entry of a JSON registry file, re-read when the file changes
+//
+// A registry file maps service names to address lists:
+//
+//	{"users": ["10.0.0.5:50051", "10.0.0.6:50051"], "products": ["10.0.1.5:50052"]}
+//
+// When addresses are removed, gRPC stops sending new calls to them and closes their
+// connections once the calls in flight are done. A lookup that fails or finds no addresses
+// keeps the previous list, so a bad DNS answer or a half-written file doesn't cut the
+// service off.
+const (
+	StaticScheme   = "static"
+	DNSSRVScheme   = "dnssrv"
+	RegistryScheme = "registry"
+)
+
+// DNSSRVRefreshInterval is how often SRV records are looked up again.
+var DNSSRVRefreshInterval = 30 * time.Second
+
+// minRefreshInterval spaces out lookups, which gRPC asks for after every failed connection.
+var minRefreshInterval = time.Second
+
+// lookupSRV is net.DefaultResolver.LookupSRV, replaced in tests.
+var lookupSRV = func(ctx context.Context, name string) ([]*net.SRV, error) {
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	return srvs, err
+}
+
+func init() {
+	resolver.Register(staticBuilder{})
+	resolver.Register(dnsSRVBuilder{})
+	resolver.Register(registryBuilder{})
+}
+
+var errNoAddresses = errors.New("no addresses")
+
+// updateAddresses sends addrs to cc, sorted so that reordered answers aren't changes.
+func updateAddresses(cc resolver.ClientConn, addrs []string) error {
+	sort.Strings(addrs)
+	state := resolver.State{Addresses: make([]resolver.Address, len(addrs))}
+	for i, addr := range addrs {
+		state.Addresses[i] = resolver.Address{Addr: addr}
+	}
+	return cc.UpdateState(state)
+}
+
+// --- static ---
+
+type staticBuilder struct{}
+
+func (staticBuilder) Scheme() string { return StaticScheme }
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs, err := parseStaticAddresses(target.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+	if err := updateAddresses(cc, addrs); err != nil {
+		return nil, err
+	}
+	return nopResolver{}, nil
+}
+
+// parseStaticAddresses splits a comma-separated list of host:port addresses.
+func parseStaticAddresses(list string) ([]string, error) {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid address %q in static target: %w", addr, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("static target: %w", errNoAddresses)
+	}
+	return addrs, nil
+}
+
+type nopResolver struct{}
+
+func (nopResolver) ResolveNow(resolver.ResolveNowOptions) {}
+func (nopResolver) Close()                                {}
+
+// --- refreshing resolvers (dnssrv, registry) ---
+
+// refreshingResolver looks addresses up with lookup when built, whenever refresh is
+// signalled, and when gRPC asks it to (after connection failures).
+type refreshingResolver struct {
+	name    string // For logs
+	cc      resolver.ClientConn
+	lookup  func(ctx context.Context) ([]string, error)
+	refresh chan struct{}
+	ctx     context.Context // Done once the resolver is closed
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func startRefreshingResolver(name string, cc resolver.ClientConn, lookup func(ctx context.Context) ([]string, error)) *refreshingResolver {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &refreshingResolver{name: name, cc: cc, lookup: lookup, refresh: make(chan struct{}, 1), ctx: ctx, cancel: cancel}
+	r.goRun(r.run)
+	return r
+}
+
+// goRun runs f in a goroutine that Close waits for. f must return once r.ctx is done.
+func (r *refreshingResolver) goRun(f func(ctx context.Context)) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		f(r.ctx)
+	}()
+}
+
+func (r *refreshingResolver) run(ctx context.Context) {
+	var last string
+	for {
+		addrs, err := r.lookup(ctx)
+		if err == nil && len(addrs) == 0 {
+			err = errNoAddresses
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Failed to resolve %s, keeping its previous addresses: %v", r.name, err)
+			r.cc.ReportError(err)
+		} else {
+			if joined := strings.Join(addrs, ","); joined != last {
+				log.Printf("Resolved %s to %s", r.name, joined)
+				last = joined
+			}
+			updateAddresses(r.cc, addrs)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(minRefreshInterval):
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.refresh:
+		}
+	}
+}
+
+func (r *refreshingResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.refresh <- struct{}{}:
+	default: // A refresh is already pending
+	}
+}
+
+func (r *refreshingResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// --- dnssrv ---
+
+type dnsSRVBuilder struct{}
+
+func (dnsSRVBuilder) Scheme() string { return DNSSRVScheme }
+
+func (dnsSRVBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	name := target.Endpoint()
+	if name == "" {
+		return nil, errors.New("dnssrv target needs a record name, e.g. dnssrv:///_grpc._tcp.userservice.example.com")
+	}
+	r := startRefreshingResolver("SRV "+name, cc, func(ctx context.Context) ([]string, error) {
+		return resolveSRV(ctx, name)
+	})
+	r.goRun(func(ctx context.Context) {
+		ticker := time.NewTicker(DNSSRVRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.ResolveNow(resolver.ResolveNowOptions{})
+			}
+		}
+	})
+	return r, nil
+}
+
+// resolveSRV returns the host:port of each target of the SRV record name.
+func resolveSRV(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	srvs, err := lookupSRV(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+	}
+	return addrs, nil
+}
+
+// --- registry ---
+
+type registryBuilder struct{}
+
+func (registryBuilder) Scheme() string { return RegistryScheme }
+
+func (registryBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	path := target.URL.Path
+	service := target.URL.Query().Get("service")
+	if path == "" || service == "" {
+		return nil, errors.New("registry target needs a file and a service, e.g. registry:///etc/registry.json?service=users")
+	}
+	r := startRefreshingResolver(fmt.Sprintf("%s in %s", service, path), cc, func(context.Context) ([]string, error) {
+		return readRegistry(path, service)
+	})
+	r.goRun(func(ctx context.Context) {
+		filewatch.Watch(ctx, 0, func() { r.ResolveNow(resolver.ResolveNowOptions{}) }, path)
+	})
+	return r, nil
+}
+
+// readRegistry returns the addresses of service in the registry file at path.
+func readRegistry(path, service string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var registry map[string][]string
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("invalid registry file %s: %w", path, err)
+	}
+	addrs, ok := registry[service]
+	if !ok {
+		return nil, fmt.Errorf("service %q is not in registry file %s", service, path)
+	}
+	return parseStaticAddresses(strings.Join(addrs, ","))
+}
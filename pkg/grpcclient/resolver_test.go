@@ -0,0 +1,146 @@
+// pkg/grpcclient/resolver_test.go
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/resolver"
+)
+
+// fakeClientConn records what a resolver reports.
+type fakeClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+	errs   chan error
+}
+
+func newFakeClientConn() *fakeClientConn {
+	return &fakeClientConn{states: make(chan resolver.State, 10), errs: make(chan error, 10)}
+}
+
+func (f *fakeClientConn) UpdateState(s resolver.State) error {
+	f.states <- s
+	return nil
+}
+
+func (f *fakeClientConn) ReportError(err error) {
+	f.errs <- err
+}
+
+func (f *fakeClientConn) nextAddrs(t *testing.T) []string {
+	t.Helper()
+	select {
+	case s := <-f.states:
+		addrs := make([]string, len(s.Addresses))
+		for i, a := range s.Addresses {
+			addrs[i] = a.Addr
+		}
+		return addrs
+	case err := <-f.errs:
+		t.Fatalf("resolver reported an error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolver reported nothing")
+	}
+	return nil
+}
+
+func (f *fakeClientConn) nextErr(t *testing.T) error {
+	t.Helper()
+	select {
+	case s := <-f.states:
+		t.Fatalf("resolver reported addresses %v, want an error", s.Addresses)
+	case err := <-f.errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolver reported nothing")
+	}
+	return nil
+}
+
+func parseTarget(t *testing.T, target string) resolver.Target {
+	t.Helper()
+	u, err := url.Parse(target)
+	require.NoError(t, err)
+	return resolver.Target{URL: *u}
+}
+
+func TestParseStaticAddresses(t *testing.T) {
+	addrs, err := parseStaticAddresses("users-1:50051, users-2:50051,")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users-1:50051", "users-2:50051"}, addrs)
+
+	_, err = parseStaticAddresses("users-1")
+	assert.Error(t, err, "missing port")
+	_, err = parseStaticAddresses(" , ")
+	assert.ErrorIs(t, err, errNoAddresses)
+}
+
+func TestStaticResolver(t *testing.T) {
+	cc := newFakeClientConn()
+	r, err := staticBuilder{}.Build(parseTarget(t, "static:///users-2:50051,users-1:50051"), cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	assert.Equal(t, []string{"users-1:50051", "users-2:50051"}, cc.nextAddrs(t))
+}
+
+func TestRegistryResolver_FollowsFileAndKeepsAddressesOnBadRead(t *testing.T) {
+	defer func(old time.Duration) { minRefreshInterval = old }(minRefreshInterval)
+	minRefreshInterval = 0
+	path := filepath.Join(t.TempDir(), "registry.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"users": ["10.0.0.5:50051", "10.0.0.6:50051"]}`), 0o644))
+
+	cc := newFakeClientConn()
+	r, err := registryBuilder{}.Build(parseTarget(t, "registry://"+path+"?service=users"), cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, []string{"10.0.0.5:50051", "10.0.0.6:50051"}, cc.nextAddrs(t))
+
+	// A replica is removed
+	require.NoError(t, os.WriteFile(path, []byte(`{"users": ["10.0.0.6:50051"]}`), 0o644))
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	assert.Equal(t, []string{"10.0.0.6:50051"}, cc.nextAddrs(t))
+
+	// A half-written file is an error, not an empty list
+	require.NoError(t, os.WriteFile(path, []byte(`{"users": [`), 0o644))
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	assert.Error(t, cc.nextErr(t))
+}
+
+func TestRegistryResolver_RequiresService(t *testing.T) {
+	_, err := registryBuilder{}.Build(parseTarget(t, "registry:///etc/registry.json"), newFakeClientConn(), resolver.BuildOptions{})
+	assert.Error(t, err)
+}
+
+func TestDNSSRVResolver(t *testing.T) {
+	defer func(old func(context.Context, string) ([]*net.SRV, error)) { lookupSRV = old }(lookupSRV)
+	defer func(old time.Duration) { minRefreshInterval = old }(minRefreshInterval)
+	minRefreshInterval = 0
+	answers := make(chan []*net.SRV, 2)
+	answers <- []*net.SRV{{Target: "users-1.example.com.", Port: 50051}, {Target: "users-2.example.com.", Port: 50051}}
+	answers <- nil
+	lookupSRV = func(ctx context.Context, name string) ([]*net.SRV, error) {
+		if name != "_grpc._tcp.users.example.com" {
+			return nil, errors.New("unexpected name " + name)
+		}
+		return <-answers, nil
+	}
+
+	cc := newFakeClientConn()
+	r, err := dnsSRVBuilder{}.Build(parseTarget(t, "dnssrv:///_grpc._tcp.users.example.com"), cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, []string{"users-1.example.com:50051", "users-2.example.com:50051"}, cc.nextAddrs(t))
+
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	assert.ErrorIs(t, cc.nextErr(t), errNoAddresses) // An empty answer keeps the previous addresses
+}
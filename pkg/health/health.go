@@ -0,0 +1,196 @@
+// pkg/health/health.go
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// DefaultCheckTimeout bounds each readiness check.
+	DefaultCheckTimeout = 2 * time.Second
+	// DefaultInterval is how often the gRPC serving status is brought up to date.
+	DefaultInterval = 5 * time.Second
+	// DefaultDrainDelay is how long a service keeps serving after reporting that it is
+	// shutting down, so load balancers stop sending it requests before it stops taking them.
+	DefaultDrainDelay = 5 * time.Second
+)
+
+var errShuttingDown = errors.New("shutting down")
+
+// Check reports whether a dependency is usable, e.g. (*sql.DB).PingContext.
+type Check func(ctx context.Context) error
+
+// Checker runs a service's readiness checks for /readyz and the grpc.health.v1 service.
+// Liveness (/livez) doesn't depend on them: a service whose database is down should be
+// taken out of rotation, not restarted.
+type Checker struct {
+	grpcHealth *health.Server
+	services   []string // gRPC services whose status follows the checks, besides the server's ("")
+	timeout    time.Duration
+
+	mu     sync.Mutex
+	checks map[string]Check
+
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a checker with no checks, which is ready until Shutdown. services
+// are the gRPC service names (e.g. "user.UserService") reported by the health service.
+func NewChecker(services ...string) *Checker {
+	c := &Checker{
+		grpcHealth: health.NewServer(),
+		services:   services,
+		timeout:    DefaultCheckTimeout,
+		checks:     make(map[string]Check),
+	}
+	c.setServing(true)
+	return c
+}
+
+// Add adds a readiness check, named in /readyz responses and logs.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Register registers the grpc.health.v1 service on server.
+func (c *Checker) Register(server *grpc.Server) {
+	healthpb.RegisterHealthServer(server, c.grpcHealth)
+}
+
+// Check runs every check concurrently and returns the failures by name. A shut down
+// checker fails with "shutting down".
+func (c *Checker) Check(ctx context.Context) map[string]error {
+	failures := make(map[string]error)
+	if c.shuttingDown.Load() {
+		failures["server"] = errShuttingDown
+		return failures
+	}
+
+	c.mu.Lock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := check(ctx); err != nil {
+				mu.Lock()
+				failures[name] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return failures
+}
+
+// Run updates the gRPC serving status from the checks every interval (DefaultInterval if 0
+// or less) until ctx is done or Shutdown is called, logging changes.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	serving := true // The health server starts out SERVING
+	for {
+		failures := c.Check(ctx)
+		if c.shuttingDown.Load() {
+			return
+		}
+		if ready := len(failures) == 0; ready != serving {
+			serving = ready
+			if ready {
+				log.Println("Ready again: all readiness checks pass")
+			} else {
+				log.Printf("Not ready: %s", describe(failures))
+			}
+			c.setServing(ready)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) setServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	c.grpcHealth.SetServingStatus("", status)
+	for _, service := range c.services {
+		c.grpcHealth.SetServingStatus(service, status)
+	}
+}
+
+// Shutdown reports the service as NOT_SERVING over gRPC and fails /readyz from now on.
+// Call it before stopping the servers, and give load balancers time to notice.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+	c.grpcHealth.Shutdown()
+}
+
+// ReadyzHandler serves /readyz: 200 if every check passes, 503 with the failures otherwise.
+func (c *Checker) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	failures := c.Check(r.Context())
+	body := struct {
+		Status string            `json:"status"`
+		Failed map[string]string `json:"failed,omitempty"`
+	}{Status: "ready"}
+	code := http.StatusOK
+	if len(failures) > 0 {
+		body.Status, code = "not ready", http.StatusServiceUnavailable
+		body.Failed = make(map[string]string, len(failures))
+		for name, err := range failures {
+			body.Failed[name] = err.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// LivezHandler serves /livez: 200 as long as the process handles requests.
+func LivezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
+
+// describe lists failures as "name: error" in name order, for logs.
+func describe(failures map[string]error) string {
+	lines := make([]string, 0, len(failures))
+	for name, err := range failures {
+		lines = append(lines, name+": "+err.Error())
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,98 @@
+// pkg/health/health_test.go
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func grpcStatus(t *testing.T, c *Checker, service string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	resp, err := c.grpcHealth.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	require.NoError(t, err)
+	return resp.Status
+}
+
+func readyz(t *testing.T, c *Checker) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c.ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec.Code, body
+}
+
+func TestChecker_Readyz(t *testing.T) {
+	c := NewChecker("user.UserService")
+	dbErr := errors.New("connection refused")
+	var dbDown bool
+	c.Add("database", func(ctx context.Context) error {
+		if dbDown {
+			return dbErr
+		}
+		return nil
+	})
+
+	code, body := readyz(t, c)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body["status"])
+
+	dbDown = true
+	code, body = readyz(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, map[string]any{"database": "connection refused"}, body["failed"])
+}
+
+func TestChecker_CheckTimesOut(t *testing.T) {
+	c := NewChecker()
+	c.timeout = 10 * time.Millisecond
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	failures := c.Check(context.Background())
+	assert.ErrorIs(t, failures["slow"], context.DeadlineExceeded)
+}
+
+func TestChecker_RunFollowsChecks(t *testing.T) {
+	c := NewChecker("order.OrderService")
+	c.Add("UserService", func(ctx context.Context) error { return errors.New("not connected") })
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, grpcStatus(t, c, "order.OrderService"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx, time.Millisecond)
+	}()
+	assert.Eventually(t, func() bool {
+		return grpcStatus(t, c, "") == healthpb.HealthCheckResponse_NOT_SERVING &&
+			grpcStatus(t, c, "order.OrderService") == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestChecker_Shutdown(t *testing.T) {
+	c := NewChecker("product.ProductService")
+	c.Shutdown()
+
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, grpcStatus(t, c, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, grpcStatus(t, c, "product.ProductService"))
+	code, body := readyz(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, map[string]any{"server": "shutting down"}, body["failed"])
+
+	c.setServing(true) // A late Run iteration can't bring it back
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, grpcStatus(t, c, ""))
+}
@@ -0,0 +1,80 @@
+// pkg/mail/mail.go
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultFrom is the sender used when MAIL_FROM is not set.
+const DefaultFrom = "no-reply@localhost"
+
+// ErrInvalidMessage is returned for messages that can't be sent as is, e.g. a header with a
+// line break in it (which would let the caller inject headers).
+var ErrInvalidMessage = errors.New("invalid mail message")
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// MailerFromEnv picks the mailer from MAIL_TRANSPORT:
+//   - "smtp": SMTP_ADDR (host:port), optionally SMTP_USERNAME and SMTP_PASSWORD
+//   - "file" (the default): one .eml file per message in MAIL_DIR (default "mail")
+//   - "memory": kept in memory, for tests
+//
+// MAIL_FROM sets the sender.
+func MailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = DefaultFrom
+	}
+	switch transport := os.Getenv("MAIL_TRANSPORT"); transport {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, errors.New("SMTP_ADDR is required for MAIL_TRANSPORT=smtp")
+		}
+		return &SMTPMailer{Addr: addr, From: from, Username: os.Getenv("SMTP_USERNAME"), Password: os.Getenv("SMTP_PASSWORD")}, nil
+	case "", "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir, From: from}, nil
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", transport)
+	}
+}
+
+// format renders msg as an RFC 5322 message from the given sender.
+func format(from string, msg Message, now time.Time) ([]byte, error) {
+	if msg.To == "" || strings.ContainsAny(msg.To+msg.Subject+from, "\r\n") {
+		return nil, ErrInvalidMessage
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,40 @@
+// pkg/mail/mail_test.go
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: filepath.Join(dir, "outbox"), From: "shop@example.com"}
+
+	err := mailer.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi", Body: "line 1\nline 2"})
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(filepath.Join(dir, "outbox"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0].Name(), "-alice@example.com.eml"))
+	data, err := os.ReadFile(filepath.Join(dir, "outbox", files[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "To: alice@example.com\r\n")
+	assert.Contains(t, string(data), "\r\n\r\nline 1\r\nline 2")
+}
+
+func TestMemoryMailer_RejectsHeaderInjection(t *testing.T) {
+	mailer := NewMemoryMailer()
+
+	err := mailer.Send(context.Background(), Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi"})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+
+	require.NoError(t, mailer.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi"}))
+	assert.Len(t, mailer.Messages(), 1)
+}
@@ -0,0 +1,60 @@
+// pkg/metrics/metrics_test.go
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPMiddleware_LabelsByRoutePattern(t *testing.T) {
+	api := chi.NewRouter()
+	api.Get("/orders/{orderID}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "orderID") == "missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	})
+	r := chi.NewRouter()
+	r.Use(HTTPMiddleware)
+	r.Mount("/api/v1", api)
+
+	for _, path := range []string{"/api/v1/orders/1", "/api/v1/orders/2", "/api/v1/orders/missing", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/v1/orders/{orderID}", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/v1/orders/{orderID}", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/order.OrderService/GetOrder"}
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "order not found")
+	})
+	require.Error(t, err)
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(grpcHandled.WithLabelValues("order.OrderService", "GetOrder", "NotFound")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(grpcHandled.WithLabelValues("order.OrderService", "GetOrder", "OK")))
+}
+
+func TestSplitMethodName(t *testing.T) {
+	service, method := splitMethodName("/user.UserService/GetUser")
+	assert.Equal(t, "user.UserService", service)
+	assert.Equal(t, "GetUser", method)
+}
@@ -0,0 +1,37 @@
+// pkg/pagination/token_test.go
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCodec_RoundTrip(t *testing.T) {
+	codec := NewTokenCodec([]byte("secret"))
+	cursor := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC), ID: "3f0c2b9e-0000-4000-8000-000000000001"}
+
+	decoded, err := codec.Decode("products", codec.Encode("products", cursor))
+
+	assert.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.ID, decoded.ID)
+}
+
+func TestTokenCodec_RejectsTamperedOrForeignTokens(t *testing.T) {
+	codec := NewTokenCodec([]byte("secret"))
+	token := codec.Encode("orders:user-1", Cursor{CreatedAt: time.Now(), ID: "order-1"})
+
+	_, err := codec.Decode("orders:user-2", token) // Different list
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+
+	_, err = NewTokenCodec([]byte("other")).Decode("orders:user-1", token) // Different secret
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+
+	_, err = codec.Decode("orders:user-1", "x"+token) // Modified payload
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+
+	_, err = codec.Decode("orders:user-1", "not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+}
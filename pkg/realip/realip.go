@@ -0,0 +1,108 @@
+// pkg/realip/realip.go
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TrustedProxies are the networks of the load balancers and reverse proxies in front of a
+// service. X-Forwarded-For is only believed from them: any client can send the header, so
+// trusting it from everyone would let a caller pick the address it is rate limited under.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs (10.0.0.0/8) and addresses
+// (10.0.0.5). An empty list trusts nobody.
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// TrustedProxiesFromEnv parses the trusted proxies in the environment variable key.
+func TrustedProxiesFromEnv(key string) (TrustedProxies, error) {
+	proxies, err := ParseTrustedProxies(os.Getenv(key))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return proxies, nil
+}
+
+// ClientIP returns the address of the client that sent r, without the port. That is the
+// connection's peer unless the peer is a trusted proxy, in which case X-Forwarded-For is
+// read from the right, skipping trusted proxies, up to the first address one of them
+// didn't add itself.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	ip := hostIP(r.RemoteAddr)
+	if !t.trusts(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break // Garbage from the client; the last good hop is the best we know
+		}
+		ip = hop
+		if !t.trusts(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// Middleware replaces r.RemoteAddr with ClientIP, so the request log and handlers see the
+// client rather than the proxy. Unlike chi's RealIP it ignores forwarding headers from
+// untrusted peers.
+func (t TrustedProxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = t.ClientIP(r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t TrustedProxies) trusts(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range t {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostIP strips the port, if any, from addr.
+func hostIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
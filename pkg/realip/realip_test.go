@@ -0,0 +1,78 @@
+// pkg/realip/realip_test.go
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8, 192.168.1.5 ,fd00::/8,")
+	require.NoError(t, err)
+	require.Len(t, proxies, 3)
+	assert.True(t, proxies.trusts("10.1.2.3"))
+	assert.True(t, proxies.trusts("192.168.1.5"))
+	assert.False(t, proxies.trusts("192.168.1.6"))
+	assert.True(t, proxies.trusts("fd00::1"))
+
+	proxies, err = ParseTrustedProxies("")
+	require.NoError(t, err)
+	assert.Empty(t, proxies)
+
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies("proxy.internal")
+	assert.Error(t, err)
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		proxies    TrustedProxies
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxy", proxies, "203.0.113.7:5123", nil, "203.0.113.7"},
+		{"untrusted peer can't spoof", proxies, "203.0.113.7:5123", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"nobody trusted by default", nil, "10.0.0.2:5123", []string{"198.51.100.1"}, "10.0.0.2"},
+		{"trusted proxy", proxies, "10.0.0.2:5123", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"client prepends a fake hop", proxies, "10.0.0.2:5123", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", proxies, "10.0.0.2:5123", []string{"198.51.100.1, 10.0.0.9", "10.0.0.3"}, "198.51.100.1"},
+		{"only trusted hops", proxies, "10.0.0.2:5123", []string{"10.0.0.9"}, "10.0.0.9"},
+		{"garbage hop", proxies, "10.0.0.2:5123", []string{"198.51.100.1, not-an-ip, 10.0.0.9"}, "10.0.0.9"},
+		{"trusted proxy without header", proxies, "10.0.0.2:5123", nil, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/users/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, tt.want, tt.proxies.ClientIP(req))
+		})
+	}
+}
+
+func TestTrustedProxies_Middleware(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	require.NoError(t, err)
+
+	var remoteAddr string
+	handler := proxies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:5123"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "198.51.100.1", remoteAddr)
+}
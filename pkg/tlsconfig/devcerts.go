@@ -0,0 +1,182 @@
+// pkg/tlsconfig/devcerts.go
+package tlsconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Validity of development certificates. Service certificates are reissued by running the
+// generator again; the CA is kept, so running services accept them at once.
+const (
+	DevCAValidity   = 5 * 365 * 24 * time.Hour
+	DevCertValidity = 365 * 24 * time.Hour
+)
+
+// DevCA is a local certificate authority for development and tests. Never use it in
+// production: its key sits unencrypted next to the certificates.
+type DevCA struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// NewDevCA creates a CA with a new key.
+func NewDevCA() (*DevCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "microservices-project development CA"},
+		NotBefore:             now.Add(-time.Hour), // Tolerate clock skew between containers
+		NotAfter:              now.Add(DevCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return parseDevCA(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	)
+}
+
+// LoadDevCA reads a CA written by WriteDevCertificates.
+func LoadDevCA(certFile, keyFile string) (*DevCA, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return parseDevCA(certPEM, keyPEM)
+}
+
+func parseDevCA(certPEM, keyPEM []byte) (*DevCA, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("CA certificate or key is not PEM")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok || !cert.IsCA {
+		return nil, errors.New("not a CA certificate and key")
+	}
+	return &DevCA{cert: cert, key: signer, CertPEM: certPEM, KeyPEM: keyPEM}, nil
+}
+
+// Issue creates a certificate for the service called name, usable by its server and its
+// clients. Its SANs are name, which is what allow-lists match, and localhost, so tools on
+// the host can verify a server reached through a published port.
+func (ca *DevCA) Issue(name string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name, "localhost"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(DevCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// WriteDevCertificates writes ca.pem and ca-key.pem, and <name>.pem and <name>-key.pem for
+// each of names, to dir. An existing CA in dir is reused.
+func WriteDevCertificates(dir string, names ...string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	caCert, caKey := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	ca, err := LoadDevCA(caCert, caKey)
+	if errors.Is(err, os.ErrNotExist) {
+		if ca, err = NewDevCA(); err == nil {
+			if err = writeFile(caKey, ca.KeyPEM); err == nil {
+				err = writeFile(caCert, ca.CertPEM)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("CA in %s: %w", dir, err)
+	}
+
+	for _, name := range names {
+		certPEM, keyPEM, err := ca.Issue(name)
+		if err != nil {
+			return fmt.Errorf("failed to issue certificate for %s: %w", name, err)
+		}
+		// The key first: a service that reloads in between sees a mismatched pair and retries
+		if err := writeFile(filepath.Join(dir, name+"-key.pem"), keyPEM); err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(dir, name+".pem"), certPEM); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes a certificate or key. Keys must be readable by the services'
+// containers, which may run as another user, hence 0644.
+func writeFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0o644)
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
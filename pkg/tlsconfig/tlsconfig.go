@@ -0,0 +1,269 @@
+// pkg/tlsconfig/tlsconfig.go
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"microservices-project/pkg/filewatch"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ErrPeerNotAllowed is returned during the handshake when a peer's certificate is valid
+// but names none of the allowed peers.
+var ErrPeerNotAllowed = errors.New("peer certificate is not allowed")
+
+// Config says where a service's certificates are and which clients it accepts.
+type Config struct {
+	CertFile string // PEM certificate (and intermediates) presented as server and as client
+	KeyFile  string // PEM private key of CertFile
+	CAFile   string // PEM CA certificates that peers' certificates must chain to
+
+	MutualTLS      bool     // Servers require a client certificate
+	AllowedClients []string // With MutualTLS, the SANs of clients that may call; empty allows any from the CA
+}
+
+// Enabled reports whether TLS is configured at all.
+func (c Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// ConfigFromEnv reads TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE, which turn on TLS for
+// both our gRPC server and our clients, TLS_MUTUAL (a bool) and TLS_ALLOWED_CLIENTS
+// (comma-separated SANs). TLS is off if TLS_CERT_FILE is not set.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		CertFile:       os.Getenv("TLS_CERT_FILE"),
+		KeyFile:        os.Getenv("TLS_KEY_FILE"),
+		CAFile:         os.Getenv("TLS_CA_FILE"),
+		AllowedClients: splitList(os.Getenv("TLS_ALLOWED_CLIENTS")),
+	}
+	if value := os.Getenv("TLS_MUTUAL"); value != "" {
+		mutual, err := strconv.ParseBool(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("TLS_MUTUAL: %w", err)
+		}
+		cfg.MutualTLS = mutual
+	}
+
+	switch {
+	case !cfg.Enabled():
+		if cfg.KeyFile != "" || cfg.CAFile != "" || cfg.MutualTLS || len(cfg.AllowedClients) > 0 {
+			return Config{}, errors.New("TLS settings are given but TLS_CERT_FILE is not set")
+		}
+	case cfg.KeyFile == "":
+		return Config{}, errors.New("TLS_KEY_FILE is required with TLS_CERT_FILE")
+	case cfg.CAFile == "":
+		return Config{}, errors.New("TLS_CA_FILE is required with TLS_CERT_FILE, to verify the services we call")
+	case len(cfg.AllowedClients) > 0 && !cfg.MutualTLS:
+		return Config{}, errors.New("TLS_ALLOWED_CLIENTS needs TLS_MUTUAL=true")
+	}
+	return cfg, nil
+}
+
+// PeerNamesFromEnv reads the comma-separated SANs a service we call may present from the
+// environment variable key, defaulting to def.
+func PeerNamesFromEnv(key string, def ...string) []string {
+	if names := splitList(os.Getenv(key)); len(names) > 0 {
+		return names
+	}
+	return def
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Certificates holds a service's certificate and the CAs it trusts, reloaded from their
+// files by Watch. Connections made after a reload use the new ones; open connections
+// are not affected.
+type Certificates struct {
+	cfg Config
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	roots *x509.CertPool
+}
+
+// Load reads the certificates configured by cfg, which must be Enabled.
+func Load(cfg Config) (*Certificates, error) {
+	c := &Certificates{cfg: cfg}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// FromEnv loads the certificates configured by ConfigFromEnv and watches their files until
+// ctx is done. It returns nil if TLS is off.
+func FromEnv(ctx context.Context) (*Certificates, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil || !cfg.Enabled() {
+		return nil, err
+	}
+	c, err := Load(cfg)
+	if err != nil {
+		return nil, err
+	}
+	go c.Watch(ctx)
+	return c, nil
+}
+
+// Reload reads the files again. On error the current certificates are kept.
+func (c *Certificates) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", c.cfg.CertFile, err)
+	}
+	caPEM, err := os.ReadFile(c.cfg.CAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA file: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no CA certificates in %s", c.cfg.CAFile)
+	}
+
+	c.mu.Lock()
+	c.cert, c.roots = &cert, roots
+	c.mu.Unlock()
+	log.Printf("Loaded TLS certificate for %v, valid until %s", SANs(cert.Leaf), cert.Leaf.NotAfter.Format("2006-01-02"))
+	return nil
+}
+
+// Watch reloads the certificates whenever one of their files changes, until ctx is done.
+// A file that fails to load (say, a key written before its certificate) is retried on
+// its next change.
+func (c *Certificates) Watch(ctx context.Context) {
+	filewatch.Watch(ctx, 0, func() {
+		if err := c.Reload(); err != nil {
+			log.Printf("Failed to reload TLS certificates, keeping the current ones: %v", err)
+		}
+	}, c.cfg.CertFile, c.cfg.KeyFile, c.cfg.CAFile)
+}
+
+func (c *Certificates) current() (*tls.Certificate, *x509.CertPool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, c.roots
+}
+
+// ServerConfig returns the TLS config of a server. With MutualTLS, clients must present a
+// certificate from the CA whose SANs include one of AllowedClients (if any are set).
+func (c *Certificates) ServerConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := c.current()
+			return cert, nil
+		},
+	}
+	if c.cfg.MutualTLS {
+		// Verified by verifyPeer rather than crypto/tls, so a reloaded CA applies at once
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return c.verifyPeer(rawCerts, x509.ExtKeyUsageClientAuth, c.cfg.AllowedClients)
+		}
+	}
+	return cfg
+}
+
+// ClientConfig returns the TLS config of a client of the service whose certificate has one
+// of serverNames as SAN (any certificate from the CA if none are given). The host name
+// we connect to is not checked against the certificate, since a target may resolve to
+// several replicas under other names. Our certificate is presented if the server asks.
+func (c *Certificates) ClientConfig(serverNames ...string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, // The chain and SANs are checked by verifyPeer instead
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := c.current()
+			return cert, nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return c.verifyPeer(rawCerts, x509.ExtKeyUsageServerAuth, serverNames)
+		},
+	}
+	if len(serverNames) > 0 {
+		cfg.ServerName = serverNames[0] // Sent as SNI
+	}
+	return cfg
+}
+
+// ServerCredentials returns the transport credentials of a gRPC server: TLS with
+// ServerConfig, or plaintext if c is nil.
+func (c *Certificates) ServerCredentials() credentials.TransportCredentials {
+	if c == nil {
+		return insecure.NewCredentials()
+	}
+	return credentials.NewTLS(c.ServerConfig())
+}
+
+// ClientCredentials returns the transport credentials of a gRPC client: TLS with
+// ClientConfig(serverNames...), or plaintext if c is nil.
+func (c *Certificates) ClientCredentials(serverNames ...string) credentials.TransportCredentials {
+	if c == nil {
+		return insecure.NewCredentials()
+	}
+	return credentials.NewTLS(c.ClientConfig(serverNames...))
+}
+
+// verifyPeer checks that the peer's certificate chains to our CAs, may be used for usage
+// and, if allowed isn't empty, has one of allowed as SAN.
+func (c *Certificates) verifyPeer(rawCerts [][]byte, usage x509.ExtKeyUsage, allowed []string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("peer presented no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("invalid peer certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+	_, roots := c.current()
+	opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool(), KeyUsages: []x509.ExtKeyUsage{usage}}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return err
+	}
+
+	if len(allowed) == 0 {
+		return nil
+	}
+	sans := SANs(certs[0])
+	for _, san := range sans {
+		if slices.Contains(allowed, san) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %v is none of %v", ErrPeerNotAllowed, sans, allowed)
+}
+
+// SANs returns the DNS names and URIs a certificate is issued to.
+func SANs(cert *x509.Certificate) []string {
+	sans := slices.Clone(cert.DNSNames)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
@@ -0,0 +1,156 @@
+// pkg/tlsconfig/tlsconfig_test.go
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// loadDev writes development certificates for names to a temporary directory and loads
+// the one of each name with cfg's other settings.
+func loadDev(t *testing.T, dir string, cfg Config, names ...string) map[string]*Certificates {
+	t.Helper()
+	require.NoError(t, WriteDevCertificates(dir, names...))
+	certs := make(map[string]*Certificates, len(names))
+	for _, name := range names {
+		cfg.CertFile = filepath.Join(dir, name+".pem")
+		cfg.KeyFile = filepath.Join(dir, name+"-key.pem")
+		cfg.CAFile = filepath.Join(dir, "ca.pem")
+		c, err := Load(cfg)
+		require.NoError(t, err)
+		certs[name] = c
+	}
+	return certs
+}
+
+// handshake connects a client with clientCfg to a server with serverCfg and returns the
+// client's and the server's errors.
+func handshake(t *testing.T, clientCfg, serverCfg *tls.Config) (clientErr, serverErr error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	done := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		done <- tls.Server(conn, serverCfg).Handshake()
+	}()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	clientErr = tls.Client(conn, clientCfg).Handshake()
+	if clientErr != nil {
+		conn.Close() // The server may still be waiting for us
+	}
+	return clientErr, <-done
+}
+
+func TestMutualTLS_AllowList(t *testing.T) {
+	dir := t.TempDir()
+	servers := loadDev(t, dir, Config{MutualTLS: true, AllowedClients: []string{"orderservice"}}, "userservice")
+	clients := loadDev(t, dir, Config{}, "orderservice", "productservice")
+	server := servers["userservice"].ServerConfig()
+
+	clientErr, serverErr := handshake(t, clients["orderservice"].ClientConfig("userservice"), server)
+	assert.NoError(t, clientErr)
+	assert.NoError(t, serverErr)
+
+	_, serverErr = handshake(t, clients["productservice"].ClientConfig("userservice"), server)
+	assert.ErrorIs(t, serverErr, ErrPeerNotAllowed)
+
+	// The client checks who it is talking to, too
+	clientErr, _ = handshake(t, clients["orderservice"].ClientConfig("productservice"), server)
+	assert.ErrorIs(t, clientErr, ErrPeerNotAllowed)
+}
+
+func TestCredentials_GRPC(t *testing.T) {
+	dir := t.TempDir()
+	servers := loadDev(t, dir, Config{MutualTLS: true, AllowedClients: []string{"orderservice"}}, "userservice")
+	clients := loadDev(t, dir, Config{}, "orderservice")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.Creds(servers["userservice"].ServerCredentials()))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	defer server.Stop()
+
+	// Through a target that isn't the certificate's name, as with several replicas
+	conn, err := grpc.NewClient("passthrough:///"+lis.Addr().String(),
+		grpc.WithTransportCredentials(clients["orderservice"].ClientCredentials("userservice")))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	var nilCerts *Certificates // TLS off
+	plain, err := grpc.NewClient("passthrough:///"+lis.Addr().String(), grpc.WithTransportCredentials(nilCerts.ClientCredentials()))
+	require.NoError(t, err)
+	defer plain.Close()
+	_, err = healthpb.NewHealthClient(plain).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Error(t, err)
+}
+
+func TestMutualTLS_RejectsOtherCA(t *testing.T) {
+	servers := loadDev(t, t.TempDir(), Config{MutualTLS: true}, "userservice")
+	strangers := loadDev(t, t.TempDir(), Config{}, "orderservice")
+
+	_, serverErr := handshake(t, strangers["orderservice"].ClientConfig("userservice"), servers["userservice"].ServerConfig())
+	assert.Error(t, serverErr)
+}
+
+func TestCertificates_Reload(t *testing.T) {
+	dir := t.TempDir()
+	c := loadDev(t, dir, Config{}, "userservice")["userservice"]
+	before, _ := c.current()
+
+	require.NoError(t, WriteDevCertificates(dir, "userservice"))
+	require.NoError(t, c.Reload())
+	after, _ := c.current()
+	assert.NotEqual(t, before.Leaf.SerialNumber, after.Leaf.SerialNumber)
+
+	// A broken key keeps the current certificate
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "userservice-key.pem"), []byte("garbage"), 0o644))
+	assert.Error(t, c.Reload())
+	kept, _ := c.current()
+	assert.Equal(t, after, kept)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	cfg, err := ConfigFromEnv()
+	require.NoError(t, err)
+	assert.False(t, cfg.Enabled())
+
+	t.Setenv("TLS_CERT_FILE", "/certs/userservice.pem")
+	t.Setenv("TLS_KEY_FILE", "/certs/userservice-key.pem")
+	t.Setenv("TLS_CA_FILE", "/certs/ca.pem")
+	t.Setenv("TLS_ALLOWED_CLIENTS", "orderservice, productservice")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err, "an allow-list needs mutual TLS")
+
+	t.Setenv("TLS_MUTUAL", "true")
+	cfg, err = ConfigFromEnv()
+	require.NoError(t, err)
+	assert.True(t, cfg.MutualTLS)
+	assert.Equal(t, []string{"orderservice", "productservice"}, cfg.AllowedClients)
+}
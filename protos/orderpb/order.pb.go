@@ -85,23 +85,134 @@ func (x *OrderItem) GetPriceAtPurchase() float64 {
 	return 0
 }
 
-// Order message
-type Order struct {
+// ShippingAddress is a copy of an address from the user's address book, taken when the
+// order was placed. Later edits to the address book don't change it.
+type ShippingAddress struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
-	Items         []*OrderItem           `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`
-	TotalAmount   float64                `protobuf:"fixed64,4,opt,name=total_amount,json=totalAmount,proto3" json:"total_amount,omitempty"`
-	Status        string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"` // e.g., PENDING, PROCESSING, COMPLETED, CANCELLED
-	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
-	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	AddressId     string                 `protobuf:"bytes,1,opt,name=address_id,json=addressId,proto3" json:"address_id,omitempty"` // The address book entry it was copied from
+	RecipientName string                 `protobuf:"bytes,2,opt,name=recipient_name,json=recipientName,proto3" json:"recipient_name,omitempty"`
+	Line1         string                 `protobuf:"bytes,3,opt,name=line1,proto3" json:"line1,omitempty"`
+	Line2         string                 `protobuf:"bytes,4,opt,name=line2,proto3" json:"line2,omitempty"`
+	City          string                 `protobuf:"bytes,5,opt,name=city,proto3" json:"city,omitempty"`
+	Region        string                 `protobuf:"bytes,6,opt,name=region,proto3" json:"region,omitempty"`
+	PostalCode    string                 `protobuf:"bytes,7,opt,name=postal_code,json=postalCode,proto3" json:"postal_code,omitempty"`
+	CountryCode   string                 `protobuf:"bytes,8,opt,name=country_code,json=countryCode,proto3" json:"country_code,omitempty"`
+	Phone         string                 `protobuf:"bytes,9,opt,name=phone,proto3" json:"phone,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
+func (x *ShippingAddress) Reset() {
+	*x = ShippingAddress{}
+	mi := &file_protos_order_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShippingAddress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShippingAddress) ProtoMessage() {}
+
+func (x *ShippingAddress) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShippingAddress.ProtoReflect.Descriptor instead.
+func (*ShippingAddress) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ShippingAddress) GetAddressId() string {
+	if x != nil {
+		return x.AddressId
+	}
+	return ""
+}
+
+func (x *ShippingAddress) GetRecipientName() string {
+	if x != nil {
+		return x.RecipientName
+	}
+	return ""
+}
+
+func (x *ShippingAddress) GetLine1() string {
+	if x != nil {
+		return x.Line1
+	}
+	return ""
+}
+
+func (x *ShippingAddress) GetLine2() string {
+	if x != nil {
+		return x.Line2
+	}
+	return ""
+}
+
+func (x *ShippingAddress) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *ShippingAddress) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *ShippingAddress) GetPostalCode() string {
+	if x != nil {
+		return x.PostalCode
+	}
+	return ""
+}
+
+func (x *ShippingAddress) GetCountryCode() string {
+	if x != nil {
+		return x.CountryCode
+	}
+	return ""
+}
+
+func (x *ShippingAddress) GetPhone() string {
+	if x != nil {
+		return x.Phone
+	}
+	return ""
+}
+
+// Order message
+type Order struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	UserId          string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Items           []*OrderItem           `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`
+	TotalAmount     float64                `protobuf:"fixed64,4,opt,name=total_amount,json=totalAmount,proto3" json:"total_amount,omitempty"`
+	Status          string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"` // e.g., PENDING, PROCESSING, COMPLETED, CANCELLED
+	CreatedAt       *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt       *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	ShippingAddress *ShippingAddress       `protobuf:"bytes,8,opt,name=shipping_address,json=shippingAddress,proto3" json:"shipping_address,omitempty"` // Unset for orders placed without one
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
 func (x *Order) Reset() {
 	*x = Order{}
-	mi := &file_protos_order_proto_msgTypes[1]
+	mi := &file_protos_order_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -113,7 +224,7 @@ func (x *Order) String() string {
 func (*Order) ProtoMessage() {}
 
 func (x *Order) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_order_proto_msgTypes[1]
+	mi := &file_protos_order_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -126,7 +237,7 @@ func (x *Order) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Order.ProtoReflect.Descriptor instead.
 func (*Order) Descriptor() ([]byte, []int) {
-	return file_protos_order_proto_rawDescGZIP(), []int{1}
+	return file_protos_order_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *Order) GetId() string {
@@ -178,18 +289,32 @@ func (x *Order) GetUpdatedAt() *timestamppb.Timestamp {
 	return nil
 }
 
+func (x *Order) GetShippingAddress() *ShippingAddress {
+	if x != nil {
+		return x.ShippingAddress
+	}
+	return nil
+}
+
 // Requests & Responses for CreateOrder
 type CreateOrderRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
-	Items         []*OrderItem           `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"` // Client sends product_id and quantity
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Items  []*OrderItem           `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"` // Client sends product_id and quantity
+	// Price_at_purchase will be fetched by OrderService
+	// Optional. Retrying with the same key and items returns the original order instead of
+	// creating a new one; reusing a key with different items is rejected.
+	IdempotencyKey string `protobuf:"bytes,3,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	// Optional. ID of an address in the user's address book (see UserService.AddAddress) to
+	// ship to. It is copied into the order.
+	ShippingAddressId string `protobuf:"bytes,4,opt,name=shipping_address_id,json=shippingAddressId,proto3" json:"shipping_address_id,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
 }
 
 func (x *CreateOrderRequest) Reset() {
 	*x = CreateOrderRequest{}
-	mi := &file_protos_order_proto_msgTypes[2]
+	mi := &file_protos_order_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -201,7 +326,7 @@ func (x *CreateOrderRequest) String() string {
 func (*CreateOrderRequest) ProtoMessage() {}
 
 func (x *CreateOrderRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_order_proto_msgTypes[2]
+	mi := &file_protos_order_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -214,7 +339,7 @@ func (x *CreateOrderRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreateOrderRequest.ProtoReflect.Descriptor instead.
 func (*CreateOrderRequest) Descriptor() ([]byte, []int) {
-	return file_protos_order_proto_rawDescGZIP(), []int{2}
+	return file_protos_order_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *CreateOrderRequest) GetUserId() string {
@@ -231,6 +356,20 @@ func (x *CreateOrderRequest) GetItems() []*OrderItem {
 	return nil
 }
 
+func (x *CreateOrderRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *CreateOrderRequest) GetShippingAddressId() string {
+	if x != nil {
+		return x.ShippingAddressId
+	}
+	return ""
+}
+
 type CreateOrderResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
@@ -240,7 +379,7 @@ type CreateOrderResponse struct {
 
 func (x *CreateOrderResponse) Reset() {
 	*x = CreateOrderResponse{}
-	mi := &file_protos_order_proto_msgTypes[3]
+	mi := &file_protos_order_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -252,7 +391,7 @@ func (x *CreateOrderResponse) String() string {
 func (*CreateOrderResponse) ProtoMessage() {}
 
 func (x *CreateOrderResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_order_proto_msgTypes[3]
+	mi := &file_protos_order_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -265,7 +404,7 @@ func (x *CreateOrderResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreateOrderResponse.ProtoReflect.Descriptor instead.
 func (*CreateOrderResponse) Descriptor() ([]byte, []int) {
-	return file_protos_order_proto_rawDescGZIP(), []int{3}
+	return file_protos_order_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *CreateOrderResponse) GetOrder() *Order {
@@ -285,7 +424,7 @@ type GetOrderRequest struct {
 
 func (x *GetOrderRequest) Reset() {
 	*x = GetOrderRequest{}
-	mi := &file_protos_order_proto_msgTypes[4]
+	mi := &file_protos_order_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -297,7 +436,7 @@ func (x *GetOrderRequest) String() string {
 func (*GetOrderRequest) ProtoMessage() {}
 
 func (x *GetOrderRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_order_proto_msgTypes[4]
+	mi := &file_protos_order_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -310,7 +449,7 @@ func (x *GetOrderRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetOrderRequest.ProtoReflect.Descriptor instead.
 func (*GetOrderRequest) Descriptor() ([]byte, []int) {
-	return file_protos_order_proto_rawDescGZIP(), []int{4}
+	return file_protos_order_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *GetOrderRequest) GetOrderId() string {
@@ -329,7 +468,7 @@ type GetOrderResponse struct {
 
 func (x *GetOrderResponse) Reset() {
 	*x = GetOrderResponse{}
-	mi := &file_protos_order_proto_msgTypes[5]
+	mi := &file_protos_order_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -341,7 +480,7 @@ func (x *GetOrderResponse) String() string {
 func (*GetOrderResponse) ProtoMessage() {}
 
 func (x *GetOrderResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_order_proto_msgTypes[5]
+	mi := &file_protos_order_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -354,7 +493,7 @@ func (x *GetOrderResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetOrderResponse.ProtoReflect.Descriptor instead.
 func (*GetOrderResponse) Descriptor() ([]byte, []int) {
-	return file_protos_order_proto_rawDescGZIP(), []int{5}
+	return file_protos_order_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *GetOrderResponse) GetOrder() *Order {
@@ -376,7 +515,7 @@ type ListUserOrdersRequest struct {
 
 func (x *ListUserOrdersRequest) Reset() {
 	*x = ListUserOrdersRequest{}
-	mi := &file_protos_order_proto_msgTypes[6]
+	mi := &file_protos_order_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -388,7 +527,7 @@ func (x *ListUserOrdersRequest) String() string {
 func (*ListUserOrdersRequest) ProtoMessage() {}
 
 func (x *ListUserOrdersRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_order_proto_msgTypes[6]
+	mi := &file_protos_order_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -401,7 +540,7 @@ func (x *ListUserOrdersRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListUserOrdersRequest.ProtoReflect.Descriptor instead.
 func (*ListUserOrdersRequest) Descriptor() ([]byte, []int) {
-	return file_protos_order_proto_rawDescGZIP(), []int{6}
+	return file_protos_order_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *ListUserOrdersRequest) GetUserId() string {
@@ -435,7 +574,7 @@ type ListUserOrdersResponse struct {
 
 func (x *ListUserOrdersResponse) Reset() {
 	*x = ListUserOrdersResponse{}
-	mi := &file_protos_order_proto_msgTypes[7]
+	mi := &file_protos_order_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -447,7 +586,7 @@ func (x *ListUserOrdersResponse) String() string {
 func (*ListUserOrdersResponse) ProtoMessage() {}
 
 func (x *ListUserOrdersResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_order_proto_msgTypes[7]
+	mi := &file_protos_order_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -460,7 +599,7 @@ func (x *ListUserOrdersResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListUserOrdersResponse.ProtoReflect.Descriptor instead.
 func (*ListUserOrdersResponse) Descriptor() ([]byte, []int) {
-	return file_protos_order_proto_rawDescGZIP(), []int{7}
+	return file_protos_order_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *ListUserOrdersResponse) GetOrders() []*Order {
@@ -477,6 +616,385 @@ func (x *ListUserOrdersResponse) GetNextPageToken() string {
 	return ""
 }
 
+// Requests & Responses for UpdateOrderStatus
+// Allowed transitions: PENDING -> PROCESSING|CANCELLED, PROCESSING -> COMPLETED|CANCELLED.
+// Anything else is rejected with FAILED_PRECONDITION.
+type UpdateOrderStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       string                 `protobuf:"bytes,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	NewStatus     string                 `protobuf:"bytes,2,opt,name=new_status,json=newStatus,proto3" json:"new_status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateOrderStatusRequest) Reset() {
+	*x = UpdateOrderStatusRequest{}
+	mi := &file_protos_order_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateOrderStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateOrderStatusRequest) ProtoMessage() {}
+
+func (x *UpdateOrderStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateOrderStatusRequest.ProtoReflect.Descriptor instead.
+func (*UpdateOrderStatusRequest) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *UpdateOrderStatusRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *UpdateOrderStatusRequest) GetNewStatus() string {
+	if x != nil {
+		return x.NewStatus
+	}
+	return ""
+}
+
+type UpdateOrderStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateOrderStatusResponse) Reset() {
+	*x = UpdateOrderStatusResponse{}
+	mi := &file_protos_order_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateOrderStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateOrderStatusResponse) ProtoMessage() {}
+
+func (x *UpdateOrderStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateOrderStatusResponse.ProtoReflect.Descriptor instead.
+func (*UpdateOrderStatusResponse) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UpdateOrderStatusResponse) GetOrder() *Order {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+// Requests & Responses for CancelOrder
+// Cancelling returns the ordered quantities to stock.
+type CancelOrderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       string                 `protobuf:"bytes,1,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelOrderRequest) Reset() {
+	*x = CancelOrderRequest{}
+	mi := &file_protos_order_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelOrderRequest) ProtoMessage() {}
+
+func (x *CancelOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelOrderRequest.ProtoReflect.Descriptor instead.
+func (*CancelOrderRequest) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CancelOrderRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+type CancelOrderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelOrderResponse) Reset() {
+	*x = CancelOrderResponse{}
+	mi := &file_protos_order_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelOrderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelOrderResponse) ProtoMessage() {}
+
+func (x *CancelOrderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelOrderResponse.ProtoReflect.Descriptor instead.
+func (*CancelOrderResponse) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CancelOrderResponse) GetOrder() *Order {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+// Requests & Responses for ExportUserOrders (services only), which the UserService calls
+// for a user's data export.
+type ExportUserOrdersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportUserOrdersRequest) Reset() {
+	*x = ExportUserOrdersRequest{}
+	mi := &file_protos_order_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportUserOrdersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportUserOrdersRequest) ProtoMessage() {}
+
+func (x *ExportUserOrdersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportUserOrdersRequest.ProtoReflect.Descriptor instead.
+func (*ExportUserOrdersRequest) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ExportUserOrdersRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type ExportUserOrdersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Orders        []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"` // Every order with its items, oldest first
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportUserOrdersResponse) Reset() {
+	*x = ExportUserOrdersResponse{}
+	mi := &file_protos_order_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportUserOrdersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportUserOrdersResponse) ProtoMessage() {}
+
+func (x *ExportUserOrdersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportUserOrdersResponse.ProtoReflect.Descriptor instead.
+func (*ExportUserOrdersResponse) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ExportUserOrdersResponse) GetOrders() []*Order {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+// Requests & Responses for EraseUserOrders (services only), which the UserService calls when
+// erasing a user. The orders move to pseudonym and their shipping addresses are cut down to
+// the country; amounts, items and statuses are kept for the accounts. Repeating the call
+// with the same pseudonym is harmless.
+type EraseUserOrdersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Pseudonym     string                 `protobuf:"bytes,2,opt,name=pseudonym,proto3" json:"pseudonym,omitempty"` // A UUID that only the UserService can map back to the user
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EraseUserOrdersRequest) Reset() {
+	*x = EraseUserOrdersRequest{}
+	mi := &file_protos_order_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EraseUserOrdersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EraseUserOrdersRequest) ProtoMessage() {}
+
+func (x *EraseUserOrdersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EraseUserOrdersRequest.ProtoReflect.Descriptor instead.
+func (*EraseUserOrdersRequest) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *EraseUserOrdersRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *EraseUserOrdersRequest) GetPseudonym() string {
+	if x != nil {
+		return x.Pseudonym
+	}
+	return ""
+}
+
+type EraseUserOrdersResponse struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	OrdersPseudonymised int64                  `protobuf:"varint,1,opt,name=orders_pseudonymised,json=ordersPseudonymised,proto3" json:"orders_pseudonymised,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *EraseUserOrdersResponse) Reset() {
+	*x = EraseUserOrdersResponse{}
+	mi := &file_protos_order_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EraseUserOrdersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EraseUserOrdersResponse) ProtoMessage() {}
+
+func (x *EraseUserOrdersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_order_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EraseUserOrdersResponse.ProtoReflect.Descriptor instead.
+func (*EraseUserOrdersResponse) Descriptor() ([]byte, []int) {
+	return file_protos_order_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *EraseUserOrdersResponse) GetOrdersPseudonymised() int64 {
+	if x != nil {
+		return x.OrdersPseudonymised
+	}
+	return 0
+}
+
 var File_protos_order_proto protoreflect.FileDescriptor
 
 const file_protos_order_proto_rawDesc = "" +
@@ -487,6 +1005,18 @@ const file_protos_order_proto_rawDesc = "" +
 	"product_id\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
 	"\bquantity\x18\x02 \x01(\x05R\bquantity\x12*\n" +
 	"\x11price_at_purchase\x18\x03 \x01(\x01R\x0fpriceAtPurchase\"\x89\x02\n" +
+	"\x0fShippingAddress\x12\x1d\n" +
+	"\n" +
+	"address_id\x18\x01 \x01(\tR\taddressId\x12%\n" +
+	"\x0erecipient_name\x18\x02 \x01(\tR\rrecipientName\x12\x14\n" +
+	"\x05line1\x18\x03 \x01(\tR\x05line1\x12\x14\n" +
+	"\x05line2\x18\x04 \x01(\tR\x05line2\x12\x12\n" +
+	"\x04city\x18\x05 \x01(\tR\x04city\x12\x16\n" +
+	"\x06region\x18\x06 \x01(\tR\x06region\x12\x1f\n" +
+	"\vpostal_code\x18\a \x01(\tR\n" +
+	"postalCode\x12!\n" +
+	"\fcountry_code\x18\b \x01(\tR\vcountryCode\x12\x14\n" +
+	"\x05phone\x18\t \x01(\tR\x05phone\"\xcc\x02\n" +
 	"\x05Order\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
 	"\auser_id\x18\x02 \x01(\tR\x06userId\x12&\n" +
@@ -496,10 +1026,13 @@ const file_protos_order_proto_rawDesc = "" +
 	"\n" +
 	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
 	"\n" +
-	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"U\n" +
+	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12A\n" +
+	"\x10shipping_address\x18\b \x01(\v2\x16.order.ShippingAddressR\x0fshippingAddress\"\xae\x01\n" +
 	"\x12CreateOrderRequest\x12\x17\n" +
 	"\auser_id\x18\x01 \x01(\tR\x06userId\x12&\n" +
-	"\x05items\x18\x02 \x03(\v2\x10.order.OrderItemR\x05items\"9\n" +
+	"\x05items\x18\x02 \x03(\v2\x10.order.OrderItemR\x05items\x12'\n" +
+	"\x0fidempotency_key\x18\x03 \x01(\tR\x0eidempotencyKey\x12.\n" +
+	"\x13shipping_address_id\x18\x04 \x01(\tR\x11shippingAddressId\"9\n" +
 	"\x13CreateOrderResponse\x12\"\n" +
 	"\x05order\x18\x01 \x01(\v2\f.order.OrderR\x05order\",\n" +
 	"\x0fGetOrderRequest\x12\x19\n" +
@@ -513,11 +1046,36 @@ const file_protos_order_proto_rawDesc = "" +
 	"page_token\x18\x03 \x01(\tR\tpageToken\"f\n" +
 	"\x16ListUserOrdersResponse\x12$\n" +
 	"\x06orders\x18\x01 \x03(\v2\f.order.OrderR\x06orders\x12&\n" +
-	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken2\xe0\x01\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"T\n" +
+	"\x18UpdateOrderStatusRequest\x12\x19\n" +
+	"\border_id\x18\x01 \x01(\tR\aorderId\x12\x1d\n" +
+	"\n" +
+	"new_status\x18\x02 \x01(\tR\tnewStatus\"?\n" +
+	"\x19UpdateOrderStatusResponse\x12\"\n" +
+	"\x05order\x18\x01 \x01(\v2\f.order.OrderR\x05order\"/\n" +
+	"\x12CancelOrderRequest\x12\x19\n" +
+	"\border_id\x18\x01 \x01(\tR\aorderId\"9\n" +
+	"\x13CancelOrderResponse\x12\"\n" +
+	"\x05order\x18\x01 \x01(\v2\f.order.OrderR\x05order\"2\n" +
+	"\x17ExportUserOrdersRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\"@\n" +
+	"\x18ExportUserOrdersResponse\x12$\n" +
+	"\x06orders\x18\x01 \x03(\v2\f.order.OrderR\x06orders\"O\n" +
+	"\x16EraseUserOrdersRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1c\n" +
+	"\tpseudonym\x18\x02 \x01(\tR\tpseudonym\"L\n" +
+	"\x17EraseUserOrdersResponse\x121\n" +
+	"\x14orders_pseudonymised\x18\x01 \x01(\x03R\x13ordersPseudonymised2\xdb\x04\n" +
 	"\fOrderService\x12D\n" +
 	"\vCreateOrder\x12\x19.order.CreateOrderRequest\x1a\x1a.order.CreateOrderResponse\x12;\n" +
 	"\bGetOrder\x12\x16.order.GetOrderRequest\x1a\x17.order.GetOrderResponse\x12M\n" +
-	"\x0eListUserOrders\x12\x1c.order.ListUserOrdersRequest\x1a\x1d.order.ListUserOrdersResponseB&Z$microservices-project/protos/orderpbb\x06proto3"
+	"\x0eListUserOrders\x12\x1c.order.ListUserOrdersRequest\x1a\x1d.order.ListUserOrdersResponse\x12V\n" +
+	"\x11UpdateOrderStatus\x12\x1f.order.UpdateOrderStatusRequest\x1a .order.UpdateOrderStatusResponse\x12D\n" +
+	"\vCancelOrder\x12\x19.order.CancelOrderRequest\x1a\x1a.order.CancelOrderResponse\x124\n" +
+	"\n" +
+	"WatchOrder\x12\x16.order.GetOrderRequest\x1a\f.order.Order0\x01\x12S\n" +
+	"\x10ExportUserOrders\x12\x1e.order.ExportUserOrdersRequest\x1a\x1f.order.ExportUserOrdersResponse\x12P\n" +
+	"\x0fEraseUserOrders\x12\x1d.order.EraseUserOrdersRequest\x1a\x1e.order.EraseUserOrdersResponseB&Z$microservices-project/protos/orderpbb\x06proto3"
 
 var (
 	file_protos_order_proto_rawDescOnce sync.Once
@@ -531,37 +1089,60 @@ func file_protos_order_proto_rawDescGZIP() []byte {
 	return file_protos_order_proto_rawDescData
 }
 
-var file_protos_order_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_protos_order_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
 var file_protos_order_proto_goTypes = []any{
-	(*OrderItem)(nil),              // 0: order.OrderItem
-	(*Order)(nil),                  // 1: order.Order
-	(*CreateOrderRequest)(nil),     // 2: order.CreateOrderRequest
-	(*CreateOrderResponse)(nil),    // 3: order.CreateOrderResponse
-	(*GetOrderRequest)(nil),        // 4: order.GetOrderRequest
-	(*GetOrderResponse)(nil),       // 5: order.GetOrderResponse
-	(*ListUserOrdersRequest)(nil),  // 6: order.ListUserOrdersRequest
-	(*ListUserOrdersResponse)(nil), // 7: order.ListUserOrdersResponse
-	(*timestamppb.Timestamp)(nil),  // 8: google.protobuf.Timestamp
+	(*OrderItem)(nil),                 // 0: order.OrderItem
+	(*ShippingAddress)(nil),           // 1: order.ShippingAddress
+	(*Order)(nil),                     // 2: order.Order
+	(*CreateOrderRequest)(nil),        // 3: order.CreateOrderRequest
+	(*CreateOrderResponse)(nil),       // 4: order.CreateOrderResponse
+	(*GetOrderRequest)(nil),           // 5: order.GetOrderRequest
+	(*GetOrderResponse)(nil),          // 6: order.GetOrderResponse
+	(*ListUserOrdersRequest)(nil),     // 7: order.ListUserOrdersRequest
+	(*ListUserOrdersResponse)(nil),    // 8: order.ListUserOrdersResponse
+	(*UpdateOrderStatusRequest)(nil),  // 9: order.UpdateOrderStatusRequest
+	(*UpdateOrderStatusResponse)(nil), // 10: order.UpdateOrderStatusResponse
+	(*CancelOrderRequest)(nil),        // 11: order.CancelOrderRequest
+	(*CancelOrderResponse)(nil),       // 12: order.CancelOrderResponse
+	(*ExportUserOrdersRequest)(nil),   // 13: order.ExportUserOrdersRequest
+	(*ExportUserOrdersResponse)(nil),  // 14: order.ExportUserOrdersResponse
+	(*EraseUserOrdersRequest)(nil),    // 15: order.EraseUserOrdersRequest
+	(*EraseUserOrdersResponse)(nil),   // 16: order.EraseUserOrdersResponse
+	(*timestamppb.Timestamp)(nil),     // 17: google.protobuf.Timestamp
 }
 var file_protos_order_proto_depIdxs = []int32{
 	0,  // 0: order.Order.items:type_name -> order.OrderItem
-	8,  // 1: order.Order.created_at:type_name -> google.protobuf.Timestamp
-	8,  // 2: order.Order.updated_at:type_name -> google.protobuf.Timestamp
-	0,  // 3: order.CreateOrderRequest.items:type_name -> order.OrderItem
-	1,  // 4: order.CreateOrderResponse.order:type_name -> order.Order
-	1,  // 5: order.GetOrderResponse.order:type_name -> order.Order
-	1,  // 6: order.ListUserOrdersResponse.orders:type_name -> order.Order
-	2,  // 7: order.OrderService.CreateOrder:input_type -> order.CreateOrderRequest
-	4,  // 8: order.OrderService.GetOrder:input_type -> order.GetOrderRequest
-	6,  // 9: order.OrderService.ListUserOrders:input_type -> order.ListUserOrdersRequest
-	3,  // 10: order.OrderService.CreateOrder:output_type -> order.CreateOrderResponse
-	5,  // 11: order.OrderService.GetOrder:output_type -> order.GetOrderResponse
-	7,  // 12: order.OrderService.ListUserOrders:output_type -> order.ListUserOrdersResponse
-	10, // [10:13] is the sub-list for method output_type
-	7,  // [7:10] is the sub-list for method input_type
-	7,  // [7:7] is the sub-list for extension type_name
-	7,  // [7:7] is the sub-list for extension extendee
-	0,  // [0:7] is the sub-list for field type_name
+	17, // 1: order.Order.created_at:type_name -> google.protobuf.Timestamp
+	17, // 2: order.Order.updated_at:type_name -> google.protobuf.Timestamp
+	1,  // 3: order.Order.shipping_address:type_name -> order.ShippingAddress
+	0,  // 4: order.CreateOrderRequest.items:type_name -> order.OrderItem
+	2,  // 5: order.CreateOrderResponse.order:type_name -> order.Order
+	2,  // 6: order.GetOrderResponse.order:type_name -> order.Order
+	2,  // 7: order.ListUserOrdersResponse.orders:type_name -> order.Order
+	2,  // 8: order.UpdateOrderStatusResponse.order:type_name -> order.Order
+	2,  // 9: order.CancelOrderResponse.order:type_name -> order.Order
+	2,  // 10: order.ExportUserOrdersResponse.orders:type_name -> order.Order
+	3,  // 11: order.OrderService.CreateOrder:input_type -> order.CreateOrderRequest
+	5,  // 12: order.OrderService.GetOrder:input_type -> order.GetOrderRequest
+	7,  // 13: order.OrderService.ListUserOrders:input_type -> order.ListUserOrdersRequest
+	9,  // 14: order.OrderService.UpdateOrderStatus:input_type -> order.UpdateOrderStatusRequest
+	11, // 15: order.OrderService.CancelOrder:input_type -> order.CancelOrderRequest
+	5,  // 16: order.OrderService.WatchOrder:input_type -> order.GetOrderRequest
+	13, // 17: order.OrderService.ExportUserOrders:input_type -> order.ExportUserOrdersRequest
+	15, // 18: order.OrderService.EraseUserOrders:input_type -> order.EraseUserOrdersRequest
+	4,  // 19: order.OrderService.CreateOrder:output_type -> order.CreateOrderResponse
+	6,  // 20: order.OrderService.GetOrder:output_type -> order.GetOrderResponse
+	8,  // 21: order.OrderService.ListUserOrders:output_type -> order.ListUserOrdersResponse
+	10, // 22: order.OrderService.UpdateOrderStatus:output_type -> order.UpdateOrderStatusResponse
+	12, // 23: order.OrderService.CancelOrder:output_type -> order.CancelOrderResponse
+	2,  // 24: order.OrderService.WatchOrder:output_type -> order.Order
+	14, // 25: order.OrderService.ExportUserOrders:output_type -> order.ExportUserOrdersResponse
+	16, // 26: order.OrderService.EraseUserOrders:output_type -> order.EraseUserOrdersResponse
+	19, // [19:27] is the sub-list for method output_type
+	11, // [11:19] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_protos_order_proto_init() }
@@ -575,7 +1156,7 @@ func file_protos_order_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protos_order_proto_rawDesc), len(file_protos_order_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   8,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -26,16 +26,17 @@ const (
 
 // Product message
 type Product struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
-	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
-	Price         float64                `protobuf:"fixed64,4,opt,name=price,proto3" json:"price,omitempty"` // Using double for price, could also use string for precision with decimal libraries
-	StockQuantity int32                  `protobuf:"varint,5,opt,name=stock_quantity,json=stockQuantity,proto3" json:"stock_quantity,omitempty"`
-	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
-	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Id                string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name              string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description       string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Price             float64                `protobuf:"fixed64,4,opt,name=price,proto3" json:"price,omitempty"`                                     // Using double for price, could also use string for precision with decimal libraries
+	StockQuantity     int32                  `protobuf:"varint,5,opt,name=stock_quantity,json=stockQuantity,proto3" json:"stock_quantity,omitempty"` // On-hand quantity
+	CreatedAt         *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt         *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	AvailableQuantity int32                  `protobuf:"varint,8,opt,name=available_quantity,json=availableQuantity,proto3" json:"available_quantity,omitempty"` // On-hand minus active (unexpired) reservations
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
 }
 
 func (x *Product) Reset() {
@@ -117,6 +118,13 @@ func (x *Product) GetUpdatedAt() *timestamppb.Timestamp {
 	return nil
 }
 
+func (x *Product) GetAvailableQuantity() int32 {
+	if x != nil {
+		return x.AvailableQuantity
+	}
+	return 0
+}
+
 // Requests & Responses for CreateProduct
 type CreateProductRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -319,6 +327,103 @@ func (x *GetProductResponse) GetProduct() *Product {
 	return nil
 }
 
+// Requests & Responses for BatchGetProducts
+type BatchGetProductsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductIds    []string               `protobuf:"bytes,1,rep,name=product_ids,json=productIds,proto3" json:"product_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetProductsRequest) Reset() {
+	*x = BatchGetProductsRequest{}
+	mi := &file_protos_product_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetProductsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetProductsRequest) ProtoMessage() {}
+
+func (x *BatchGetProductsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetProductsRequest.ProtoReflect.Descriptor instead.
+func (*BatchGetProductsRequest) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchGetProductsRequest) GetProductIds() []string {
+	if x != nil {
+		return x.ProductIds
+	}
+	return nil
+}
+
+type BatchGetProductsResponse struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Products          []*Product             `protobuf:"bytes,1,rep,name=products,proto3" json:"products,omitempty"`                                              // In no particular order
+	MissingProductIds []string               `protobuf:"bytes,2,rep,name=missing_product_ids,json=missingProductIds,proto3" json:"missing_product_ids,omitempty"` // Requested IDs that do not exist
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *BatchGetProductsResponse) Reset() {
+	*x = BatchGetProductsResponse{}
+	mi := &file_protos_product_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetProductsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetProductsResponse) ProtoMessage() {}
+
+func (x *BatchGetProductsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetProductsResponse.ProtoReflect.Descriptor instead.
+func (*BatchGetProductsResponse) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchGetProductsResponse) GetProducts() []*Product {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+func (x *BatchGetProductsResponse) GetMissingProductIds() []string {
+	if x != nil {
+		return x.MissingProductIds
+	}
+	return nil
+}
+
 // Requests & Responses for ListProducts
 type ListProductsRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -330,7 +435,7 @@ type ListProductsRequest struct {
 
 func (x *ListProductsRequest) Reset() {
 	*x = ListProductsRequest{}
-	mi := &file_protos_product_proto_msgTypes[5]
+	mi := &file_protos_product_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -342,7 +447,7 @@ func (x *ListProductsRequest) String() string {
 func (*ListProductsRequest) ProtoMessage() {}
 
 func (x *ListProductsRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_product_proto_msgTypes[5]
+	mi := &file_protos_product_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -355,7 +460,7 @@ func (x *ListProductsRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListProductsRequest.ProtoReflect.Descriptor instead.
 func (*ListProductsRequest) Descriptor() ([]byte, []int) {
-	return file_protos_product_proto_rawDescGZIP(), []int{5}
+	return file_protos_product_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *ListProductsRequest) GetPageSize() int32 {
@@ -382,7 +487,7 @@ type ListProductsResponse struct {
 
 func (x *ListProductsResponse) Reset() {
 	*x = ListProductsResponse{}
-	mi := &file_protos_product_proto_msgTypes[6]
+	mi := &file_protos_product_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -394,7 +499,7 @@ func (x *ListProductsResponse) String() string {
 func (*ListProductsResponse) ProtoMessage() {}
 
 func (x *ListProductsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_product_proto_msgTypes[6]
+	mi := &file_protos_product_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -407,7 +512,7 @@ func (x *ListProductsResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListProductsResponse.ProtoReflect.Descriptor instead.
 func (*ListProductsResponse) Descriptor() ([]byte, []int) {
-	return file_protos_product_proto_rawDescGZIP(), []int{6}
+	return file_protos_product_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *ListProductsResponse) GetProducts() []*Product {
@@ -438,7 +543,7 @@ type UpdateProductRequest struct {
 
 func (x *UpdateProductRequest) Reset() {
 	*x = UpdateProductRequest{}
-	mi := &file_protos_product_proto_msgTypes[7]
+	mi := &file_protos_product_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -450,7 +555,7 @@ func (x *UpdateProductRequest) String() string {
 func (*UpdateProductRequest) ProtoMessage() {}
 
 func (x *UpdateProductRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_product_proto_msgTypes[7]
+	mi := &file_protos_product_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -463,7 +568,7 @@ func (x *UpdateProductRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateProductRequest.ProtoReflect.Descriptor instead.
 func (*UpdateProductRequest) Descriptor() ([]byte, []int) {
-	return file_protos_product_proto_rawDescGZIP(), []int{7}
+	return file_protos_product_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *UpdateProductRequest) GetProductId() string {
@@ -510,7 +615,7 @@ type UpdateProductResponse struct {
 
 func (x *UpdateProductResponse) Reset() {
 	*x = UpdateProductResponse{}
-	mi := &file_protos_product_proto_msgTypes[8]
+	mi := &file_protos_product_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -522,7 +627,7 @@ func (x *UpdateProductResponse) String() string {
 func (*UpdateProductResponse) ProtoMessage() {}
 
 func (x *UpdateProductResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_product_proto_msgTypes[8]
+	mi := &file_protos_product_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -535,7 +640,7 @@ func (x *UpdateProductResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateProductResponse.ProtoReflect.Descriptor instead.
 func (*UpdateProductResponse) Descriptor() ([]byte, []int) {
-	return file_protos_product_proto_rawDescGZIP(), []int{8}
+	return file_protos_product_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *UpdateProductResponse) GetProduct() *Product {
@@ -555,7 +660,7 @@ type DeleteProductRequest struct {
 
 func (x *DeleteProductRequest) Reset() {
 	*x = DeleteProductRequest{}
-	mi := &file_protos_product_proto_msgTypes[9]
+	mi := &file_protos_product_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -567,7 +672,7 @@ func (x *DeleteProductRequest) String() string {
 func (*DeleteProductRequest) ProtoMessage() {}
 
 func (x *DeleteProductRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_product_proto_msgTypes[9]
+	mi := &file_protos_product_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -580,7 +685,7 @@ func (x *DeleteProductRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeleteProductRequest.ProtoReflect.Descriptor instead.
 func (*DeleteProductRequest) Descriptor() ([]byte, []int) {
-	return file_protos_product_proto_rawDescGZIP(), []int{9}
+	return file_protos_product_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *DeleteProductRequest) GetProductId() string {
@@ -599,7 +704,7 @@ type DeleteProductResponse struct {
 
 func (x *DeleteProductResponse) Reset() {
 	*x = DeleteProductResponse{}
-	mi := &file_protos_product_proto_msgTypes[10]
+	mi := &file_protos_product_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -611,7 +716,7 @@ func (x *DeleteProductResponse) String() string {
 func (*DeleteProductResponse) ProtoMessage() {}
 
 func (x *DeleteProductResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_product_proto_msgTypes[10]
+	mi := &file_protos_product_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -624,7 +729,7 @@ func (x *DeleteProductResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeleteProductResponse.ProtoReflect.Descriptor instead.
 func (*DeleteProductResponse) Descriptor() ([]byte, []int) {
-	return file_protos_product_proto_rawDescGZIP(), []int{10}
+	return file_protos_product_proto_rawDescGZIP(), []int{12}
 }
 
 func (x *DeleteProductResponse) GetMessage() string {
@@ -645,7 +750,7 @@ type UpdateStockRequest struct {
 
 func (x *UpdateStockRequest) Reset() {
 	*x = UpdateStockRequest{}
-	mi := &file_protos_product_proto_msgTypes[11]
+	mi := &file_protos_product_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -657,7 +762,7 @@ func (x *UpdateStockRequest) String() string {
 func (*UpdateStockRequest) ProtoMessage() {}
 
 func (x *UpdateStockRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_product_proto_msgTypes[11]
+	mi := &file_protos_product_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -670,7 +775,7 @@ func (x *UpdateStockRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateStockRequest.ProtoReflect.Descriptor instead.
 func (*UpdateStockRequest) Descriptor() ([]byte, []int) {
-	return file_protos_product_proto_rawDescGZIP(), []int{11}
+	return file_protos_product_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *UpdateStockRequest) GetProductId() string {
@@ -696,7 +801,7 @@ type UpdateStockResponse struct {
 
 func (x *UpdateStockResponse) Reset() {
 	*x = UpdateStockResponse{}
-	mi := &file_protos_product_proto_msgTypes[12]
+	mi := &file_protos_product_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -708,7 +813,7 @@ func (x *UpdateStockResponse) String() string {
 func (*UpdateStockResponse) ProtoMessage() {}
 
 func (x *UpdateStockResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_product_proto_msgTypes[12]
+	mi := &file_protos_product_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -721,7 +826,7 @@ func (x *UpdateStockResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateStockResponse.ProtoReflect.Descriptor instead.
 func (*UpdateStockResponse) Descriptor() ([]byte, []int) {
-	return file_protos_product_proto_rawDescGZIP(), []int{12}
+	return file_protos_product_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *UpdateStockResponse) GetProduct() *Product {
@@ -731,11 +836,527 @@ func (x *UpdateStockResponse) GetProduct() *Product {
 	return nil
 }
 
+// BatchUpdateStock applies several stock changes in one transaction: all of them or none.
+type BatchUpdateStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Updates       []*UpdateStockRequest  `protobuf:"bytes,1,rep,name=updates,proto3" json:"updates,omitempty"` // Changes to the same product are added together
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchUpdateStockRequest) Reset() {
+	*x = BatchUpdateStockRequest{}
+	mi := &file_protos_product_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchUpdateStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchUpdateStockRequest) ProtoMessage() {}
+
+func (x *BatchUpdateStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchUpdateStockRequest.ProtoReflect.Descriptor instead.
+func (*BatchUpdateStockRequest) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *BatchUpdateStockRequest) GetUpdates() []*UpdateStockRequest {
+	if x != nil {
+		return x.Updates
+	}
+	return nil
+}
+
+type BatchUpdateStockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*UpdateStockResponse `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"` // One per distinct product, ordered by product ID
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchUpdateStockResponse) Reset() {
+	*x = BatchUpdateStockResponse{}
+	mi := &file_protos_product_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchUpdateStockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchUpdateStockResponse) ProtoMessage() {}
+
+func (x *BatchUpdateStockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchUpdateStockResponse.ProtoReflect.Descriptor instead.
+func (*BatchUpdateStockResponse) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *BatchUpdateStockResponse) GetResults() []*UpdateStockResponse {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// Two-phase stock reservations (used by OrderService).
+// ReserveStock holds inventory without touching stock_quantity; CommitReservation deducts it,
+// ReleaseReservation gives it back. Uncommitted reservations expire after a TTL.
+type ReservationItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Quantity      int32                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReservationItem) Reset() {
+	*x = ReservationItem{}
+	mi := &file_protos_product_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReservationItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReservationItem) ProtoMessage() {}
+
+func (x *ReservationItem) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReservationItem.ProtoReflect.Descriptor instead.
+func (*ReservationItem) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ReservationItem) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *ReservationItem) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+type Reservation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Reference     string                 `protobuf:"bytes,2,opt,name=reference,proto3" json:"reference,omitempty"` // Caller supplied, e.g. the order ID
+	Items         []*ReservationItem     `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`
+	Status        string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"` // PENDING, COMMITTED, RELEASED, EXPIRED
+	ExpiresAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Reservation) Reset() {
+	*x = Reservation{}
+	mi := &file_protos_product_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reservation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reservation) ProtoMessage() {}
+
+func (x *Reservation) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reservation.ProtoReflect.Descriptor instead.
+func (*Reservation) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *Reservation) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Reservation) GetReference() string {
+	if x != nil {
+		return x.Reference
+	}
+	return ""
+}
+
+func (x *Reservation) GetItems() []*ReservationItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Reservation) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Reservation) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *Reservation) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Reservation) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type ReserveStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reference     string                 `protobuf:"bytes,1,opt,name=reference,proto3" json:"reference,omitempty"` // A repeated request with the same reference returns the reservation it made
+	Items         []*ReservationItem     `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReserveStockRequest) Reset() {
+	*x = ReserveStockRequest{}
+	mi := &file_protos_product_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReserveStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReserveStockRequest) ProtoMessage() {}
+
+func (x *ReserveStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReserveStockRequest.ProtoReflect.Descriptor instead.
+func (*ReserveStockRequest) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ReserveStockRequest) GetReference() string {
+	if x != nil {
+		return x.Reference
+	}
+	return ""
+}
+
+func (x *ReserveStockRequest) GetItems() []*ReservationItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type ReserveStockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reservation   *Reservation           `protobuf:"bytes,1,opt,name=reservation,proto3" json:"reservation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReserveStockResponse) Reset() {
+	*x = ReserveStockResponse{}
+	mi := &file_protos_product_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReserveStockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReserveStockResponse) ProtoMessage() {}
+
+func (x *ReserveStockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReserveStockResponse.ProtoReflect.Descriptor instead.
+func (*ReserveStockResponse) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ReserveStockResponse) GetReservation() *Reservation {
+	if x != nil {
+		return x.Reservation
+	}
+	return nil
+}
+
+type CommitReservationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ReservationId string                 `protobuf:"bytes,1,opt,name=reservation_id,json=reservationId,proto3" json:"reservation_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitReservationRequest) Reset() {
+	*x = CommitReservationRequest{}
+	mi := &file_protos_product_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitReservationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitReservationRequest) ProtoMessage() {}
+
+func (x *CommitReservationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitReservationRequest.ProtoReflect.Descriptor instead.
+func (*CommitReservationRequest) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *CommitReservationRequest) GetReservationId() string {
+	if x != nil {
+		return x.ReservationId
+	}
+	return ""
+}
+
+type CommitReservationResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reservation   *Reservation           `protobuf:"bytes,1,opt,name=reservation,proto3" json:"reservation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitReservationResponse) Reset() {
+	*x = CommitReservationResponse{}
+	mi := &file_protos_product_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitReservationResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitReservationResponse) ProtoMessage() {}
+
+func (x *CommitReservationResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitReservationResponse.ProtoReflect.Descriptor instead.
+func (*CommitReservationResponse) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *CommitReservationResponse) GetReservation() *Reservation {
+	if x != nil {
+		return x.Reservation
+	}
+	return nil
+}
+
+type ReleaseReservationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ReservationId string                 `protobuf:"bytes,1,opt,name=reservation_id,json=reservationId,proto3" json:"reservation_id,omitempty"`
+	Reference     string                 `protobuf:"bytes,2,opt,name=reference,proto3" json:"reference,omitempty"` // Instead of reservation_id: the reservation made with this reference, if any
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseReservationRequest) Reset() {
+	*x = ReleaseReservationRequest{}
+	mi := &file_protos_product_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseReservationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseReservationRequest) ProtoMessage() {}
+
+func (x *ReleaseReservationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseReservationRequest.ProtoReflect.Descriptor instead.
+func (*ReleaseReservationRequest) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ReleaseReservationRequest) GetReservationId() string {
+	if x != nil {
+		return x.ReservationId
+	}
+	return ""
+}
+
+func (x *ReleaseReservationRequest) GetReference() string {
+	if x != nil {
+		return x.Reference
+	}
+	return ""
+}
+
+type ReleaseReservationResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reservation   *Reservation           `protobuf:"bytes,1,opt,name=reservation,proto3" json:"reservation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseReservationResponse) Reset() {
+	*x = ReleaseReservationResponse{}
+	mi := &file_protos_product_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseReservationResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseReservationResponse) ProtoMessage() {}
+
+func (x *ReleaseReservationResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_product_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseReservationResponse.ProtoReflect.Descriptor instead.
+func (*ReleaseReservationResponse) Descriptor() ([]byte, []int) {
+	return file_protos_product_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ReleaseReservationResponse) GetReservation() *Reservation {
+	if x != nil {
+		return x.Reservation
+	}
+	return nil
+}
+
 var File_protos_product_proto protoreflect.FileDescriptor
 
 const file_protos_product_proto_rawDesc = "" +
 	"\n" +
-	"\x14protos/product.proto\x12\aproduct\x1a\x1fgoogle/protobuf/timestamp.proto\"\x82\x02\n" +
+	"\x14protos/product.proto\x12\aproduct\x1a\x1fgoogle/protobuf/timestamp.proto\"\xb1\x02\n" +
 	"\aProduct\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12 \n" +
@@ -745,7 +1366,8 @@ const file_protos_product_proto_rawDesc = "" +
 	"\n" +
 	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
 	"\n" +
-	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"\x89\x01\n" +
+	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12-\n" +
+	"\x12available_quantity\x18\b \x01(\x05R\x11availableQuantity\"\x89\x01\n" +
 	"\x14CreateProductRequest\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12 \n" +
 	"\vdescription\x18\x02 \x01(\tR\vdescription\x12\x14\n" +
@@ -757,7 +1379,13 @@ const file_protos_product_proto_rawDesc = "" +
 	"\n" +
 	"product_id\x18\x01 \x01(\tR\tproductId\"@\n" +
 	"\x12GetProductResponse\x12*\n" +
-	"\aproduct\x18\x01 \x01(\v2\x10.product.ProductR\aproduct\"Q\n" +
+	"\aproduct\x18\x01 \x01(\v2\x10.product.ProductR\aproduct\":\n" +
+	"\x17BatchGetProductsRequest\x12\x1f\n" +
+	"\vproduct_ids\x18\x01 \x03(\tR\n" +
+	"productIds\"x\n" +
+	"\x18BatchGetProductsResponse\x12,\n" +
+	"\bproducts\x18\x01 \x03(\v2\x10.product.ProductR\bproducts\x12.\n" +
+	"\x13missing_product_ids\x18\x02 \x03(\tR\x11missingProductIds\"Q\n" +
 	"\x13ListProductsRequest\x12\x1b\n" +
 	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
 	"\n" +
@@ -784,15 +1412,53 @@ const file_protos_product_proto_rawDesc = "" +
 	"product_id\x18\x01 \x01(\tR\tproductId\x12'\n" +
 	"\x0fquantity_change\x18\x02 \x01(\x05R\x0equantityChange\"A\n" +
 	"\x13UpdateStockResponse\x12*\n" +
-	"\aproduct\x18\x01 \x01(\v2\x10.product.ProductR\aproduct2\xde\x03\n" +
+	"\aproduct\x18\x01 \x01(\v2\x10.product.ProductR\aproduct\"P\n" +
+	"\x17BatchUpdateStockRequest\x125\n" +
+	"\aupdates\x18\x01 \x03(\v2\x1b.product.UpdateStockRequestR\aupdates\"R\n" +
+	"\x18BatchUpdateStockResponse\x126\n" +
+	"\aresults\x18\x01 \x03(\v2\x1c.product.UpdateStockResponseR\aresults\"L\n" +
+	"\x0fReservationItem\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\"\xb4\x02\n" +
+	"\vReservation\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1c\n" +
+	"\treference\x18\x02 \x01(\tR\treference\x12.\n" +
+	"\x05items\x18\x03 \x03(\v2\x18.product.ReservationItemR\x05items\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x129\n" +
+	"\n" +
+	"expires_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\x129\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"c\n" +
+	"\x13ReserveStockRequest\x12\x1c\n" +
+	"\treference\x18\x01 \x01(\tR\treference\x12.\n" +
+	"\x05items\x18\x02 \x03(\v2\x18.product.ReservationItemR\x05items\"N\n" +
+	"\x14ReserveStockResponse\x126\n" +
+	"\vreservation\x18\x01 \x01(\v2\x14.product.ReservationR\vreservation\"A\n" +
+	"\x18CommitReservationRequest\x12%\n" +
+	"\x0ereservation_id\x18\x01 \x01(\tR\rreservationId\"S\n" +
+	"\x19CommitReservationResponse\x126\n" +
+	"\vreservation\x18\x01 \x01(\v2\x14.product.ReservationR\vreservation\"`\n" +
+	"\x19ReleaseReservationRequest\x12%\n" +
+	"\x0ereservation_id\x18\x01 \x01(\tR\rreservationId\x12\x1c\n" +
+	"\treference\x18\x02 \x01(\tR\treference\"T\n" +
+	"\x1aReleaseReservationResponse\x126\n" +
+	"\vreservation\x18\x01 \x01(\v2\x14.product.ReservationR\vreservation2\x98\a\n" +
 	"\x0eProductService\x12N\n" +
 	"\rCreateProduct\x12\x1d.product.CreateProductRequest\x1a\x1e.product.CreateProductResponse\x12E\n" +
 	"\n" +
-	"GetProduct\x12\x1a.product.GetProductRequest\x1a\x1b.product.GetProductResponse\x12K\n" +
+	"GetProduct\x12\x1a.product.GetProductRequest\x1a\x1b.product.GetProductResponse\x12W\n" +
+	"\x10BatchGetProducts\x12 .product.BatchGetProductsRequest\x1a!.product.BatchGetProductsResponse\x12K\n" +
 	"\fListProducts\x12\x1c.product.ListProductsRequest\x1a\x1d.product.ListProductsResponse\x12N\n" +
 	"\rUpdateProduct\x12\x1d.product.UpdateProductRequest\x1a\x1e.product.UpdateProductResponse\x12N\n" +
 	"\rDeleteProduct\x12\x1d.product.DeleteProductRequest\x1a\x1e.product.DeleteProductResponse\x12H\n" +
-	"\vUpdateStock\x12\x1b.product.UpdateStockRequest\x1a\x1c.product.UpdateStockResponseB(Z&microservices-project/protos/productpbb\x06proto3"
+	"\vUpdateStock\x12\x1b.product.UpdateStockRequest\x1a\x1c.product.UpdateStockResponse\x12W\n" +
+	"\x10BatchUpdateStock\x12 .product.BatchUpdateStockRequest\x1a!.product.BatchUpdateStockResponse\x12K\n" +
+	"\fReserveStock\x12\x1c.product.ReserveStockRequest\x1a\x1d.product.ReserveStockResponse\x12Z\n" +
+	"\x11CommitReservation\x12!.product.CommitReservationRequest\x1a\".product.CommitReservationResponse\x12]\n" +
+	"\x12ReleaseReservation\x12\".product.ReleaseReservationRequest\x1a#.product.ReleaseReservationResponseB(Z&microservices-project/protos/productpbb\x06proto3"
 
 var (
 	file_protos_product_proto_rawDescOnce sync.Once
@@ -806,48 +1472,81 @@ func file_protos_product_proto_rawDescGZIP() []byte {
 	return file_protos_product_proto_rawDescData
 }
 
-var file_protos_product_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_protos_product_proto_msgTypes = make([]protoimpl.MessageInfo, 25)
 var file_protos_product_proto_goTypes = []any{
-	(*Product)(nil),               // 0: product.Product
-	(*CreateProductRequest)(nil),  // 1: product.CreateProductRequest
-	(*CreateProductResponse)(nil), // 2: product.CreateProductResponse
-	(*GetProductRequest)(nil),     // 3: product.GetProductRequest
-	(*GetProductResponse)(nil),    // 4: product.GetProductResponse
-	(*ListProductsRequest)(nil),   // 5: product.ListProductsRequest
-	(*ListProductsResponse)(nil),  // 6: product.ListProductsResponse
-	(*UpdateProductRequest)(nil),  // 7: product.UpdateProductRequest
-	(*UpdateProductResponse)(nil), // 8: product.UpdateProductResponse
-	(*DeleteProductRequest)(nil),  // 9: product.DeleteProductRequest
-	(*DeleteProductResponse)(nil), // 10: product.DeleteProductResponse
-	(*UpdateStockRequest)(nil),    // 11: product.UpdateStockRequest
-	(*UpdateStockResponse)(nil),   // 12: product.UpdateStockResponse
-	(*timestamppb.Timestamp)(nil), // 13: google.protobuf.Timestamp
+	(*Product)(nil),                    // 0: product.Product
+	(*CreateProductRequest)(nil),       // 1: product.CreateProductRequest
+	(*CreateProductResponse)(nil),      // 2: product.CreateProductResponse
+	(*GetProductRequest)(nil),          // 3: product.GetProductRequest
+	(*GetProductResponse)(nil),         // 4: product.GetProductResponse
+	(*BatchGetProductsRequest)(nil),    // 5: product.BatchGetProductsRequest
+	(*BatchGetProductsResponse)(nil),   // 6: product.BatchGetProductsResponse
+	(*ListProductsRequest)(nil),        // 7: product.ListProductsRequest
+	(*ListProductsResponse)(nil),       // 8: product.ListProductsResponse
+	(*UpdateProductRequest)(nil),       // 9: product.UpdateProductRequest
+	(*UpdateProductResponse)(nil),      // 10: product.UpdateProductResponse
+	(*DeleteProductRequest)(nil),       // 11: product.DeleteProductRequest
+	(*DeleteProductResponse)(nil),      // 12: product.DeleteProductResponse
+	(*UpdateStockRequest)(nil),         // 13: product.UpdateStockRequest
+	(*UpdateStockResponse)(nil),        // 14: product.UpdateStockResponse
+	(*BatchUpdateStockRequest)(nil),    // 15: product.BatchUpdateStockRequest
+	(*BatchUpdateStockResponse)(nil),   // 16: product.BatchUpdateStockResponse
+	(*ReservationItem)(nil),            // 17: product.ReservationItem
+	(*Reservation)(nil),                // 18: product.Reservation
+	(*ReserveStockRequest)(nil),        // 19: product.ReserveStockRequest
+	(*ReserveStockResponse)(nil),       // 20: product.ReserveStockResponse
+	(*CommitReservationRequest)(nil),   // 21: product.CommitReservationRequest
+	(*CommitReservationResponse)(nil),  // 22: product.CommitReservationResponse
+	(*ReleaseReservationRequest)(nil),  // 23: product.ReleaseReservationRequest
+	(*ReleaseReservationResponse)(nil), // 24: product.ReleaseReservationResponse
+	(*timestamppb.Timestamp)(nil),      // 25: google.protobuf.Timestamp
 }
 var file_protos_product_proto_depIdxs = []int32{
-	13, // 0: product.Product.created_at:type_name -> google.protobuf.Timestamp
-	13, // 1: product.Product.updated_at:type_name -> google.protobuf.Timestamp
+	25, // 0: product.Product.created_at:type_name -> google.protobuf.Timestamp
+	25, // 1: product.Product.updated_at:type_name -> google.protobuf.Timestamp
 	0,  // 2: product.CreateProductResponse.product:type_name -> product.Product
 	0,  // 3: product.GetProductResponse.product:type_name -> product.Product
-	0,  // 4: product.ListProductsResponse.products:type_name -> product.Product
-	0,  // 5: product.UpdateProductResponse.product:type_name -> product.Product
-	0,  // 6: product.UpdateStockResponse.product:type_name -> product.Product
-	1,  // 7: product.ProductService.CreateProduct:input_type -> product.CreateProductRequest
-	3,  // 8: product.ProductService.GetProduct:input_type -> product.GetProductRequest
-	5,  // 9: product.ProductService.ListProducts:input_type -> product.ListProductsRequest
-	7,  // 10: product.ProductService.UpdateProduct:input_type -> product.UpdateProductRequest
-	9,  // 11: product.ProductService.DeleteProduct:input_type -> product.DeleteProductRequest
-	11, // 12: product.ProductService.UpdateStock:input_type -> product.UpdateStockRequest
-	2,  // 13: product.ProductService.CreateProduct:output_type -> product.CreateProductResponse
-	4,  // 14: product.ProductService.GetProduct:output_type -> product.GetProductResponse
-	6,  // 15: product.ProductService.ListProducts:output_type -> product.ListProductsResponse
-	8,  // 16: product.ProductService.UpdateProduct:output_type -> product.UpdateProductResponse
-	10, // 17: product.ProductService.DeleteProduct:output_type -> product.DeleteProductResponse
-	12, // 18: product.ProductService.UpdateStock:output_type -> product.UpdateStockResponse
-	13, // [13:19] is the sub-list for method output_type
-	7,  // [7:13] is the sub-list for method input_type
-	7,  // [7:7] is the sub-list for extension type_name
-	7,  // [7:7] is the sub-list for extension extendee
-	0,  // [0:7] is the sub-list for field type_name
+	0,  // 4: product.BatchGetProductsResponse.products:type_name -> product.Product
+	0,  // 5: product.ListProductsResponse.products:type_name -> product.Product
+	0,  // 6: product.UpdateProductResponse.product:type_name -> product.Product
+	0,  // 7: product.UpdateStockResponse.product:type_name -> product.Product
+	13, // 8: product.BatchUpdateStockRequest.updates:type_name -> product.UpdateStockRequest
+	14, // 9: product.BatchUpdateStockResponse.results:type_name -> product.UpdateStockResponse
+	17, // 10: product.Reservation.items:type_name -> product.ReservationItem
+	25, // 11: product.Reservation.expires_at:type_name -> google.protobuf.Timestamp
+	25, // 12: product.Reservation.created_at:type_name -> google.protobuf.Timestamp
+	25, // 13: product.Reservation.updated_at:type_name -> google.protobuf.Timestamp
+	17, // 14: product.ReserveStockRequest.items:type_name -> product.ReservationItem
+	18, // 15: product.ReserveStockResponse.reservation:type_name -> product.Reservation
+	18, // 16: product.CommitReservationResponse.reservation:type_name -> product.Reservation
+	18, // 17: product.ReleaseReservationResponse.reservation:type_name -> product.Reservation
+	1,  // 18: product.ProductService.CreateProduct:input_type -> product.CreateProductRequest
+	3,  // 19: product.ProductService.GetProduct:input_type -> product.GetProductRequest
+	5,  // 20: product.ProductService.BatchGetProducts:input_type -> product.BatchGetProductsRequest
+	7,  // 21: product.ProductService.ListProducts:input_type -> product.ListProductsRequest
+	9,  // 22: product.ProductService.UpdateProduct:input_type -> product.UpdateProductRequest
+	11, // 23: product.ProductService.DeleteProduct:input_type -> product.DeleteProductRequest
+	13, // 24: product.ProductService.UpdateStock:input_type -> product.UpdateStockRequest
+	15, // 25: product.ProductService.BatchUpdateStock:input_type -> product.BatchUpdateStockRequest
+	19, // 26: product.ProductService.ReserveStock:input_type -> product.ReserveStockRequest
+	21, // 27: product.ProductService.CommitReservation:input_type -> product.CommitReservationRequest
+	23, // 28: product.ProductService.ReleaseReservation:input_type -> product.ReleaseReservationRequest
+	2,  // 29: product.ProductService.CreateProduct:output_type -> product.CreateProductResponse
+	4,  // 30: product.ProductService.GetProduct:output_type -> product.GetProductResponse
+	6,  // 31: product.ProductService.BatchGetProducts:output_type -> product.BatchGetProductsResponse
+	8,  // 32: product.ProductService.ListProducts:output_type -> product.ListProductsResponse
+	10, // 33: product.ProductService.UpdateProduct:output_type -> product.UpdateProductResponse
+	12, // 34: product.ProductService.DeleteProduct:output_type -> product.DeleteProductResponse
+	14, // 35: product.ProductService.UpdateStock:output_type -> product.UpdateStockResponse
+	16, // 36: product.ProductService.BatchUpdateStock:output_type -> product.BatchUpdateStockResponse
+	20, // 37: product.ProductService.ReserveStock:output_type -> product.ReserveStockResponse
+	22, // 38: product.ProductService.CommitReservation:output_type -> product.CommitReservationResponse
+	24, // 39: product.ProductService.ReleaseReservation:output_type -> product.ReleaseReservationResponse
+	29, // [29:40] is the sub-list for method output_type
+	18, // [18:29] is the sub-list for method input_type
+	18, // [18:18] is the sub-list for extension type_name
+	18, // [18:18] is the sub-list for extension extendee
+	0,  // [0:18] is the sub-list for field type_name
 }
 
 func init() { file_protos_product_proto_init() }
@@ -861,7 +1560,7 @@ func file_protos_product_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protos_product_proto_rawDesc), len(file_protos_product_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   13,
+			NumMessages:   25,
 			NumExtensions: 0,
 			NumServices:   1,
 		},